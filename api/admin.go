@@ -0,0 +1,131 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Запрос на создание ключа API
+// swagger:model
+type ApiKeyRequest struct {
+	// название интеграции, уникальное среди неотозванных ключей
+	Name      string     `json:"name"`
+	// области доступа: catalog:read, catalog:write, catalog:delete, admin
+	Scopes    []string   `json:"scopes"`
+	// время окончания действия, если не задано - бессрочный
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Созданный ключ API. Сам ключ показывается только в этом ответе
+// swagger:model
+type ApiKeyCreated struct {
+	*model.ApiKey
+	// ключ, который передается в заголовке X-API-Key
+	Key string `json:"key"`
+}
+
+// swagger:operation GET /admin/db/stats getDbStats
+// ---
+// description: Получить статистику пула соединений с БД
+// responses:
+//  '200':
+//    schema:
+//      $ref: '#/definitions/DbStats'
+//
+func (api *Api) getDbStats(c echo.Context) error {
+	return c.JSON(http.StatusOK, api.as.GetDbStats())
+}
+
+// swagger:operation GET /admin/keys getApiKeys
+// ---
+// description: Получить ключи API, включая отозванные. Сами ключи не возвращаются
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/ApiKey'
+//
+func (api *Api) getApiKeys(c echo.Context) error {
+	keys, err := api.as.GetApiKeys(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	if keys == nil {
+		keys = []*model.ApiKey{}
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// swagger:operation POST /admin/keys createApiKey
+// ---
+// description: Создать ключ API. Ключ возвращается один раз, в БД хранится только его хэш
+// parameters:
+// - name: key
+//   in: body
+//   description: название, области доступа и срок действия ключа
+//   required: true
+//   schema:
+//     $ref: '#/definitions/ApiKeyRequest'
+// responses:
+//  '201':
+//    schema:
+//      $ref: '#/definitions/ApiKeyCreated'
+//  '400':
+//     description: Bad request param
+//  '409':
+//     description: неотозванный ключ с таким названием уже есть
+//
+func (api *Api) createApiKey(c echo.Context) error {
+	req := &ApiKeyRequest{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	key := &model.ApiKey{Name: req.Name, Scopes: req.Scopes, ExpiresAt: req.ExpiresAt}
+	if err := api.validate.Struct(key); err != nil {
+		return err
+	}
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `expires_at`: must be in the future")
+	}
+	secret, err := api.as.CreateApiKey(c.Request().Context(), key)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, &ApiKeyCreated{ApiKey: key, Key: secret})
+}
+
+// swagger:operation DELETE /admin/keys/{id} revokeApiKey
+// ---
+// description: Отозвать ключ API. Отозванный ключ остается в списке с временем отзыва
+// parameters:
+// - name: id
+//   in: path
+//   description: id ключа
+//   required: true
+//   type: int
+// responses:
+//  '204':
+//     description: Ключ отозван
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: API key `id`= not found
+//
+func (api *Api) revokeApiKey(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	if err = api.as.RevokeApiKey(c.Request().Context(), id); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "API key `id` = "+strconv.Itoa(id)+" not found or already revoked")
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
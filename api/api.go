@@ -8,6 +8,7 @@
 // - application/json
 // Produces:
 // - application/json
+// - application/problem+json
 // Contact: uchonyy@gmail.com
 // swagger:meta
 package api
@@ -17,22 +18,32 @@ import (
 	"echo-rest-api/config"
 	"echo-rest-api/model"
 	"echo-rest-api/service"
-	"fmt"
+	"echo-rest-api/store"
 	"github.com/labstack/echo"
 	"github.com/labstack/echo/middleware"
 	"github.com/labstack/gommon/log"
 	"gopkg.in/go-playground/validator.v9"
 	"net/http"
 	"strconv"
+	"strings"
 )
 
 type Api struct {
-	Http     *echo.Echo
-	conf     *config.Config
-	cs       service.CategoryService
-	ps       service.ProductService
-	apiInfo  ApiInfo
-	validate *validator.Validate
+	Http      *echo.Echo
+	conf      *config.Config
+	cs        service.CategoryService
+	ps        service.ProductService
+	as        service.AdminService
+	apiInfo   ApiInfo
+	validate  *validator.Validate
+	cursorKey []byte
+	images    *store.ImageFiles
+	auth      *jwtAuth
+	authErr   error
+	rbac      *rbac
+	rbacErr   error
+	// права, которые требуют маршруты /api, по "метод путь"
+	permissions map[string]string
 }
 
 type ApiInfo struct {
@@ -41,42 +52,103 @@ type ApiInfo struct {
 	Routs   []string
 }
 
-func NewApi(conf *config.Config, cs service.CategoryService, ps service.ProductService) *Api {
+func NewApi(conf *config.Config, cs service.CategoryService, ps service.ProductService, as service.AdminService) *Api {
 	api := &Api{}
 	api.validate = validator.New()
+	api.validate.RegisterTagNameFunc(jsonFieldName)
 	api.conf = conf
 	api.cs = cs
 	api.ps = ps
+	api.as = as
+	api.cursorKey = cursorKey(conf.Api.CursorSecret)
+	api.permissions = map[string]string{}
+	api.images = store.NewImageFiles(conf)
 	api.Http = echo.New()
 	api.Http.Logger.SetLevel(log.Lvl(conf.LogLevel))
 	api.apiInfo.Address = ":" + strconv.Itoa(api.conf.Api.HttpPort)
 	api.Http.HideBanner = true
+	api.Http.HTTPErrorHandler = api.httpErrorHandler
 	api.Http.Pre(middleware.RemoveTrailingSlash())
 	if conf.Api.Logging {
 		api.Http.Use(middleware.Logger())
 		api.apiInfo.MW = append(api.apiInfo.MW, "Logger")
 	}
+	api.Http.Use(middleware.RequestID())
+	api.apiInfo.MW = append(api.apiInfo.MW, "RequestID")
+	api.Http.Use(api.requestContext)
+	api.apiInfo.MW = append(api.apiInfo.MW, "RequestContext")
+	if conf.Auth.Enabled {
+		api.auth, api.authErr = newJwtAuth(conf)
+		api.apiInfo.MW = append(api.apiInfo.MW, "JWTAuth")
+	} else if conf.Auth.ApiKeys {
+		api.apiInfo.MW = append(api.apiInfo.MW, "ApiKeyAuth")
+	}
+	if api.authRequired() {
+		api.Http.Use(api.authenticate)
+	}
+	if conf.Rbac.Enabled {
+		api.rbac, api.rbacErr = newRbac(conf)
+		api.apiInfo.MW = append(api.apiInfo.MW, "RBAC")
+	}
 	api.Http.GET("/", api.index)
 	api.Http.Static("/spec", "spec")
-	api.Http.GET("/api/categories", api.getCategories)
-	api.Http.GET("/api/categories/:id", api.getCategory)
-	api.Http.POST("/api/categories", api.createCategory)
-	api.Http.PUT("/api/categories/:id", api.updateCategory)
-	api.Http.DELETE("/api/categories/:id", api.deleteCategory)
+	api.Http.Group(imagesPath, api.productImages, cacheControl(conf.Images.CacheMaxAge)).Static("", conf.Images.Dir)
+	api.route(echo.GET, "/api/categories", api.getCategories, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/categories/tree", api.getCategoryTree, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/categories/:id", api.getCategory, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/categories/:id/ancestors", api.getCategoryAncestors, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/categories", api.createCategory, model.ScopeCatalogWrite)
+	api.route(echo.PUT, "/api/categories/:id", api.updateCategory, model.ScopeCatalogWrite)
+	api.route(echo.PATCH, "/api/categories/:id", api.patchCategory, model.ScopeCatalogWrite)
+	api.route(echo.DELETE, "/api/categories/:id", api.deleteCategory, model.ScopeCatalogDelete)
+	api.route(echo.POST, "/api/categories/:id/restore", api.restoreCategory, model.ScopeCatalogWrite)
+
+	api.route(echo.GET, "/api/products", api.getProducts, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/products/:id", api.getProduct, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/products", api.createProduct, model.ScopeCatalogWrite)
+	api.route(echo.PUT, "/api/products/:id", api.updateProduct, model.ScopeCatalogWrite)
+	api.route(echo.PATCH, "/api/products/:id", api.patchProduct, model.ScopeCatalogWrite)
+	api.route(echo.DELETE, "/api/products/:id", api.deleteProduct, model.ScopeCatalogWrite)
+	api.route(echo.POST, "/api/products/:id/restore", api.restoreProduct, model.ScopeCatalogWrite)
+	api.route(echo.GET, "/api/products/:id/variants", api.getVariants, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/products/:id/variants/:variant", api.getVariant, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/products/:id/variants", api.createVariant, model.ScopeCatalogWrite)
+	api.route(echo.PUT, "/api/products/:id/variants/:variant", api.updateVariant, model.ScopeCatalogWrite)
+	api.route(echo.DELETE, "/api/products/:id/variants/:variant", api.deleteVariant, model.ScopeCatalogWrite)
+	api.route(echo.GET, "/api/products/:id/prices", api.getPriceHistory, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/products/:id/images", api.getImages, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/products/:id/images", api.createImage, model.ScopeCatalogWrite, api.uploadLimit())
+	api.route(echo.PUT, "/api/products/:id/images/order", api.reorderImages, model.ScopeCatalogWrite)
+	api.route(echo.DELETE, "/api/products/:id/images/:image", api.deleteImage, model.ScopeCatalogWrite)
+	api.route(echo.GET, "/api/products/:id/stock", api.getStock, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/products/:id/stock/adjustments", api.getStockAdjustments, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/products/:id/stock/adjustments", api.adjustStock, model.ScopeCatalogWrite)
+	api.route(echo.POST, "/api/products/:id/stock/reservations", api.createReservation, model.ScopeCatalogWrite)
+	api.route(echo.GET, "/api/products/:id/stock/reservations/:reservation", api.getReservation, model.ScopeCatalogRead)
+	api.route(echo.POST, "/api/products/:id/stock/reservations/:reservation/commit", api.commitReservation, model.ScopeCatalogWrite)
+	api.route(echo.POST, "/api/products/:id/stock/reservations/:reservation/release", api.releaseReservation, model.ScopeCatalogWrite)
 
-	api.Http.GET("/api/products", api.getProducts)
-	api.Http.GET("/api/products/:id", api.getProduct)
-	api.Http.POST("/api/products", api.createProduct)
-	api.Http.PUT("/api/products/:id", api.updateProduct)
-	api.Http.DELETE("/api/products/:id", api.deleteProduct)
+	api.route(echo.GET, "/api/tags", api.getTags, model.ScopeCatalogRead)
+	api.route(echo.GET, "/api/search", api.searchProducts, model.ScopeCatalogRead)
+
+	api.route(echo.GET, "/api/admin/db/stats", api.getDbStats, model.ScopeAdmin)
+	api.route(echo.GET, "/api/admin/keys", api.getApiKeys, model.ScopeAdmin)
+	api.route(echo.POST, "/api/admin/keys", api.createApiKey, model.ScopeAdmin)
+	api.route(echo.DELETE, "/api/admin/keys/:id", api.revokeApiKey, model.ScopeAdmin)
 	for _, r := range api.Http.Routes() {
-		api.apiInfo.Routs = append(api.apiInfo.Routs, fmt.Sprintf("%s %s", r.Path, r.Method))
+		api.apiInfo.Routs = append(api.apiInfo.Routs, api.routeInfo(r))
 	}
 	return api
 }
 
-// Запустить api
+// Запустить api. Если настройки аутентификации или rbac некорректны, возвращает ошибку без запуска
 func (api *Api) Start() error {
+	if api.authErr != nil {
+		return api.authErr
+	}
+	if api.rbacErr != nil {
+		return api.rbacErr
+	}
 	return api.Http.Start(":" + strconv.Itoa(api.conf.Api.HttpPort))
 }
 
@@ -102,12 +174,23 @@ func (api *Api) spec(c echo.Context) error {
 //   description: id необходимой категории
 //   required: true
 //   type: int
+// - name: include_deleted
+//   in: query
+//   description: вернуть категорию, даже если она удалена. Требует право admin
+//   required: false
+//   type: boolean
 // responses:
 //  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
 //    schema:
 //      $ref: '#/definitions/Category'
 //  '400':
 //     description: Bad request param `id`
+//  '403':
+//     description: include_deleted without permission admin
 //  '404':
 //     description: Category `id`= not found
 //
@@ -116,37 +199,135 @@ func (api *Api) getCategory(c echo.Context) error {
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
 	}
-	cat, err := api.cs.GetCategory(id)
+	includeDeleted, err := api.includeDeletedParam(c)
 	if err != nil {
 		return err
 	}
-	if cat == nil {
-		return echo.NewHTTPError(http.StatusNotFound, "Category `id` = ", id, " not found")
+	cat, err := api.cs.GetCategory(c.Request().Context(), id)
+	if err != nil {
+		return err
 	}
+	if cat == nil || (cat.DeletedAt != nil && !includeDeleted) {
+		return echo.NewHTTPError(http.StatusNotFound, "Category `id` = "+strconv.Itoa(id)+" not found")
+	}
+	c.Response().Header().Set(HeaderETag, etag(cat.Version))
 	return c.JSON(http.StatusOK, cat)
 }
 
 // swagger:operation GET /categories getCategories
 // ---
 // description: Получить список категорий
+// parameters:
+// - name: limit
+//   in: query
+//   description: размер страницы
+//   required: false
+//   type: int
+// - name: offset
+//   in: query
+//   description: количество пропускаемых категорий
+//   required: false
+//   type: int
+// - name: sort
+//   in: query
+//   description: поля сортировки через запятую, минус перед полем - по убыванию. Поля - id, name
+//   required: false
+//   type: string
+// - name: include_deleted
+//   in: query
+//   description: включить в список удаленные категории. Требует право admin
+//   required: false
+//   type: boolean
 // responses:
 //  '200':
+//    headers:
+//      X-Total-Count:
+//        description: общее количество категорий
+//        type: int
+//      Link:
+//        description: ссылки на первую, предыдущую, следующую и последнюю страницы
+//        type: string
 //    schema:
 //      type: array
 //      items:
 //        $ref: '#/definitions/Category'
+//  '400':
+//     description: Bad request param
+//  '403':
+//     description: include_deleted without permission admin
 //
 func (api *Api) getCategories(c echo.Context) error {
-	cats, err := api.cs.GetCategories()
+	params, err := api.listParams(c, model.CategorySortFields)
+	if err != nil {
+		return err
+	}
+	if params.IncludeDeleted, err = api.includeDeletedParam(c); err != nil {
+		return err
+	}
+	cats, total, err := api.cs.GetCategories(c.Request().Context(), params)
 	if err != nil {
 		return err
 	}
 	if cats == nil {
 		cats = []*model.Category{}
 	}
+	api.setListHeaders(c, params, total, nil)
 	return c.JSON(http.StatusOK, cats)
 }
 
+// swagger:operation GET /categories/tree getCategoryTree
+// ---
+// description: Получить дерево категорий, подкатегории упорядочены по названию
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/CategoryTree'
+//
+func (api *Api) getCategoryTree(c echo.Context) error {
+	tree, err := api.cs.GetCategoryTree(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tree)
+}
+
+// swagger:operation GET /categories/{id}/ancestors getCategoryAncestors
+// ---
+// description: Получить предков категории от корневой до родительской, например для хлебных крошек
+// parameters:
+// - name: id
+//   in: path
+//   description: id необходимой категории
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/Category'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Category `id`= not found
+//
+func (api *Api) getCategoryAncestors(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	ancestors, err := api.cs.GetCategoryAncestors(c.Request().Context(), id)
+	if err != nil {
+		return err
+	}
+	if ancestors == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Category `id` = "+strconv.Itoa(id)+" not found")
+	}
+	return c.JSON(http.StatusOK, ancestors)
+}
+
 // swagger:operation POST /categories createCategory
 // ---
 // description: Создать категорию
@@ -159,10 +340,16 @@ func (api *Api) getCategories(c echo.Context) error {
 //     $ref: '#/definitions/Category'
 // responses:
 //  '201':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
 //    schema:
 //      $ref: '#/definitions/Category'
 //  '400':
 //     description: Bad request param
+//  '409':
+//     description: Parent category is deleted
 //
 func (api *Api) createCategory(c echo.Context) error {
 	req := &model.Category{}
@@ -171,12 +358,16 @@ func (api *Api) createCategory(c echo.Context) error {
 		return err
 	}
 	if err := api.validate.Struct(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+		return err
+	}
+	if err := categoryAttributeSchema(req); err != nil {
+		return err
 	}
-	res, err := api.cs.CreateCategory(req)
+	res, err := api.cs.CreateCategory(c.Request().Context(), req)
 	if err != nil {
 		return err
 	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
 	return c.JSON(http.StatusCreated, map[string]*int{"id": res})
 }
 
@@ -195,11 +386,26 @@ func (api *Api) createCategory(c echo.Context) error {
 //   required: true
 //   schema:
 //     $ref: '#/definitions/Category'
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
 // responses:
 //  '204':
 //     description: Категория обновлена
+//     headers:
+//       ETag:
+//         description: версия записи
+//         type: string
 //  '400':
 //     description: Bad request param
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
+//  '409':
+//     description: Parent category is deleted
 //
 func (api *Api) updateCategory(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -211,29 +417,47 @@ func (api *Api) updateCategory(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
 	}
 	if err := api.validate.Struct(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+		return err
+	}
+	if err := categoryAttributeSchema(req); err != nil {
+		return err
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
 	}
 	req.Id = id
-	if err = api.cs.UpdateCategory(req); err != nil {
-		if err != sql.ErrNoRows {
+	req.Version = version
+	if err = api.cs.UpdateCategory(c.Request().Context(), req); err != nil {
+		if err == store.ErrConflict {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Category `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		} else if err == store.ErrCycle {
+			return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `parent_id`: category can not be a child of itself").SetInternal(err)
+		} else if err != sql.ErrNoRows {
 			return err
 		} else {
-			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = ", id, " not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = "+strconv.Itoa(id)+" not found")
 		}
 
 	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
 	return c.NoContent(http.StatusNoContent)
 }
 
 // swagger:operation DELETE /categories/{id} deleteCategory
 // ---
-// description: Удалить категорию
+// description: Удалить категорию вместе с подкатегориями и их продуктами. Удаленные записи можно восстановить до их очистки командой purge
 // parameters:
 // - name: id
 //   in: path
 //   description: id необходимой категории
 //   required: true
 //   type: int
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
 // responses:
 //  '204':
 //     description: Категория удалена
@@ -241,23 +465,74 @@ func (api *Api) updateCategory(c echo.Context) error {
 //     description: Bad request param `id`
 //  '404':
 //     description: Category `id`= not found
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
 //
 func (api *Api) deleteCategory(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
 	}
-	if err = api.cs.DeleteCategory(id); err != nil {
-		if err != sql.ErrNoRows {
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if err = api.cs.DeleteCategory(c.Request().Context(), id, version); err != nil {
+		if err == store.ErrConflict {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Category `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		} else if err != sql.ErrNoRows {
 			return err
 		} else {
-			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = ", id, " not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = "+strconv.Itoa(id)+" not found")
 		}
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
 
+// swagger:operation POST /categories/{id}/restore restoreCategory
+// ---
+// description: Восстановить удаленную категорию вместе с продуктами, удаленными вместе с ней
+// parameters:
+// - name: id
+//   in: path
+//   description: id удаленной категории
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//    schema:
+//      $ref: '#/definitions/Category'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Category `id`= not found or not deleted
+//  '409':
+//     description: Parent category is deleted
+//
+func (api *Api) restoreCategory(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	res, err := api.cs.RestoreCategory(c.Request().Context(), id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		} else {
+			return echo.NewHTTPError(http.StatusNotFound, "Deleted category `id` = "+strconv.Itoa(id)+" not found")
+		}
+	}
+	c.Response().Header().Set(HeaderETag, etag(res.Version))
+	return c.JSON(http.StatusOK, res)
+}
+
 // swagger:operation GET /products/{id} getProduct
 // ---
 // description: Получить продукт
@@ -267,27 +542,84 @@ func (api *Api) deleteCategory(c echo.Context) error {
 //   description: id необходимого продукта
 //   required: true
 //   type: int
+// - name: include_deleted
+//   in: query
+//   description: вернуть продукт, даже если он удален. Требует право admin
+//   required: false
+//   type: boolean
+// - name: embed
+//   in: query
+//   description: variants - включить в ответ варианты продукта
+//   required: false
+//   type: string
+// - name: currency
+//   in: query
+//   description: код валюты, в которой вернуть цену продукта
+//   required: false
+//   type: string
+// - name: at
+//   in: query
+//   description: момент времени в RFC 3339, цены продукта на который вернуть
+//   required: false
+//   type: string
 // responses:
 //  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
 //    schema:
 //      $ref: '#/definitions/Product'
 //  '400':
 //     description: Bad request param `id`
+//  '403':
+//     description: include_deleted without permission admin
 //  '404':
-//     description: Product `id`= not found
+//     description: Product `id`= not found, у продукта нет цены в валюте currency или не было цен в момент at
 //
 func (api *Api) getProduct(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = ", id, " not found")
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	includeDeleted, err := api.includeDeletedParam(c)
+	if err != nil {
+		return err
+	}
+	embed, err := embedVariants(c)
+	if err != nil {
+		return err
+	}
+	currency, err := currencyParam(c)
+	if err != nil {
+		return err
+	}
+	at, err := timeParam(c, "at")
+	if err != nil {
+		return err
+	}
+	var prod *model.Product
+	if at != nil {
+		prod, err = api.ps.GetProductAt(c.Request().Context(), id, *at)
+	} else {
+		prod, err = api.ps.GetProduct(c.Request().Context(), id)
 	}
-	prod, err := api.ps.GetProduct(id)
 	if err != nil {
 		return err
 	}
-	if prod == nil {
-		return c.String(http.StatusNotFound, "")
+	if prod == nil || (prod.DeletedAt != nil && !includeDeleted) {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(id)+" not found")
+	}
+	if currency != "" && !prod.InCurrency(currency) {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(id)+" has no price in "+currency)
 	}
+	if embed && prod.DeletedAt == nil {
+		if prod.Variants, err = api.ps.GetVariants(c.Request().Context(), id); err != nil {
+			return err
+		}
+	}
+	api.setImageUrls(prod)
+	c.Response().Header().Set(HeaderETag, etag(prod.Version))
 	return c.JSON(http.StatusOK, prod)
 }
 
@@ -296,35 +628,205 @@ func (api *Api) getProduct(c echo.Context) error {
 // description: Получить список продуктов
 // parameters:
 // - name: category
-//   in: path
-//   description: id категории по которой выбрать продукты
+//   in: query
+//   description: id категорий через запятую, по которым выбрать продукты
+//   required: false
+//   type: string
+// - name: recursive
+//   in: query
+//   description: выбрать также продукты всех подкатегорий из category
+//   required: false
+//   type: boolean
+// - name: currency
+//   in: query
+//   description: код валюты: выбрать продукты с ценой в этой валюте, цены, min_price, max_price и сортировка - в ней
+//   required: false
+//   type: string
+// - name: tag
+//   in: query
+//   description: теги через запятую или повтором параметра
+//   required: false
+//   type: string
+// - name: tag_mode
+//   in: query
+//   description: any - продукты хотя бы с одним из тегов tag (по умолчанию), all - со всеми
+//   required: false
+//   type: string
+// - name: attr.{name}
+//   in: query
+//   description: значение атрибута продукта name, например attr.voltage=220
+//   required: false
+//   type: string
+// - name: ids
+//   in: query
+//   description: id продуктов через запятую
+//   required: false
+//   type: string
+// - name: min_price
+//   in: query
+//   description: минимальная цена
+//   required: false
+//   type: number
+// - name: max_price
+//   in: query
+//   description: максимальная цена
+//   required: false
+//   type: number
+// - name: name
+//   in: query
+//   description: подстрока названия
+//   required: false
+//   type: string
+// - name: desc
+//   in: query
+//   description: подстрока описания
+//   required: false
+//   type: string
+// - name: limit
+//   in: query
+//   description: размер страницы
 //   required: false
 //   type: int
+// - name: offset
+//   in: query
+//   description: количество пропускаемых продуктов
+//   required: false
+//   type: int
+// - name: sort
+//   in: query
+//   description: поля сортировки через запятую, минус перед полем - по убыванию. Поля - id, name, category, price
+//   required: false
+//   type: string
+// - name: cursor
+//   in: query
+//   description: курсор из заголовка X-Next-Cursor предыдущей страницы, используется вместо offset
+//   required: false
+//   type: string
+// - name: include_deleted
+//   in: query
+//   description: включить в список удаленные продукты. Требует право admin
+//   required: false
+//   type: boolean
 // responses:
 //  '200':
+//    headers:
+//      X-Total-Count:
+//        description: общее количество продуктов
+//        type: int
+//      X-Next-Cursor:
+//        description: курсор следующей страницы
+//        type: string
+//      Link:
+//        description: ссылки на первую, предыдущую, следующую и последнюю страницы
+//        type: string
 //    schema:
 //      type: array
 //      items:
 //        $ref: '#/definitions/Product'
+//  '400':
+//     description: Bad request param
+//  '403':
+//     description: include_deleted without permission admin
 //
 func (api *Api) getProducts(c echo.Context) error {
-	var products []*model.Product
-	var err error
-	category, err := strconv.Atoi(c.QueryParam("category"))
+	params, err := api.listParams(c, model.ProductSortFields)
 	if err != nil {
-		products, err = api.ps.GetProducts(nil)
-	} else {
-		products, err = api.ps.GetProducts(&category)
+		return err
+	}
+	if err = api.cursorParam(c, params); err != nil {
+		return err
 	}
+	if params.IncludeDeleted, err = api.includeDeletedParam(c); err != nil {
+		return err
+	}
+	filter, err := productFilter(c)
+	if err != nil {
+		return err
+	}
+	products, total, err := api.ps.GetProducts(c.Request().Context(), filter, params)
 	if err != nil {
 		return err
 	}
 	if products == nil {
 		products = []*model.Product{}
 	}
+	var next *model.Cursor
+	if len(products) > 0 {
+		last := products[len(products)-1]
+		next = nextCursor(params, len(products), last.Id, last.SortValue)
+	}
+	api.setImageUrls(products...)
+	api.setListHeaders(c, params, total, next)
 	return c.JSON(http.StatusOK, products)
 }
 
+// swagger:operation GET /search searchProducts
+// ---
+// description: Найти продукты по словам из названия и описания, в порядке убывания релевантности
+// parameters:
+// - name: q
+//   in: query
+//   description: поисковый запрос
+//   required: true
+//   type: string
+// - name: category
+//   in: query
+//   description: id категорий через запятую, в которых искать продукты
+//   required: false
+//   type: string
+// - name: limit
+//   in: query
+//   description: размер страницы
+//   required: false
+//   type: int
+// - name: offset
+//   in: query
+//   description: количество пропускаемых продуктов
+//   required: false
+//   type: int
+// responses:
+//  '200':
+//    headers:
+//      X-Total-Count:
+//        description: общее количество найденных продуктов
+//        type: int
+//      Link:
+//        description: ссылки на первую, предыдущую, следующую и последнюю страницы
+//        type: string
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/ProductSearchResult'
+//  '400':
+//     description: Bad request param
+//
+func (api *Api) searchProducts(c echo.Context) error {
+	search := &model.ProductSearch{Query: strings.TrimSpace(c.QueryParam("q"))}
+	if search.Query == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `q`")
+	}
+	var err error
+	if search.Categories, err = intListParam(c, "category"); err != nil {
+		return err
+	}
+	params, err := api.listParams(c, nil)
+	if err != nil {
+		return err
+	}
+	results, total, err := api.ps.SearchProducts(c.Request().Context(), search, params)
+	if err != nil {
+		return err
+	}
+	if results == nil {
+		results = []*model.ProductSearchResult{}
+	}
+	for _, r := range results {
+		api.setImageUrls(&r.Product)
+	}
+	api.setListHeaders(c, params, total, nil)
+	return c.JSON(http.StatusOK, results)
+}
+
 // swagger:operation POST /products createProduct
 // ---
 // description: Создать продукт
@@ -337,10 +839,18 @@ func (api *Api) getProducts(c echo.Context) error {
 //     $ref: '#/definitions/Product'
 // responses:
 //  '201':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
 //    schema:
 //      $ref: '#/definitions/Product'
 //  '400':
-//     description: Bad request param
+//     description: Bad request param, для атрибутов, не подходящих под схему категории - ошибки по атрибутам
+//     schema:
+//       $ref: '#/definitions/Problem'
+//  '409':
+//     description: Product category is deleted
 //
 func (api *Api) createProduct(c echo.Context) error {
 	req := &model.Product{}
@@ -348,12 +858,20 @@ func (api *Api) createProduct(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
 	}
 	if err := api.validate.Struct(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+		return err
+	}
+	if err := api.productCurrency(req); err != nil {
+		return err
 	}
-	res, err := api.ps.CreateProduct(req)
+	req.NormalizeTags()
+	if err := productAttributes(api.categoryLookup(c.Request().Context()), req); err != nil {
+		return err
+	}
+	res, err := api.ps.CreateProduct(c.Request().Context(), req)
 	if err != nil {
 		return err
 	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
 	return c.JSON(http.StatusCreated, map[string]*int{"id": res})
 }
 
@@ -372,11 +890,28 @@ func (api *Api) createProduct(c echo.Context) error {
 //   required: true
 //   schema:
 //     $ref: '#/definitions/Product'
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
 // responses:
 //  '204':
-//     description: Продукт обновлена
+//     description: Продукт обновлен
+//     headers:
+//       ETag:
+//         description: версия записи
+//         type: string
 //  '400':
-//     description: Bad request param
+//     description: Bad request param, для атрибутов, не подходящих под схему категории - ошибки по атрибутам
+//     schema:
+//       $ref: '#/definitions/Problem'
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
+//  '409':
+//     description: Product category is deleted
 //
 func (api *Api) updateProduct(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -388,28 +923,49 @@ func (api *Api) updateProduct(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
 	}
 	if err := api.validate.Struct(req); err != nil {
-		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+		return err
+	}
+	if err := api.productCurrency(req); err != nil {
+		return err
+	}
+	req.NormalizeTags()
+	if err := productAttributes(api.categoryLookup(c.Request().Context()), req); err != nil {
+		return err
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
 	}
 	req.Id = id
-	if err = api.ps.UpdateProduct(req); err != nil {
-		if err != sql.ErrNoRows {
+	req.Version = version
+	if err = api.ps.UpdateProduct(c.Request().Context(), req); err != nil {
+		if err == store.ErrConflict {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Product `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		} else if err != sql.ErrNoRows {
 			return err
 		} else {
-			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = ", id, " not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(id)+" not found")
 		}
 	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
 	return c.NoContent(http.StatusNoContent)
 }
 
 // swagger:operation DELETE /products/{id} deleteProduct
 // ---
-// description: Удалить продукт
+// description: Удалить продукт вместе с вариантами. Удаленный продукт можно восстановить до его очистки командой purge.
+//   Изображения удаленного продукта сразу перестают отдаваться, но их файлы удаляются только при очистке, чтобы восстановить их вместе с продуктом
 // parameters:
 // - name: id
 //   in: path
 //   description: id необходимого продукта
 //   required: true
 //   type: int
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
 // responses:
 //  '204':
 //     description: Категория удалена
@@ -417,19 +973,71 @@ func (api *Api) updateProduct(c echo.Context) error {
 //     description: Bad request param `id`
 //  '404':
 //     description: Product `id`= not found
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
 //
 func (api *Api) deleteProduct(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
 	}
-	if err = api.ps.DeleteProduct(id); err != nil {
-		if err != sql.ErrNoRows {
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if err = api.ps.DeleteProduct(c.Request().Context(), id, version); err != nil {
+		if err == store.ErrConflict {
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Product `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		} else if err != sql.ErrNoRows {
 			return err
 		} else {
-			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = ", id, " not found")
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(id)+" not found")
 		}
 	}
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// swagger:operation POST /products/{id}/restore restoreProduct
+// ---
+// description: Восстановить удаленный продукт
+// parameters:
+// - name: id
+//   in: path
+//   description: id удаленного продукта
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//    schema:
+//      $ref: '#/definitions/Product'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Product `id`= not found or not deleted
+//  '409':
+//     description: Product category is deleted
+//
+func (api *Api) restoreProduct(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	res, err := api.ps.RestoreProduct(c.Request().Context(), id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return err
+		} else {
+			return echo.NewHTTPError(http.StatusNotFound, "Deleted product `id` = "+strconv.Itoa(id)+" not found")
+		}
+	}
+	api.setImageUrls(res)
+	c.Response().Header().Set(HeaderETag, etag(res.Version))
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"context"
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Префикс query параметров фильтра по атрибутам: ?attr.voltage=220
+const attributeParamPrefix = "attr."
+
+// Имя атрибута в фильтре: буквы, цифры и подчеркивание
+var attributeNameRe = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// Получить фильтр по атрибутам из query параметров attr.<имя>
+func attributeParams(c echo.Context) (map[string]string, error) {
+	var res map[string]string
+	for name, values := range c.QueryParams() {
+		if !strings.HasPrefix(name, attributeParamPrefix) {
+			continue
+		}
+		attr := strings.TrimPrefix(name, attributeParamPrefix)
+		if !attributeNameRe.MatchString(attr) || len(values) != 1 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `"+name+"`")
+		}
+		if res == nil {
+			res = map[string]string{}
+		}
+		res[attr] = values[0]
+	}
+	return res, nil
+}
+
+// Проверить, что схема атрибутов категории - корректная JSON Schema
+func categoryAttributeSchema(category *model.Category) error {
+	if category.AttributeSchema == nil {
+		return nil
+	}
+	if err := model.CheckAttributeSchema(category.AttributeSchema); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `attribute_schema`: "+err.Error())
+	}
+	return nil
+}
+
+// Получение категорий через сервис категорий, вне транзакции
+func (api *Api) categoryLookup(ctx context.Context) model.CategoryLookup {
+	return func(id int) (*model.Category, error) {
+		return api.cs.GetCategory(ctx, id)
+	}
+}
+
+// Проверить атрибуты продукта по схеме атрибутов его категории, прочитанной через lookup.
+// Несуществующая категория здесь не проверяется, ее отклонит сторедж
+func productAttributes(lookup model.CategoryLookup, product *model.Product) error {
+	category, err := lookup(product.Category)
+	if err != nil {
+		return err
+	}
+	if category == nil {
+		return nil
+	}
+	errs, err := model.ValidateAttributes(category.AttributeSchema, product.Attributes)
+	if err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return attributesProblem(errs)
+	}
+	return nil
+}
@@ -0,0 +1,337 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Ошибка токена, причина которой не отдается клиенту
+var errInvalidToken = errors.New("invalid token")
+
+// Заголовок с ключом API для интеграций, альтернатива токену в Authorization
+const HeaderApiKey = "X-API-Key"
+
+// Проверка JWT токенов по настройкам auth из конфига
+type jwtAuth struct {
+	algorithm string
+	secret    []byte
+	// публичные ключи по kid, ключ из PEM файла - с пустым kid
+	keys      map[string]interface{}
+	issuer    string
+	audience  string
+	leeway    time.Duration
+}
+
+// Создать проверку токенов: прочитать секрет или файл публичных ключей для алгоритма auth.algorithm
+func newJwtAuth(conf *config.Config) (*jwtAuth, error) {
+	auth := &jwtAuth{
+		algorithm: conf.Auth.Algorithm,
+		issuer:    conf.Auth.Issuer,
+		audience:  conf.Auth.Audience,
+		leeway:    time.Duration(conf.Auth.Leeway) * time.Second,
+	}
+	switch auth.algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		if conf.Auth.Secret == "" {
+			return nil, errors.New("auth.secret is required for HS256")
+		}
+		auth.secret = []byte(conf.Auth.Secret)
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg():
+		var err error
+		if conf.Auth.JwksFile != "" {
+			auth.keys, err = readJwks(conf.Auth.JwksFile, auth.algorithm)
+		} else if conf.Auth.PublicKeyFile != "" {
+			auth.keys, err = readPublicKey(conf.Auth.PublicKeyFile, auth.algorithm)
+		} else {
+			err = errors.New("auth.publickeyfile or auth.jwksfile is required for " + auth.algorithm)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported auth.algorithm %q, expected HS256, RS256 or ES256", auth.algorithm)
+	}
+	return auth, nil
+}
+
+// Прочитать публичный ключ из PEM файла
+func readPublicKey(file string, algorithm string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var key interface{}
+	if algorithm == jwt.SigningMethodRS256.Alg() {
+		key, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	} else {
+		key, err = jwt.ParseECPublicKeyFromPEM(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return map[string]interface{}{"": key}, nil
+}
+
+// Ключ из JWKS файла (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N   string `json:"n"`
+	E   string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Прочитать публичные ключи из JWKS файла. Ключи других типов, алгоритмов и назначений пропускаются
+func readJwks(file string, algorithm string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	jwks := &struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err = json.Unmarshal(data, jwks); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	keys := map[string]interface{}{}
+	for _, k := range jwks.Keys {
+		if (k.Alg != "" && k.Alg != algorithm) || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		var key interface{}
+		switch {
+		case k.Kty == "RSA" && algorithm == jwt.SigningMethodRS256.Alg():
+			key, err = rsaKey(k)
+		case k.Kty == "EC" && algorithm == jwt.SigningMethodES256.Alg():
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: key %q: %v", file, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s: no %s keys", file, algorithm)
+	}
+	return keys, nil
+}
+
+// Число из base64url
+func jwkInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// Публичный ключ RSA из JWK
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := jwkInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := jwkInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if n.Sign() == 0 || !e.IsInt64() || e.Int64() < 3 {
+		return nil, errors.New("invalid RSA key")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+// Публичный ключ EC P-256 из JWK
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := jwkInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := jwkInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !elliptic.P256().IsOnCurve(x, y) {
+		return nil, errors.New("point is not on curve P-256")
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+}
+
+// Ключ проверки подписи токена. Алгоритм токена должен совпадать с настроенным,
+// иначе токен с публичным ключом RS256 в качестве секрета HS256 прошел бы проверку
+func (a *jwtAuth) key(token *jwt.Token) (interface{}, error) {
+	if token.Method.Alg() != a.algorithm {
+		return nil, errInvalidToken
+	}
+	if a.secret != nil {
+		return a.secret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	// токен без kid проверяется единственным ключом
+	if len(a.keys) == 1 && kid == "" {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	return nil, errInvalidToken
+}
+
+// Проверить подпись и claims токена: exp обязателен, nbf, iss и aud проверяются, если заданы
+func (a *jwtAuth) parse(tokenString string, now time.Time) (jwt.MapClaims, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, claims, a.key); err != nil {
+		return nil, errInvalidToken
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiration time")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.leeway)) {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("token is not valid yet")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return nil, errors.New("token issuer is not accepted")
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return nil, errors.New("token audience is not accepted")
+	}
+	return claims, nil
+}
+
+// Есть ли audience в claim aud: строке или массиве строк
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Требуется ли аутентификация запросов к /api: токеном или ключом API при auth.enabled, только ключом API при auth.apikeys
+func (api *Api) authRequired() bool {
+	return api.conf.Auth.Enabled || api.conf.Auth.ApiKeys
+}
+
+// Запрос без токена, разрешенный auth.anonymousread: чтение каталога, но не административные методы
+func (api *Api) anonymousAllowed(c echo.Context) bool {
+	if !api.conf.Auth.AnonymousRead {
+		return false
+	}
+	method := c.Request().Method
+	if method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions {
+		return false
+	}
+	return !strings.HasPrefix(c.Request().URL.Path, "/api/admin")
+}
+
+// Ответ 401 с заголовком WWW-Authenticate (RFC 6750)
+func unauthorized(c echo.Context, detail string) error {
+	challenge := `Bearer realm="api"`
+	if detail != "" {
+		challenge += `, error="invalid_token"`
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, challenge)
+	if detail == "" {
+		detail = "Bearer token or " + HeaderApiKey + " is required"
+	}
+	return echo.NewHTTPError(http.StatusUnauthorized, detail)
+}
+
+// Аутентифицировать запрос ключом API. Пользователь запроса - "api-key:" и название ключа,
+// области доступа ключа передаются в контексте и проверяются require
+func (api *Api) authenticateApiKey(c echo.Context, secret string) error {
+	key, err := api.as.AuthenticateApiKey(c.Request().Context(), secret)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="api"`)
+		return echo.NewHTTPError(http.StatusUnauthorized, "Invalid, revoked or expired API key")
+	}
+	ctx := model.ContextWithUser(c.Request().Context(), "api-key:"+key.Name)
+	c.SetRequest(c.Request().WithContext(model.ContextWithScopes(ctx, key.Scopes)))
+	return nil
+}
+
+// Middleware аутентификации запросов к /api по JWT токену из заголовка Authorization: Bearer или ключу API из X-API-Key.
+// Subject токена передается в контексте запроса как пользователь, claims - через model.ClaimsFromContext.
+// Если проверка токенов выключена (только auth.apikeys), токены не принимаются
+func (api *Api) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !strings.HasPrefix(c.Request().URL.Path, "/api/") {
+			return next(c)
+		}
+		if api.conf.Auth.Enabled && api.auth == nil {
+			// настройки auth некорректны, ошибку при запуске возвращает Start
+			return api.authErr
+		}
+		header := c.Request().Header.Get(echo.HeaderAuthorization)
+		if secret := c.Request().Header.Get(HeaderApiKey); secret != "" && header == "" {
+			if err := api.authenticateApiKey(c, secret); err != nil {
+				return err
+			}
+			return next(c)
+		}
+		if header == "" {
+			if api.anonymousAllowed(c) {
+				return next(c)
+			}
+			return unauthorized(c, "")
+		}
+		if api.auth == nil {
+			return unauthorized(c, "Bearer tokens are not accepted, use "+HeaderApiKey)
+		}
+		const prefix = "Bearer "
+		if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+			return unauthorized(c, "Authorization header must be Bearer token")
+		}
+		claims, err := api.auth.parse(strings.TrimSpace(header[len(prefix):]), time.Now())
+		if err != nil {
+			return unauthorized(c, "Invalid bearer token: "+err.Error())
+		}
+		ctx := model.ContextWithClaims(c.Request().Context(), map[string]interface{}(claims))
+		if sub, ok := claims["sub"].(string); ok && sub != "" {
+			ctx = model.ContextWithUser(ctx, sub)
+		}
+		c.SetRequest(c.Request().WithContext(ctx))
+		return next(c)
+	}
+}
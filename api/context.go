@@ -0,0 +1,49 @@
+package api
+
+import (
+	"context"
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"time"
+)
+
+// Статус ответа на запрос, который клиент отменил, не дождавшись ответа (nginx)
+const StatusClientClosedRequest = 499
+
+// Заголовок с именем пользователя, от имени которого выполняется запрос, например для истории цен
+const HeaderUser = "X-User"
+
+// Middleware, ограничивающий время обработки запроса значением Api.Timeout из конфига.
+// Контекст запроса передается в сервисы и сторедж, поэтому при отключении клиента или
+// истечении времени запросы к БД прерываются, а ошибка отдается как 499 или 503 вместо 500.
+//
+// Также передает в контексте запроса имя пользователя из заголовка X-User, если аутентификация (auth.enabled и auth.apikeys) выключена
+func (api *Api) requestContext(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if api.conf.Api.Timeout > 0 {
+			ctx, cancel := context.WithTimeout(c.Request().Context(), time.Duration(api.conf.Api.Timeout)*time.Second)
+			defer cancel()
+			c.SetRequest(c.Request().WithContext(ctx))
+		}
+		if user := c.Request().Header.Get(HeaderUser); user != "" && !api.authRequired() {
+			c.SetRequest(c.Request().WithContext(model.ContextWithUser(c.Request().Context(), user)))
+		}
+		err := next(c)
+		if err == nil {
+			return nil
+		}
+		return contextError(c.Request().Context(), err)
+	}
+}
+
+// Заменить ошибку обработки запроса, прерванного из-за отмены контекста, на ошибку с подходящим статусом
+func contextError(ctx context.Context, err error) error {
+	switch ctx.Err() {
+	case context.Canceled:
+		return echo.NewHTTPError(StatusClientClosedRequest, "Client closed request")
+	case context.DeadlineExceeded:
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Request timeout exceeded")
+	}
+	return err
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"strings"
+)
+
+// Получить код валюты из query параметра currency
+func currencyParam(c echo.Context) (string, error) {
+	v := strings.ToUpper(c.QueryParam("currency"))
+	if v == "" {
+		return "", nil
+	}
+	if len(v) != 3 || strings.Trim(v, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", echo.NewHTTPError(http.StatusBadRequest, "Bad request param `currency`")
+	}
+	return v, nil
+}
+
+// Проставить продукту валюту по умолчанию и проверить, что валюты его цен не повторяются
+func (api *Api) productCurrency(product *model.Product) error {
+	product.NormalizeCurrency(api.conf.Api.Currency)
+	if err := product.CheckPrices(); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	return nil
+}
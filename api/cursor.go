@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"echo-rest-api/model"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/labstack/echo"
+	"net/http"
+	"strings"
+)
+
+// Заголовок с курсором следующей страницы списка
+const HeaderNextCursor = "X-Next-Cursor"
+
+var errBadCursor = errors.New("bad cursor")
+
+// Ключ подписи курсоров из конфига, либо случайный, если в конфиге не задан.
+// Со случайным ключом курсоры перестают быть валидны после перезапуска сервиса
+func cursorKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Закодировать курсор в непрозрачную строку вида <данные>.<подпись>
+func (api *Api) encodeCursor(cursor *model.Cursor) string {
+	payload, _ := json.Marshal(cursor)
+	mac := hmac.New(sha256.New, api.cursorKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Раскодировать курсор, проверив его подпись
+func (api *Api) decodeCursor(s string) (*model.Cursor, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 2 {
+		return nil, errBadCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errBadCursor
+	}
+	sign, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errBadCursor
+	}
+	mac := hmac.New(sha256.New, api.cursorKey)
+	mac.Write(payload)
+	if !hmac.Equal(sign, mac.Sum(nil)) {
+		return nil, errBadCursor
+	}
+	cursor := &model.Cursor{}
+	if err := json.Unmarshal(payload, cursor); err != nil {
+		return nil, errBadCursor
+	}
+	return cursor, nil
+}
+
+// Получить курсор из query параметра cursor
+func (api *Api) cursorParam(c echo.Context, params *model.ListParams) error {
+	v := c.QueryParam("cursor")
+	if v == "" {
+		return nil
+	}
+	if c.QueryParam("offset") != "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request params: `cursor` and `offset` are mutually exclusive")
+	}
+	cursor, err := api.decodeCursor(v)
+	if err != nil || len(cursor.Values) != len(params.Sort) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `cursor`")
+	}
+	if cursor.Sort != model.SortString(params.Sort) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `cursor`: cursor was issued for sort `"+cursor.Sort+"`")
+	}
+	params.After = cursor
+	return nil
+}
+
+// Курсор следующей страницы, если страница из count записей заполнена и за ней могут быть записи.
+// id и value - id и значения полей последней записи страницы
+func nextCursor(params *model.ListParams, count int, id int, value func(field string) interface{}) *model.Cursor {
+	if params.Limit <= 0 || count < params.Limit {
+		return nil
+	}
+	cursor := &model.Cursor{Sort: model.SortString(params.Sort), Id: id}
+	for _, f := range params.Sort {
+		cursor.Values = append(cursor.Values, value(f.Field))
+	}
+	return cursor
+}
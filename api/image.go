@@ -0,0 +1,315 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"image"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Путь, по которому отдается каталог изображений продуктов
+const imagesPath = "/images"
+
+// Запас к images.maxsize на заголовки multipart формы при ограничении тела запроса загрузки
+const uploadOverhead = 64 << 10
+
+// Новый порядок изображений продукта
+// swagger:model
+type ImageOrderRequest struct {
+	// id всех изображений продукта в порядке показа
+	Ids []int `json:"ids" validate:"required"`
+}
+
+// Middleware, разрешающий клиенту кэшировать ответ maxAge секунд
+func cacheControl(maxAge int) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(maxAge))
+			return next(c)
+		}
+	}
+}
+
+// Middleware каталога изображений: файлы /images/<id продукта>/... отдаются, только пока продукт не удален.
+// Файлы удаленного продукта остаются в каталоге до purge, иначе восстановленный продукт остался бы без изображений
+func (api *Api) productImages(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dir := strings.SplitN(strings.TrimPrefix(c.Request().URL.Path, imagesPath+"/"), "/", 2)[0]
+		id, err := strconv.Atoi(dir)
+		if err != nil {
+			return echo.ErrNotFound
+		}
+		product, err := api.ps.GetProduct(c.Request().Context(), id)
+		if err != nil {
+			return err
+		}
+		if product == nil || product.DeletedAt != nil {
+			return echo.ErrNotFound
+		}
+		return next(c)
+	}
+}
+
+// Заполнить url изображений продуктов
+func (api *Api) setImageUrls(products ...*model.Product) {
+	for _, product := range products {
+		for _, image := range product.Images {
+			image.SetUrls(imagesPath, api.images.Sizes())
+		}
+	}
+}
+
+// Middleware, ограничивающий тело запроса загрузки изображения размером images.maxsize с запасом на заголовки формы.
+// Без ограничения файл формы целиком читался бы на диск до проверки его размера
+func (api *Api) uploadLimit() echo.MiddlewareFunc {
+	if api.conf.Images.MaxSize <= 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return next
+		}
+	}
+	return middleware.BodyLimit(strconv.FormatInt(api.conf.Images.MaxSize+uploadOverhead, 10))
+}
+
+// Получить id продукта и изображения из пути /products/:id/images/:image
+func imagePath(c echo.Context) (int, int, error) {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	id, err := strconv.Atoi(c.Param("image"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `image`")
+	}
+	return product, id, nil
+}
+
+// Прочитать загруженное изображение из поля image формы и проверить его размер и тип
+func (api *Api) uploadedImage(c echo.Context) ([]byte, string, error) {
+	file, err := c.FormFile("image")
+	if err == echo.ErrStatusRequestEntityTooLarge {
+		// тело запроса больше лимита uploadLimit
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", echo.NewHTTPError(http.StatusBadRequest, "Bad request param `image`")
+	}
+	if api.conf.Images.MaxSize > 0 && file.Size > api.conf.Images.MaxSize {
+		return nil, "", echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Image is larger than "+strconv.FormatInt(api.conf.Images.MaxSize, 10)+" bytes")
+	}
+	src, err := file.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer src.Close()
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, "", err
+	}
+	// тип определяется по содержимому, а не по заголовку от клиента
+	contentType := http.DetectContentType(data)
+	if _, ok := model.ImageExtensions[contentType]; !ok {
+		return nil, "", echo.NewHTTPError(http.StatusUnsupportedMediaType, "Unsupported image type "+contentType)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", echo.NewHTTPError(http.StatusBadRequest, "Bad request param `image`: "+err.Error())
+	}
+	// размер проверяется до декодирования: небольшой файл может заявить огромное изображение
+	if err = api.images.CheckSize(cfg); err != nil {
+		return nil, "", echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Image is larger than "+strconv.FormatInt(api.conf.Images.MaxPixels, 10)+" pixels")
+	}
+	return data, contentType, nil
+}
+
+// swagger:operation GET /products/{id}/images getImages
+// ---
+// description: Получить изображения продукта в порядке показа
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/ProductImage'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) getImages(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	images, err := api.ps.GetImages(c.Request().Context(), product)
+	if err != nil {
+		return err
+	}
+	if images == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+	}
+	api.setImageUrls(&model.Product{Images: images})
+	return c.JSON(http.StatusOK, images)
+}
+
+// swagger:operation POST /products/{id}/images createImage
+// ---
+// description: Загрузить изображение продукта (jpeg, png или gif не больше images.maxsize байт и images.maxpixels пикселей).
+//   Изображение добавляется последним, для него создаются миниатюры размеров images.thumbnailsizes
+// consumes:
+// - multipart/form-data
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: image
+//   in: formData
+//   description: файл изображения
+//   required: true
+//   type: file
+// responses:
+//  '201':
+//    schema:
+//      $ref: '#/definitions/ProductImage'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//  '413':
+//     description: изображение больше images.maxsize байт или images.maxpixels пикселей
+//  '415':
+//     description: тип изображения не поддерживается
+//
+func (api *Api) createImage(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	data, contentType, err := api.uploadedImage(c)
+	if err != nil {
+		return err
+	}
+	img := &model.ProductImage{Product: product, ContentType: contentType}
+	if _, err = api.ps.CreateImage(c.Request().Context(), img); err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+		}
+		return err
+	}
+	if err = api.images.Save(img, data); err != nil {
+		// запись об изображении без файлов не нужна
+		api.ps.DeleteImage(c.Request().Context(), product, img.Id)
+		return err
+	}
+	api.setImageUrls(&model.Product{Images: []*model.ProductImage{img}})
+	return c.JSON(http.StatusCreated, img)
+}
+
+// swagger:operation PUT /products/{id}/images/order reorderImages
+// ---
+// description: Изменить порядок изображений продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: order
+//   in: body
+//   description: id всех изображений продукта в новом порядке
+//   required: true
+//   schema:
+//     $ref: '#/definitions/ImageOrderRequest'
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/ProductImage'
+//  '400':
+//     description: Bad request param, переданы не все изображения продукта
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) reorderImages(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	req := &ImageOrderRequest{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err := api.validate.Struct(req); err != nil {
+		return err
+	}
+	images, err := api.ps.ReorderImages(c.Request().Context(), product, req.Ids)
+	if err != nil {
+		switch err {
+		case store.ErrImageOrder:
+			return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `ids`: expected all images of product `id` = "+strconv.Itoa(product)).SetInternal(err)
+		case sql.ErrNoRows:
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+		}
+		return err
+	}
+	if images == nil {
+		images = []*model.ProductImage{}
+	}
+	api.setImageUrls(&model.Product{Images: images})
+	return c.JSON(http.StatusOK, images)
+}
+
+// swagger:operation DELETE /products/{id}/images/{image} deleteImage
+// ---
+// description: Удалить изображение продукта вместе с его файлами
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: image
+//   in: path
+//   description: id изображения
+//   required: true
+//   type: int
+// responses:
+//  '204':
+//     description: Изображение удалено
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Image `id`= not found
+//
+func (api *Api) deleteImage(c echo.Context) error {
+	product, id, err := imagePath(c)
+	if err != nil {
+		return err
+	}
+	img, err := api.ps.DeleteImage(c.Request().Context(), product, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return echo.NewHTTPError(http.StatusNotFound, "Image `id` = "+strconv.Itoa(id)+" not found")
+		}
+		return err
+	}
+	if err = api.images.Remove(img); err != nil {
+		c.Logger().Warn(err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
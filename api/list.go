@@ -0,0 +1,145 @@
+package api
+
+import (
+	"echo-rest-api/model"
+	"fmt"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Заголовок с общим количеством записей списка
+	HeaderTotalCount = "X-Total-Count"
+	// Заголовок со ссылками на соседние страницы списка
+	HeaderLink = "Link"
+)
+
+// Получить query параметр include_deleted. Удаленные записи доступны только с правом admin
+func (api *Api) includeDeletedParam(c echo.Context) (bool, error) {
+	includeDeleted, err := boolParam(c, "include_deleted")
+	if err != nil || !includeDeleted {
+		return false, err
+	}
+	if api.permitted(c.Request().Context(), model.ScopeAdmin) != nil {
+		return false, echo.NewHTTPError(http.StatusForbidden, "Param `include_deleted` requires permission `"+model.ScopeAdmin+"`")
+	}
+	return true, nil
+}
+
+// Получить параметры выборки списка из query параметров limit, offset и sort.
+// allowed - поля, по которым разрешена сортировка
+func (api *Api) listParams(c echo.Context, allowed []string) (*model.ListParams, error) {
+	params := &model.ListParams{Limit: api.conf.Api.Limit}
+	sort, err := sortParam(c, allowed)
+	if err != nil {
+		return nil, err
+	}
+	params.Sort = sort
+	if v := c.QueryParam("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || (api.conf.Api.MaxLimit > 0 && limit > api.conf.Api.MaxLimit) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `limit`")
+		}
+		params.Limit = limit
+	}
+	if v := c.QueryParam("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `offset`")
+		}
+		params.Offset = offset
+	}
+	return params, nil
+}
+
+// Получить сортировку из query параметра sort вида -price,name, минус означает сортировку по убыванию
+func sortParam(c echo.Context, allowed []string) ([]model.SortField, error) {
+	v := c.QueryParam("sort")
+	if v == "" {
+		return nil, nil
+	}
+	var sort []model.SortField
+	seen := map[string]bool{}
+	for _, item := range strings.Split(v, ",") {
+		field := model.SortField{Field: strings.TrimSpace(item)}
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field, field.Desc = field.Field[1:], true
+		} else if strings.HasPrefix(field.Field, "+") {
+			field.Field = field.Field[1:]
+		}
+		ok := false
+		for _, a := range allowed {
+			if field.Field == a {
+				ok = true
+				break
+			}
+		}
+		if !ok || seen[field.Field] {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `sort`")
+		}
+		seen[field.Field] = true
+		sort = append(sort, field)
+	}
+	return sort, nil
+}
+
+// Выставить заголовки X-Total-Count, X-Next-Cursor и Link (RFC 5988) со ссылками на соседние страницы.
+// next - курсор следующей страницы, nil если список не поддерживает курсоры или страница последняя
+func (api *Api) setListHeaders(c echo.Context, params *model.ListParams, total int, next *model.Cursor) {
+	c.Response().Header().Set(HeaderTotalCount, strconv.Itoa(total))
+	if params.Limit <= 0 {
+		return
+	}
+	var links []string
+	link := func(query map[string]string, rel string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, listURL(c, query), rel))
+	}
+	page := func(offset int) map[string]string {
+		return map[string]string{"limit": strconv.Itoa(params.Limit), "offset": strconv.Itoa(offset), "cursor": ""}
+	}
+	link(page(0), "first")
+	if next != nil {
+		cursor := api.encodeCursor(next)
+		c.Response().Header().Set(HeaderNextCursor, cursor)
+		if params.After != nil {
+			link(map[string]string{"limit": strconv.Itoa(params.Limit), "offset": "", "cursor": cursor}, "next")
+		}
+	}
+	if params.After != nil {
+		// при выборке по курсору смещение текущей страницы неизвестно
+		c.Response().Header().Set(HeaderLink, strings.Join(links, ", "))
+		return
+	}
+	if params.Offset > 0 {
+		prev := params.Offset - params.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		link(page(prev), "prev")
+	}
+	if params.Offset+params.Limit < total {
+		link(page(params.Offset+params.Limit), "next")
+	}
+	last := 0
+	if total > 0 {
+		last = (total - 1) / params.Limit * params.Limit
+	}
+	link(page(last), "last")
+	c.Response().Header().Set(HeaderLink, strings.Join(links, ", "))
+}
+
+// Ссылка на текущий запрос с измененными query параметрами, пустое значение удаляет параметр
+func listURL(c echo.Context, params map[string]string) string {
+	req := c.Request()
+	query := req.URL.Query()
+	for k, v := range params {
+		if v == "" {
+			query.Del(k)
+		} else {
+			query.Set(k, v)
+		}
+	}
+	return fmt.Sprintf("%s://%s%s?%s", c.Scheme(), req.Host, req.URL.Path, query.Encode())
+}
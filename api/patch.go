@@ -0,0 +1,248 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"encoding/json"
+	"github.com/evanphx/json-patch"
+	"github.com/labstack/echo"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Тип тела PATCH запроса с JSON Merge Patch (RFC 7396)
+	MIMEApplicationMergePatch = "application/merge-patch+json"
+	// Тип тела PATCH запроса с JSON Patch (RFC 6902)
+	MIMEApplicationJSONPatch = "application/json-patch+json"
+	// Максимальный размер тела PATCH запроса, тело читается в память целиком
+	maxPatchSize = 1 << 20
+)
+
+// Функция, применяющая тело PATCH запроса к json документу
+type patchFunc func(doc []byte) ([]byte, error)
+
+// Прочитать тело PATCH запроса. Формат выбирается по Content-Type: merge patch или json patch
+func patchBody(c echo.Context) (patchFunc, error) {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(c.Response(), c.Request().Body, maxPatchSize))
+	if _, ok := err.(*http.MaxBytesError); ok {
+		return nil, echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Patch is larger than "+strconv.Itoa(maxPatchSize)+" bytes")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch strings.TrimSpace(contentType) {
+	case MIMEApplicationMergePatch:
+		if !json.Valid(body) {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param: invalid merge patch")
+		}
+		return func(doc []byte) ([]byte, error) {
+			return jsonpatch.MergePatch(doc, body)
+		}, nil
+	case MIMEApplicationJSONPatch:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+		}
+		return patch.Apply, nil
+	}
+	return nil, echo.NewHTTPError(http.StatusUnsupportedMediaType, "Content-Type must be "+MIMEApplicationMergePatch+" or "+MIMEApplicationJSONPatch)
+}
+
+// Применить patch к json записи current и разобрать результат в res
+func applyPatch(patch patchFunc, current interface{}, res interface{}) error {
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	if doc, err = patch(doc); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err = json.Unmarshal(doc, res); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	return nil
+}
+
+// swagger:operation PATCH /products/{id} patchProduct
+// ---
+// description: Изменить часть полей продукта. Изменения применяются к текущему продукту,
+//   результат проверяется так же, как при PUT
+// consumes:
+// - application/merge-patch+json
+// - application/json-patch+json
+// parameters:
+// - name: id
+//   in: path
+//   description: id необходимого продукта
+//   required: true
+//   type: int
+// - name: patch
+//   in: body
+//   description: JSON Merge Patch (RFC 7396) или JSON Patch (RFC 6902)
+//   required: true
+//   schema:
+//     type: object
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
+// responses:
+//  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//    schema:
+//      $ref: '#/definitions/Product'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//  '412':
+//     description: запись изменена после получения ETag
+//  '413':
+//     description: тело запроса больше 1 МБ
+//  '415':
+//     description: неизвестный формат изменений
+//  '428':
+//     description: Header `If-Match` is required
+//
+func (api *Api) patchProduct(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	patch, err := patchBody(c)
+	if err != nil {
+		return err
+	}
+	prod, err := api.ps.PatchProduct(c.Request().Context(), id, version, func(current *model.Product, category model.CategoryLookup) (*model.Product, error) {
+		req := &model.Product{}
+		if err := applyPatch(patch, current, req); err != nil {
+			return nil, err
+		}
+		if err := api.validate.Struct(req); err != nil {
+			return nil, err
+		}
+		if err := api.productCurrency(req); err != nil {
+			return nil, err
+		}
+		req.NormalizeTags()
+		// схема категории читается в транзакции изменения, а не отдельным запросом
+		if err := productAttributes(category, req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
+	if err != nil {
+		switch err {
+		case store.ErrConflict:
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Product `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		case sql.ErrNoRows:
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(id)+" not found")
+		}
+		return err
+	}
+	api.setImageUrls(prod)
+	c.Response().Header().Set(HeaderETag, etag(prod.Version))
+	return c.JSON(http.StatusOK, prod)
+}
+
+// swagger:operation PATCH /categories/{id} patchCategory
+// ---
+// description: Изменить часть полей категории. Изменения применяются к текущей категории,
+//   результат проверяется так же, как при PUT
+// consumes:
+// - application/merge-patch+json
+// - application/json-patch+json
+// parameters:
+// - name: id
+//   in: path
+//   description: id необходимой категории
+//   required: true
+//   type: int
+// - name: patch
+//   in: body
+//   description: JSON Merge Patch (RFC 7396) или JSON Patch (RFC 6902)
+//   required: true
+//   schema:
+//     type: object
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
+// responses:
+//  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//    schema:
+//      $ref: '#/definitions/Category'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Category `id`= not found
+//  '412':
+//     description: запись изменена после получения ETag
+//  '413':
+//     description: тело запроса больше 1 МБ
+//  '415':
+//     description: неизвестный формат изменений
+//  '428':
+//     description: Header `If-Match` is required
+//
+func (api *Api) patchCategory(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	patch, err := patchBody(c)
+	if err != nil {
+		return err
+	}
+	category, err := api.cs.PatchCategory(c.Request().Context(), id, version, func(current *model.Category) (*model.Category, error) {
+		req := &model.Category{}
+		if err := applyPatch(patch, current, req); err != nil {
+			return nil, err
+		}
+		if err := api.validate.Struct(req); err != nil {
+			return nil, err
+		}
+		if err := categoryAttributeSchema(req); err != nil {
+			return nil, err
+		}
+		return req, nil
+	})
+	if err != nil {
+		switch err {
+		case store.ErrConflict:
+			return echo.NewHTTPError(http.StatusPreconditionFailed, "Category `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+		case store.ErrCycle:
+			return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `parent_id`: category can not be a child of itself").SetInternal(err)
+		case sql.ErrNoRows:
+			return echo.NewHTTPError(http.StatusNotFound, "Category `id` = "+strconv.Itoa(id)+" not found")
+		}
+		return err
+	}
+	c.Response().Header().Set(HeaderETag, etag(category.Version))
+	return c.JSON(http.StatusOK, category)
+}
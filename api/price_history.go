@@ -0,0 +1,89 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+)
+
+// swagger:operation GET /products/{id}/prices getPriceHistory
+// ---
+// description: Получить историю изменений цен продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: limit
+//   in: query
+//   description: размер страницы
+//   required: false
+//   type: int
+// - name: offset
+//   in: query
+//   description: количество пропускаемых изменений
+//   required: false
+//   type: int
+// - name: sort
+//   in: query
+//   description: поле сортировки, минус перед полем - по убыванию. Поля - id
+//   required: false
+//   type: string
+// - name: cursor
+//   in: query
+//   description: курсор из заголовка X-Next-Cursor предыдущей страницы, используется вместо offset
+//   required: false
+//   type: string
+// responses:
+//  '200':
+//    headers:
+//      X-Total-Count:
+//        description: общее количество изменений
+//        type: int
+//      X-Next-Cursor:
+//        description: курсор следующей страницы
+//        type: string
+//      Link:
+//        description: ссылки на первую, предыдущую, следующую и последнюю страницы
+//        type: string
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/PriceChange'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) getPriceHistory(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	params, err := api.listParams(c, model.PriceChangeSortFields)
+	if err != nil {
+		return err
+	}
+	if err = api.cursorParam(c, params); err != nil {
+		return err
+	}
+	changes, total, err := api.ps.GetPriceHistory(c.Request().Context(), product, params)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+	} else if err != nil {
+		return err
+	}
+	if changes == nil {
+		changes = []*model.PriceChange{}
+	}
+	var next *model.Cursor
+	if len(changes) > 0 {
+		last := changes[len(changes)-1]
+		next = nextCursor(params, len(changes), last.Id, last.SortValue)
+	}
+	api.setListHeaders(c, params, total, next)
+	return c.JSON(http.StatusOK, changes)
+}
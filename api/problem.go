@@ -0,0 +1,214 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"encoding/json"
+	"fmt"
+	"github.com/labstack/echo"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Тип ответа с ошибкой по RFC 7807
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Префикс URI типа ошибки, type = problemTypePrefix + code
+const problemTypePrefix = "/problems/"
+
+// Коды ошибок, которые не выводятся из HTTP статуса
+const (
+	CodeValidationFailed    = "validation_failed"
+	CodeInvalidAttributes   = "invalid_attributes"
+	CodeVersionConflict     = "version_conflict"
+	CodeCategoryCycle       = "category_cycle"
+	CodeDuplicateValue      = "duplicate_value"
+	CodeForeignKeyViolation = "foreign_key_violation"
+	CodeInsufficientStock   = "insufficient_stock"
+	CodeReservationClosed   = "reservation_closed"
+	CodeImageOrder          = "image_order_mismatch"
+	CodeCategoryDeleted     = "category_deleted"
+	CodeInternalError       = "internal_error"
+)
+
+// Ошибка в формате RFC 7807 (application/problem+json)
+// swagger:model
+type Problem struct {
+	// URI типа ошибки: /problems/<code>
+	Type      string       `json:"type"`
+	// текст HTTP статуса
+	Title     string       `json:"title"`
+	// HTTP статус
+	Status    int          `json:"status"`
+	// описание ошибки
+	Detail    string       `json:"detail,omitempty"`
+	// путь запроса, при обработке которого возникла ошибка
+	Instance  string       `json:"instance,omitempty"`
+	// id запроса из заголовка X-Request-ID
+	RequestId string       `json:"request_id,omitempty"`
+	// код ошибки, не меняется между версиями API
+	Code      string       `json:"code"`
+	// ошибки по полям запроса
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
+}
+
+// Ошибка поля запроса
+// swagger:model
+type FieldError struct {
+	// путь к полю в теле запроса: name, prices[0].currency, attributes.voltage
+	Field   string `json:"field"`
+	// правило, которому не соответствует значение: required, min, schema, ...
+	Code    string `json:"code"`
+	// описание ошибки
+	Message string `json:"message"`
+}
+
+// Текст HTTP статуса, включая нестандартные статусы API
+func statusText(status int) string {
+	if status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(status)
+}
+
+// Код ошибки по HTTP статусу: not_found, bad_request, ...
+func statusCode(status int) string {
+	return strings.ToLower(strings.Replace(statusText(status), " ", "_", -1))
+}
+
+// HTTP статус и код ошибки стореджа. Для неизвестной ошибки ok = false
+func storeErrorCode(err error) (status int, code string, ok bool) {
+	switch err {
+	case sql.ErrNoRows:
+		return http.StatusNotFound, statusCode(http.StatusNotFound), true
+	case store.ErrConflict:
+		return http.StatusPreconditionFailed, CodeVersionConflict, true
+	case store.ErrCycle:
+		return http.StatusBadRequest, CodeCategoryCycle, true
+	case store.ErrDuplicate:
+		return http.StatusConflict, CodeDuplicateValue, true
+	case store.ErrForeignKey:
+		return http.StatusUnprocessableEntity, CodeForeignKeyViolation, true
+	case store.ErrInsufficientStock:
+		return http.StatusConflict, CodeInsufficientStock, true
+	case store.ErrReservationClosed:
+		return http.StatusConflict, CodeReservationClosed, true
+	case store.ErrImageOrder:
+		return http.StatusBadRequest, CodeImageOrder, true
+	case store.ErrCategoryDeleted:
+		return http.StatusConflict, CodeCategoryDeleted, true
+	}
+	return 0, "", false
+}
+
+// Использовать имена полей из json тегов в ошибках валидации
+func jsonFieldName(field reflect.StructField) string {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// Ошибки валидации по полям. Путь к полю считается от корня тела запроса
+func validationErrors(errs validator.ValidationErrors) []FieldError {
+	res := make([]FieldError, 0, len(errs))
+	for _, e := range errs {
+		field := e.Namespace()
+		if i := strings.IndexByte(field, '.'); i >= 0 {
+			field = field[i+1:]
+		}
+		res = append(res, FieldError{Field: field, Code: e.Tag(), Message: validationMessage(e)})
+	}
+	return res
+}
+
+// Описание ошибки валидации поля
+func validationMessage(e validator.FieldError) string {
+	switch e.Tag() {
+	case "required":
+		return "is required"
+	case "min", "gte":
+		return "must be at least " + e.Param()
+	case "max", "lte":
+		return "must be at most " + e.Param()
+	case "gt":
+		return "must be greater than " + e.Param()
+	case "lt":
+		return "must be less than " + e.Param()
+	case "len":
+		return "must have length " + e.Param()
+	case "oneof":
+		return "must be one of " + e.Param()
+	}
+	if e.Param() != "" {
+		return fmt.Sprintf("must satisfy %s=%s", e.Tag(), e.Param())
+	}
+	return "must satisfy " + e.Tag()
+}
+
+// Ошибка проверки атрибутов продукта по схеме категории
+func attributesProblem(errs []model.AttributeError) *Problem {
+	problem := &Problem{Status: http.StatusBadRequest, Code: CodeInvalidAttributes, Detail: "Bad request param `attributes`"}
+	for _, e := range errs {
+		problem.Errors = append(problem.Errors, FieldError{Field: "attributes." + e.Field, Code: "schema", Message: e.Message})
+	}
+	return problem
+}
+
+// Привести ошибку обработки запроса к Problem
+func toProblem(err error) *Problem {
+	switch e := err.(type) {
+	case *Problem:
+		return e
+	case validator.ValidationErrors:
+		return &Problem{Status: http.StatusBadRequest, Code: CodeValidationFailed, Detail: "Bad request params", Errors: validationErrors(e)}
+	case *echo.HTTPError:
+		problem := &Problem{Status: e.Code, Code: statusCode(e.Code), Detail: fmt.Sprint(e.Message)}
+		// обработчик мог указать ошибку стореджа, по которой получен статус
+		if _, code, ok := storeErrorCode(e.Internal); ok {
+			problem.Code = code
+		}
+		return problem
+	}
+	if status, code, ok := storeErrorCode(err); ok {
+		return &Problem{Status: status, Code: code, Detail: err.Error()}
+	}
+	return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: http.StatusText(http.StatusInternalServerError)}
+}
+
+// Обработчик ошибок echo: отдает ошибки в формате application/problem+json.
+// Внутренние ошибки пишутся в лог, клиенту отдается только статус
+func (api *Api) httpErrorHandler(err error, c echo.Context) {
+	problem := toProblem(err)
+	if problem.Status >= http.StatusInternalServerError {
+		c.Logger().Error(err)
+	}
+	if c.Response().Committed {
+		return
+	}
+	problem.Type = problemTypePrefix + problem.Code
+	problem.Title = statusText(problem.Status)
+	problem.Instance = c.Request().URL.Path
+	problem.RequestId = c.Response().Header().Get(echo.HeaderXRequestID)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		c.Response().Header().Set(echo.HeaderContentType, MIMEApplicationProblemJSON)
+		c.Response().WriteHeader(problem.Status)
+		err = json.NewEncoder(c.Response()).Encode(problem)
+	}
+	if err != nil {
+		c.Logger().Error(err)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"echo-rest-api/model"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Получить список id из query параметра. Значения можно передать через запятую
+// или повторив параметр: ?category=1,2&category=3
+func intListParam(c echo.Context, name string) ([]int, error) {
+	var res []int
+	for _, v := range c.QueryParams()[name] {
+		for _, item := range strings.Split(v, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(item))
+			if err != nil {
+				return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `"+name+"`")
+			}
+			res = append(res, id)
+		}
+	}
+	return res, nil
+}
+
+// Получить флаг из query параметра, по умолчанию false
+func boolParam(c echo.Context, name string) (bool, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return false, nil
+	}
+	res, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `"+name+"`")
+	}
+	return res, nil
+}
+
+// Получить теги без повторов из query параметра tag и режим их выбора из tag_mode: any - хотя бы один тег, all - все теги
+func tagParams(c echo.Context) ([]string, bool, error) {
+	var tags []string
+	seen := map[string]bool{}
+	for _, v := range c.QueryParams()["tag"] {
+		for _, tag := range strings.Split(v, ",") {
+			if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" && !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	switch c.QueryParam("tag_mode") {
+	case "", "any":
+		return tags, false, nil
+	case "all":
+		return tags, true, nil
+	}
+	return nil, false, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `tag_mode`")
+}
+
+// Получить время в формате RFC 3339 из query параметра
+func timeParam(c echo.Context, name string) (*time.Time, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `"+name+"`")
+	}
+	return &t, nil
+}
+
+// Получить цену из query параметра
+func priceParam(c echo.Context, name string) (*model.Money, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return nil, nil
+	}
+	price, err := model.ParseMoney(v)
+	if err != nil || price < 0 {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `"+name+"`")
+	}
+	return &price, nil
+}
+
+// Получить фильтр продуктов из query параметров ids, category, recursive, currency, min_price, max_price, tag, tag_mode, attr.<имя>, name и desc
+func productFilter(c echo.Context) (*model.ProductFilter, error) {
+	var err error
+	filter := &model.ProductFilter{}
+	if filter.Ids, err = intListParam(c, "ids"); err != nil {
+		return nil, err
+	}
+	if filter.Categories, err = intListParam(c, "category"); err != nil {
+		return nil, err
+	}
+	if filter.Recursive, err = boolParam(c, "recursive"); err != nil {
+		return nil, err
+	}
+	if filter.Currency, err = currencyParam(c); err != nil {
+		return nil, err
+	}
+	if filter.MinPrice, err = priceParam(c, "min_price"); err != nil {
+		return nil, err
+	}
+	if filter.MaxPrice, err = priceParam(c, "max_price"); err != nil {
+		return nil, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Bad request params: `min_price` is greater than `max_price`")
+	}
+	if filter.Tags, filter.AllTags, err = tagParams(c); err != nil {
+		return nil, err
+	}
+	if filter.Attributes, err = attributeParams(c); err != nil {
+		return nil, err
+	}
+	filter.Name = c.QueryParam("name")
+	filter.Description = c.QueryParam("desc")
+	return filter, nil
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"context"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Проверка прав ролей по настройкам rbac из конфига
+type rbac struct {
+	// права ролей
+	roles       map[string][]string
+	// роли пользователей
+	users       map[string][]string
+	roleClaim   string
+	defaultRole string
+}
+
+// Создать проверку прав: роли из конфига или роли по умолчанию. Права ролей и роли пользователей должны существовать.
+// Без аутентификации пользователь известен только из X-User, который клиент подставляет сам, поэтому она обязательна
+func newRbac(conf *config.Config) (*rbac, error) {
+	if !conf.Auth.Enabled && !conf.Auth.ApiKeys {
+		return nil, errors.New("rbac.enabled requires auth.enabled or auth.apikeys")
+	}
+	r := &rbac{
+		roles:       conf.Rbac.Roles,
+		users:       conf.Rbac.Users,
+		roleClaim:   conf.Rbac.RoleClaim,
+		defaultRole: conf.Rbac.DefaultRole,
+	}
+	if len(r.roles) == 0 {
+		r.roles = model.DefaultRoles()
+	}
+	for role, permissions := range r.roles {
+		for _, permission := range permissions {
+			if !model.HasScope(model.Scopes, permission) {
+				return nil, fmt.Errorf("rbac.roles: role %q has unknown permission %q", role, permission)
+			}
+		}
+	}
+	for user, roles := range r.users {
+		for _, role := range roles {
+			if _, ok := r.roles[role]; !ok {
+				return nil, fmt.Errorf("rbac.users: user %q has unknown role %q", user, role)
+			}
+		}
+	}
+	if _, ok := r.roles[r.defaultRole]; r.defaultRole != "" && !ok {
+		return nil, fmt.Errorf("rbac.defaultrole: unknown role %q", r.defaultRole)
+	}
+	return r, nil
+}
+
+// Роли вызывающего: из rbac.users и claim токена, если ни одной нет - роль по умолчанию.
+// user - subject токена или имя ключа API, X-User при включенной аутентификации в контекст не попадает
+func (r *rbac) rolesOf(user string, claims map[string]interface{}) []string {
+	var roles []string
+	if user != "" {
+		roles = append(roles, r.users[user]...)
+	}
+	if r.roleClaim != "" {
+		switch claim := claims[r.roleClaim].(type) {
+		case string:
+			roles = append(roles, strings.Fields(claim)...)
+		case []interface{}:
+			for _, role := range claim {
+				if role, ok := role.(string); ok {
+					roles = append(roles, role)
+				}
+			}
+		}
+	}
+	if len(roles) == 0 && r.defaultRole != "" {
+		roles = append(roles, r.defaultRole)
+	}
+	return roles
+}
+
+// Есть ли право permission хотя бы у одной из ролей. Неизвестные роли из токена прав не дают
+func (r *rbac) allowed(roles []string, permission string) bool {
+	for _, role := range roles {
+		if model.HasScope(r.roles[role], permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Роли с правом permission по алфавиту, для списка маршрутов
+func (r *rbac) rolesWith(permission string) []string {
+	var roles []string
+	for role, permissions := range r.roles {
+		if model.HasScope(permissions, permission) {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// Зарегистрировать маршрут /api, требующий право permission, с дополнительными middleware маршрута mw
+func (api *Api) route(method string, path string, h echo.HandlerFunc, permission string, mw ...echo.MiddlewareFunc) {
+	api.Http.Add(method, path, h, append([]echo.MiddlewareFunc{api.require(permission)}, mw...)...)
+	api.permissions[method+" "+path] = permission
+}
+
+// Middleware маршрута, требующий право permission
+func (api *Api) require(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if err := api.permitted(c.Request().Context(), permission); err != nil {
+				return err
+			}
+			return next(c)
+		}
+	}
+}
+
+// Проверить право permission у вызывающего: область доступа у ключа API и, если включен rbac, право у одной из ролей.
+// Запросы с токеном областями доступа не ограничиваются, анонимным по auth.anonymousread без rbac доступно только чтение каталога
+func (api *Api) permitted(ctx context.Context, permission string) error {
+	scopes, ok := model.ScopesFromContext(ctx)
+	if ok && !model.HasScope(scopes, permission) {
+		return echo.NewHTTPError(http.StatusForbidden, "API key has no scope `"+permission+"`")
+	}
+	if api.conf.Rbac.Enabled {
+		if api.rbac == nil {
+			// настройки rbac некорректны, ошибку при запуске возвращает Start
+			return api.rbacErr
+		}
+		roles := api.rbac.rolesOf(model.UserFromContext(ctx), model.ClaimsFromContext(ctx))
+		if !api.rbac.allowed(roles, permission) {
+			return echo.NewHTTPError(http.StatusForbidden, "Roles ["+strings.Join(roles, ", ")+"] have no permission `"+permission+"`")
+		}
+		return nil
+	}
+	if api.authRequired() && !ok && model.ClaimsFromContext(ctx) == nil && permission != model.ScopeCatalogRead {
+		return echo.NewHTTPError(http.StatusForbidden, "Anonymous request has no permission `"+permission+"`")
+	}
+	return nil
+}
+
+// Маршрут для списка маршрутов ApiInfo.Routs: путь, метод, требуемое право и, если включен rbac, роли с этим правом
+func (api *Api) routeInfo(r *echo.Route) string {
+	info := fmt.Sprintf("%s %s", r.Path, r.Method)
+	permission, ok := api.permissions[r.Method+" "+r.Path]
+	if !ok {
+		return info
+	}
+	info += " " + permission
+	if api.rbac != nil {
+		info += " [" + strings.Join(api.rbac.rolesWith(permission), " ") + "]"
+	}
+	return info
+}
@@ -0,0 +1,379 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Запрос на резерв продукта
+// swagger:model
+type ReservationRequest struct {
+	// количество
+	Quantity int `json:"quantity" validate:"required,gt=0"`
+	// срок резерва в секундах, по умолчанию api.reservationttl из конфига
+	Ttl      int `json:"ttl" validate:"gte=0"`
+}
+
+// Получить id продукта и резерва из пути /products/:id/stock/reservations/:reservation
+func reservationPath(c echo.Context) (int, int, error) {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	id, err := strconv.Atoi(c.Param("reservation"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `reservation`")
+	}
+	return product, id, nil
+}
+
+// Ошибка изменения остатка в виде HTTP ошибки
+func stockError(err error, product int, reservation int) error {
+	switch err {
+	case store.ErrInsufficientStock:
+		return echo.NewHTTPError(http.StatusConflict, "Insufficient stock of product `id` = "+strconv.Itoa(product)).SetInternal(err)
+	case store.ErrReservationClosed:
+		return echo.NewHTTPError(http.StatusConflict, "Reservation `id` = "+strconv.Itoa(reservation)+" is not active").SetInternal(err)
+	case sql.ErrNoRows:
+		if reservation == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "Reservation `id` = "+strconv.Itoa(reservation)+" not found")
+	}
+	return err
+}
+
+// swagger:operation GET /products/{id}/stock getStock
+// ---
+// description: Получить остаток продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      $ref: '#/definitions/Stock'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) getStock(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	stock, err := api.ps.GetStock(c.Request().Context(), product)
+	if err != nil {
+		return err
+	}
+	if stock == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+	}
+	return c.JSON(http.StatusOK, stock)
+}
+
+// swagger:operation GET /products/{id}/stock/adjustments getStockAdjustments
+// ---
+// description: Получить журнал изменений остатка продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: limit
+//   in: query
+//   description: размер страницы
+//   required: false
+//   type: int
+// - name: offset
+//   in: query
+//   description: количество пропускаемых изменений
+//   required: false
+//   type: int
+// - name: sort
+//   in: query
+//   description: поле сортировки, минус перед полем - по убыванию. Поля - id
+//   required: false
+//   type: string
+// - name: cursor
+//   in: query
+//   description: курсор из заголовка X-Next-Cursor предыдущей страницы, используется вместо offset
+//   required: false
+//   type: string
+// responses:
+//  '200':
+//    headers:
+//      X-Total-Count:
+//        description: общее количество изменений
+//        type: int
+//      X-Next-Cursor:
+//        description: курсор следующей страницы
+//        type: string
+//      Link:
+//        description: ссылки на первую, предыдущую, следующую и последнюю страницы
+//        type: string
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/StockAdjustment'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) getStockAdjustments(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	params, err := api.listParams(c, model.StockAdjustmentSortFields)
+	if err != nil {
+		return err
+	}
+	if err = api.cursorParam(c, params); err != nil {
+		return err
+	}
+	adjustments, total, err := api.ps.GetStockAdjustments(c.Request().Context(), product, params)
+	if err != nil {
+		return stockError(err, product, 0)
+	}
+	if adjustments == nil {
+		adjustments = []*model.StockAdjustment{}
+	}
+	var next *model.Cursor
+	if len(adjustments) > 0 {
+		last := adjustments[len(adjustments)-1]
+		next = nextCursor(params, len(adjustments), last.Id, last.SortValue)
+	}
+	api.setListHeaders(c, params, total, next)
+	return c.JSON(http.StatusOK, adjustments)
+}
+
+// swagger:operation POST /products/{id}/stock/adjustments adjustStock
+// ---
+// description: Изменить остаток продукта. Остаток не может стать меньше количества в действующих резервах
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: adjustment
+//   in: body
+//   description: изменение остатка, причина - receipt, return, damage, loss или correction
+//   required: true
+//   schema:
+//     $ref: '#/definitions/StockAdjustment'
+// responses:
+//  '201':
+//    schema:
+//      $ref: '#/definitions/Stock'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//  '409':
+//     description: Insufficient stock
+//
+func (api *Api) adjustStock(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	req := &model.StockAdjustment{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err := api.validate.Struct(req); err != nil {
+		return err
+	}
+	if !model.ManualAdjustmentReason(req.Reason) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `reason`")
+	}
+	req.Product = product
+	if _, err = api.ps.AdjustStock(c.Request().Context(), req); err != nil {
+		return stockError(err, product, 0)
+	}
+	stock, err := api.ps.GetStock(c.Request().Context(), product)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusCreated, stock)
+}
+
+// swagger:operation POST /products/{id}/stock/reservations createReservation
+// ---
+// description: Зарезервировать продукт. Резерв уменьшает доступное количество до подтверждения, отмены или истечения срока
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: reservation
+//   in: body
+//   description: количество и срок резерва
+//   required: true
+//   schema:
+//     $ref: '#/definitions/ReservationRequest'
+// responses:
+//  '201':
+//    schema:
+//      $ref: '#/definitions/StockReservation'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//  '409':
+//     description: Insufficient stock
+//
+func (api *Api) createReservation(c echo.Context) error {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	req := &ReservationRequest{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err := api.validate.Struct(req); err != nil {
+		return err
+	}
+	ttl := req.Ttl
+	if ttl == 0 {
+		ttl = api.conf.Api.ReservationTtl
+	}
+	reservation := &model.StockReservation{
+		Product:   product,
+		Quantity:  req.Quantity,
+		ExpiresAt: time.Now().UTC().Add(time.Duration(ttl) * time.Second),
+	}
+	id, err := api.ps.CreateReservation(c.Request().Context(), reservation)
+	if err != nil {
+		return stockError(err, product, 0)
+	}
+	reservation.Id = *id
+	return c.JSON(http.StatusCreated, reservation)
+}
+
+// swagger:operation GET /products/{id}/stock/reservations/{reservation} getReservation
+// ---
+// description: Получить резерв продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: reservation
+//   in: path
+//   description: id резерва
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      $ref: '#/definitions/StockReservation'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Reservation `id`= not found
+//
+func (api *Api) getReservation(c echo.Context) error {
+	product, id, err := reservationPath(c)
+	if err != nil {
+		return err
+	}
+	reservation, err := api.ps.GetReservation(c.Request().Context(), product, id)
+	if err != nil {
+		return err
+	}
+	if reservation == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Reservation `id` = "+strconv.Itoa(id)+" not found")
+	}
+	return c.JSON(http.StatusOK, reservation)
+}
+
+// swagger:operation POST /products/{id}/stock/reservations/{reservation}/commit commitReservation
+// ---
+// description: Подтвердить резерв, списав зарезервированное количество со склада
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: reservation
+//   in: path
+//   description: id резерва
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      $ref: '#/definitions/StockReservation'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Reservation `id`= not found
+//  '409':
+//     description: резерв уже подтвержден, отменен или его срок истек
+//
+func (api *Api) commitReservation(c echo.Context) error {
+	product, id, err := reservationPath(c)
+	if err != nil {
+		return err
+	}
+	reservation, err := api.ps.CommitReservation(c.Request().Context(), product, id)
+	if err != nil {
+		return stockError(err, product, id)
+	}
+	return c.JSON(http.StatusOK, reservation)
+}
+
+// swagger:operation POST /products/{id}/stock/reservations/{reservation}/release releaseReservation
+// ---
+// description: Отменить резерв, вернув количество в доступное
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: reservation
+//   in: path
+//   description: id резерва
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      $ref: '#/definitions/StockReservation'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Reservation `id`= not found
+//  '409':
+//     description: резерв уже подтвержден или отменен
+//
+func (api *Api) releaseReservation(c echo.Context) error {
+	product, id, err := reservationPath(c)
+	if err != nil {
+		return err
+	}
+	reservation, err := api.ps.ReleaseReservation(c.Request().Context(), product, id)
+	if err != nil {
+		return stockError(err, product, id)
+	}
+	return c.JSON(http.StatusOK, reservation)
+}
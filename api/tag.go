@@ -0,0 +1,24 @@
+package api
+
+import (
+	"github.com/labstack/echo"
+	"net/http"
+)
+
+// swagger:operation GET /tags getTags
+// ---
+// description: Получить теги продуктов с количеством неудаленных продуктов с каждым тегом
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/Tag'
+//
+func (api *Api) getTags(c echo.Context) error {
+	tags, err := api.ps.GetTags(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, tags)
+}
@@ -0,0 +1,299 @@
+package api
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Получить id продукта и варианта из пути /products/:id/variants/:variant
+func variantPath(c echo.Context) (int, int, error) {
+	product, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `id`")
+	}
+	if c.Param("variant") == "" {
+		return product, 0, nil
+	}
+	id, err := strconv.Atoi(c.Param("variant"))
+	if err != nil {
+		return 0, 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `variant`")
+	}
+	return product, id, nil
+}
+
+// Ошибка изменения варианта в виде HTTP ошибки
+func variantError(err error, product int, id int) error {
+	switch err {
+	case store.ErrConflict:
+		return echo.NewHTTPError(http.StatusPreconditionFailed, "Variant `id` = "+strconv.Itoa(id)+" was modified").SetInternal(err)
+	case store.ErrDuplicate:
+		return echo.NewHTTPError(http.StatusConflict, "Variant with the same `sku` already exists").SetInternal(err)
+	case sql.ErrNoRows:
+		if id == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "Variant `id` = "+strconv.Itoa(id)+" not found")
+	}
+	return err
+}
+
+// Проверить query параметр embed. Поддерживается только embed=variants
+func embedVariants(c echo.Context) (bool, error) {
+	embed := c.QueryParam("embed")
+	if embed == "" {
+		return false, nil
+	}
+	for _, v := range strings.Split(embed, ",") {
+		if v != "variants" {
+			return false, echo.NewHTTPError(http.StatusBadRequest, "Bad request param `embed`")
+		}
+	}
+	return true, nil
+}
+
+// swagger:operation GET /products/{id}/variants getVariants
+// ---
+// description: Получить варианты продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    schema:
+//      type: array
+//      items:
+//        $ref: '#/definitions/Variant'
+//  '400':
+//     description: Bad request param `id`
+//  '404':
+//     description: Product `id`= not found
+//
+func (api *Api) getVariants(c echo.Context) error {
+	product, _, err := variantPath(c)
+	if err != nil {
+		return err
+	}
+	variants, err := api.ps.GetVariants(c.Request().Context(), product)
+	if err != nil {
+		return err
+	}
+	if variants == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Product `id` = "+strconv.Itoa(product)+" not found")
+	}
+	return c.JSON(http.StatusOK, variants)
+}
+
+// swagger:operation GET /products/{id}/variants/{variant} getVariant
+// ---
+// description: Получить вариант продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: variant
+//   in: path
+//   description: id варианта
+//   required: true
+//   type: int
+// responses:
+//  '200':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//    schema:
+//      $ref: '#/definitions/Variant'
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Variant `id`= not found
+//
+func (api *Api) getVariant(c echo.Context) error {
+	product, id, err := variantPath(c)
+	if err != nil {
+		return err
+	}
+	variant, err := api.ps.GetVariant(c.Request().Context(), product, id)
+	if err != nil {
+		return err
+	}
+	if variant == nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Variant `id` = "+strconv.Itoa(id)+" not found")
+	}
+	c.Response().Header().Set(HeaderETag, etag(variant.Version))
+	return c.JSON(http.StatusOK, variant)
+}
+
+// swagger:operation POST /products/{id}/variants createVariant
+// ---
+// description: Создать вариант продукта
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: variant
+//   in: body
+//   description: новый вариант
+//   required: true
+//   schema:
+//     $ref: '#/definitions/Variant'
+// responses:
+//  '201':
+//    headers:
+//      ETag:
+//        description: версия записи
+//        type: string
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Product `id`= not found
+//  '409':
+//     description: Variant with the same `sku` already exists
+//
+func (api *Api) createVariant(c echo.Context) error {
+	product, _, err := variantPath(c)
+	if err != nil {
+		return err
+	}
+	req := &model.Variant{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err := api.validate.Struct(req); err != nil {
+		return err
+	}
+	req.Product = product
+	res, err := api.ps.CreateVariant(c.Request().Context(), req)
+	if err != nil {
+		return variantError(err, product, 0)
+	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
+	return c.JSON(http.StatusCreated, map[string]*int{"id": res})
+}
+
+// swagger:operation PUT /products/{id}/variants/{variant} updateVariant
+// ---
+// description: Обновить вариант продукта вместе с опциями
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: variant
+//   in: path
+//   description: id варианта
+//   required: true
+//   type: int
+// - name: body
+//   in: body
+//   description: измененный вариант
+//   required: true
+//   schema:
+//     $ref: '#/definitions/Variant'
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
+// responses:
+//  '204':
+//     description: Вариант обновлен
+//     headers:
+//       ETag:
+//         description: версия записи
+//         type: string
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Variant `id`= not found
+//  '409':
+//     description: Variant with the same `sku` already exists
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
+//
+func (api *Api) updateVariant(c echo.Context) error {
+	product, id, err := variantPath(c)
+	if err != nil {
+		return err
+	}
+	req := &model.Variant{}
+	if err := c.Bind(req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Bad request param: "+err.Error())
+	}
+	if err := api.validate.Struct(req); err != nil {
+		return err
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	req.Id = id
+	req.Product = product
+	req.Version = version
+	if err = api.ps.UpdateVariant(c.Request().Context(), req); err != nil {
+		return variantError(err, product, id)
+	}
+	c.Response().Header().Set(HeaderETag, etag(req.Version))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// swagger:operation DELETE /products/{id}/variants/{variant} deleteVariant
+// ---
+// description: Удалить вариант продукта. Удаленный вариант окончательно удаляется командой purge
+// parameters:
+// - name: id
+//   in: path
+//   description: id продукта
+//   required: true
+//   type: int
+// - name: variant
+//   in: path
+//   description: id варианта
+//   required: true
+//   type: int
+// - name: If-Match
+//   in: header
+//   description: ETag записи, которую необходимо изменить, * - без проверки версии
+//   required: true
+//   type: string
+// responses:
+//  '204':
+//     description: Вариант удален
+//  '400':
+//     description: Bad request param
+//  '404':
+//     description: Variant `id`= not found
+//  '412':
+//     description: запись изменена после получения ETag
+//  '428':
+//     description: Header `If-Match` is required
+//
+func (api *Api) deleteVariant(c echo.Context) error {
+	product, id, err := variantPath(c)
+	if err != nil {
+		return err
+	}
+	version, err := api.ifMatch(c)
+	if err != nil {
+		return err
+	}
+	if err = api.ps.DeleteVariant(c.Request().Context(), product, id, version); err != nil {
+		return variantError(err, product, id)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
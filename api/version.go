@@ -0,0 +1,43 @@
+package api
+
+import (
+	"github.com/labstack/echo"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Заголовок с версией записи
+	HeaderETag = "ETag"
+	// Заголовок с версией записи, которую клиент ожидает изменить
+	HeaderIfMatch = "If-Match"
+)
+
+// ETag записи с версией version
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// Получить ожидаемую версию записи из заголовка If-Match.
+// 0 - версия не проверяется: If-Match: * или заголовок не передан, если в конфиге он не обязателен
+func (api *Api) ifMatch(c echo.Context) (int, error) {
+	v := strings.TrimSpace(c.Request().Header.Get(HeaderIfMatch))
+	if v == "" {
+		if api.conf.Api.IfMatchOptional {
+			return 0, nil
+		}
+		return 0, echo.NewHTTPError(http.StatusPreconditionRequired, "Header `If-Match` is required")
+	}
+	if v == "*" {
+		return 0, nil
+	}
+	if len(v) < 2 || !strings.HasPrefix(v, `"`) || !strings.HasSuffix(v, `"`) {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request header `If-Match`")
+	}
+	version, err := strconv.Atoi(v[1 : len(v)-1])
+	if err != nil || version < 1 {
+		return 0, echo.NewHTTPError(http.StatusBadRequest, "Bad request header `If-Match`")
+	}
+	return version, nil
+}
@@ -11,13 +11,90 @@ type Config struct {
 	Api        struct {
 		HttpPort int  `default:"8080"`
 		Logging  bool `default:"false"`
+		// Максимальное время обработки запроса в секундах, 0 - без ограничения
+		Timeout int `default:"30"`
+		// Размер страницы списков по умолчанию, 0 - без ограничения
+		Limit int `default:"50"`
+		// Максимальный размер страницы, который может запросить клиент, 0 - без ограничения
+		MaxLimit int `default:"1000"`
+		// Ключ подписи курсоров списков. Если не задан, генерируется при старте
+		CursorSecret string
+		// Разрешить PUT и DELETE без заголовка If-Match, т.е. без проверки версии записи
+		IfMatchOptional bool `default:"false"`
+		// Срок резерва продукта по умолчанию в секундах
+		ReservationTtl int `default:"900"`
+		// Валюта цены продукта по умолчанию, код ISO 4217
+		Currency string `default:"RUB"`
+	}
+	Auth struct {
+		// Проверять JWT токены из заголовка Authorization: Bearer. Если выключено вместе с auth.apikeys, API доступно без аутентификации
+		Enabled bool `default:"false"`
+		// Требовать ключ API из заголовка X-API-Key, даже если проверка JWT токенов выключена. С auth.enabled ключи принимаются всегда
+		ApiKeys bool `default:"false"`
+		// Алгоритм подписи токенов: HS256, RS256 или ES256
+		Algorithm string `default:"HS256"`
+		// Секрет подписи токенов HS256
+		Secret string
+		// PEM файл с публичным ключом RS256 или ES256
+		PublicKeyFile string
+		// JWKS файл с публичными ключами RS256 или ES256, ключ выбирается по kid токена
+		JwksFile string
+		// Издатель токенов (iss), если не задан - не проверяется
+		Issuer string
+		// Аудитория токенов (aud), если не задана - не проверяется
+		Audience string
+		// Допустимое расхождение часов в секундах при проверке exp и nbf
+		Leeway int `default:"30"`
+		// Разрешить GET запросы к каталогу без токена
+		AnonymousRead bool `default:"false"`
+	}
+	Rbac struct {
+		// Проверять права ролей вызывающего для каждого маршрута /api
+		Enabled bool `default:"false"`
+		// Права ролей: catalog:read, catalog:write, catalog:delete, admin. Если не заданы - роли viewer, editor и admin по умолчанию
+		Roles map[string][]string
+		// Роли пользователей по имени: sub токена или api-key:<название ключа>. Требует auth.enabled или auth.apikeys
+		Users map[string][]string
+		// Claim токена с ролями: строка через пробел или массив. Роли из токена дополняют роли из rbac.users
+		RoleClaim string `default:"roles"`
+		// Роль вызывающего, которому не назначено ни одной роли, в том числе анонимного. Пусто - доступ запрещен
+		DefaultRole string `default:"viewer"`
+	}
+	Images struct {
+		// Каталог, в котором хранятся изображения продуктов и их миниатюры
+		Dir string `default:"images"`
+		// Максимальный размер загружаемого изображения в байтах
+		MaxSize int64 `default:"5242880"`
+		// Максимальное количество пикселей загружаемого изображения (ширина x высота)
+		MaxPixels int64 `default:"40000000"`
+		// Размеры миниатюр в пикселях по большей стороне
+		ThumbnailSizes []int `default:"[100, 400]"`
+		// Время кэширования изображений клиентом в секундах
+		CacheMaxAge int `default:"86400"`
 	}
 	Store struct {
-		Host     string `required:"true"`
-		Port     int    `required:"true"`
-		User     string `required:"true"`
-		Password string `required:"true"`
-		Dbname   string `required:"true"`
+		// Тип стореджа: postgres, sqlite или memory
+		Driver string `default:"postgres"`
+		// Строка подключения к БД, для sqlite - путь к файлу.
+		// Для postgres, если не указана, собирается из Host, Port, User, Password, Dbname
+		Dsn      string
+		Host     string
+		Port     int
+		User     string
+		Password string
+		Dbname   string
+		// Максимальное количество открытых соединений с БД, 0 - без ограничения
+		MaxOpenConns int `default:"25"`
+		// Максимальное количество простаивающих соединений в пуле, 0 - не держать простаивающие соединения
+		MaxIdleConns int `default:"5"`
+		// Максимальное время жизни соединения в секундах, 0 - без ограничения
+		ConnMaxLifetime int `default:"1800"`
+		// Максимальное время простоя соединения в секундах, 0 - без ограничения
+		ConnMaxIdleTime int `default:"300"`
+		// Применять миграции схемы при старте сервиса (только postgres)
+		AutoMigrate bool `default:"false"`
+		// Сколько дней хранить удаленные записи, после чего их окончательно удаляет команда purge
+		RetentionDays int `default:"30"`
 	}
 }
 
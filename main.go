@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"echo-rest-api/api"
 	"echo-rest-api/config"
 	"echo-rest-api/service"
 	"echo-rest-api/store"
 	"flag"
+	"fmt"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
+	"time"
 )
 
 func main() {
@@ -16,6 +20,10 @@ func main() {
 	// Получаем флаги запуска приложения
 	configFile := flag.String("c", "config.yaml", "Path to config file")
 	flag.Parse()
+	command := flag.Arg(0)
+	if command != "" && command != "purge" && command != "migrate" {
+		log.Fatal("Unknown command: ", command)
+	}
 	// Загружаем конфиг
 	var conf *config.Config
 	if conf, err = config.NewConfig(*configFile); err != nil {
@@ -24,22 +32,82 @@ func main() {
 	// Конфигурируем логгер
 	log.SetLevel(log.Level(conf.LogLevel))
 	log.Info("Starting service with configuration: ", conf.ConfigFile)
-	// Создаем сторедж
+	// Применяем или откатываем миграции схемы БД
+	if command == "migrate" {
+		migrate(conf, flag.Arg(1))
+		return
+	}
+	// Создаем сторедж и хранилище файлов изображений продуктов
+	images := store.NewImageFiles(conf)
 	store, err := store.NewStore(conf)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer store.Close()
 	log.Info("Store created successfully")
+	// Окончательно удаляем записи, удаленные раньше срока хранения
+	if command == "purge" {
+		before := time.Now().AddDate(0, 0, -conf.Store.RetentionDays)
+		purged, err := store.Purge(context.Background(), nil, before)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.WithField("before", before).WithField("purged", purged).Info("Deleted records purged")
+		// файлы изображений окончательно удаленных продуктов
+		purged, err = images.Purge(context.Background(), store)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.WithField("dir", conf.Images.Dir).WithField("purged", purged).Info("Product images purged")
+		return
+	}
 	// Создаем сервисы
 	cs := service.NewCategoryService(store)
 	ps := service.NewProductService(store)
+	as := service.NewAdminService(store)
 	log.Info("Services created successfully")
 	// Создаем  Api
-	api := api.NewApi(conf, cs, ps)
+	api := api.NewApi(conf, cs, ps, as)
 	log.WithField("address", api.GetApiInfo().Address).
 		WithField("mw", api.GetApiInfo().MW).
 		WithField("routs", api.GetApiInfo().Routs).
 		Info("Starting api")
 	log.Fatal(api.Start())
 }
+
+// Выполнить команду миграции схемы БД: up, down или status
+func migrate(conf *config.Config, action string) {
+	migrator, err := store.NewMigrator(conf)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer migrator.Close()
+	switch action {
+	case "up":
+		applied, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.WithField("applied", applied).Info("Migrations applied")
+	case "down":
+		id, err := migrator.Down()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.WithField("migration", id).Info("Migration rolled back")
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%-30s %s\n", status.Id, applied)
+		}
+	default:
+		log.Fatal("Unknown migrate action: ", action, ", expected up, down or status")
+	}
+}
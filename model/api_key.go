@@ -0,0 +1,114 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// Области доступа ключей API. Они же права ролей, каждый маршрут /api требует одно из них
+const (
+	// чтение категорий, продуктов, остатков и изображений
+	ScopeCatalogRead   = "catalog:read"
+	// изменение категорий, продуктов, остатков и изображений
+	ScopeCatalogWrite  = "catalog:write"
+	// удаление категорий вместе с подкатегориями и продуктами
+	ScopeCatalogDelete = "catalog:delete"
+	// административные методы: статистика БД, ключи API
+	ScopeAdmin         = "admin"
+)
+
+// Все области доступа
+var Scopes = []string{ScopeCatalogRead, ScopeCatalogWrite, ScopeCatalogDelete, ScopeAdmin}
+
+// Префикс ключей API, по нему ключ легко узнать в конфигах и логах
+const ApiKeyPrefix = "erk_"
+
+// Длина видимой части ключа, по которой ключ можно узнать в списке
+const apiKeyVisible = len(ApiKeyPrefix) + 6
+
+// Ключ API для интеграций. Хранится только хэш ключа, сам ключ показывается один раз при создании
+// swagger:model
+type ApiKey struct {
+	// id ключа
+	Id         int        `json:"id"`
+	// название интеграции
+	Name       string     `json:"name" validate:"required,max=100"`
+	// начало ключа, по которому его можно узнать
+	Prefix     string     `json:"prefix"`
+	// области доступа: catalog:read, catalog:write, catalog:delete, admin
+	Scopes     []string   `json:"scopes" validate:"required,dive,oneof=catalog:read catalog:write catalog:delete admin"`
+	// время окончания действия, если не задано - бессрочный
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// время последнего использования
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// время создания
+	CreatedAt  time.Time  `json:"created_at"`
+	// время отзыва, у действующего ключа не задано
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// SHA-256 хэш ключа
+	Hash       string     `json:"-"`
+}
+
+// Создать новый ключ API: префикс и 32 случайных байта в base64url. Возвращает ключ, его видимую часть и хэш
+func NewApiKeySecret() (secret string, prefix string, hash string, err error) {
+	data := make([]byte, 32)
+	if _, err = rand.Read(data); err != nil {
+		return "", "", "", err
+	}
+	secret = ApiKeyPrefix + base64.RawURLEncoding.EncodeToString(data)
+	return secret, secret[:apiKeyVisible], HashApiKey(secret), nil
+}
+
+// Хэш ключа API. Ключ случайный и длинный, поэтому соль и медленный хэш не нужны
+func HashApiKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Действует ли ключ в момент now: не отозван и не истек
+func (k *ApiKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// Есть ли у ключа область доступа scope
+func (k *ApiKey) HasScope(scope string) bool {
+	return HasScope(k.Scopes, scope)
+}
+
+// Есть ли scope среди областей доступа scopes
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Области доступа в виде строки через пробел, как scope в OAuth 2.0
+func ScopeString(scopes []string) string {
+	return strings.Join(scopes, " ")
+}
+
+// Области доступа из строки через пробел
+func ParseScopes(scopes string) []string {
+	return strings.Fields(scopes)
+}
+
+type scopesKey struct{}
+
+// Контекст с областями доступа ключа API, которым аутентифицирован запрос
+func ContextWithScopes(ctx context.Context, scopes []string) context.Context {
+	return context.WithValue(ctx, scopesKey{}, scopes)
+}
+
+// Области доступа из контекста. ok = false, если запрос не ограничен областями доступа, например аутентифицирован JWT
+func ScopesFromContext(ctx context.Context) (scopes []string, ok bool) {
+	scopes, ok = ctx.Value(scopesKey{}).([]string)
+	return scopes, ok
+}
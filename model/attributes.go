@@ -0,0 +1,122 @@
+package model
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// Json объект: атрибуты продукта или JSON Schema атрибутов категории.
+// В БД хранится в колонке jsonb (в sqlite - текстом), пустой объект - NULL
+type JsonObject map[string]interface{}
+
+// Объект из колонки jsonb: postgresql отдает его байтами, sqlite - строкой
+func (o *JsonObject) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, o)
+	case string:
+		return json.Unmarshal([]byte(v), o)
+	}
+	return fmt.Errorf("cannot scan %T into JsonObject", src)
+}
+
+// Объект в БД передается строкой, чтобы postgresql привел ее к jsonb
+func (o JsonObject) Value() (driver.Value, error) {
+	if o == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Ошибка значения атрибута продукта
+// swagger:model
+type AttributeError struct {
+	// атрибут, пустой для ошибки объекта атрибутов целиком
+	Field   string `json:"field"`
+	// описание ошибки
+	Message string `json:"message"`
+}
+
+// Проверить, что объект - корректная JSON Schema
+func CheckAttributeSchema(schema JsonObject) error {
+	_, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(map[string]interface{}(schema)))
+	return err
+}
+
+// Проверить атрибуты по JSON Schema категории и вернуть ошибки по атрибутам.
+// Без схемы подходят любые атрибуты
+func ValidateAttributes(schema JsonObject, attributes JsonObject) ([]AttributeError, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	if attributes == nil {
+		attributes = JsonObject{}
+	}
+	res, err := gojsonschema.Validate(gojsonschema.NewGoLoader(map[string]interface{}(schema)),
+		gojsonschema.NewGoLoader(map[string]interface{}(attributes)))
+	if err != nil {
+		return nil, err
+	}
+	var errs []AttributeError
+	for _, e := range res.Errors() {
+		field := e.Field()
+		if field == gojsonschema.STRING_CONTEXT_ROOT {
+			field = ""
+			// у обязательного атрибута ошибка относится к объекту, а имя атрибута - в деталях
+			if property, ok := e.Details()["property"].(string); ok {
+				field = property
+			}
+		}
+		errs = append(errs, AttributeError{Field: field, Message: e.Description()})
+	}
+	return errs, nil
+}
+
+// Значение атрибута в виде json, как его отдает jsonb -> в postgresql и sqlite
+func AttributeJson(v interface{}) string {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return ""
+	}
+	return string(bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+// Значения атрибута в виде json, подходящие под значение value из фильтра:
+// само значение (число, true, false) или строка с ним
+func AttributeValues(value string) []string {
+	return []string{value, AttributeJson(value)}
+}
+
+// Подходят ли атрибуты продукта под фильтр по значениям атрибутов
+func (p *Product) HasAttributes(filter map[string]string) bool {
+	for name, value := range filter {
+		v, ok := p.Attributes[name]
+		if !ok {
+			return false
+		}
+		s := AttributeJson(v)
+		matched := false
+		for _, a := range AttributeValues(value) {
+			if s == a {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
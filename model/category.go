@@ -1,10 +1,61 @@
 package model
+
+import "time"
+
 // Категория.
 // Сущность категория продукта
 // swagger:model
 type Category struct {
 	// id категории
-	Id   int    `json:"id"`
+	Id              int        `json:"id"`
 	// название категории
-	Name string `json:"name" validate:"required,min=3"`
+	Name            string     `json:"name" validate:"required,min=3"`
+	// id родительской категории, у корневой категории не задан
+	ParentId        *int       `json:"parent_id"`
+	// JSON Schema атрибутов продуктов категории, без нее атрибуты не проверяются
+	AttributeSchema JsonObject `json:"attribute_schema,omitempty"`
+	// версия, увеличивается при каждом изменении
+	Version         int        `json:"version"`
+	// время удаления, у неудаленной категории не задано
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Значение поля категории, по которому возможна сортировка
+func (c *Category) SortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return c.Id
+	case "name":
+		return c.Name
+	}
+	return nil
+}
+
+// Категория с подкатегориями.
+// swagger:model
+type CategoryTree struct {
+	Category
+	// подкатегории
+	Children []*CategoryTree `json:"children"`
+}
+
+// Собрать дерево категорий из списка. Порядок подкатегорий сохраняется из списка.
+// Категории, родителя которых нет в списке, становятся корневыми
+func NewCategoryTree(categories []*Category) []*CategoryTree {
+	nodes := make(map[int]*CategoryTree, len(categories))
+	for _, category := range categories {
+		nodes[category.Id] = &CategoryTree{Category: *category, Children: []*CategoryTree{}}
+	}
+	roots := []*CategoryTree{}
+	for _, category := range categories {
+		node := nodes[category.Id]
+		if category.ParentId != nil {
+			if parent, ok := nodes[*category.ParentId]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
 }
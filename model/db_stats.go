@@ -0,0 +1,44 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Статистика пула соединений с БД.
+// swagger:model
+type DbStats struct {
+	// максимальное количество открытых соединений, 0 - без ограничения
+	MaxOpenConnections int   `json:"max_open_connections"`
+	// открытых соединений, используемых и простаивающих
+	OpenConnections    int   `json:"open_connections"`
+	// используемых соединений
+	InUse              int   `json:"in_use"`
+	// простаивающих соединений
+	Idle               int   `json:"idle"`
+	// сколько раз запросы ждали свободное соединение
+	WaitCount          int64 `json:"wait_count"`
+	// суммарное время ожидания свободного соединения в миллисекундах
+	WaitDuration       int64 `json:"wait_duration_ms"`
+	// соединений, закрытых из-за превышения MaxIdleConns
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	// соединений, закрытых из-за превышения ConnMaxIdleTime
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	// соединений, закрытых из-за превышения ConnMaxLifetime
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+}
+
+// Статистика пула из sql.DBStats
+func NewDbStats(stats sql.DBStats) *DbStats {
+	return &DbStats{
+		MaxOpenConnections: stats.MaxOpenConnections,
+		OpenConnections:    stats.OpenConnections,
+		InUse:              stats.InUse,
+		Idle:               stats.Idle,
+		WaitCount:          stats.WaitCount,
+		WaitDuration:       int64(stats.WaitDuration / time.Millisecond),
+		MaxIdleClosed:      stats.MaxIdleClosed,
+		MaxIdleTimeClosed:  stats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  stats.MaxLifetimeClosed,
+	}
+}
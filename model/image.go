@@ -0,0 +1,81 @@
+package model
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+)
+
+// Типы изображений продуктов, которые можно загрузить, и расширения их файлов
+var ImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Изображение продукта.
+// Файлы хранятся в каталоге images.dir из конфига: <id продукта>/<id изображения>.<расширение>,
+// миниатюры - <id продукта>/<id изображения>_<размер>.<расширение>
+// swagger:model
+type ProductImage struct {
+	// id изображения
+	Id          int               `json:"id"`
+	// id продукта
+	Product     int               `json:"product"`
+	// тип изображения: image/jpeg, image/png или image/gif
+	ContentType string            `json:"content_type"`
+	// порядковый номер изображения у продукта, с 0
+	Position    int               `json:"position"`
+	// время загрузки
+	CreatedAt   time.Time         `json:"created_at"`
+	// url изображения
+	Url         string            `json:"url"`
+	// url миниатюр по размеру в пикселях по большей стороне
+	Thumbnails  map[string]string `json:"thumbnails,omitempty"`
+}
+
+// Путь к файлу изображения относительно каталога изображений
+func (i *ProductImage) File() string {
+	return path.Join(strconv.Itoa(i.Product), strconv.Itoa(i.Id)+ImageExtensions[i.ContentType])
+}
+
+// Путь к файлу миниатюры размера size относительно каталога изображений.
+// Миниатюры gif сохраняются в png
+func (i *ProductImage) ThumbnailFile(size int) string {
+	ext := ImageExtensions[i.ContentType]
+	if i.ContentType == "image/gif" {
+		ext = ImageExtensions["image/png"]
+	}
+	return path.Join(strconv.Itoa(i.Product), fmt.Sprintf("%d_%d%s", i.Id, size, ext))
+}
+
+// Заполнить url изображения и его миниатюр размеров sizes, prefix - путь, по которому отдается каталог изображений
+func (i *ProductImage) SetUrls(prefix string, sizes []int) {
+	i.Url = path.Join(prefix, i.File())
+	i.Thumbnails = nil
+	for _, size := range sizes {
+		if i.Thumbnails == nil {
+			i.Thumbnails = map[string]string{}
+		}
+		i.Thumbnails[strconv.Itoa(size)] = path.Join(prefix, i.ThumbnailFile(size))
+	}
+}
+
+// Совпадают ли ids с id изображений images: каждое изображение ровно один раз
+func SameImages(images []*ProductImage, ids []int) bool {
+	if len(images) != len(ids) {
+		return false
+	}
+	seen := map[int]bool{}
+	for _, image := range images {
+		seen[image.Id] = true
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			return false
+		}
+		delete(seen, id)
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package model
+
+import "strings"
+
+// Параметры выборки списка
+type ListParams struct {
+	// максимальное количество записей, 0 - без ограничения
+	Limit int
+	// количество пропускаемых записей, учитывается только вместе с Limit
+	Offset int
+	// сортировка, после всех полей записи всегда упорядочиваются по id
+	Sort []SortField
+	// выбрать записи, следующие за курсором, вместо Offset
+	After *Cursor
+	// выбирать также удаленные записи
+	IncludeDeleted bool
+}
+
+// Поле сортировки
+type SortField struct {
+	// название поля
+	Field string
+	// сортировать по убыванию
+	Desc bool
+}
+
+// Поля, по которым можно сортировать категории
+var CategorySortFields = []string{"id", "name"}
+
+// Поля, по которым можно сортировать продукты
+var ProductSortFields = []string{"id", "name", "category", "price"}
+
+// Поля, по которым можно сортировать журнал изменений остатка
+var StockAdjustmentSortFields = []string{"id"}
+
+// Поля, по которым можно сортировать историю цен
+var PriceChangeSortFields = []string{"id"}
+
+// Строковое представление сортировки в формате query параметра sort: -price,name
+func SortString(sort []SortField) string {
+	fields := make([]string, len(sort))
+	for i, f := range sort {
+		if f.Desc {
+			fields[i] = "-" + f.Field
+		} else {
+			fields[i] = f.Field
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// Курсор.
+// Позиция последней записи страницы для постраничной выборки по ключу сортировки
+type Cursor struct {
+	// сортировка, для которой получен курсор, в формате SortString
+	Sort string `json:"sort,omitempty"`
+	// значения полей сортировки последней записи
+	Values []interface{} `json:"values,omitempty"`
+	// id последней записи
+	Id int `json:"id"`
+}
@@ -0,0 +1,110 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Количество знаков после запятой в денежных суммах, как в колонках numeric(10,2)
+const MoneyScale = 2
+
+// Денежная сумма в минимальных единицах валюты (копейках, центах).
+// Хранится целым числом, поэтому не накапливает ошибок округления float64.
+// В json и в БД передается десятичным числом с двумя знаками после запятой
+type Money int64
+
+// Разобрать десятичную сумму вида 19.99. Больше двух знаков после запятой не допускается
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	units, frac := strings.TrimPrefix(s, "-"), ""
+	if i := strings.IndexByte(units, '.'); i >= 0 {
+		units, frac = units[:i], units[i+1:]
+	}
+	if units == "" || len(frac) > MoneyScale || strings.ContainsAny(units+frac, "+-") {
+		return 0, fmt.Errorf("bad money value %q", s)
+	}
+	frac += strings.Repeat("0", MoneyScale-len(frac))
+	n, err := strconv.ParseInt(units+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad money value %q", s)
+	}
+	if neg {
+		n = -n
+	}
+	return Money(n), nil
+}
+
+// Сумма из float64, округленная до минимальных единиц
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * math.Pow10(MoneyScale)))
+}
+
+// Десятичная запись суммы с двумя знаками после запятой
+func (m Money) String() string {
+	sign := ""
+	n := int64(m)
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	unit := int64(math.Pow10(MoneyScale))
+	return fmt.Sprintf("%s%d.%0*d", sign, n/unit, MoneyScale, n%unit)
+}
+
+// Сумма в виде float64, только для сравнения, но не для вычислений
+func (m Money) Float64() float64 {
+	return float64(m) / math.Pow10(MoneyScale)
+}
+
+// Сумма в json - число с двумя знаками после запятой
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// Сумма из json принимается и числом, и строкой
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	v, err := ParseMoney(strings.Trim(s, `"`))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Сумма из колонки numeric: postgresql отдает ее строкой, sqlite - числом
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case float64:
+		*m = MoneyFromFloat(v)
+	case int64:
+		*m = Money(v * int64(math.Pow10(MoneyScale)))
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+// Сумма в БД передается строкой, чтобы numeric получил точное значение
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,11 @@
+package model
+
+// Получение категории по id для проверки изменяемого продукта. Возвращает и удаленную категорию, nil - если ее нет
+type CategoryLookup func(id int) (*Category, error)
+
+// Изменение продукта для PATCH: по текущему продукту возвращает измененный или ошибку, прерывающую изменение.
+// category читает категории в транзакции изменения, чтобы проверить атрибуты по актуальной схеме
+type ProductPatch func(current *Product, category CategoryLookup) (*Product, error)
+
+// Изменение категории для PATCH: по текущей категории возвращает измененную или ошибку, прерывающую изменение
+type CategoryPatch func(current *Category) (*Category, error)
@@ -0,0 +1,117 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// Изменение цены продукта.
+// Запись истории цен, которая пишется в одной транзакции с изменением продукта
+// swagger:model
+type PriceChange struct {
+	// id изменения
+	Id        int       `json:"id"`
+	// id продукта
+	Product   int       `json:"product"`
+	// код валюты цены
+	Currency  string    `json:"currency"`
+	// цена до изменения, не задана, если цены в этой валюте не было
+	OldPrice  *Money    `json:"old_price"`
+	// цена после изменения, не задана, если цена в этой валюте удалена
+	NewPrice  *Money    `json:"new_price"`
+	// время изменения
+	ChangedAt time.Time `json:"changed_at"`
+	// пользователь, изменивший цену
+	ChangedBy string    `json:"changed_by"`
+}
+
+// Значение поля изменения цены, по которому возможна сортировка
+func (pc *PriceChange) SortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return pc.Id
+	}
+	return nil
+}
+
+// Все цены продукта по валютам: основная и цены в других валютах
+func (p *Product) PriceMap() map[string]Money {
+	prices := map[string]Money{p.Currency: p.Price}
+	for _, price := range p.Prices {
+		prices[price.Currency] = price.Amount
+	}
+	return prices
+}
+
+// Изменения цен при переходе от цен old к ценам new, упорядоченные по валюте
+func PriceChanges(product int, old, new map[string]Money) []*PriceChange {
+	var changes []*PriceChange
+	for currency, amount := range new {
+		amount := amount
+		if prev, ok := old[currency]; !ok {
+			changes = append(changes, &PriceChange{Product: product, Currency: currency, NewPrice: &amount})
+		} else if prev != amount {
+			changes = append(changes, &PriceChange{Product: product, Currency: currency, OldPrice: &prev, NewPrice: &amount})
+		}
+	}
+	for currency, amount := range old {
+		amount := amount
+		if _, ok := new[currency]; !ok {
+			changes = append(changes, &PriceChange{Product: product, Currency: currency, OldPrice: &amount})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Currency < changes[j].Currency })
+	return changes
+}
+
+// Цены по валютам на момент at по истории изменений history, упорядоченной по времени, и текущим ценам current.
+// До первого изменения в валюте действовала его старая цена, без изменений - текущая
+func PricesAt(history []*PriceChange, current map[string]Money, at time.Time) map[string]Money {
+	prices := map[string]Money{}
+	seen := map[string]bool{}
+	for _, change := range history {
+		if !seen[change.Currency] && change.OldPrice != nil {
+			prices[change.Currency] = *change.OldPrice
+		}
+		seen[change.Currency] = true
+		if change.ChangedAt.After(at) {
+			continue
+		}
+		if change.NewPrice != nil {
+			prices[change.Currency] = *change.NewPrice
+		} else {
+			delete(prices, change.Currency)
+		}
+	}
+	for currency, amount := range current {
+		if !seen[currency] {
+			prices[currency] = amount
+		}
+	}
+	return prices
+}
+
+// Продукт с ценами на момент at. Основной остается цена в валюте продукта, если она тогда была,
+// иначе - цена в первой по алфавиту валюте. Возвращает false, если цен тогда не было
+func (p *Product) WithPrices(prices map[string]Money) bool {
+	if len(prices) == 0 {
+		return false
+	}
+	currency := p.Currency
+	if _, ok := prices[currency]; !ok {
+		currency = ""
+		for c := range prices {
+			if currency == "" || c < currency {
+				currency = c
+			}
+		}
+	}
+	p.Price, p.Currency, p.Prices = prices[currency], currency, nil
+	for c, amount := range prices {
+		if c != currency {
+			p.Prices = append(p.Prices, ProductPrice{Currency: c, Amount: amount})
+		}
+	}
+	sort.Slice(p.Prices, func(i, j int) bool { return p.Prices[i].Currency < p.Prices[j].Currency })
+	return true
+}
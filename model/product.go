@@ -1,17 +1,107 @@
 package model
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
 // Продукт.
 // Сущность продукт
 // swagger:model
 type Product struct {
 	// id продукта
-	Id          int     `json:"id"`
+	Id          int             `json:"id"`
 	// название
-	Name        string  `json:"name" validate:"required,min=3"`
+	Name        string          `json:"name" validate:"required,min=3"`
 	// описание
-	Description string  `json:"desc"`
+	Description string          `json:"desc"`
 	// id категория
-	Category    int     `json:"category" validate:"required"`
+	Category    int             `json:"category" validate:"required"`
 	// цена
-	Price       float64 `json:"price" validate:"required,gt=0"`
+	Price       Money           `json:"price" validate:"required,gt=0"`
+	// код валюты цены по ISO 4217, по умолчанию api.currency из конфига
+	Currency    string          `json:"currency" validate:"omitempty,len=3,alpha"`
+	// цены в других валютах
+	Prices      []ProductPrice  `json:"prices,omitempty" validate:"dive"`
+	// теги, без учета регистра
+	Tags        []string        `json:"tags,omitempty" validate:"dive,max=50"`
+	// атрибуты, проверяются по схеме атрибутов категории
+	Attributes  JsonObject      `json:"attributes,omitempty"`
+	// изображения в порядке показа
+	Images      []*ProductImage `json:"images,omitempty"`
+	// версия, увеличивается при каждом изменении
+	Version     int             `json:"version"`
+	// время удаления, у неудаленного продукта не задано
+	DeletedAt   *time.Time      `json:"deleted_at,omitempty"`
+	// варианты продукта, заполняются только по запросу с embed=variants
+	Variants    []*Variant      `json:"variants,omitempty"`
+}
+
+// Цена продукта в валюте.
+// swagger:model
+type ProductPrice struct {
+	// код валюты по ISO 4217
+	Currency string `json:"currency" validate:"required,len=3,alpha"`
+	// цена
+	Amount   Money  `json:"amount" validate:"required,gt=0"`
+}
+
+// Привести коды валют продукта к верхнему регистру, пустую валюту цены заменить на currency
+func (p *Product) NormalizeCurrency(currency string) {
+	if p.Currency == "" {
+		p.Currency = currency
+	}
+	p.Currency = strings.ToUpper(p.Currency)
+	for i := range p.Prices {
+		p.Prices[i].Currency = strings.ToUpper(p.Prices[i].Currency)
+	}
+}
+
+// Проверить, что валюты цен не повторяются и не совпадают с валютой основной цены
+func (p *Product) CheckPrices() error {
+	seen := map[string]bool{p.Currency: true}
+	for _, price := range p.Prices {
+		if seen[price.Currency] {
+			return fmt.Errorf("duplicate price currency %q", price.Currency)
+		}
+		seen[price.Currency] = true
+	}
+	return nil
+}
+
+// Выбрать цену продукта в валюте currency: основную или одну из Prices.
+// Выбранная цена становится основной, прежняя основная переходит в Prices.
+// Возвращает false, если цены в этой валюте нет
+func (p *Product) InCurrency(currency string) bool {
+	currency = strings.ToUpper(currency)
+	if p.Currency == currency {
+		return true
+	}
+	for i, price := range p.Prices {
+		if price.Currency == currency {
+			prices := append([]ProductPrice{}, p.Prices...)
+			prices[i] = ProductPrice{Currency: p.Currency, Amount: p.Price}
+			sort.Slice(prices, func(i, j int) bool { return prices[i].Currency < prices[j].Currency })
+			p.Price, p.Currency, p.Prices = price.Amount, price.Currency, prices
+			return true
+		}
+	}
+	return false
+}
+
+// Значение поля продукта, по которому возможна сортировка
+func (p *Product) SortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return p.Id
+	case "name":
+		return p.Name
+	case "category":
+		return p.Category
+	case "price":
+		return p.Price
+	}
+	return nil
 }
@@ -0,0 +1,29 @@
+package model
+
+// Фильтр списка продуктов.
+// Пустые поля не участвуют в фильтрации, заданные объединяются по И
+type ProductFilter struct {
+	// id продуктов
+	Ids []int
+	// id категорий
+	Categories []int
+	// включать продукты всех подкатегорий Categories
+	Recursive bool
+	// валюта цены: продукты без цены в этой валюте не выбираются,
+	// у остальных цена, фильтр и сортировка по цене - в этой валюте
+	Currency string
+	// минимальная цена, включительно
+	MinPrice *Money
+	// максимальная цена, включительно
+	MaxPrice *Money
+	// теги продукта
+	Tags []string
+	// выбирать продукты со всеми тегами Tags, иначе - хотя бы с одним
+	AllTags bool
+	// значения атрибутов продукта по имени атрибута
+	Attributes map[string]string
+	// подстрока названия, без учета регистра
+	Name string
+	// подстрока описания, без учета регистра
+	Description string
+}
@@ -0,0 +1,28 @@
+package model
+
+// Параметры полнотекстового поиска продуктов
+type ProductSearch struct {
+	// поисковый запрос
+	Query string
+	// id категорий, в которых искать
+	Categories []int
+}
+
+// Результат поиска продукта.
+// Продукт с релевантностью и подсвеченными совпадениями
+// swagger:model
+type ProductSearchResult struct {
+	Product
+	// релевантность, чем больше, тем лучше продукт подходит под запрос
+	Rank float64 `json:"rank"`
+	// название и фрагменты описания, в которых найденные слова обернуты в <b></b>
+	Highlights ProductHighlights `json:"highlights"`
+}
+
+// Подсвеченные совпадения в полях продукта
+type ProductHighlights struct {
+	// название
+	Name string `json:"name"`
+	// фрагменты описания
+	Description string `json:"desc"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// Роли пользователей и ключей API
+const (
+	// чтение каталога
+	RoleViewer = "viewer"
+	// чтение и изменение каталога, кроме удаления категорий
+	RoleEditor = "editor"
+	// все права, включая удаление категорий и административные методы
+	RoleAdmin  = "admin"
+)
+
+// Права ролей по умолчанию, используются, если роли не заданы в rbac.roles конфига
+func DefaultRoles() map[string][]string {
+	return map[string][]string{
+		RoleViewer: {ScopeCatalogRead},
+		RoleEditor: {ScopeCatalogRead, ScopeCatalogWrite},
+		RoleAdmin:  {ScopeCatalogRead, ScopeCatalogWrite, ScopeCatalogDelete, ScopeAdmin},
+	}
+}
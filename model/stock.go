@@ -0,0 +1,113 @@
+package model
+
+import "time"
+
+// Остаток продукта.
+// swagger:model
+type Stock struct {
+	// id продукта
+	Product   int `json:"product"`
+	// количество на складе
+	OnHand    int `json:"on_hand"`
+	// количество в действующих резервах
+	Reserved  int `json:"reserved"`
+	// доступное количество: на складе за вычетом резервов
+	Available int `json:"available"`
+}
+
+// Причины изменения остатка
+const (
+	// поступление на склад
+	StockReceipt     = "receipt"
+	// возврат от покупателя
+	StockReturn      = "return"
+	// списание брака
+	StockDamage      = "damage"
+	// недостача
+	StockLoss        = "loss"
+	// корректировка по инвентаризации
+	StockCorrection  = "correction"
+	// продажа по резерву, только при подтверждении резерва
+	StockReserved    = "reservation"
+)
+
+// Причины, с которыми остаток можно изменить вручную
+var StockAdjustmentReasons = []string{StockReceipt, StockReturn, StockDamage, StockLoss, StockCorrection}
+
+// Можно ли изменить остаток вручную с причиной reason
+func ManualAdjustmentReason(reason string) bool {
+	for _, r := range StockAdjustmentReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Изменение остатка.
+// Запись журнала изменений, который только дополняется
+// swagger:model
+type StockAdjustment struct {
+	// id изменения
+	Id        int       `json:"id"`
+	// id продукта
+	Product   int       `json:"product"`
+	// изменение количества, отрицательное - уменьшение
+	Delta     int       `json:"delta" validate:"required"`
+	// причина изменения: receipt, return, damage, loss, correction или reservation
+	Reason    string    `json:"reason" validate:"required"`
+	// комментарий
+	Note      string    `json:"note"`
+	// время изменения
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Статусы резерва
+const (
+	// резерв действует и уменьшает доступное количество
+	ReservationActive    = "active"
+	// резерв подтвержден, количество списано со склада
+	ReservationCommitted = "committed"
+	// резерв отменен
+	ReservationReleased  = "released"
+	// срок резерва истек до подтверждения
+	ReservationExpired   = "expired"
+)
+
+// Резерв продукта.
+// swagger:model
+type StockReservation struct {
+	// id резерва
+	Id        int       `json:"id"`
+	// id продукта
+	Product   int       `json:"product"`
+	// зарезервированное количество
+	Quantity  int       `json:"quantity" validate:"required,gt=0"`
+	// статус: active, committed, released или expired
+	Status    string    `json:"status"`
+	// время, после которого неподтвержденный резерв перестает действовать
+	ExpiresAt time.Time `json:"expires_at"`
+	// время создания
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Действует ли резерв в момент now
+func (r *StockReservation) Active(now time.Time) bool {
+	return r.Status == ReservationActive && r.ExpiresAt.After(now)
+}
+
+// Отметить статусом expired действующий резерв, срок которого к моменту now истек
+func (r *StockReservation) Expire(now time.Time) {
+	if r.Status == ReservationActive && !r.ExpiresAt.After(now) {
+		r.Status = ReservationExpired
+	}
+}
+
+// Значение поля изменения остатка, по которому возможна сортировка
+func (a *StockAdjustment) SortValue(field string) interface{} {
+	switch field {
+	case "id":
+		return a.Id
+	}
+	return nil
+}
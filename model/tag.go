@@ -0,0 +1,50 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// Тег продукта с количеством неудаленных продуктов, у которых он есть.
+// swagger:model
+type Tag struct {
+	// тег
+	Name  string `json:"name"`
+	// количество продуктов с тегом
+	Count int    `json:"count"`
+}
+
+// Привести теги продукта к нижнему регистру, убрать пробелы по краям и повторы, упорядочить
+func (p *Product) NormalizeTags() {
+	if p.Tags == nil {
+		return
+	}
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, tag := range p.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	p.Tags = tags
+}
+
+// Есть ли у продукта теги tags: все, если all, иначе хотя бы один
+func (p *Product) HasTags(tags []string, all bool) bool {
+	n := 0
+	for _, tag := range tags {
+		for _, t := range p.Tags {
+			if t == tag {
+				n++
+				break
+			}
+		}
+	}
+	if all {
+		return n == len(tags)
+	}
+	return n > 0
+}
@@ -0,0 +1,29 @@
+package model
+
+import "context"
+
+type userKey struct{}
+
+type claimsKey struct{}
+
+// Контекст с именем пользователя, от имени которого выполняется запрос
+func ContextWithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// Имя пользователя из контекста, пустое, если не задано
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// Контекст с claims JWT токена, которым аутентифицирован запрос
+func ContextWithClaims(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Claims JWT токена из контекста, nil для запроса без токена
+func ClaimsFromContext(ctx context.Context) map[string]interface{} {
+	claims, _ := ctx.Value(claimsKey{}).(map[string]interface{})
+	return claims
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Вариант продукта.
+// Модификация продукта со своим артикулом, ценой и значениями опций, например размером и цветом
+// swagger:model
+type Variant struct {
+	// id варианта
+	Id        int               `json:"id"`
+	// id продукта
+	Product   int               `json:"product"`
+	// артикул, уникальный среди неудаленных вариантов
+	Sku       string            `json:"sku" validate:"required,max=64"`
+	// цена варианта в валюте продукта, если не задана - действует цена продукта
+	Price     *Money            `json:"price,omitempty" validate:"omitempty,gt=0"`
+	// значения опций варианта, например {"size": "M", "color": "red"}
+	Options   map[string]string `json:"options"`
+	// версия, увеличивается при каждом изменении
+	Version   int               `json:"version"`
+	// время удаления, у неудаленного варианта не задано
+	DeletedAt *time.Time        `json:"deleted_at,omitempty"`
+}
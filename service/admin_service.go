@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"time"
+)
+
+// Как часто обновлять время последнего использования ключа API, чтобы не писать в БД на каждый запрос
+const apiKeyTouchInterval = time.Minute
+
+type AdminService interface {
+	// Получить статистику пула соединений с БД
+	GetDbStats() *model.DbStats
+	// Получить все ключи API, включая отозванные
+	GetApiKeys(ctx context.Context) ([]*model.ApiKey, error)
+	// Создать ключ API. Возвращает сам ключ, он больше нигде не сохраняется. В key записываются id, prefix и created_at
+	CreateApiKey(ctx context.Context, key *model.ApiKey) (string, error)
+	// Отозвать ключ API. Если ключа нет или он уже отозван, возвращает sql.ErrNoRows
+	RevokeApiKey(ctx context.Context, id int) error
+	// Найти действующий ключ API по секрету и отметить его использование. Если ключа нет, он отозван или истек, возвращает nil
+	AuthenticateApiKey(ctx context.Context, secret string) (*model.ApiKey, error)
+}
+
+func NewAdminService(store store.Store) AdminService {
+	return &AdminServiceContext{store: store}
+}
+
+type AdminServiceContext struct {
+	store store.Store
+}
+
+func (asc *AdminServiceContext) GetDbStats() *model.DbStats {
+	return model.NewDbStats(asc.store.Stats())
+}
+
+func (asc *AdminServiceContext) GetApiKeys(ctx context.Context) ([]*model.ApiKey, error) {
+	return asc.store.GetApiKeys(ctx, nil)
+}
+
+func (asc *AdminServiceContext) CreateApiKey(ctx context.Context, key *model.ApiKey) (string, error) {
+	secret, prefix, hash, err := model.NewApiKeySecret()
+	if err != nil {
+		return "", err
+	}
+	key.Prefix = prefix
+	key.Hash = hash
+	if _, err = asc.store.CreateApiKey(ctx, nil, key); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (asc *AdminServiceContext) RevokeApiKey(ctx context.Context, id int) error {
+	return asc.store.RevokeApiKey(ctx, nil, id)
+}
+
+func (asc *AdminServiceContext) AuthenticateApiKey(ctx context.Context, secret string) (*model.ApiKey, error) {
+	key, err := asc.store.GetApiKeyByHash(ctx, nil, model.HashApiKey(secret))
+	if err != nil || key == nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if !key.Active(now) {
+		return nil, nil
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err = asc.store.TouchApiKey(ctx, nil, key.Id, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
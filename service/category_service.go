@@ -1,21 +1,33 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"echo-rest-api/model"
 	"echo-rest-api/store"
 )
 
 type CategoryService interface {
 	// Получить категорию по ид
-	GetCategory(id int) (*model.Category, error)
-	// Получить все категории
-	GetCategories() ([]*model.Category, error)
+	GetCategory(ctx context.Context, id int) (*model.Category, error)
+	// Получить предков категории от корневой до родительской. Если категории нет, возвращает nil
+	GetCategoryAncestors(ctx context.Context, id int) ([]*model.Category, error)
+	// Получить страницу категорий и общее количество категорий
+	GetCategories(ctx context.Context, params *model.ListParams) ([]*model.Category, int, error)
+	// Получить дерево неудаленных категорий, подкатегории упорядочены по названию
+	GetCategoryTree(ctx context.Context) ([]*model.CategoryTree, error)
 	// Создать категорию
-	CreateCategory(category *model.Category) (*int, error)
-	// Обновить категорию
-	UpdateCategory(category *model.Category) error
-	// Удалить категорию
-	DeleteCategory(id int) error
+	CreateCategory(ctx context.Context, category *model.Category) (*int, error)
+	// Обновить категорию, если версия не изменилась (0 - без проверки). В Version записывается новая версия.
+	// Если новый родитель - сама категория или ее подкатегория, возвращает store.ErrCycle
+	UpdateCategory(ctx context.Context, category *model.Category) error
+	// Изменить категорию функцией patch в одной транзакции с чтением текущей категории, если версия не изменилась
+	// (0 - без проверки). Возвращает измененную категорию с новой версией. Если категории нет или она удалена, возвращает sql.ErrNoRows
+	PatchCategory(ctx context.Context, id int, version int, patch model.CategoryPatch) (*model.Category, error)
+	// Пометить удаленной категорию вместе с подкатегориями и их продуктами, если ее версия совпадает с version (0 - без проверки)
+	DeleteCategory(ctx context.Context, id int, version int) error
+	// Восстановить удаленную категорию вместе с подкатегориями и продуктами, удаленными вместе с ней. Возвращает восстановленную запись
+	RestoreCategory(ctx context.Context, id int) (*model.Category, error)
 }
 
 func NewCategoryService(store store.Store) CategoryService {
@@ -26,20 +38,32 @@ type CategoryServiceContext struct {
 	store store.Store
 }
 
-func (csc *CategoryServiceContext) GetCategory(id int) (*model.Category, error) {
-	return csc.store.GetCategory(nil, id)
+func (csc *CategoryServiceContext) GetCategory(ctx context.Context, id int) (*model.Category, error) {
+	return csc.store.GetCategory(ctx, nil, id)
 }
 
-func (csc *CategoryServiceContext) GetCategories() ([]*model.Category, error) {
-	return csc.store.GetCategories(nil)
+func (csc *CategoryServiceContext) GetCategoryAncestors(ctx context.Context, id int) ([]*model.Category, error) {
+	return csc.store.GetCategoryAncestors(ctx, nil, id)
 }
 
-func (csc *CategoryServiceContext) CreateCategory(category *model.Category) (*int, error) {
-	tx, err := csc.store.Begin()
+func (csc *CategoryServiceContext) GetCategories(ctx context.Context, params *model.ListParams) ([]*model.Category, int, error) {
+	return csc.store.GetCategories(ctx, nil, params)
+}
+
+func (csc *CategoryServiceContext) GetCategoryTree(ctx context.Context) ([]*model.CategoryTree, error) {
+	categories, _, err := csc.store.GetCategories(ctx, nil, &model.ListParams{Sort: []model.SortField{{Field: "name"}}})
+	if err != nil {
+		return nil, err
+	}
+	return model.NewCategoryTree(categories), nil
+}
+
+func (csc *CategoryServiceContext) CreateCategory(ctx context.Context, category *model.Category) (*int, error) {
+	tx, err := csc.store.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	cat, err := csc.store.CreateCategory(tx, category)
+	cat, err := csc.store.CreateCategory(ctx, tx, category)
 	if err != nil {
 		csc.store.Rollback(tx)
 		return nil, err
@@ -50,12 +74,12 @@ func (csc *CategoryServiceContext) CreateCategory(category *model.Category) (*in
 	return cat, nil
 }
 
-func (csc *CategoryServiceContext) UpdateCategory(category *model.Category) error {
-	tx, err := csc.store.Begin()
+func (csc *CategoryServiceContext) UpdateCategory(ctx context.Context, category *model.Category) error {
+	tx, err := csc.store.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	err = csc.store.UpdateCategory(tx, category)
+	err = csc.store.UpdateCategory(ctx, tx, category)
 	if err != nil {
 		csc.store.Rollback(tx)
 		return err
@@ -66,12 +90,42 @@ func (csc *CategoryServiceContext) UpdateCategory(category *model.Category) erro
 	return nil
 }
 
-func (csc *CategoryServiceContext) DeleteCategory(id int) error {
-	tx, err := csc.store.Begin()
+func (csc *CategoryServiceContext) PatchCategory(ctx context.Context, id int, version int, patch model.CategoryPatch) (*model.Category, error) {
+	tx, err := csc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := csc.store.GetCategory(ctx, tx, id)
+	if err == nil && (current == nil || current.DeletedAt != nil) {
+		err = sql.ErrNoRows
+	} else if err == nil && version != 0 && version != current.Version {
+		err = store.ErrConflict
+	}
+	var category *model.Category
+	if err == nil {
+		category, err = patch(current)
+	}
+	if err == nil {
+		category.Id = id
+		category.Version = current.Version
+		err = csc.store.UpdateCategory(ctx, tx, category)
+	}
+	if err != nil {
+		csc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = csc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (csc *CategoryServiceContext) DeleteCategory(ctx context.Context, id int, version int) error {
+	tx, err := csc.store.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	err = csc.store.DeleteCategory(tx, id)
+	err = csc.store.DeleteCategory(ctx, tx, id, version)
 	if err != nil {
 		csc.store.Rollback(tx)
 		return err
@@ -81,3 +135,23 @@ func (csc *CategoryServiceContext) DeleteCategory(id int) error {
 	}
 	return nil
 }
+
+func (csc *CategoryServiceContext) RestoreCategory(ctx context.Context, id int) (*model.Category, error) {
+	tx, err := csc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = csc.store.RestoreCategory(ctx, tx, id); err != nil {
+		csc.store.Rollback(tx)
+		return nil, err
+	}
+	res, err := csc.store.GetCategory(ctx, tx, id)
+	if err != nil {
+		csc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = csc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
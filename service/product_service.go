@@ -1,21 +1,74 @@
 package service
 
 import (
+	"context"
+	"database/sql"
 	"echo-rest-api/model"
 	"echo-rest-api/store"
+	"time"
 )
 
 type ProductService interface {
 	// Получить продукт по id
-	GetProduct(id int) (*model.Product, error)
-	// Получить все продукты
-	GetProducts(category *int) ([]*model.Product, error)
+	GetProduct(ctx context.Context, id int) (*model.Product, error)
+	// Получить страницу продуктов, подходящих под фильтр, и общее количество таких продуктов
+	GetProducts(ctx context.Context, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error)
+	// Найти продукты по поисковому запросу и общее количество найденных
+	SearchProducts(ctx context.Context, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error)
 	// Создать продукт
-	CreateProduct(product *model.Product) (*int, error)
-	// Обновить продукт
-	UpdateProduct(product *model.Product) error
-	// Удалить продукт
-	DeleteProduct(id int) error
+	CreateProduct(ctx context.Context, product *model.Product) (*int, error)
+	// Обновить продукт, если версия не изменилась (0 - без проверки). В Version записывается новая версия
+	UpdateProduct(ctx context.Context, product *model.Product) error
+	// Изменить продукт функцией patch в одной транзакции с чтением текущего продукта, если версия не изменилась
+	// (0 - без проверки). Возвращает измененный продукт с новой версией. Если продукта нет или он удален, возвращает sql.ErrNoRows
+	PatchProduct(ctx context.Context, id int, version int, patch model.ProductPatch) (*model.Product, error)
+	// Пометить удаленным продукт вместе с вариантами, если его версия совпадает с version (0 - без проверки)
+	DeleteProduct(ctx context.Context, id int, version int) error
+	// Восстановить удаленный продукт вместе с вариантами, удаленными вместе с ним. Возвращает восстановленную запись
+	RestoreProduct(ctx context.Context, id int) (*model.Product, error)
+	// Получить варианты продукта. Если продукта нет или он удален, возвращает nil
+	GetVariants(ctx context.Context, product int) ([]*model.Variant, error)
+	// Получить вариант продукта. Если варианта нет, он удален или относится к другому продукту, возвращает nil
+	GetVariant(ctx context.Context, product int, id int) (*model.Variant, error)
+	// Создать вариант продукта variant.Product. Если продукта нет или он удален, возвращает sql.ErrNoRows
+	CreateVariant(ctx context.Context, variant *model.Variant) (*int, error)
+	// Обновить вариант продукта variant.Product, если версия не изменилась (0 - без проверки). В Version записывается новая версия
+	UpdateVariant(ctx context.Context, variant *model.Variant) error
+	// Пометить удаленным вариант продукта, если его версия совпадает с version (0 - без проверки)
+	DeleteVariant(ctx context.Context, product int, id int, version int) error
+	// Получить остаток продукта. Если продукта нет или он удален, возвращает nil
+	GetStock(ctx context.Context, product int) (*model.Stock, error)
+	// Изменить остаток продукта adjustment.Product. Если продукта нет или он удален, возвращает sql.ErrNoRows
+	AdjustStock(ctx context.Context, adjustment *model.StockAdjustment) (*int, error)
+	// Получить страницу журнала изменений остатка продукта и общее количество изменений.
+	// Если продукта нет или он удален, возвращает sql.ErrNoRows
+	GetStockAdjustments(ctx context.Context, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error)
+	// Получить резерв продукта. Если резерва нет или он относится к другому продукту, возвращает nil
+	GetReservation(ctx context.Context, product int, id int) (*model.StockReservation, error)
+	// Зарезервировать продукт reservation.Product. Если продукта нет или он удален, возвращает sql.ErrNoRows
+	CreateReservation(ctx context.Context, reservation *model.StockReservation) (*int, error)
+	// Подтвердить резерв продукта, списав количество со склада. Возвращает подтвержденный резерв
+	CommitReservation(ctx context.Context, product int, id int) (*model.StockReservation, error)
+	// Отменить резерв продукта. Возвращает отмененный резерв
+	ReleaseReservation(ctx context.Context, product int, id int) (*model.StockReservation, error)
+	// Получить страницу истории цен продукта и общее количество изменений.
+	// Если продукта нет, возвращает sql.ErrNoRows
+	GetPriceHistory(ctx context.Context, product int, params *model.ListParams) ([]*model.PriceChange, int, error)
+	// Получить продукт с ценами, действовавшими в момент at.
+	// Если продукта нет или в тот момент у него не было цен, возвращает nil
+	GetProductAt(ctx context.Context, id int, at time.Time) (*model.Product, error)
+	// Получить теги неудаленных продуктов с количеством продуктов
+	GetTags(ctx context.Context) ([]*model.Tag, error)
+	// Получить изображения продукта в порядке показа. Если продукта нет или он удален, возвращает nil
+	GetImages(ctx context.Context, product int) ([]*model.ProductImage, error)
+	// Добавить изображение продукта image.Product последним. Если продукта нет или он удален, возвращает sql.ErrNoRows
+	CreateImage(ctx context.Context, image *model.ProductImage) (*int, error)
+	// Удалить изображение продукта. Возвращает удаленное изображение, чтобы удалить его файлы.
+	// Если изображения нет или оно относится к другому продукту, возвращает sql.ErrNoRows
+	DeleteImage(ctx context.Context, product int, id int) (*model.ProductImage, error)
+	// Упорядочить изображения продукта в порядке ids. Возвращает изображения в новом порядке.
+	// Если продукта нет или он удален, возвращает sql.ErrNoRows
+	ReorderImages(ctx context.Context, product int, ids []int) ([]*model.ProductImage, error)
 }
 
 func NewProductService(store store.Store) ProductService {
@@ -26,20 +79,24 @@ type ProductServiceContext struct {
 	store store.Store
 }
 
-func (psc *ProductServiceContext) GetProduct(id int) (*model.Product, error) {
-	return psc.store.GetProduct(nil, id)
+func (psc *ProductServiceContext) GetProduct(ctx context.Context, id int) (*model.Product, error) {
+	return psc.store.GetProduct(ctx, nil, id)
 }
 
-func (psc *ProductServiceContext) GetProducts(category *int) ([]*model.Product, error) {
-	return psc.store.GetProducts(nil, category)
+func (psc *ProductServiceContext) GetProducts(ctx context.Context, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error) {
+	return psc.store.GetProducts(ctx, nil, filter, params)
 }
 
-func (psc *ProductServiceContext) CreateProduct(product *model.Product) (*int, error) {
-	tx, err := psc.store.Begin()
+func (psc *ProductServiceContext) SearchProducts(ctx context.Context, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	return psc.store.SearchProducts(ctx, nil, search, params)
+}
+
+func (psc *ProductServiceContext) CreateProduct(ctx context.Context, product *model.Product) (*int, error) {
+	tx, err := psc.store.Begin(ctx)
 	if err != nil {
 		return nil, err
 	}
-	cat, err := psc.store.CreateProduct(tx, product)
+	cat, err := psc.store.CreateProduct(ctx, tx, product)
 	if err != nil {
 		psc.store.Rollback(tx)
 		return nil, err
@@ -50,12 +107,12 @@ func (psc *ProductServiceContext) CreateProduct(product *model.Product) (*int, e
 	return cat, nil
 }
 
-func (psc *ProductServiceContext) UpdateProduct(product *model.Product) error {
-	tx, err := psc.store.Begin()
+func (psc *ProductServiceContext) UpdateProduct(ctx context.Context, product *model.Product) error {
+	tx, err := psc.store.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	err = psc.store.UpdateProduct(tx, product)
+	err = psc.store.UpdateProduct(ctx, tx, product)
 	if err != nil {
 		psc.store.Rollback(tx)
 		return err
@@ -66,18 +123,377 @@ func (psc *ProductServiceContext) UpdateProduct(product *model.Product) error {
 	return nil
 }
 
-func (psc *ProductServiceContext) DeleteProduct(id int) error {
-	tx, err := psc.store.Begin()
+func (psc *ProductServiceContext) PatchProduct(ctx context.Context, id int, version int, patch model.ProductPatch) (*model.Product, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := psc.store.GetProduct(ctx, tx, id)
+	if err == nil && (current == nil || current.DeletedAt != nil) {
+		err = sql.ErrNoRows
+	} else if err == nil && version != 0 && version != current.Version {
+		err = store.ErrConflict
+	}
+	var product *model.Product
+	if err == nil {
+		product, err = patch(current, func(id int) (*model.Category, error) {
+			return psc.store.GetCategory(ctx, tx, id)
+		})
+	}
+	if err == nil {
+		product.Id = id
+		product.Version = current.Version
+		err = psc.store.UpdateProduct(ctx, tx, product)
+	}
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return product, nil
+}
+
+func (psc *ProductServiceContext) DeleteProduct(ctx context.Context, id int, version int) error {
+	tx, err := psc.store.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	err = psc.store.DeleteProduct(tx, id)
+	err = psc.store.DeleteProduct(ctx, tx, id, version)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (psc *ProductServiceContext) RestoreProduct(ctx context.Context, id int) (*model.Product, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = psc.store.RestoreProduct(ctx, tx, id); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	res, err := psc.store.GetProduct(ctx, tx, id)
 	if err != nil {
 		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (psc *ProductServiceContext) GetVariants(ctx context.Context, product int) ([]*model.Variant, error) {
+	prod, err := psc.store.GetProduct(ctx, nil, product)
+	if err != nil || prod == nil || prod.DeletedAt != nil {
+		return nil, err
+	}
+	return psc.store.GetVariants(ctx, nil, product)
+}
+
+func (psc *ProductServiceContext) GetVariant(ctx context.Context, product int, id int) (*model.Variant, error) {
+	variant, err := psc.store.GetVariant(ctx, nil, id)
+	if err != nil || variant == nil || variant.DeletedAt != nil || variant.Product != product {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// Проверить в транзакции, что вариант id есть, не удален и относится к продукту product
+func (psc *ProductServiceContext) checkVariant(ctx context.Context, tx *sql.Tx, product int, id int) error {
+	variant, err := psc.store.GetVariant(ctx, tx, id)
+	if err != nil {
 		return err
 	}
+	if variant == nil || variant.DeletedAt != nil || variant.Product != product {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (psc *ProductServiceContext) CreateVariant(ctx context.Context, variant *model.Variant) (*int, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	prod, err := psc.store.GetProduct(ctx, tx, variant.Product)
+	if err == nil && (prod == nil || prod.DeletedAt != nil) {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	id, err := psc.store.CreateVariant(ctx, tx, variant)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
 	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (psc *ProductServiceContext) UpdateVariant(ctx context.Context, variant *model.Variant) error {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err = psc.checkVariant(ctx, tx, variant.Product, variant.Id); err != nil {
+		psc.store.Rollback(tx)
+		return err
+	}
+	if err = psc.store.UpdateVariant(ctx, tx, variant); err != nil {
+		psc.store.Rollback(tx)
+		return err
+	}
+	return psc.store.Commit(tx)
+}
+
+func (psc *ProductServiceContext) DeleteVariant(ctx context.Context, product int, id int, version int) error {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	if err = psc.checkVariant(ctx, tx, product, id); err != nil {
+		psc.store.Rollback(tx)
 		return err
 	}
+	if err = psc.store.DeleteVariant(ctx, tx, id, version); err != nil {
+		psc.store.Rollback(tx)
+		return err
+	}
+	return psc.store.Commit(tx)
+}
+
+// Проверить в транзакции, что продукт есть и не удален
+func (psc *ProductServiceContext) checkProduct(ctx context.Context, tx *sql.Tx, id int) error {
+	prod, err := psc.store.GetProduct(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if prod == nil || prod.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
 	return nil
 }
+
+func (psc *ProductServiceContext) GetStock(ctx context.Context, product int) (*model.Stock, error) {
+	prod, err := psc.store.GetProduct(ctx, nil, product)
+	if err != nil || prod == nil || prod.DeletedAt != nil {
+		return nil, err
+	}
+	return psc.store.GetStock(ctx, nil, product)
+}
+
+func (psc *ProductServiceContext) AdjustStock(ctx context.Context, adjustment *model.StockAdjustment) (*int, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = psc.checkProduct(ctx, tx, adjustment.Product); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	id, err := psc.store.AdjustStock(ctx, tx, adjustment)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+func (psc *ProductServiceContext) GetStockAdjustments(ctx context.Context, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error) {
+	if err := psc.checkProduct(ctx, nil, product); err != nil {
+		return nil, 0, err
+	}
+	return psc.store.GetStockAdjustments(ctx, nil, product, params)
+}
+
+func (psc *ProductServiceContext) GetReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	reservation, err := psc.store.GetReservation(ctx, nil, id)
+	if err != nil || reservation == nil || reservation.Product != product {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (psc *ProductServiceContext) CreateReservation(ctx context.Context, reservation *model.StockReservation) (*int, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = psc.checkProduct(ctx, tx, reservation.Product); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	id, err := psc.store.CreateReservation(ctx, tx, reservation)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// Выполнить в транзакции действие над резервом продукта и вернуть измененный резерв
+func (psc *ProductServiceContext) changeReservation(ctx context.Context, product int, id int,
+	change func(ctx context.Context, tx *sql.Tx, id int) error) (*model.StockReservation, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reservation, err := psc.store.GetReservation(ctx, tx, id)
+	if err == nil && (reservation == nil || reservation.Product != product) {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = change(ctx, tx, id)
+	}
+	if err == nil {
+		reservation, err = psc.store.GetReservation(ctx, tx, id)
+	}
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+func (psc *ProductServiceContext) CommitReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	return psc.changeReservation(ctx, product, id, psc.store.CommitReservation)
+}
+
+func (psc *ProductServiceContext) ReleaseReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	return psc.changeReservation(ctx, product, id, psc.store.ReleaseReservation)
+}
+
+func (psc *ProductServiceContext) GetPriceHistory(ctx context.Context, product int, params *model.ListParams) ([]*model.PriceChange, int, error) {
+	prod, err := psc.store.GetProduct(ctx, nil, product)
+	if err != nil {
+		return nil, 0, err
+	}
+	if prod == nil {
+		return nil, 0, sql.ErrNoRows
+	}
+	return psc.store.GetPriceHistory(ctx, nil, product, params)
+}
+
+func (psc *ProductServiceContext) GetProductAt(ctx context.Context, id int, at time.Time) (*model.Product, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer psc.store.Rollback(tx)
+	prod, err := psc.store.GetProduct(ctx, tx, id)
+	if err != nil || prod == nil {
+		return nil, err
+	}
+	history, _, err := psc.store.GetPriceHistory(ctx, tx, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !prod.WithPrices(model.PricesAt(history, prod.PriceMap(), at)) {
+		return nil, nil
+	}
+	return prod, nil
+}
+
+func (psc *ProductServiceContext) GetTags(ctx context.Context) ([]*model.Tag, error) {
+	return psc.store.GetTags(ctx, nil)
+}
+
+func (psc *ProductServiceContext) GetImages(ctx context.Context, product int) ([]*model.ProductImage, error) {
+	prod, err := psc.store.GetProduct(ctx, nil, product)
+	if err != nil || prod == nil || prod.DeletedAt != nil {
+		return nil, err
+	}
+	if prod.Images == nil {
+		return []*model.ProductImage{}, nil
+	}
+	return prod.Images, nil
+}
+
+func (psc *ProductServiceContext) CreateImage(ctx context.Context, image *model.ProductImage) (*int, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = psc.checkProduct(ctx, tx, image.Product); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	id, err := psc.store.CreateImage(ctx, tx, image)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	image.Id = *id
+	return id, nil
+}
+
+func (psc *ProductServiceContext) DeleteImage(ctx context.Context, product int, id int) (*model.ProductImage, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	image, err := psc.store.GetImage(ctx, tx, id)
+	if err == nil && (image == nil || image.Product != product) {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = psc.store.DeleteImage(ctx, tx, id)
+	}
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+func (psc *ProductServiceContext) ReorderImages(ctx context.Context, product int, ids []int) ([]*model.ProductImage, error) {
+	tx, err := psc.store.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = psc.checkProduct(ctx, tx, product); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.ReorderImages(ctx, tx, product, ids); err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	images, err := psc.store.GetImages(ctx, tx, product)
+	if err != nil {
+		psc.store.Rollback(tx)
+		return nil, err
+	}
+	if err = psc.store.Commit(tx); err != nil {
+		return nil, err
+	}
+	return images, nil
+}
@@ -0,0 +1,20 @@
+-- +migrate Up
+CREATE TABLE tag(
+  id   SERIAL,
+  name VARCHAR(50) NOT NULL,
+  constraint tag_pk primary key(id),
+  constraint tag_name_uq unique(name)
+);
+
+CREATE TABLE product_tag(
+  product INTEGER NOT NULL,
+  tag     INTEGER NOT NULL,
+  constraint product_tag_pk primary key(product, tag),
+  constraint product_tag_to_product foreign key (product) references product(id) ON DELETE CASCADE,
+  constraint product_tag_to_tag foreign key (tag) references tag(id) ON DELETE CASCADE
+);
+CREATE INDEX product_tag_tag_idx ON product_tag (tag);
+
+-- +migrate Down
+DROP TABLE product_tag;
+DROP TABLE tag;
@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE category ADD COLUMN attribute_schema JSONB;
+ALTER TABLE product ADD COLUMN attributes JSONB;
+CREATE INDEX product_attributes_idx ON product USING GIN (attributes);
+
+-- +migrate Down
+DROP INDEX product_attributes_idx;
+ALTER TABLE product DROP COLUMN attributes;
+ALTER TABLE category DROP COLUMN attribute_schema;
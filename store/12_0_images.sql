@@ -0,0 +1,14 @@
+-- +migrate Up
+CREATE TABLE product_image(
+  id           SERIAL,
+  product      INTEGER NOT NULL,
+  content_type VARCHAR(50) NOT NULL,
+  position     INTEGER NOT NULL,
+  created_at   TIMESTAMPTZ NOT NULL,
+  constraint product_image_pk primary key(id),
+  constraint product_image_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+CREATE INDEX product_image_product_idx ON product_image (product, position);
+
+-- +migrate Down
+DROP TABLE product_image;
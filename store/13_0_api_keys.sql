@@ -0,0 +1,19 @@
+-- +migrate Up
+CREATE TABLE api_key(
+  id           SERIAL,
+  name         VARCHAR(100) NOT NULL,
+  prefix       VARCHAR(20) NOT NULL,
+  key_hash     CHAR(64) NOT NULL,
+  scopes       TEXT NOT NULL,
+  expires_at   TIMESTAMPTZ,
+  last_used_at TIMESTAMPTZ,
+  created_at   TIMESTAMPTZ NOT NULL,
+  revoked_at   TIMESTAMPTZ,
+  constraint api_key_pk primary key(id),
+  constraint api_key_hash_uq unique(key_hash)
+);
+
+CREATE UNIQUE INDEX api_key_name_idx ON api_key (name) WHERE revoked_at IS NULL;
+
+-- +migrate Down
+DROP TABLE api_key;
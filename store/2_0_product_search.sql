@@ -0,0 +1,10 @@
+-- +migrate Up
+ALTER TABLE product ADD COLUMN search tsvector GENERATED ALWAYS AS (
+  setweight(to_tsvector('simple', name), 'A') || setweight(to_tsvector('simple', description), 'B')
+) STORED;
+
+CREATE INDEX product_search_idx ON product USING GIN (search);
+
+-- +migrate Down
+DROP INDEX product_search_idx;
+ALTER TABLE product DROP COLUMN search;
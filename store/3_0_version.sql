@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE category ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE product ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+-- +migrate Down
+ALTER TABLE product DROP COLUMN version;
+ALTER TABLE category DROP COLUMN version;
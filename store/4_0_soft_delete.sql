@@ -0,0 +1,7 @@
+-- +migrate Up
+ALTER TABLE category ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE product ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- +migrate Down
+ALTER TABLE product DROP COLUMN deleted_at;
+ALTER TABLE category DROP COLUMN deleted_at;
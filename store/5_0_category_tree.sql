@@ -0,0 +1,9 @@
+-- +migrate Up
+ALTER TABLE category ADD COLUMN parent_id INTEGER;
+ALTER TABLE category ADD CONSTRAINT category_to_parent foreign key (parent_id) references category(id) ON DELETE SET NULL;
+CREATE INDEX category_parent_idx ON category (parent_id);
+
+-- +migrate Down
+DROP INDEX category_parent_idx;
+ALTER TABLE category DROP CONSTRAINT category_to_parent;
+ALTER TABLE category DROP COLUMN parent_id;
@@ -0,0 +1,25 @@
+-- +migrate Up
+CREATE TABLE product_variant(
+  id         SERIAL,
+  product    INTEGER NOT NULL,
+  sku        VARCHAR(64) NOT NULL,
+  price      NUMERIC(10,2),
+  version    INTEGER NOT NULL DEFAULT 1,
+  deleted_at TIMESTAMPTZ,
+  constraint product_variant_pk primary key(id),
+  constraint product_variant_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+CREATE INDEX product_variant_product_idx ON product_variant (product);
+CREATE UNIQUE INDEX product_variant_sku_idx ON product_variant (sku) WHERE deleted_at IS NULL;
+
+CREATE TABLE variant_option(
+  variant INTEGER NOT NULL,
+  name    VARCHAR(50) NOT NULL,
+  value   VARCHAR(100) NOT NULL,
+  constraint variant_option_pk primary key(variant, name),
+  constraint variant_option_to_variant foreign key (variant) references product_variant(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE variant_option;
+DROP TABLE product_variant;
@@ -0,0 +1,38 @@
+-- +migrate Up
+CREATE TABLE product_stock(
+  product INTEGER NOT NULL,
+  on_hand INTEGER NOT NULL DEFAULT 0,
+  constraint product_stock_pk primary key(product),
+  constraint product_stock_to_product foreign key (product) references product(id) ON DELETE CASCADE,
+  constraint product_stock_on_hand check (on_hand >= 0)
+);
+
+CREATE TABLE stock_adjustment(
+  id         SERIAL,
+  product    INTEGER NOT NULL,
+  delta      INTEGER NOT NULL,
+  reason     VARCHAR(20) NOT NULL,
+  note       TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL,
+  constraint stock_adjustment_pk primary key(id),
+  constraint stock_adjustment_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+CREATE INDEX stock_adjustment_product_idx ON stock_adjustment (product);
+
+CREATE TABLE stock_reservation(
+  id         SERIAL,
+  product    INTEGER NOT NULL,
+  quantity   INTEGER NOT NULL,
+  status     VARCHAR(20) NOT NULL,
+  expires_at TIMESTAMPTZ NOT NULL,
+  created_at TIMESTAMPTZ NOT NULL,
+  constraint stock_reservation_pk primary key(id),
+  constraint stock_reservation_to_product foreign key (product) references product(id) ON DELETE CASCADE,
+  constraint stock_reservation_quantity check (quantity > 0)
+);
+CREATE INDEX stock_reservation_active_idx ON stock_reservation (product, expires_at) WHERE status = 'active';
+
+-- +migrate Down
+DROP TABLE stock_reservation;
+DROP TABLE stock_adjustment;
+DROP TABLE product_stock;
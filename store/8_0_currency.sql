@@ -0,0 +1,14 @@
+-- +migrate Up
+ALTER TABLE product ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+CREATE TABLE product_price(
+  product  INTEGER NOT NULL,
+  currency CHAR(3) NOT NULL,
+  amount   NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+  constraint product_price_pk primary key(product, currency),
+  constraint product_price_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+-- +migrate Down
+DROP TABLE product_price;
+ALTER TABLE product DROP COLUMN currency;
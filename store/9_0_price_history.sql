@@ -0,0 +1,16 @@
+-- +migrate Up
+CREATE TABLE product_price_history(
+  id         SERIAL,
+  product    INTEGER NOT NULL,
+  currency   CHAR(3) NOT NULL,
+  old_price  NUMERIC(10,2),
+  new_price  NUMERIC(10,2),
+  changed_at TIMESTAMPTZ NOT NULL,
+  changed_by VARCHAR(100) NOT NULL DEFAULT '',
+  constraint product_price_history_pk primary key(id),
+  constraint product_price_history_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+CREATE INDEX product_price_history_product_idx ON product_price_history (product, changed_at);
+
+-- +migrate Down
+DROP TABLE product_price_history;
@@ -0,0 +1,34 @@
+package store
+
+import (
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Коды ошибок postgresql о нарушении ограничений
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+)
+
+// Привести ошибку нарушения ограничения БД к ошибке стореджа: уникальность - ErrDuplicate,
+// внешний ключ - ErrForeignKey. Остальные ошибки возвращаются как есть
+func constraintError(err error) error {
+	switch e := err.(type) {
+	case *pq.Error:
+		switch e.Code {
+		case pgUniqueViolation:
+			return ErrDuplicate
+		case pgForeignKeyViolation:
+			return ErrForeignKey
+		}
+	case sqlite3.Error:
+		switch e.ExtendedCode {
+		case sqlite3.ErrConstraintUnique, sqlite3.ErrConstraintPrimaryKey:
+			return ErrDuplicate
+		case sqlite3.ErrConstraintForeignKey:
+			return ErrForeignKey
+		}
+	}
+	return err
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"errors"
+	"github.com/nfnt/resize"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Качество jpeg миниатюр
+const thumbnailQuality = 85
+
+// Изображение больше images.maxpixels пикселей
+var ErrImageTooLarge = errors.New("image has too many pixels")
+
+// Файлы изображений продуктов в локальном каталоге images.dir из конфига.
+// Файлы продукта лежат в подкаталоге с его id, поэтому удаляются вместе с ним
+type ImageFiles struct {
+	dir       string
+	sizes     []int
+	maxPixels int64
+}
+
+// Создать хранилище файлов изображений по настройкам images из конфига
+func NewImageFiles(conf *config.Config) *ImageFiles {
+	return &ImageFiles{dir: conf.Images.Dir, sizes: conf.Images.ThumbnailSizes, maxPixels: conf.Images.MaxPixels}
+}
+
+// Каталог изображений
+func (f *ImageFiles) Dir() string {
+	return f.dir
+}
+
+// Размеры миниатюр
+func (f *ImageFiles) Sizes() []int {
+	return f.sizes
+}
+
+// Проверить размер изображения по заголовку, не декодируя его: больше images.maxpixels пикселей - ErrImageTooLarge
+func (f *ImageFiles) CheckSize(cfg image.Config) error {
+	if f.maxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > f.maxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// Сохранить оригинал изображения и его миниатюры. Если сохранить не удалось, уже записанные файлы удаляются.
+// Размер изображения проверяется до декодирования
+func (f *ImageFiles) Save(img *model.ProductImage, data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err = f.CheckSize(cfg); err != nil {
+		return err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Join(f.dir, strconv.Itoa(img.Product)), 0755); err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(f.dir, img.File()), data, 0644); err != nil {
+		f.Remove(img)
+		return err
+	}
+	for _, size := range f.sizes {
+		if err = f.saveThumbnail(img, src, size); err != nil {
+			f.Remove(img)
+			return err
+		}
+	}
+	return nil
+}
+
+// Сохранить миниатюру, вписанную в квадрат size x size. Меньшие изображения не увеличиваются
+func (f *ImageFiles) saveThumbnail(img *model.ProductImage, src image.Image, size int) error {
+	thumbnail := resize.Thumbnail(uint(size), uint(size), src, resize.Lanczos3)
+	file, err := os.Create(filepath.Join(f.dir, img.ThumbnailFile(size)))
+	if err != nil {
+		return err
+	}
+	if img.ContentType == "image/jpeg" {
+		err = jpeg.Encode(file, thumbnail, &jpeg.Options{Quality: thumbnailQuality})
+	} else {
+		err = png.Encode(file, thumbnail)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Удалить файлы изображения и его миниатюр
+func (f *ImageFiles) Remove(img *model.ProductImage) error {
+	files := []string{img.File()}
+	for _, size := range f.sizes {
+		files = append(files, img.ThumbnailFile(size))
+	}
+	var res error
+	for _, file := range files {
+		if err := os.Remove(filepath.Join(f.dir, file)); err != nil && !os.IsNotExist(err) {
+			res = err
+		}
+	}
+	return res
+}
+
+// Удалить каталоги изображений продуктов, которых больше нет в сторедже, например после purge.
+// Возвращает количество удаленных каталогов
+func (f *ImageFiles) Purge(ctx context.Context, s Store) (int, error) {
+	entries, err := ioutil.ReadDir(f.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, entry := range entries {
+		id, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		product, err := s.GetProduct(ctx, nil, id)
+		if err != nil {
+			return purged, err
+		}
+		if product != nil {
+			continue
+		}
+		if err = os.RemoveAll(filepath.Join(f.dir, entry.Name())); err != nil {
+			return purged, err
+		}
+		purged++
+	}
+	return purged, nil
+}
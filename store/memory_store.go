@@ -0,0 +1,1459 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/model"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Данные стореджа в памяти
+type memoryData struct {
+	categories     map[int]model.Category
+	products       map[int]model.Product
+	variants       map[int]model.Variant
+	stock          map[int]int
+	adjustments    map[int]model.StockAdjustment
+	reservations   map[int]model.StockReservation
+	priceHistory   map[int]model.PriceChange
+	images         map[int]model.ProductImage
+	apiKeys        map[int]model.ApiKey
+	categorySeq    int
+	productSeq     int
+	variantSeq     int
+	adjustmentSeq  int
+	reservationSeq int
+	priceChangeSeq int
+	imageSeq       int
+	apiKeySeq      int
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		categories:   map[int]model.Category{},
+		products:     map[int]model.Product{},
+		variants:     map[int]model.Variant{},
+		stock:        map[int]int{},
+		adjustments:  map[int]model.StockAdjustment{},
+		reservations: map[int]model.StockReservation{},
+		priceHistory: map[int]model.PriceChange{},
+		images:       map[int]model.ProductImage{},
+		apiKeys:      map[int]model.ApiKey{},
+	}
+}
+
+// Копия данных, изменения в которой не затрагивают оригинал
+func (md *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	for id, category := range md.categories {
+		c.categories[id] = category
+	}
+	for id, product := range md.products {
+		c.products[id] = product
+	}
+	for id, variant := range md.variants {
+		c.variants[id] = variant
+	}
+	for product, onHand := range md.stock {
+		c.stock[product] = onHand
+	}
+	for id, adjustment := range md.adjustments {
+		c.adjustments[id] = adjustment
+	}
+	for id, reservation := range md.reservations {
+		c.reservations[id] = reservation
+	}
+	for id, change := range md.priceHistory {
+		c.priceHistory[id] = change
+	}
+	for id, image := range md.images {
+		c.images[id] = image
+	}
+	for id, key := range md.apiKeys {
+		c.apiKeys[id] = key
+	}
+	c.categorySeq = md.categorySeq
+	c.productSeq = md.productSeq
+	c.variantSeq = md.variantSeq
+	c.adjustmentSeq = md.adjustmentSeq
+	c.reservationSeq = md.reservationSeq
+	c.priceChangeSeq = md.priceChangeSeq
+	c.imageSeq = md.imageSeq
+	c.apiKeySeq = md.apiKeySeq
+	return c
+}
+
+// Контекст стореджа в памяти.
+// Транзакция - это копия данных, которая при коммите заменяет основные данные,
+// а при откате отбрасывается. *sql.Tx используется только как идентификатор транзакции.
+// Транзакции выполняются по одной, запись без транзакции ждет завершения открытой транзакции,
+// иначе коммит заменил бы данные, записанные после ее начала
+type MemoryStoreContext struct {
+	mu    sync.Mutex
+	data  *memoryData
+	txs   map[*sql.Tx]*memoryData
+	// занят, пока открыта транзакция или выполняется запись без транзакции
+	write chan struct{}
+}
+
+// Создать сторедж в памяти
+func NewMemoryStore() Store {
+	return &MemoryStoreContext{
+		data:  newMemoryData(),
+		txs:   map[*sql.Tx]*memoryData{},
+		write: make(chan struct{}, 1),
+	}
+}
+
+// Дождаться права записи. Если контекст отменен раньше, возвращает его ошибку
+func (msc *MemoryStoreContext) acquire(ctx context.Context) error {
+	select {
+	case msc.write <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Заблокировать запись без транзакции до завершения открытой транзакции. Возвращает функцию снятия блокировки.
+// Запись в транзакции не блокируется: транзакция уже владеет правом записи. Если контекст отменен,
+// блокировка не берется, ошибку контекста вернет dataFor
+func (msc *MemoryStoreContext) lockWrite(ctx context.Context, tx *sql.Tx) func() {
+	if tx != nil || msc.acquire(ctx) != nil {
+		return func() {}
+	}
+	return func() { <-msc.write }
+}
+
+// Данные, с которыми работает запрос: транзакции, если она указана, иначе основные.
+// Если контекст запроса уже отменен, возвращает его ошибку
+func (msc *MemoryStoreContext) dataFor(ctx context.Context, tx *sql.Tx) (*memoryData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return msc.data, nil
+	}
+	data, ok := msc.txs[tx]
+	if !ok {
+		return nil, sql.ErrTxDone
+	}
+	return data, nil
+}
+
+// Границы страницы в отсортированном списке из total записей
+func pageBounds(total int, params *model.ListParams) (int, int) {
+	if params == nil || params.Limit <= 0 {
+		return 0, total
+	}
+	from := params.Offset
+	if params.After != nil {
+		from = 0
+	}
+	if from > total {
+		from = total
+	}
+	to := from + params.Limit
+	if to > total {
+		to = total
+	}
+	return from, to
+}
+
+// Запись, которую можно сортировать
+type sortable interface {
+	SortValue(field string) interface{}
+}
+
+// Значения полей сортировки записи
+func keyValues(keys []model.SortField, item sortable) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = item.SortValue(key.Field)
+	}
+	return values
+}
+
+// Значения полей сортировки из курсора
+func cursorValues(params *model.ListParams) ([]interface{}, error) {
+	if len(params.After.Values) != len(params.Sort) {
+		return nil, fmt.Errorf("cursor does not match sort %q", model.SortString(params.Sort))
+	}
+	return append(append([]interface{}{}, params.After.Values...), params.After.Id), nil
+}
+
+// Привести число к float64, значения из курсора после json всегда float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case model.Money:
+		return n.Float64(), true
+	}
+	return 0, false
+}
+
+// Сравнить значения полей: числа как числа, остальное как строки
+func compareValues(a, b interface{}) int {
+	if fa, ok := toFloat(a); ok {
+		if fb, ok := toFloat(b); ok {
+			switch {
+			case fa < fb:
+				return -1
+			case fa > fb:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// Сравнить наборы значений полей сортировки с учетом направления
+func compareKeys(keys []model.SortField, a, b []interface{}) int {
+	for i, key := range keys {
+		if c := compareValues(a[i], b[i]); c != 0 {
+			if key.Desc {
+				return -c
+			}
+			return c
+		}
+	}
+	return 0
+}
+
+// Содержит ли список значение
+func containsInt(values []int, v int) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Скрыта ли из списка запись, удаленная в deletedAt
+func hidden(params *model.ListParams, deletedAt *time.Time) bool {
+	return deletedAt != nil && (params == nil || !params.IncludeDeleted)
+}
+
+// id категорий ids и всех их подкатегорий
+func (md *memoryData) subtree(ids []int) []int {
+	res := append([]int{}, ids...)
+	for i := 0; i < len(res); i++ {
+		for id, category := range md.categories {
+			if category.ParentId != nil && *category.ParentId == res[i] && !containsInt(res, id) {
+				res = append(res, id)
+			}
+		}
+	}
+	return res
+}
+
+// Проверить категорию, в которую записывается запись: ErrForeignKey, если ее нет, ErrCategoryDeleted, если она удалена
+func (md *memoryData) liveCategory(id int) error {
+	category, ok := md.categories[id]
+	if !ok {
+		return ErrForeignKey
+	}
+	if category.DeletedAt != nil {
+		return ErrCategoryDeleted
+	}
+	return nil
+}
+
+// Подходит ли продукт под фильтр
+func productMatches(filter *model.ProductFilter, product *model.Product) bool {
+	if filter == nil {
+		return true
+	}
+	if len(filter.Ids) > 0 && !containsInt(filter.Ids, product.Id) {
+		return false
+	}
+	if len(filter.Categories) > 0 && !containsInt(filter.Categories, product.Category) {
+		return false
+	}
+	if filter.Currency != "" && !product.InCurrency(filter.Currency) {
+		return false
+	}
+	if filter.MinPrice != nil && product.Price < *filter.MinPrice {
+		return false
+	}
+	if filter.MaxPrice != nil && product.Price > *filter.MaxPrice {
+		return false
+	}
+	if len(filter.Tags) > 0 && !product.HasTags(filter.Tags, filter.AllTags) {
+		return false
+	}
+	if len(filter.Attributes) > 0 && !product.HasAttributes(filter.Attributes) {
+		return false
+	}
+	if filter.Name != "" && !strings.Contains(strings.ToLower(product.Name), strings.ToLower(filter.Name)) {
+		return false
+	}
+	if filter.Description != "" && !strings.Contains(strings.ToLower(product.Description), strings.ToLower(filter.Description)) {
+		return false
+	}
+	return true
+}
+
+// Статистика пула соединений: у стореджа в памяти соединений нет
+func (msc *MemoryStoreContext) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+// Закрыть сторедж
+func (msc *MemoryStoreContext) Close() error {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	// открытая транзакция отбрасывается вместе с правом записи
+	if len(msc.txs) > 0 {
+		<-msc.write
+	}
+	msc.txs = map[*sql.Tx]*memoryData{}
+	return nil
+}
+
+// Начать транзакцию
+func (msc *MemoryStoreContext) Begin(ctx context.Context) (*sql.Tx, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := msc.acquire(ctx); err != nil {
+		return nil, err
+	}
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	tx := new(sql.Tx)
+	msc.txs[tx] = msc.data.clone()
+	return tx, nil
+}
+
+// Закомитить транзакцию
+func (msc *MemoryStoreContext) Commit(tx *sql.Tx) error {
+	if tx == nil {
+		return errors.New("tx is nil")
+	}
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, ok := msc.txs[tx]
+	if !ok {
+		return sql.ErrTxDone
+	}
+	delete(msc.txs, tx)
+	msc.data = data
+	<-msc.write
+	return nil
+}
+
+// Откатить транзакцию
+func (msc *MemoryStoreContext) Rollback(tx *sql.Tx) error {
+	if tx == nil {
+		return errors.New("tx is nil")
+	}
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	if _, ok := msc.txs[tx]; !ok {
+		return sql.ErrTxDone
+	}
+	delete(msc.txs, tx)
+	<-msc.write
+	return nil
+}
+
+// Получить категорию по id
+func (msc *MemoryStoreContext) GetCategory(ctx context.Context, tx *sql.Tx, id int) (*model.Category, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	category, ok := data.categories[id]
+	if !ok {
+		return nil, nil
+	}
+	return &category, nil
+}
+
+// Получить предков категории от корневой до родительской
+func (msc *MemoryStoreContext) GetCategoryAncestors(ctx context.Context, tx *sql.Tx, id int) ([]*model.Category, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	category, ok := data.categories[id]
+	if !ok {
+		return nil, nil
+	}
+	ancestors := []*model.Category{}
+	for category.ParentId != nil {
+		parent, ok := data.categories[*category.ParentId]
+		if !ok {
+			break
+		}
+		ancestors = append([]*model.Category{&parent}, ancestors...)
+		category = parent
+	}
+	return ancestors, nil
+}
+
+// Получить страницу категорий и общее количество категорий
+func (msc *MemoryStoreContext) GetCategories(ctx context.Context, tx *sql.Tx, params *model.ListParams) ([]*model.Category, int, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkSort(params, model.CategorySortFields); err != nil {
+		return nil, 0, err
+	}
+	var categories []*model.Category
+	for _, category := range data.categories {
+		if hidden(params, category.DeletedAt) {
+			continue
+		}
+		category := category
+		categories = append(categories, &category)
+	}
+	keys := sortKeys(params)
+	sort.Slice(categories, func(i, j int) bool {
+		return compareKeys(keys, keyValues(keys, categories[i]), keyValues(keys, categories[j])) < 0
+	})
+	total := len(categories)
+	if params != nil && params.After != nil {
+		after, err := cursorValues(params)
+		if err != nil {
+			return nil, 0, err
+		}
+		categories = categories[sort.Search(len(categories), func(i int) bool {
+			return compareKeys(keys, keyValues(keys, categories[i]), after) > 0
+		}):]
+	}
+	from, to := pageBounds(len(categories), params)
+	return categories[from:to], total, nil
+}
+
+// Создать категорию
+func (msc *MemoryStoreContext) CreateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if category.ParentId != nil {
+		if err := data.liveCategory(*category.ParentId); err != nil {
+			return nil, err
+		}
+	}
+	data.categorySeq++
+	id := data.categorySeq
+	data.categories[id] = model.Category{Id: id, Name: category.Name, ParentId: category.ParentId, AttributeSchema: category.AttributeSchema, Version: 1}
+	category.Version = 1
+	return &id, nil
+}
+
+// Обновить категорию
+func (msc *MemoryStoreContext) UpdateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.categories[category.Id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if category.Version != 0 && category.Version != current.Version {
+		return ErrConflict
+	}
+	if category.ParentId != nil {
+		if _, ok := data.categories[*category.ParentId]; !ok {
+			return ErrForeignKey
+		}
+		if containsInt(data.subtree([]int{category.Id}), *category.ParentId) {
+			return ErrCycle
+		}
+		if err := data.liveCategory(*category.ParentId); err != nil {
+			return err
+		}
+	}
+	category.Version = current.Version + 1
+	data.categories[category.Id] = *category
+	return nil
+}
+
+// Пометить удаленной категорию вместе с ее подкатегориями и их продуктами
+func (msc *MemoryStoreContext) DeleteCategory(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.categories[id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != current.Version {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	subtree := data.subtree([]int{id})
+	for _, categoryId := range subtree {
+		category := data.categories[categoryId]
+		if category.DeletedAt == nil {
+			category.DeletedAt = &now
+			category.Version++
+			data.categories[categoryId] = category
+		}
+	}
+	for productId, product := range data.products {
+		if containsInt(subtree, product.Category) && product.DeletedAt == nil {
+			product.DeletedAt = &now
+			product.Version++
+			data.products[productId] = product
+		}
+	}
+	for variantId, variant := range data.variants {
+		if containsInt(subtree, data.products[variant.Product].Category) && variant.DeletedAt == nil {
+			variant.DeletedAt = &now
+			variant.Version++
+			data.variants[variantId] = variant
+		}
+	}
+	return nil
+}
+
+// Восстановить удаленную категорию вместе с подкатегориями и продуктами, удаленными вместе с ней или после нее
+func (msc *MemoryStoreContext) RestoreCategory(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.categories[id]
+	if !ok || current.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+	if current.ParentId != nil {
+		if err := data.liveCategory(*current.ParentId); err != nil {
+			return err
+		}
+	}
+	subtree := data.subtree([]int{id})
+	for variantId, variant := range data.variants {
+		if containsInt(subtree, data.products[variant.Product].Category) && variant.DeletedAt != nil && !variant.DeletedAt.Before(*current.DeletedAt) {
+			variant.DeletedAt = nil
+			variant.Version++
+			data.variants[variantId] = variant
+		}
+	}
+	for productId, product := range data.products {
+		if containsInt(subtree, product.Category) && product.DeletedAt != nil && !product.DeletedAt.Before(*current.DeletedAt) {
+			product.DeletedAt = nil
+			product.Version++
+			data.products[productId] = product
+		}
+	}
+	for _, categoryId := range subtree[1:] {
+		category := data.categories[categoryId]
+		if category.DeletedAt != nil && !category.DeletedAt.Before(*current.DeletedAt) {
+			category.DeletedAt = nil
+			category.Version++
+			data.categories[categoryId] = category
+		}
+	}
+	current.DeletedAt = nil
+	current.Version++
+	data.categories[id] = current
+	return nil
+}
+
+// Копия продукта, не разделяющая с ним цены и теги. Цены упорядочены по валюте
+func copyProduct(product model.Product) *model.Product {
+	product.Prices = append([]model.ProductPrice(nil), product.Prices...)
+	product.Tags = append([]string(nil), product.Tags...)
+	// изображения хранятся отдельно от продукта
+	product.Images = nil
+	sort.Strings(product.Tags)
+	sort.Slice(product.Prices, func(i, j int) bool { return product.Prices[i].Currency < product.Prices[j].Currency })
+	return &product
+}
+
+// Получить продукт по id
+func (msc *MemoryStoreContext) GetProduct(ctx context.Context, tx *sql.Tx, id int) (*model.Product, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	product, ok := data.products[id]
+	if !ok {
+		return nil, nil
+	}
+	product.Images = data.productImages(id)
+	return &product, nil
+}
+
+// Получить страницу продуктов, подходящих под фильтр, и общее количество таких продуктов
+func (msc *MemoryStoreContext) GetProducts(ctx context.Context, tx *sql.Tx, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkSort(params, model.ProductSortFields); err != nil {
+		return nil, 0, err
+	}
+	if filter != nil && filter.Recursive && len(filter.Categories) > 0 {
+		f := *filter
+		f.Categories = data.subtree(filter.Categories)
+		filter = &f
+	}
+	var products []*model.Product
+	for _, product := range data.products {
+		product := product
+		// productMatches выбирает цену в валюте фильтра
+		if hidden(params, product.DeletedAt) || !productMatches(filter, &product) {
+			continue
+		}
+		products = append(products, &product)
+	}
+	keys := sortKeys(params)
+	sort.Slice(products, func(i, j int) bool {
+		return compareKeys(keys, keyValues(keys, products[i]), keyValues(keys, products[j])) < 0
+	})
+	total := len(products)
+	if params != nil && params.After != nil {
+		after, err := cursorValues(params)
+		if err != nil {
+			return nil, 0, err
+		}
+		products = products[sort.Search(len(products), func(i int) bool {
+			return compareKeys(keys, keyValues(keys, products[i]), after) > 0
+		}):]
+	}
+	from, to := pageBounds(len(products), params)
+	for _, product := range products[from:to] {
+		product.Images = data.productImages(product.Id)
+	}
+	return products[from:to], total, nil
+}
+
+// Найти продукты по поисковому запросу с упрощенным подсчетом релевантности
+func (msc *MemoryStoreContext) SearchProducts(ctx context.Context, tx *sql.Tx, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	pattern := searchPattern(search.Query)
+	var results []*model.ProductSearchResult
+	for _, product := range data.products {
+		if product.DeletedAt != nil {
+			continue
+		}
+		product := product
+		if r := matchProduct(pattern, search, &product); r != nil {
+			r.Images = data.productImages(product.Id)
+			results = append(results, r)
+		}
+	}
+	return searchPage(results, params), len(results), nil
+}
+
+// Создать продукт
+func (msc *MemoryStoreContext) CreateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := data.liveCategory(product.Category); err != nil {
+		return nil, err
+	}
+	data.productSeq++
+	id := data.productSeq
+	product.Version = 1
+	p := copyProduct(*product)
+	p.Id = id
+	data.products[id] = *p
+	data.savePriceChanges(ctx, model.PriceChanges(id, nil, p.PriceMap()))
+	return &id, nil
+}
+
+// Обновить продукт
+func (msc *MemoryStoreContext) UpdateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.products[product.Id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if product.Version != 0 && product.Version != current.Version {
+		return ErrConflict
+	}
+	if err := data.liveCategory(product.Category); err != nil {
+		return err
+	}
+	product.Version = current.Version + 1
+	data.products[product.Id] = *copyProduct(*product)
+	data.savePriceChanges(ctx, model.PriceChanges(product.Id, current.PriceMap(), product.PriceMap()))
+	return nil
+}
+
+// Пометить удаленным продукт вместе с его вариантами
+func (msc *MemoryStoreContext) DeleteProduct(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.products[id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != current.Version {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	current.DeletedAt = &now
+	current.Version++
+	data.products[id] = current
+	for variantId, variant := range data.variants {
+		if variant.Product == id && variant.DeletedAt == nil {
+			variant.DeletedAt = &now
+			variant.Version++
+			data.variants[variantId] = variant
+		}
+	}
+	return nil
+}
+
+// Восстановить удаленный продукт вместе с вариантами, удаленными вместе с ним или после него
+func (msc *MemoryStoreContext) RestoreProduct(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.products[id]
+	if !ok || current.DeletedAt == nil {
+		return sql.ErrNoRows
+	}
+	if err := data.liveCategory(current.Category); err != nil {
+		return err
+	}
+	for variantId, variant := range data.variants {
+		if variant.Product == id && variant.DeletedAt != nil && !variant.DeletedAt.Before(*current.DeletedAt) {
+			variant.DeletedAt = nil
+			variant.Version++
+			data.variants[variantId] = variant
+		}
+	}
+	current.DeletedAt = nil
+	current.Version++
+	data.products[id] = current
+	return nil
+}
+
+// Копия варианта с отдельной копией опций
+func copyVariant(variant model.Variant) *model.Variant {
+	options := make(map[string]string, len(variant.Options))
+	for name, value := range variant.Options {
+		options[name] = value
+	}
+	variant.Options = options
+	return &variant
+}
+
+// Проверить, что артикул варианта не занят другим неудаленным вариантом
+func (md *memoryData) checkSku(variant *model.Variant) error {
+	for id, v := range md.variants {
+		if id != variant.Id && v.DeletedAt == nil && v.Sku == variant.Sku {
+			return ErrDuplicate
+		}
+	}
+	return nil
+}
+
+// Получить вариант продукта по id
+func (msc *MemoryStoreContext) GetVariant(ctx context.Context, tx *sql.Tx, id int) (*model.Variant, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	variant, ok := data.variants[id]
+	if !ok {
+		return nil, nil
+	}
+	return copyVariant(variant), nil
+}
+
+// Получить неудаленные варианты продукта
+func (msc *MemoryStoreContext) GetVariants(ctx context.Context, tx *sql.Tx, product int) ([]*model.Variant, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	variants := []*model.Variant{}
+	for _, variant := range data.variants {
+		if variant.Product == product && variant.DeletedAt == nil {
+			variants = append(variants, copyVariant(variant))
+		}
+	}
+	sort.Slice(variants, func(i, j int) bool {
+		return variants[i].Id < variants[j].Id
+	})
+	return variants, nil
+}
+
+// Создать вариант продукта
+func (msc *MemoryStoreContext) CreateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := data.products[variant.Product]; !ok {
+		return nil, ErrForeignKey
+	}
+	if err := data.checkSku(variant); err != nil {
+		return nil, err
+	}
+	data.variantSeq++
+	id := data.variantSeq
+	variant.Version = 1
+	v := copyVariant(*variant)
+	v.Id = id
+	data.variants[id] = *v
+	return &id, nil
+}
+
+// Обновить вариант продукта
+func (msc *MemoryStoreContext) UpdateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if err := data.checkSku(variant); err != nil {
+		return err
+	}
+	current, ok := data.variants[variant.Id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if variant.Version != 0 && variant.Version != current.Version {
+		return ErrConflict
+	}
+	variant.Version = current.Version + 1
+	v := copyVariant(*variant)
+	v.Product = current.Product
+	data.variants[variant.Id] = *v
+	return nil
+}
+
+// Пометить удаленным вариант продукта
+func (msc *MemoryStoreContext) DeleteVariant(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	current, ok := data.variants[id]
+	if !ok || current.DeletedAt != nil {
+		return sql.ErrNoRows
+	}
+	if version != 0 && version != current.Version {
+		return ErrConflict
+	}
+	now := time.Now().UTC()
+	current.DeletedAt = &now
+	current.Version++
+	data.variants[id] = current
+	return nil
+}
+
+// Количество продукта в действующих на момент now резервах
+func (md *memoryData) reserved(product int, now time.Time) int {
+	reserved := 0
+	for _, reservation := range md.reservations {
+		if reservation.Product == product && reservation.Active(now) {
+			reserved += reservation.Quantity
+		}
+	}
+	return reserved
+}
+
+// Записать изменение в журнал и изменить количество на складе
+func (md *memoryData) adjust(adjustment *model.StockAdjustment, now time.Time) *int {
+	md.adjustmentSeq++
+	id := md.adjustmentSeq
+	adjustment.CreatedAt = now
+	a := *adjustment
+	a.Id = id
+	md.adjustments[id] = a
+	md.stock[adjustment.Product] += adjustment.Delta
+	return &id
+}
+
+// Получить остаток продукта
+func (msc *MemoryStoreContext) GetStock(ctx context.Context, tx *sql.Tx, product int) (*model.Stock, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	onHand := data.stock[product]
+	reserved := data.reserved(product, time.Now().UTC())
+	return &model.Stock{Product: product, OnHand: onHand, Reserved: reserved, Available: onHand - reserved}, nil
+}
+
+// Изменить количество продукта на складе
+func (msc *MemoryStoreContext) AdjustStock(ctx context.Context, tx *sql.Tx, adjustment *model.StockAdjustment) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := data.products[adjustment.Product]; !ok {
+		return nil, ErrForeignKey
+	}
+	now := time.Now().UTC()
+	// уменьшить можно только доступное количество, иначе действующие резервы нельзя будет подтвердить
+	if adjustment.Delta < 0 && data.stock[adjustment.Product]-data.reserved(adjustment.Product, now)+adjustment.Delta < 0 {
+		return nil, ErrInsufficientStock
+	}
+	return data.adjust(adjustment, now), nil
+}
+
+// Получить страницу журнала изменений остатка продукта и общее количество изменений
+func (msc *MemoryStoreContext) GetStockAdjustments(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkSort(params, model.StockAdjustmentSortFields); err != nil {
+		return nil, 0, err
+	}
+	var adjustments []*model.StockAdjustment
+	for _, adjustment := range data.adjustments {
+		if adjustment.Product != product {
+			continue
+		}
+		adjustment := adjustment
+		adjustments = append(adjustments, &adjustment)
+	}
+	keys := sortKeys(params)
+	sort.Slice(adjustments, func(i, j int) bool {
+		return compareKeys(keys, keyValues(keys, adjustments[i]), keyValues(keys, adjustments[j])) < 0
+	})
+	total := len(adjustments)
+	if params != nil && params.After != nil {
+		after, err := cursorValues(params)
+		if err != nil {
+			return nil, 0, err
+		}
+		adjustments = adjustments[sort.Search(len(adjustments), func(i int) bool {
+			return compareKeys(keys, keyValues(keys, adjustments[i]), after) > 0
+		}):]
+	}
+	from, to := pageBounds(len(adjustments), params)
+	return adjustments[from:to], total, nil
+}
+
+// Получить теги неудаленных продуктов с количеством продуктов
+func (msc *MemoryStoreContext) GetTags(ctx context.Context, tx *sql.Tx) ([]*model.Tag, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, product := range data.products {
+		if product.DeletedAt != nil {
+			continue
+		}
+		for _, tag := range product.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []*model.Tag{}
+	for name, count := range counts {
+		tags = append(tags, &model.Tag{Name: name, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+// Изображения продукта в порядке показа
+func (md *memoryData) productImages(product int) []*model.ProductImage {
+	var images []*model.ProductImage
+	for _, image := range md.images {
+		if image.Product == product {
+			image := image
+			images = append(images, &image)
+		}
+	}
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].Position != images[j].Position {
+			return images[i].Position < images[j].Position
+		}
+		return images[i].Id < images[j].Id
+	})
+	return images
+}
+
+// Получить изображения продукта в порядке показа
+func (msc *MemoryStoreContext) GetImages(ctx context.Context, tx *sql.Tx, product int) ([]*model.ProductImage, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	return data.productImages(product), nil
+}
+
+// Получить изображение по id
+func (msc *MemoryStoreContext) GetImage(ctx context.Context, tx *sql.Tx, id int) (*model.ProductImage, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	image, ok := data.images[id]
+	if !ok {
+		return nil, nil
+	}
+	return &image, nil
+}
+
+// Добавить изображение продукта последним
+func (msc *MemoryStoreContext) CreateImage(ctx context.Context, tx *sql.Tx, image *model.ProductImage) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := data.products[image.Product]; !ok {
+		return nil, ErrForeignKey
+	}
+	image.Position = 0
+	for _, other := range data.images {
+		if other.Product == image.Product && other.Position >= image.Position {
+			image.Position = other.Position + 1
+		}
+	}
+	image.CreatedAt = time.Now().UTC()
+	data.imageSeq++
+	id := data.imageSeq
+	image.Id = id
+	data.images[id] = *image
+	return &id, nil
+}
+
+// Удалить изображение
+func (msc *MemoryStoreContext) DeleteImage(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if _, ok := data.images[id]; !ok {
+		return sql.ErrNoRows
+	}
+	delete(data.images, id)
+	return nil
+}
+
+// Упорядочить изображения продукта в порядке ids
+func (msc *MemoryStoreContext) ReorderImages(ctx context.Context, tx *sql.Tx, product int, ids []int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !model.SameImages(data.productImages(product), ids) {
+		return ErrImageOrder
+	}
+	for position, id := range ids {
+		image := data.images[id]
+		image.Position = position
+		data.images[id] = image
+	}
+	return nil
+}
+
+// Записать изменения цен в историю от имени пользователя из контекста
+func (md *memoryData) savePriceChanges(ctx context.Context, changes []*model.PriceChange) {
+	now := time.Now().UTC()
+	for _, change := range changes {
+		md.priceChangeSeq++
+		change.Id = md.priceChangeSeq
+		change.ChangedAt = now
+		change.ChangedBy = model.UserFromContext(ctx)
+		md.priceHistory[change.Id] = *change
+	}
+}
+
+// Получить страницу истории цен продукта и общее количество изменений
+func (msc *MemoryStoreContext) GetPriceHistory(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.PriceChange, int, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkSort(params, model.PriceChangeSortFields); err != nil {
+		return nil, 0, err
+	}
+	var changes []*model.PriceChange
+	for _, change := range data.priceHistory {
+		if change.Product != product {
+			continue
+		}
+		change := change
+		changes = append(changes, &change)
+	}
+	keys := sortKeys(params)
+	sort.Slice(changes, func(i, j int) bool {
+		return compareKeys(keys, keyValues(keys, changes[i]), keyValues(keys, changes[j])) < 0
+	})
+	total := len(changes)
+	if params != nil && params.After != nil {
+		after, err := cursorValues(params)
+		if err != nil {
+			return nil, 0, err
+		}
+		changes = changes[sort.Search(len(changes), func(i int) bool {
+			return compareKeys(keys, keyValues(keys, changes[i]), after) > 0
+		}):]
+	}
+	from, to := pageBounds(len(changes), params)
+	return changes[from:to], total, nil
+}
+
+// Получить резерв по id
+func (msc *MemoryStoreContext) GetReservation(ctx context.Context, tx *sql.Tx, id int) (*model.StockReservation, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	reservation, ok := data.reservations[id]
+	if !ok {
+		return nil, nil
+	}
+	reservation.Expire(time.Now().UTC())
+	return &reservation, nil
+}
+
+// Зарезервировать продукт
+func (msc *MemoryStoreContext) CreateReservation(ctx context.Context, tx *sql.Tx, reservation *model.StockReservation) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := data.products[reservation.Product]; !ok {
+		return nil, ErrForeignKey
+	}
+	now := time.Now().UTC()
+	if data.stock[reservation.Product]-data.reserved(reservation.Product, now) < reservation.Quantity {
+		return nil, ErrInsufficientStock
+	}
+	data.reservationSeq++
+	id := data.reservationSeq
+	reservation.Status = model.ReservationActive
+	reservation.CreatedAt = now
+	r := *reservation
+	r.Id = id
+	r.ExpiresAt = r.ExpiresAt.UTC()
+	data.reservations[id] = r
+	return &id, nil
+}
+
+// Подтвердить резерв
+func (msc *MemoryStoreContext) CommitReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	reservation, ok := data.reservations[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	now := time.Now().UTC()
+	if !reservation.Active(now) {
+		return ErrReservationClosed
+	}
+	if data.stock[reservation.Product] < reservation.Quantity {
+		return ErrInsufficientStock
+	}
+	data.adjust(&model.StockAdjustment{Product: reservation.Product, Delta: -reservation.Quantity, Reason: model.StockReserved,
+		Note: fmt.Sprintf("reservation %d", id)}, now)
+	reservation.Status = model.ReservationCommitted
+	data.reservations[id] = reservation
+	return nil
+}
+
+// Отменить резерв
+func (msc *MemoryStoreContext) ReleaseReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	reservation, ok := data.reservations[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if reservation.Status != model.ReservationActive {
+		return ErrReservationClosed
+	}
+	reservation.Status = model.ReservationReleased
+	data.reservations[id] = reservation
+	return nil
+}
+
+// Окончательно удалить варианты, продукты и категории, удаленные раньше before.
+// Вместе с категорией удаляются все ее продукты, вместе с продуктом - его варианты,
+// у подкатегорий сбрасывается родитель
+func (msc *MemoryStoreContext) Purge(ctx context.Context, tx *sql.Tx, before time.Time) (int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for id, variant := range data.variants {
+		if variant.DeletedAt != nil && variant.DeletedAt.Before(before) {
+			delete(data.variants, id)
+			purged++
+		}
+	}
+	for id, product := range data.products {
+		if product.DeletedAt != nil && product.DeletedAt.Before(before) {
+			delete(data.products, id)
+			purged++
+		}
+	}
+	for id, category := range data.categories {
+		if category.DeletedAt != nil && category.DeletedAt.Before(before) {
+			delete(data.categories, id)
+			purged++
+			for productId, product := range data.products {
+				if product.Category == id {
+					delete(data.products, productId)
+				}
+			}
+			for childId, child := range data.categories {
+				if child.ParentId != nil && *child.ParentId == id {
+					child.ParentId = nil
+					data.categories[childId] = child
+				}
+			}
+		}
+	}
+	for id, variant := range data.variants {
+		if _, ok := data.products[variant.Product]; !ok {
+			delete(data.variants, id)
+		}
+	}
+	for product := range data.stock {
+		if _, ok := data.products[product]; !ok {
+			delete(data.stock, product)
+		}
+	}
+	for id, adjustment := range data.adjustments {
+		if _, ok := data.products[adjustment.Product]; !ok {
+			delete(data.adjustments, id)
+		}
+	}
+	for id, reservation := range data.reservations {
+		if _, ok := data.products[reservation.Product]; !ok {
+			delete(data.reservations, id)
+		}
+	}
+	for id, change := range data.priceHistory {
+		if _, ok := data.products[change.Product]; !ok {
+			delete(data.priceHistory, id)
+		}
+	}
+	for id, image := range data.images {
+		if _, ok := data.products[image.Product]; !ok {
+			delete(data.images, id)
+		}
+	}
+	return purged, nil
+}
+
+// Копия ключа API, области доступа которой не разделяются с оригиналом
+func copyApiKey(key model.ApiKey) *model.ApiKey {
+	key.Scopes = append([]string(nil), key.Scopes...)
+	return &key
+}
+
+// Получить все ключи API в порядке создания
+func (msc *MemoryStoreContext) GetApiKeys(ctx context.Context, tx *sql.Tx) ([]*model.ApiKey, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	var keys []*model.ApiKey
+	for _, key := range data.apiKeys {
+		keys = append(keys, copyApiKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Id < keys[j].Id })
+	return keys, nil
+}
+
+// Получить ключ API по хэшу
+func (msc *MemoryStoreContext) GetApiKeyByHash(ctx context.Context, tx *sql.Tx, hash string) (*model.ApiKey, error) {
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range data.apiKeys {
+		if key.Hash == hash {
+			return copyApiKey(key), nil
+		}
+	}
+	return nil, nil
+}
+
+// Создать ключ API
+func (msc *MemoryStoreContext) CreateApiKey(ctx context.Context, tx *sql.Tx, key *model.ApiKey) (*int, error) {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range data.apiKeys {
+		if k.Hash == key.Hash || (k.Name == key.Name && k.RevokedAt == nil) {
+			return nil, ErrDuplicate
+		}
+	}
+	data.apiKeySeq++
+	id := data.apiKeySeq
+	key.Id = id
+	key.CreatedAt = time.Now().UTC()
+	k := *copyApiKey(*key)
+	if k.ExpiresAt != nil {
+		expiresAt := k.ExpiresAt.UTC()
+		k.ExpiresAt = &expiresAt
+	}
+	k.LastUsedAt = nil
+	k.RevokedAt = nil
+	data.apiKeys[id] = k
+	return &id, nil
+}
+
+// Отозвать ключ API
+func (msc *MemoryStoreContext) RevokeApiKey(ctx context.Context, tx *sql.Tx, id int) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	key, ok := data.apiKeys[id]
+	if !ok || key.RevokedAt != nil {
+		return sql.ErrNoRows
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	data.apiKeys[id] = key
+	return nil
+}
+
+// Записать время последнего использования ключа API
+func (msc *MemoryStoreContext) TouchApiKey(ctx context.Context, tx *sql.Tx, id int, at time.Time) error {
+	defer msc.lockWrite(ctx, tx)()
+	msc.mu.Lock()
+	defer msc.mu.Unlock()
+	data, err := msc.dataFor(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if key, ok := data.apiKeys[id]; ok {
+		at = at.UTC()
+		key.LastUsedAt = &at
+		data.apiKeys[id] = key
+	}
+	return nil
+}
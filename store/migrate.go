@@ -0,0 +1,285 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/config"
+	"embed"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Миграции схемы postgresql, встроенные в бинарник.
+// Формат файлов совместим с sql-migrate: секции -- +migrate Up и -- +migrate Down
+//
+//go:embed *.sql
+var migrationFiles embed.FS
+
+// Таблица примененных миграций, та же, что у sql-migrate, чтобы не применять заново уже примененные им миграции
+const migrationsTable = "gorp_migrations"
+
+// Ключ advisory lock, который держит мигратор, чтобы несколько реплик не мигрировали БД одновременно
+const migrationsLock = 4729461052
+
+// Миграция схемы
+type Migration struct {
+	// имя файла миграции
+	Id string
+	// запросы применения
+	Up string
+	// запросы отката
+	Down string
+}
+
+// Состояние миграции
+type MigrationStatus struct {
+	// имя файла миграции
+	Id string
+	// время применения, nil если миграция не применена
+	AppliedAt *time.Time
+}
+
+// Получить встроенные миграции в порядке применения
+func Migrations() ([]*Migration, error) {
+	entries, err := migrationFiles.ReadDir(".")
+	if err != nil {
+		return nil, err
+	}
+	var migrations []*Migration
+	for _, entry := range entries {
+		data, err := migrationFiles.ReadFile(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		m, err := parseMigration(entry.Name(), string(data))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrationLess(migrations[i].Id, migrations[j].Id)
+	})
+	return migrations, nil
+}
+
+// Разобрать файл миграции на секции Up и Down
+func parseMigration(id string, data string) (*Migration, error) {
+	m := &Migration{Id: id}
+	var section *string
+	for _, line := range strings.SplitAfter(data, "\n") {
+		if fields := strings.Fields(line); len(fields) > 2 && fields[0] == "--" && fields[1] == "+migrate" {
+			switch fields[2] {
+			case "Up":
+				section = &m.Up
+			case "Down":
+				section = &m.Down
+			}
+			continue
+		}
+		if section == nil {
+			if strings.TrimSpace(line) != "" && !strings.HasPrefix(strings.TrimSpace(line), "--") {
+				return nil, fmt.Errorf("migration %s: statement outside of Up or Down section", id)
+			}
+			continue
+		}
+		*section += line
+	}
+	if strings.TrimSpace(m.Up) == "" {
+		return nil, fmt.Errorf("migration %s: no Up section", id)
+	}
+	return m, nil
+}
+
+// Числовой префикс имени миграции: 1_0_init_store.sql -> [1 0]
+func migrationVersion(id string) []int {
+	var version []int
+	for _, part := range strings.Split(id, "_") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		version = append(version, n)
+	}
+	return version
+}
+
+// Порядок миграций: по числовому префиксу, при равных префиксах - по имени
+func migrationLess(a, b string) bool {
+	va, vb := migrationVersion(a), migrationVersion(b)
+	for i := 0; i < len(va) && i < len(vb); i++ {
+		if va[i] != vb[i] {
+			return va[i] < vb[i]
+		}
+	}
+	if len(va) != len(vb) {
+		return len(va) < len(vb)
+	}
+	return a < b
+}
+
+// Мигратор схемы БД postgresql
+type Migrator struct {
+	db *sql.DB
+}
+
+// Создать мигратор для БД из конфигурации. Миграции поддерживаются только для postgres
+func NewMigrator(conf *config.Config) (*Migrator, error) {
+	if conf.Store.Driver != "" && conf.Store.Driver != "postgres" {
+		return nil, fmt.Errorf("migrations are not supported by store driver %q", conf.Store.Driver)
+	}
+	db, err := sql.Open("postgres", postgresDsn(conf))
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Migrator{db}, nil
+}
+
+// Закрыть соединение с БД
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Выполнить fn на отдельном соединении под advisory lock, создав при необходимости таблицу миграций
+func (m *Migrator) locked(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1);", migrationsLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1);", migrationsLock)
+	query := "CREATE TABLE IF NOT EXISTS " + migrationsTable + " (id TEXT NOT NULL PRIMARY KEY, applied_at TIMESTAMPTZ);"
+	if _, err = conn.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// Время применения примененных миграций
+func applied(conn *sql.Conn) (map[string]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT id, applied_at FROM "+migrationsTable+";")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[string]time.Time{}
+	for rows.Next() {
+		var id string
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		res[id] = at
+	}
+	return res, rows.Err()
+}
+
+// Применить или откатить миграцию в транзакции вместе с записью об этом в таблице миграций
+func apply(conn *sql.Conn, query string, record string, args ...interface{}) error {
+	ctx := context.Background()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Применить все непримененные миграции. Возвращает количество примененных
+func (m *Migrator) Up() (int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = m.locked(func(conn *sql.Conn) error {
+		done, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if _, ok := done[migration.Id]; ok {
+				continue
+			}
+			record := "INSERT INTO " + migrationsTable + " (id, applied_at) VALUES ($1, $2);"
+			if err := apply(conn, migration.Up, record, migration.Id, time.Now().UTC()); err != nil {
+				return fmt.Errorf("migration %s: %v", migration.Id, err)
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Откатить последнюю примененную миграцию. Возвращает ее имя
+func (m *Migrator) Down() (string, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return "", err
+	}
+	var id string
+	err = m.locked(func(conn *sql.Conn) error {
+		done, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0; i-- {
+			migration := migrations[i]
+			if _, ok := done[migration.Id]; !ok {
+				continue
+			}
+			record := "DELETE FROM " + migrationsTable + " WHERE id = $1;"
+			if err := apply(conn, migration.Down, record, migration.Id); err != nil {
+				return fmt.Errorf("migration %s: %v", migration.Id, err)
+			}
+			id = migration.Id
+			return nil
+		}
+		return errors.New("no applied migrations")
+	})
+	return id, err
+}
+
+// Состояние всех встроенных миграций
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []*MigrationStatus
+	err = m.locked(func(conn *sql.Conn) error {
+		done, err := applied(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			status := &MigrationStatus{Id: migration.Id}
+			if at, ok := done[migration.Id]; ok {
+				status.AppliedAt = &at
+			}
+			res = append(res, status)
+		}
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,132 @@
+package store
+
+import (
+	"echo-rest-api/model"
+	"fmt"
+	"strings"
+)
+
+// Собрать WHERE из условий
+func where(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// Добавить условие, исключающее удаленные записи, если в параметрах выборки не запрошены удаленные
+func notDeleted(conds []string, params *model.ListParams) []string {
+	if params != nil && params.IncludeDeleted {
+		return conds
+	}
+	return append(conds, "deleted_at IS NULL")
+}
+
+// Добавить условие column IN (...) со списком значений
+func inCondition(conds []string, args []interface{}, column string, values []int) ([]string, []interface{}) {
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		args = append(args, v)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return append(conds, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", "))), args
+}
+
+// Начало запроса с рекурсивным CTE subtree(id): категории, подходящие под условие cond, и все их подкатегории
+func subtree(cond string) string {
+	return "WITH RECURSIVE subtree(id) AS (SELECT id FROM category WHERE " + cond +
+		" UNION SELECT category.id FROM category JOIN subtree ON category.parent_id = subtree.id) "
+}
+
+// Добавить условие поиска подстроки в колонке без учета регистра
+func likeCondition(conds []string, args []interface{}, column string, substr string) ([]string, []interface{}) {
+	pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(substr) + "%"
+	args = append(args, pattern)
+	return append(conds, fmt.Sprintf(`lower(%s) LIKE lower($%d) ESCAPE '\'`, column, len(args))), args
+}
+
+// Поля сортировки запроса с id в конце для однозначного порядка записей
+func sortKeys(params *model.ListParams) []model.SortField {
+	var keys []model.SortField
+	if params != nil {
+		keys = append(keys, params.Sort...)
+	}
+	return append(keys, model.SortField{Field: "id"})
+}
+
+// Проверить, что сортировка идет только по разрешенным полям.
+// Поля сортировки совпадают с названиями колонок и подставляются в запрос как есть
+func checkSort(params *model.ListParams, allowed []string) error {
+	if params == nil {
+		return nil
+	}
+	for _, f := range params.Sort {
+		ok := false
+		for _, a := range allowed {
+			if f.Field == a {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown sort field %q", f.Field)
+		}
+	}
+	return nil
+}
+
+// Собрать ORDER BY из параметров выборки
+func orderBy(params *model.ListParams) string {
+	var fields []string
+	for _, key := range sortKeys(params) {
+		if key.Desc {
+			fields = append(fields, key.Field+" DESC")
+		} else {
+			fields = append(fields, key.Field+" ASC")
+		}
+	}
+	return " ORDER BY " + strings.Join(fields, ", ")
+}
+
+// Добавить условие выборки записей, следующих за курсором в порядке сортировки:
+// (f1 > v1) OR (f1 = v1 AND f2 > v2) OR ... , для полей по убыванию сравнение обратное
+func afterCursor(conds []string, args []interface{}, params *model.ListParams) ([]string, []interface{}, error) {
+	if params == nil || params.After == nil {
+		return conds, args, nil
+	}
+	if len(params.After.Values) != len(params.Sort) {
+		return nil, nil, fmt.Errorf("cursor does not match sort %q", model.SortString(params.Sort))
+	}
+	keys := sortKeys(params)
+	values := append(append([]interface{}{}, params.After.Values...), params.After.Id)
+	var or []string
+	for i, key := range keys {
+		var and []string
+		for j := 0; j < i; j++ {
+			args = append(args, values[j])
+			and = append(and, fmt.Sprintf("%s = $%d", keys[j].Field, len(args)))
+		}
+		op := ">"
+		if key.Desc {
+			op = "<"
+		}
+		args = append(args, values[i])
+		and = append(and, fmt.Sprintf("%s %s $%d", key.Field, op, len(args)))
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return append(conds, "("+strings.Join(or, " OR ")+")"), args, nil
+}
+
+// Добавить к запросу LIMIT и OFFSET из параметров выборки.
+// При выборке по курсору OFFSET не используется
+func limitQuery(query string, args []interface{}, params *model.ListParams) (string, []interface{}) {
+	if params == nil || params.Limit <= 0 {
+		return query + ";", args
+	}
+	if params.After != nil {
+		query += fmt.Sprintf(" LIMIT $%d;", len(args)+1)
+		return query, append(args, params.Limit)
+	}
+	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d;", len(args)+1, len(args)+2)
+	return query, append(args, params.Limit, params.Offset)
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"echo-rest-api/model"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Упрощенный поиск продуктов для стореджей без полнотекстового поиска (memory, sqlite):
+// продукт находится, если содержит хотя бы одно слово запроса,
+// релевантность - количество вхождений слов, вхождение в название весит вдвое больше
+
+// Регулярное выражение, находящее слова запроса без учета регистра
+func searchPattern(query string) *regexp.Regexp {
+	var terms []string
+	for _, term := range strings.Fields(query) {
+		terms = append(terms, regexp.QuoteMeta(term))
+	}
+	if len(terms) == 0 {
+		return nil
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(terms, "|"))
+}
+
+// Проверить продукт на соответствие запросу и посчитать релевантность
+func matchProduct(pattern *regexp.Regexp, search *model.ProductSearch, product *model.Product) *model.ProductSearchResult {
+	if pattern == nil {
+		return nil
+	}
+	if len(search.Categories) > 0 && !containsInt(search.Categories, product.Category) {
+		return nil
+	}
+	inName := len(pattern.FindAllStringIndex(product.Name, -1))
+	inDescription := len(pattern.FindAllStringIndex(product.Description, -1))
+	if inName+inDescription == 0 {
+		return nil
+	}
+	return &model.ProductSearchResult{
+		Product: *product,
+		Rank:    float64(2*inName + inDescription),
+		Highlights: model.ProductHighlights{
+			Name:        pattern.ReplaceAllString(product.Name, "<b>$0</b>"),
+			Description: pattern.ReplaceAllString(product.Description, "<b>$0</b>"),
+		},
+	}
+}
+
+// Отсортировать результаты по убыванию релевантности и выбрать страницу
+func searchPage(results []*model.ProductSearchResult, params *model.ListParams) []*model.ProductSearchResult {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Id < results[j].Id
+	})
+	from, to := pageBounds(len(results), params)
+	return results[from:to]
+}
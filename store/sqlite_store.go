@@ -0,0 +1,201 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"strings"
+)
+
+// Схема БД для sqlite, повторяет таблицы из миграций postgresql
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS category(
+  id               INTEGER PRIMARY KEY AUTOINCREMENT,
+  name             VARCHAR(100) NOT NULL,
+  parent_id        INTEGER,
+  attribute_schema TEXT,
+  version          INTEGER NOT NULL DEFAULT 1,
+  deleted_at       TIMESTAMP,
+  constraint category_to_parent foreign key (parent_id) references category(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS category_parent_idx ON category (parent_id);
+
+CREATE TABLE IF NOT EXISTS product(
+  id          INTEGER PRIMARY KEY AUTOINCREMENT,
+  category    INTEGER NOT NULL,
+  name        VARCHAR(200) NOT NULL,
+  description TEXT NOT NULL,
+  price       NUMERIC(10,2) NOT NULL,
+  currency    CHAR(3) NOT NULL DEFAULT 'RUB',
+  attributes  TEXT,
+  version     INTEGER NOT NULL DEFAULT 1,
+  deleted_at  TIMESTAMP,
+  constraint product_to_category foreign key (category) references category(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS product_price(
+  product  INTEGER NOT NULL,
+  currency CHAR(3) NOT NULL,
+  amount   NUMERIC(10,2) NOT NULL CHECK (amount > 0),
+  constraint product_price_pk primary key(product, currency),
+  constraint product_price_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS product_variant(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  product    INTEGER NOT NULL,
+  sku        VARCHAR(64) NOT NULL,
+  price      NUMERIC(10,2),
+  version    INTEGER NOT NULL DEFAULT 1,
+  deleted_at TIMESTAMP,
+  constraint product_variant_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS product_variant_product_idx ON product_variant (product);
+CREATE UNIQUE INDEX IF NOT EXISTS product_variant_sku_idx ON product_variant (sku) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS variant_option(
+  variant INTEGER NOT NULL,
+  name    VARCHAR(50) NOT NULL,
+  value   VARCHAR(100) NOT NULL,
+  PRIMARY KEY (variant, name),
+  constraint variant_option_to_variant foreign key (variant) references product_variant(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS product_stock(
+  product INTEGER NOT NULL PRIMARY KEY,
+  on_hand INTEGER NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+  constraint product_stock_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS stock_adjustment(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  product    INTEGER NOT NULL,
+  delta      INTEGER NOT NULL,
+  reason     VARCHAR(20) NOT NULL,
+  note       TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMP NOT NULL,
+  constraint stock_adjustment_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS stock_adjustment_product_idx ON stock_adjustment (product);
+
+CREATE TABLE IF NOT EXISTS stock_reservation(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  product    INTEGER NOT NULL,
+  quantity   INTEGER NOT NULL CHECK (quantity > 0),
+  status     VARCHAR(20) NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  constraint stock_reservation_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS stock_reservation_active_idx ON stock_reservation (product, expires_at) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS product_price_history(
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  product    INTEGER NOT NULL,
+  currency   CHAR(3) NOT NULL,
+  old_price  NUMERIC(10,2),
+  new_price  NUMERIC(10,2),
+  changed_at TIMESTAMP NOT NULL,
+  changed_by VARCHAR(100) NOT NULL DEFAULT '',
+  constraint product_price_history_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS product_price_history_product_idx ON product_price_history (product, changed_at);
+
+CREATE TABLE IF NOT EXISTS tag(
+  id   INTEGER PRIMARY KEY AUTOINCREMENT,
+  name VARCHAR(50) NOT NULL,
+  constraint tag_name_uq unique(name)
+);
+
+CREATE TABLE IF NOT EXISTS product_tag(
+  product INTEGER NOT NULL,
+  tag     INTEGER NOT NULL,
+  constraint product_tag_pk primary key(product, tag),
+  constraint product_tag_to_product foreign key (product) references product(id) ON DELETE CASCADE,
+  constraint product_tag_to_tag foreign key (tag) references tag(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS product_tag_tag_idx ON product_tag (tag);
+
+CREATE TABLE IF NOT EXISTS product_image(
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  product      INTEGER NOT NULL,
+  content_type VARCHAR(50) NOT NULL,
+  position     INTEGER NOT NULL,
+  created_at   TIMESTAMP NOT NULL,
+  constraint product_image_to_product foreign key (product) references product(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS product_image_product_idx ON product_image (product, position);
+
+CREATE TABLE IF NOT EXISTS api_key(
+  id           INTEGER PRIMARY KEY AUTOINCREMENT,
+  name         VARCHAR(100) NOT NULL,
+  prefix       VARCHAR(20) NOT NULL,
+  key_hash     CHAR(64) NOT NULL,
+  scopes       TEXT NOT NULL,
+  expires_at   TIMESTAMP,
+  last_used_at TIMESTAMP,
+  created_at   TIMESTAMP NOT NULL,
+  revoked_at   TIMESTAMP,
+  constraint api_key_hash_uq unique(key_hash)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_key_name_idx ON api_key (name) WHERE revoked_at IS NULL;
+`
+
+// Контекст стореджа в sqlite.
+// Запросы StoreContext совместимы с sqlite, поэтому переопределяется только то, что отличается.
+type SqliteStoreContext struct {
+	*StoreContext
+}
+
+// Создать сторедж в sqlite. В conf.Store.Dsn указывается путь к файлу БД
+func NewSqliteStore(conf *config.Config) (Store, error) {
+	dsn := conf.Store.Dsn
+	// внешние ключи в sqlite по умолчанию выключены, без них не работает каскадное удаление
+	if !strings.Contains(dsn, "_foreign_keys") && !strings.Contains(dsn, "_fk") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&_foreign_keys=1"
+		} else {
+			dsn += "?_foreign_keys=1"
+		}
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	configurePool(db, conf)
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err = db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &SqliteStoreContext{&StoreContext{db}}, nil
+}
+
+// Найти продукты по поисковому запросу. Полнотекстового поиска postgresql в sqlite нет,
+// поэтому продукты выбираются по категориям, а релевантность считается упрощенно
+func (sc *SqliteStoreContext) SearchProducts(ctx context.Context, tx *sql.Tx, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	products, _, err := sc.GetProducts(ctx, tx, &model.ProductFilter{Categories: search.Categories}, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	pattern := searchPattern(search.Query)
+	var results []*model.ProductSearchResult
+	for _, product := range products {
+		if r := matchProduct(pattern, search, product); r != nil {
+			results = append(results, r)
+		}
+	}
+	return searchPage(results, params), len(results), nil
+}
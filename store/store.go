@@ -1,42 +1,149 @@
 package store
 
 import (
+	"context"
 	"database/sql"
 	"echo-rest-api/config"
 	"echo-rest-api/model"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 )
 
+// Ошибка обновления или удаления записи, версия которой не совпала с ожидаемой:
+// запись изменили после того, как клиент ее прочитал
+var ErrConflict = errors.New("version conflict")
+
+// Ошибка обновления категории, при котором она стала бы своим же предком
+var ErrCycle = errors.New("category cycle")
+
+// Ошибка создания или обновления записи со значением, которое должно быть уникальным, но уже занято
+var ErrDuplicate = errors.New("duplicate value")
+
+// Ошибка создания или обновления записи, которая ссылается на несуществующую запись, например продукта
+// с несуществующей категорией
+var ErrForeignKey = errors.New("referenced record does not exist")
+
+// Ошибка создания, обновления или восстановления записи в удаленной категории. Такую запись
+// окончательно удалила бы вместе с категорией команда purge
+var ErrCategoryDeleted = errors.New("category is deleted")
+
+// Ошибка изменения остатка или резерва, после которого количество на складе стало бы отрицательным
+// или меньше зарезервированного
+var ErrInsufficientStock = errors.New("insufficient stock")
+
+// Ошибка подтверждения или отмены резерва, который уже подтвержден, отменен или истек
+var ErrReservationClosed = errors.New("reservation is not active")
+
+// Ошибка изменения порядка изображений, при котором переданы не все изображения продукта или чужие изображения
+var ErrImageOrder = errors.New("image ids do not match product images")
+
 type Store interface {
 	// Закрыть сторедж
 	Close() error
+	// Статистика пула соединений с БД
+	Stats() sql.DBStats
 	// Начать транзакцию
-	Begin() (*sql.Tx, error)
+	Begin(ctx context.Context) (*sql.Tx, error)
 	// Закомитить транзакцию
 	Commit(tx *sql.Tx) error
 	// Откатить транзакцию
 	Rollback(tx *sql.Tx) error
-	// Получить категорию по id
-	GetCategory(tx *sql.Tx, id int) (*model.Category, error)
-	// Получить все категории
-	GetCategories(tx *sql.Tx) ([]*model.Category, error)
-	// Создать категорию
-	CreateCategory(tx *sql.Tx, category *model.Category) (*int, error)
-	// Обновить категорию
-	UpdateCategory(tx *sql.Tx, category *model.Category) error
-	// Удалить категорию
-	DeleteCategory(tx *sql.Tx, id int) error
-	// Получить продукт по id
-	GetProduct(tx *sql.Tx, id int) (*model.Product, error)
-	// Получить все продукты
-	GetProducts(tx *sql.Tx, category *int) ([]*model.Product, error)
-	// Создать продукт
-	CreateProduct(tx *sql.Tx, product *model.Product) (*int, error)
-	// Обновить продукт
-	UpdateProduct(tx *sql.Tx, product *model.Product) error
-	// Удалить продукт
-	DeleteProduct(tx *sql.Tx, id int) error
+	// Получить категорию по id, в том числе удаленную
+	GetCategory(ctx context.Context, tx *sql.Tx, id int) (*model.Category, error)
+	// Получить предков категории от корневой до родительской. Если категории нет, возвращает nil
+	GetCategoryAncestors(ctx context.Context, tx *sql.Tx, id int) ([]*model.Category, error)
+	// Получить страницу категорий и общее количество категорий.
+	// Удаленные категории выбираются только с params.IncludeDeleted
+	GetCategories(ctx context.Context, tx *sql.Tx, params *model.ListParams) ([]*model.Category, int, error)
+	// Создать категорию. Если родительской категории нет, возвращает ErrForeignKey, если она удалена - ErrCategoryDeleted
+	CreateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) (*int, error)
+	// Обновить категорию, если ее версия совпадает с category.Version (0 - без проверки версии).
+	// При успехе в category.Version записывается новая версия. Если новый родитель - сама категория
+	// или ее подкатегория, возвращает ErrCycle, если он удален - ErrCategoryDeleted
+	UpdateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) error
+	// Пометить удаленной категорию вместе с ее подкатегориями и их продуктами, если версия категории
+	// совпадает с version (0 - без проверки версии)
+	DeleteCategory(ctx context.Context, tx *sql.Tx, id int, version int) error
+	// Восстановить удаленную категорию вместе с подкатегориями и продуктами, удаленными вместе с ней.
+	// Если родительская категория удалена, возвращает ErrCategoryDeleted
+	RestoreCategory(ctx context.Context, tx *sql.Tx, id int) error
+	// Получить продукт по id, в том числе удаленный
+	GetProduct(ctx context.Context, tx *sql.Tx, id int) (*model.Product, error)
+	// Получить страницу продуктов, подходящих под фильтр, и общее количество таких продуктов.
+	// Удаленные продукты выбираются только с params.IncludeDeleted
+	GetProducts(ctx context.Context, tx *sql.Tx, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error)
+	// Найти продукты по поисковому запросу, в порядке убывания релевантности, и общее количество найденных
+	SearchProducts(ctx context.Context, tx *sql.Tx, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error)
+	// Создать продукт. Если категории продукта нет, возвращает ErrForeignKey, если она удалена - ErrCategoryDeleted
+	CreateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) (*int, error)
+	// Обновить продукт, если его версия совпадает с product.Version (0 - без проверки версии).
+	// При успехе в product.Version записывается новая версия. Если категории продукта нет, возвращает ErrForeignKey,
+	// если она удалена - ErrCategoryDeleted
+	UpdateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) error
+	// Пометить удаленным продукт вместе с его вариантами, если его версия совпадает с version (0 - без проверки версии)
+	DeleteProduct(ctx context.Context, tx *sql.Tx, id int, version int) error
+	// Восстановить удаленный продукт вместе с вариантами, удаленными вместе с ним. Если категория продукта удалена,
+	// возвращает ErrCategoryDeleted
+	RestoreProduct(ctx context.Context, tx *sql.Tx, id int) error
+	// Получить вариант продукта по id, в том числе удаленный
+	GetVariant(ctx context.Context, tx *sql.Tx, id int) (*model.Variant, error)
+	// Получить неудаленные варианты продукта в порядке id
+	GetVariants(ctx context.Context, tx *sql.Tx, product int) ([]*model.Variant, error)
+	// Создать вариант продукта. Если артикул занят другим неудаленным вариантом, возвращает ErrDuplicate
+	CreateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) (*int, error)
+	// Обновить вариант продукта вместе с опциями, если его версия совпадает с variant.Version (0 - без проверки версии).
+	// При успехе в variant.Version записывается новая версия. Если артикул занят другим вариантом, возвращает ErrDuplicate
+	UpdateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) error
+	// Пометить удаленным вариант продукта, если его версия совпадает с version (0 - без проверки версии)
+	DeleteVariant(ctx context.Context, tx *sql.Tx, id int, version int) error
+	// Получить остаток продукта
+	GetStock(ctx context.Context, tx *sql.Tx, product int) (*model.Stock, error)
+	// Изменить количество продукта на складе и записать изменение в журнал. Остаток продукта блокируется
+	// до конца транзакции. Если доступное количество (за вычетом действующих резервов) стало бы отрицательным,
+	// возвращает ErrInsufficientStock
+	AdjustStock(ctx context.Context, tx *sql.Tx, adjustment *model.StockAdjustment) (*int, error)
+	// Получить страницу журнала изменений остатка продукта и общее количество изменений
+	GetStockAdjustments(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error)
+	// Получить резерв по id. Статус действующего резерва с истекшим сроком - expired
+	GetReservation(ctx context.Context, tx *sql.Tx, id int) (*model.StockReservation, error)
+	// Зарезервировать продукт до reservation.ExpiresAt. Остаток продукта блокируется до конца транзакции.
+	// Если доступного количества не хватает, возвращает ErrInsufficientStock
+	CreateReservation(ctx context.Context, tx *sql.Tx, reservation *model.StockReservation) (*int, error)
+	// Подтвердить резерв, списав зарезервированное количество со склада.
+	// Если резерв не действует, возвращает ErrReservationClosed
+	CommitReservation(ctx context.Context, tx *sql.Tx, id int) error
+	// Отменить действующий или истекший резерв. Если резерв уже подтвержден или отменен, возвращает ErrReservationClosed
+	ReleaseReservation(ctx context.Context, tx *sql.Tx, id int) error
+	// Получить страницу истории цен продукта и общее количество изменений. Без сортировки - в порядке изменения
+	GetPriceHistory(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.PriceChange, int, error)
+	// Получить теги неудаленных продуктов с количеством продуктов, упорядоченные по имени
+	GetTags(ctx context.Context, tx *sql.Tx) ([]*model.Tag, error)
+	// Получить изображения продукта в порядке показа
+	GetImages(ctx context.Context, tx *sql.Tx, product int) ([]*model.ProductImage, error)
+	// Получить изображение по id
+	GetImage(ctx context.Context, tx *sql.Tx, id int) (*model.ProductImage, error)
+	// Добавить изображение продукта последним
+	CreateImage(ctx context.Context, tx *sql.Tx, image *model.ProductImage) (*int, error)
+	// Удалить изображение. Если его нет, возвращает sql.ErrNoRows
+	DeleteImage(ctx context.Context, tx *sql.Tx, id int) error
+	// Упорядочить изображения продукта в порядке ids. Если ids не совпадают с изображениями продукта, возвращает ErrImageOrder
+	ReorderImages(ctx context.Context, tx *sql.Tx, product int, ids []int) error
+	// Получить все ключи API, включая отозванные, в порядке создания
+	GetApiKeys(ctx context.Context, tx *sql.Tx) ([]*model.ApiKey, error)
+	// Получить ключ API по хэшу ключа
+	GetApiKeyByHash(ctx context.Context, tx *sql.Tx, hash string) (*model.ApiKey, error)
+	// Создать ключ API. Если ключ с таким хэшем или неотозванный ключ с таким названием уже есть, возвращает ErrDuplicate:
+	// по названию ключу назначаются роли и пишется пользователь в историю цен
+	CreateApiKey(ctx context.Context, tx *sql.Tx, key *model.ApiKey) (*int, error)
+	// Отозвать ключ API. Если ключа нет или он уже отозван, возвращает sql.ErrNoRows
+	RevokeApiKey(ctx context.Context, tx *sql.Tx, id int) error
+	// Записать время последнего использования ключа API
+	TouchApiKey(ctx context.Context, tx *sql.Tx, id int, at time.Time) error
+	// Окончательно удалить категории, продукты и варианты, удаленные раньше before. Возвращает количество удаленных записей
+	Purge(ctx context.Context, tx *sql.Tx, before time.Time) (int, error)
 }
 
 // Контекст стореджа
@@ -44,19 +151,55 @@ type StoreContext struct {
 	db *sql.DB
 }
 
-// Создать сторедж
+// Создать сторедж, тип которого задан в конфигурации
 func NewStore(conf *config.Config) (Store, error) {
-	storeConfig := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+	switch conf.Store.Driver {
+	case "", "postgres":
+		return NewPostgresStore(conf)
+	case "sqlite":
+		return NewSqliteStore(conf)
+	case "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown store driver %q", conf.Store.Driver)
+	}
+}
+
+// Строка подключения к postgresql из конфигурации
+func postgresDsn(conf *config.Config) string {
+	if conf.Store.Dsn != "" {
+		return conf.Store.Dsn
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
 		conf.Store.Host, conf.Store.Port, conf.Store.User, conf.Store.Password, conf.Store.Dbname,
 	)
-	db, err := sql.Open("postgres", storeConfig)
+}
+
+// Настроить пул соединений с БД по конфигурации
+func configurePool(db *sql.DB, conf *config.Config) {
+	db.SetMaxOpenConns(conf.Store.MaxOpenConns)
+	db.SetMaxIdleConns(conf.Store.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(conf.Store.ConnMaxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(conf.Store.ConnMaxIdleTime) * time.Second)
+}
+
+// Создать сторедж в postgresql. Если в конфигурации включен AutoMigrate, применяет миграции схемы
+func NewPostgresStore(conf *config.Config) (Store, error) {
+	db, err := sql.Open("postgres", postgresDsn(conf))
 	if err != nil {
 		return nil, err
 	}
+	configurePool(db, conf)
 	err = db.Ping()
 	if err != nil {
 		return nil, err
 	}
+	if conf.Store.AutoMigrate {
+		if _, err = (&Migrator{db}).Up(); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
 	return &StoreContext{db}, nil
 }
 
@@ -65,9 +208,14 @@ func (sc *StoreContext) Close() error {
 	return sc.db.Close()
 }
 
+// Статистика пула соединений с БД
+func (sc *StoreContext) Stats() sql.DBStats {
+	return sc.db.Stats()
+}
+
 // Начать транзакцию
-func (sc *StoreContext) Begin() (*sql.Tx, error) {
-	return sc.db.Begin()
+func (sc *StoreContext) Begin(ctx context.Context) (*sql.Tx, error) {
+	return sc.db.BeginTx(ctx, nil)
 }
 
 // Закомитить транзакцию
@@ -87,16 +235,16 @@ func (sc *StoreContext) Rollback(tx *sql.Tx) error {
 }
 
 // Получить категорию по id
-func (sc *StoreContext) GetCategory(tx *sql.Tx, id int) (*model.Category, error) {
-	var query = "SELECT id, name FROM category WHERE id= $1;"
+func (sc *StoreContext) GetCategory(ctx context.Context, tx *sql.Tx, id int) (*model.Category, error) {
+	var query = "SELECT id, name, parent_id, attribute_schema, version, deleted_at FROM category WHERE id= $1;"
 	var row *sql.Row
 	if tx != nil {
-		row = tx.QueryRow(query, id)
+		row = tx.QueryRowContext(ctx, query, id)
 	} else {
-		row = sc.db.QueryRow(query, id)
+		row = sc.db.QueryRowContext(ctx, query, id)
 	}
 	category := &model.Category{}
-	if err := row.Scan(&category.Id, &category.Name); err != nil {
+	if err := row.Scan(&category.Id, &category.Name, &category.ParentId, &category.AttributeSchema, &category.Version, &category.DeletedAt); err != nil {
 		if err != sql.ErrNoRows {
 			return nil, err
 		} else {
@@ -106,15 +254,107 @@ func (sc *StoreContext) GetCategory(tx *sql.Tx, id int) (*model.Category, error)
 	return category, nil
 }
 
-// Получить все категории
-func (sc *StoreContext) GetCategories(tx *sql.Tx) ([]*model.Category, error) {
-	query := "SELECT id, name FROM category;"
+// Источник выборки продуктов по фильтру, условия и аргументы для него.
+// С валютой в фильтре цена и валюта продукта берутся в этой валюте из product или product_price,
+// а продукты без цены в ней не выбираются. CAST нужен sqlite, чтобы цена сравнивалась с параметрами как число
+func productSource(filter *model.ProductFilter) (string, []string, []interface{}) {
+	if filter == nil || filter.Currency == "" {
+		return " FROM product", nil, nil
+	}
+	return " FROM (SELECT p.id, p.name, p.description, p.category, " +
+			"CAST(CASE WHEN p.currency = $1 THEN p.price ELSE pp.amount END AS NUMERIC) AS price, " +
+			"CASE WHEN p.currency = $1 THEN p.currency ELSE pp.currency END AS currency, p.attributes, p.version, p.deleted_at " +
+			"FROM product p LEFT JOIN product_price pp ON pp.product = p.id AND pp.currency = $1) product",
+		[]string{"price IS NOT NULL"}, []interface{}{filter.Currency}
+}
+
+// Условия выборки продуктов по фильтру, добавленные к conds и args
+func productConditions(filter *model.ProductFilter, conds []string, args []interface{}) ([]string, []interface{}) {
+	if filter == nil {
+		return conds, args
+	}
+	if len(filter.Ids) > 0 {
+		conds, args = inCondition(conds, args, "id", filter.Ids)
+	}
+	if len(filter.Categories) > 0 && filter.Recursive {
+		var in []string
+		in, args = inCondition(nil, args, "id", filter.Categories)
+		conds = append(conds, "category IN ("+subtree(in[0])+"SELECT id FROM subtree)")
+	} else if len(filter.Categories) > 0 {
+		conds, args = inCondition(conds, args, "category", filter.Categories)
+	}
+	if filter.MinPrice != nil {
+		args = append(args, *filter.MinPrice)
+		conds = append(conds, fmt.Sprintf("price >= $%d", len(args)))
+	}
+	if filter.MaxPrice != nil {
+		args = append(args, *filter.MaxPrice)
+		conds = append(conds, fmt.Sprintf("price <= $%d", len(args)))
+	}
+	if len(filter.Tags) > 0 {
+		var in []string
+		distinct := map[string]bool{}
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+			in = append(in, fmt.Sprintf("$%d", len(args)))
+			distinct[tag] = true
+		}
+		cond := "id IN (SELECT product_tag.product FROM product_tag JOIN tag ON tag.id = product_tag.tag WHERE tag.name IN (" + strings.Join(in, ", ") + ")"
+		if filter.AllTags {
+			// повторы тегов в фильтре не должны требовать повторов у продукта
+			cond += fmt.Sprintf(" GROUP BY product_tag.product HAVING count(DISTINCT tag.name) = %d", len(distinct))
+		}
+		conds = append(conds, cond+")")
+	}
+	// значение атрибута сравнивается в виде json: и как число или true/false, и как строка
+	if len(filter.Attributes) > 0 {
+		names := make([]string, 0, len(filter.Attributes))
+		for name := range filter.Attributes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			values := model.AttributeValues(filter.Attributes[name])
+			args = append(args, name, values[0], values[1])
+			conds = append(conds, fmt.Sprintf("CAST(attributes -> CAST($%d AS TEXT) AS TEXT) IN ($%d, $%d)", len(args)-2, len(args)-1, len(args)))
+		}
+	}
+	if filter.Name != "" {
+		conds, args = likeCondition(conds, args, "name", filter.Name)
+	}
+	if filter.Description != "" {
+		conds, args = likeCondition(conds, args, "description", filter.Description)
+	}
+	return conds, args
+}
+
+// Получить количество записей
+func (sc *StoreContext) count(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	var total int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&total)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, args...).Scan(&total)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// Получить предков категории от корневой до родительской
+func (sc *StoreContext) GetCategoryAncestors(ctx context.Context, tx *sql.Tx, id int) ([]*model.Category, error) {
+	query := "WITH RECURSIVE ancestors(id, parent_id, depth) AS (SELECT id, parent_id, 0 FROM category WHERE id = $1 " +
+		"UNION SELECT category.id, category.parent_id, ancestors.depth + 1 FROM category JOIN ancestors ON category.id = ancestors.parent_id) " +
+		"SELECT category.id, category.name, category.parent_id, category.attribute_schema, category.version, category.deleted_at " +
+		"FROM ancestors JOIN category ON category.id = ancestors.id ORDER BY ancestors.depth DESC;"
 	var rows *sql.Rows
 	var err error
 	if tx != nil {
-		rows, err = tx.Query(query)
+		rows, err = tx.QueryContext(ctx, query, id)
 	} else {
-		rows, err = sc.db.Query(query)
+		rows, err = sc.db.QueryContext(ctx, query, id)
 	}
 	if err != nil {
 		return nil, err
@@ -123,39 +363,121 @@ func (sc *StoreContext) GetCategories(tx *sql.Tx) ([]*model.Category, error) {
 	var categories []*model.Category
 	for rows.Next() {
 		category := &model.Category{}
-		if err := rows.Scan(&category.Id, &category.Name); err != nil {
+		if err := rows.Scan(&category.Id, &category.Name, &category.ParentId, &category.AttributeSchema, &category.Version, &category.DeletedAt); err != nil {
 			return nil, err
 		}
 		categories = append(categories, category)
 	}
-	return categories, nil
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(categories) == 0 {
+		return nil, nil
+	}
+	// последняя - сама категория
+	return categories[:len(categories)-1], nil
+}
+
+// Получить страницу категорий и общее количество категорий
+func (sc *StoreContext) GetCategories(ctx context.Context, tx *sql.Tx, params *model.ListParams) ([]*model.Category, int, error) {
+	if err := checkSort(params, model.CategorySortFields); err != nil {
+		return nil, 0, err
+	}
+	conds := notDeleted(nil, params)
+	total, err := sc.count(ctx, tx, "SELECT count(*) FROM category"+where(conds)+";")
+	if err != nil {
+		return nil, 0, err
+	}
+	conds, args, err := afterCursor(conds, nil, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := limitQuery("SELECT id, name, parent_id, attribute_schema, version, deleted_at FROM category"+where(conds)+orderBy(params), args, params)
+	var rows *sql.Rows
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var categories []*model.Category
+	for rows.Next() {
+		category := &model.Category{}
+		if err := rows.Scan(&category.Id, &category.Name, &category.ParentId, &category.AttributeSchema, &category.Version, &category.DeletedAt); err != nil {
+			return nil, 0, err
+		}
+		categories = append(categories, category)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return categories, total, nil
 }
 
 // Создать категорию
-func (sc *StoreContext) CreateCategory(tx *sql.Tx, category *model.Category) (*int, error) {
-	var query = "INSERT INTO category(name) VALUES($1) RETURNING id;"
+func (sc *StoreContext) CreateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) (*int, error) {
+	if err := sc.liveCategory(ctx, tx, category.ParentId); err != nil {
+		return nil, err
+	}
+	var query = "INSERT INTO category(name, parent_id, attribute_schema) VALUES($1, $2, $3) RETURNING id, version;"
 	var id int
 	var err error
 	if tx != nil {
-		err = tx.QueryRow(query, category.Name).Scan(&id)
+		err = tx.QueryRowContext(ctx, query, category.Name, category.ParentId, category.AttributeSchema).Scan(&id, &category.Version)
 	} else {
-		err = sc.db.QueryRow(query, category.Name).Scan(&id)
+		err = sc.db.QueryRowContext(ctx, query, category.Name, category.ParentId, category.AttributeSchema).Scan(&id, &category.Version)
 	}
 	if err != nil {
-		return nil, err
+		return nil, constraintError(err)
 	}
 	return &id, nil
 }
 
 // Обновить категорию
-func (sc *StoreContext) UpdateCategory(tx *sql.Tx, category *model.Category) error {
-	query := "UPDATE category SET name =$1 WHERE id = $2;"
+func (sc *StoreContext) UpdateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) error {
+	if category.ParentId != nil {
+		n, err := sc.count(ctx, tx, subtree("id = $1")+"SELECT count(*) FROM subtree WHERE id = $2;", category.Id, *category.ParentId)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrCycle
+		}
+		if err = sc.liveCategory(ctx, tx, category.ParentId); err != nil {
+			return err
+		}
+	}
+	query := "UPDATE category SET name =$1, parent_id = $2, attribute_schema = $3, version = version + 1 " +
+		"WHERE id = $4 AND deleted_at IS NULL AND ($5 = 0 OR version = $5) RETURNING version;"
+	var version int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, category.Name, category.ParentId, category.AttributeSchema, category.Id, category.Version).Scan(&version)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, category.Name, category.ParentId, category.AttributeSchema, category.Id, category.Version).Scan(&version)
+	}
+	if err == sql.ErrNoRows {
+		return sc.versionError(ctx, tx, "category", category.Id)
+	} else if err != nil {
+		return constraintError(err)
+	}
+	category.Version = version
+	return nil
+}
+
+// Пометить удаленной категорию вместе с ее подкатегориями и их продуктами
+func (sc *StoreContext) DeleteCategory(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	now := time.Now().UTC()
+	query := "UPDATE category SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3);"
 	var res sql.Result
 	var err error
 	if tx != nil {
-		res, err = tx.Exec(query, category.Name, category.Id)
+		res, err = tx.ExecContext(ctx, query, now, id, version)
 	} else {
-		res, err = sc.db.Exec(query, category.Name, category.Id)
+		res, err = sc.db.ExecContext(ctx, query, now, id, version)
 	}
 	if err != nil {
 		return err
@@ -163,20 +485,66 @@ func (sc *StoreContext) UpdateCategory(tx *sql.Tx, category *model.Category) err
 	if a, err := res.RowsAffected(); err != nil {
 		return err
 	} else if a == 0 {
-		return sql.ErrNoRows
+		return sc.versionError(ctx, tx, "category", id)
+	}
+	for _, query := range []string{
+		"UPDATE category SET deleted_at = $1, version = version + 1 WHERE id IN (" + subtree("id = $2") + "SELECT id FROM subtree) AND deleted_at IS NULL;",
+		"UPDATE product SET deleted_at = $1, version = version + 1 WHERE category IN (" + subtree("id = $2") + "SELECT id FROM subtree) AND deleted_at IS NULL;",
+		"UPDATE product_variant SET deleted_at = $1, version = version + 1 WHERE product IN " +
+			"(SELECT id FROM product WHERE category IN (" + subtree("id = $2") + "SELECT id FROM subtree)) AND deleted_at IS NULL;",
+	} {
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, now, id)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, now, id)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-// Удалить категорию
-func (sc *StoreContext) DeleteCategory(tx *sql.Tx, id int) error {
-	query := "DELETE FROM category WHERE id = $1;"
+// Восстановить удаленную категорию вместе с подкатегориями и продуктами, удаленными вместе с ней или после нее
+func (sc *StoreContext) RestoreCategory(ctx context.Context, tx *sql.Tx, id int) error {
+	parent, err := sc.categoryOf(ctx, tx, "SELECT parent_id FROM category WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	if err = sc.liveCategory(ctx, tx, parent); err != nil {
+		return err
+	}
+	deletedAt := "(SELECT deleted_at FROM category WHERE id = $1)"
+	for _, query := range []string{
+		"UPDATE product_variant SET deleted_at = NULL, version = version + 1 WHERE product IN " +
+			"(SELECT id FROM product WHERE category IN (" + subtree("id = $1") + "SELECT id FROM subtree)) AND deleted_at >= " + deletedAt + ";",
+		"UPDATE product SET deleted_at = NULL, version = version + 1 WHERE category IN (" + subtree("id = $1") + "SELECT id FROM subtree) AND " +
+			"deleted_at >= " + deletedAt + ";",
+		"UPDATE category SET deleted_at = NULL, version = version + 1 WHERE id IN (" + subtree("id = $1") + "SELECT id FROM subtree) AND " +
+			"id <> $1 AND deleted_at >= " + deletedAt + ";",
+	} {
+		var err error
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, id)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sc.restore(ctx, tx, "category", id)
+}
+
+// Снять пометку удаления с записи
+func (sc *StoreContext) restore(ctx context.Context, tx *sql.Tx, table string, id int) error {
+	query := "UPDATE " + table + " SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL;"
 	var res sql.Result
 	var err error
 	if tx != nil {
-		res, err = tx.Exec(query, id)
+		res, err = tx.ExecContext(ctx, query, id)
 	} else {
-		res, err = sc.db.Exec(query, id)
+		res, err = sc.db.ExecContext(ctx, query, id)
 	}
 	if err != nil {
 		return err
@@ -189,107 +557,283 @@ func (sc *StoreContext) DeleteCategory(tx *sql.Tx, id int) error {
 	return nil
 }
 
+// Ошибка для записи, которую не удалось изменить: ErrConflict, если запись есть, но с другой версией,
+// иначе sql.ErrNoRows. Удаленные записи считаются отсутствующими
+func (sc *StoreContext) versionError(ctx context.Context, tx *sql.Tx, table string, id int) error {
+	n, err := sc.count(ctx, tx, "SELECT count(*) FROM "+table+" WHERE id = $1 AND deleted_at IS NULL;", id)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrConflict
+	}
+	return sql.ErrNoRows
+}
+
+// Проверить, что категория id не удалена. Строка категории блокируется до конца транзакции, удалена она или нет,
+// поэтому параллельное удаление категории дождется транзакции и пометит удаленными и записи, созданные в ней.
+// Если категория удалена, возвращает ErrCategoryDeleted, отсутствующую категорию проверяет внешний ключ
+func (sc *StoreContext) liveCategory(ctx context.Context, tx *sql.Tx, id *int) error {
+	if id == nil {
+		return nil
+	}
+	query := "UPDATE category SET version = version WHERE id = $1 RETURNING deleted_at;"
+	var deletedAt *time.Time
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, *id).Scan(&deletedAt)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, *id).Scan(&deletedAt)
+	}
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if deletedAt != nil {
+		return ErrCategoryDeleted
+	}
+	return nil
+}
+
+// Категория записи id: родитель категории или категория продукта, запрос выбирает ее по id записи
+func (sc *StoreContext) categoryOf(ctx context.Context, tx *sql.Tx, query string, id int) (*int, error) {
+	var category *int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, id).Scan(&category)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, id).Scan(&category)
+	}
+	return category, err
+}
+
 // Получить продукт по id
-func (sc *StoreContext) GetProduct(tx *sql.Tx, id int) (*model.Product, error) {
-	var query = "SELECT id, name, description, category, price FROM product WHERE id= $1;"
+func (sc *StoreContext) GetProduct(ctx context.Context, tx *sql.Tx, id int) (*model.Product, error) {
+	var query = "SELECT id, name, description, category, price, currency, attributes, version, deleted_at FROM product WHERE id= $1;"
 	var row *sql.Row
 	if tx != nil {
-		row = tx.QueryRow(query, id)
+		row = tx.QueryRowContext(ctx, query, id)
 	} else {
-		row = sc.db.QueryRow(query, id)
+		row = sc.db.QueryRowContext(ctx, query, id)
 	}
 	product := &model.Product{}
-	if err := row.Scan(&product.Id, &product.Name, &product.Description, &product.Category, &product.Price); err != nil {
+	if err := row.Scan(&product.Id, &product.Name, &product.Description, &product.Category, &product.Price, &product.Currency, &product.Attributes,
+		&product.Version, &product.DeletedAt); err != nil {
 		if err != sql.ErrNoRows {
 			return nil, err
 		} else {
 			return nil, nil
 		}
 	}
+	if err := sc.loadPrices(ctx, tx, []*model.Product{product}); err != nil {
+		return nil, err
+	}
+	if err := sc.loadTags(ctx, tx, []*model.Product{product}); err != nil {
+		return nil, err
+	}
+	if err := sc.loadImages(ctx, tx, []*model.Product{product}); err != nil {
+		return nil, err
+	}
 	return product, nil
 }
 
-// Получить все продукты либо все продукты из категории если указана category
-func (sc *StoreContext) GetProducts(tx *sql.Tx, category *int) ([]*model.Product, error) {
-	var query string
+// Получить страницу продуктов, подходящих под фильтр, и общее количество таких продуктов
+func (sc *StoreContext) GetProducts(ctx context.Context, tx *sql.Tx, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error) {
+	if err := checkSort(params, model.ProductSortFields); err != nil {
+		return nil, 0, err
+	}
+	from, conds, args := productSource(filter)
+	conds, args = productConditions(filter, conds, args)
+	conds = notDeleted(conds, params)
+	total, err := sc.count(ctx, tx, "SELECT count(*)"+from+where(conds)+";", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	conds, args, err = afterCursor(conds, args, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := limitQuery("SELECT id, name, description, category, price, currency, attributes, version, deleted_at"+from+where(conds)+orderBy(params), args, params)
 	var rows *sql.Rows
-	var err error
-	if category == nil {
-		query = "SELECT id, name, description, category, price FROM product;"
-		if tx != nil {
-			rows, err = tx.Query(query)
-		} else {
-			rows, err = sc.db.Query(query)
-		}
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
 	} else {
-		query = "SELECT id, name, description, category, price FROM product WHERE category= $1;"
-		if tx != nil {
-			rows, err = tx.Query(query, category)
-		} else {
-			rows, err = sc.db.Query(query, category)
-		}
+		rows, err = sc.db.QueryContext(ctx, query, args...)
 	}
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 	var products []*model.Product
-	product := &model.Product{}
 	for rows.Next() {
-		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Category, &product.Price); err != nil {
-			return nil, err
+		product := &model.Product{}
+		if err := rows.Scan(&product.Id, &product.Name, &product.Description, &product.Category, &product.Price, &product.Currency, &product.Attributes,
+			&product.Version, &product.DeletedAt); err != nil {
+			return nil, 0, err
 		}
 		products = append(products, product)
 	}
-	return products, nil
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+	if err = sc.loadPrices(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	if err = sc.loadTags(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	if err = sc.loadImages(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	return products, total, nil
+}
+
+// Найти продукты по поисковому запросу с помощью полнотекстового поиска postgresql
+// по колонке search, в порядке убывания релевантности, и общее количество найденных
+func (sc *StoreContext) SearchProducts(ctx context.Context, tx *sql.Tx, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	from := " FROM product, websearch_to_tsquery('simple', $1) q"
+	conds := []string{"search @@ q", "deleted_at IS NULL"}
+	args := []interface{}{search.Query}
+	if len(search.Categories) > 0 {
+		conds, args = inCondition(conds, args, "category", search.Categories)
+	}
+	total, err := sc.count(ctx, tx, "SELECT count(*)"+from+where(conds)+";", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := limitQuery("SELECT id, name, description, category, price, currency, attributes, version, ts_rank(search, q) AS rank, "+
+		"ts_headline('simple', name, q, 'StartSel=<b>, StopSel=</b>, HighlightAll=true'), "+
+		"ts_headline('simple', description, q, 'StartSel=<b>, StopSel=</b>, MaxFragments=3, FragmentDelimiter=\" ... \"')"+
+		from+where(conds)+" ORDER BY rank DESC, id ASC", args, params)
+	var rows *sql.Rows
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var results []*model.ProductSearchResult
+	for rows.Next() {
+		r := &model.ProductSearchResult{}
+		if err := rows.Scan(&r.Id, &r.Name, &r.Description, &r.Category, &r.Price, &r.Currency, &r.Attributes, &r.Version, &r.Rank,
+			&r.Highlights.Name, &r.Highlights.Description); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+	products := make([]*model.Product, len(results))
+	for i, r := range results {
+		products[i] = &r.Product
+	}
+	if err = sc.loadPrices(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	if err = sc.loadTags(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	if err = sc.loadImages(ctx, tx, products); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
 }
 
 // Создать продукт
-func (sc *StoreContext) CreateProduct(tx *sql.Tx, product *model.Product) (*int, error) {
-	var query = "INSERT INTO product( name, description, category, price) VALUES($1, $2, $3, $4) RETURNING id;"
+func (sc *StoreContext) CreateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) (*int, error) {
+	if err := sc.liveCategory(ctx, tx, &product.Category); err != nil {
+		return nil, err
+	}
+	var query = "INSERT INTO product( name, description, category, price, currency, attributes) VALUES($1, $2, $3, $4, $5, $6) RETURNING id, version;"
 	var id int
 	var err error
 	if tx != nil {
-		err = tx.QueryRow(query, product.Name, product.Description, product.Category, product.Price).Scan(&id)
+		err = tx.QueryRowContext(ctx, query, product.Name, product.Description, product.Category, product.Price, product.Currency,
+			product.Attributes).Scan(&id, &product.Version)
 	} else {
-		err = sc.db.QueryRow(query, product.Name, product.Description, product.Category, product.Price).Scan(&id)
+		err = sc.db.QueryRowContext(ctx, query, product.Name, product.Description, product.Category, product.Price, product.Currency,
+			product.Attributes).Scan(&id, &product.Version)
 	}
 	if err != nil {
+		return nil, constraintError(err)
+	}
+	if err = sc.savePrices(ctx, tx, id, product.Prices); err != nil {
+		return nil, err
+	}
+	if err = sc.savePriceChanges(ctx, tx, model.PriceChanges(id, nil, product.PriceMap())); err != nil {
+		return nil, err
+	}
+	if err = sc.saveTags(ctx, tx, id, product.Tags); err != nil {
 		return nil, err
 	}
 	return &id, nil
 }
 
 // Обновить продукт
-func (sc *StoreContext) UpdateProduct(tx *sql.Tx, product *model.Product) error {
-	query := "UPDATE product SET name=$1, description=$2, category=$3, price=$4  WHERE id = $5;"
-	var res sql.Result
+func (sc *StoreContext) UpdateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) error {
+	// прежние цены читаются под блокировкой строки продукта, чтобы история не пропустила параллельное изменение
+	query := "UPDATE product SET version = version WHERE id = $1;"
 	var err error
 	if tx != nil {
-		res, err = tx.Exec(query, product.Name, product.Description, product.Category, product.Price, product.Id)
+		_, err = tx.ExecContext(ctx, query, product.Id)
 	} else {
-		res, err = sc.db.Exec(query, product.Name, product.Description, product.Category, product.Price, product.Id)
+		_, err = sc.db.ExecContext(ctx, query, product.Id)
 	}
 	if err != nil {
 		return err
 	}
-	if a, err := res.RowsAffected(); err != nil {
+	current, err := sc.GetProduct(ctx, tx, product.Id)
+	if err != nil {
+		return err
+	}
+	if err = sc.liveCategory(ctx, tx, &product.Category); err != nil {
+		return err
+	}
+	query = "UPDATE product SET name=$1, description=$2, category=$3, price=$4, currency=$5, attributes=$6, version = version + 1 " +
+		"WHERE id = $7 AND deleted_at IS NULL AND ($8 = 0 OR version = $8) RETURNING version;"
+	var version int
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, product.Name, product.Description, product.Category, product.Price, product.Currency,
+			product.Attributes, product.Id, product.Version).Scan(&version)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, product.Name, product.Description, product.Category, product.Price, product.Currency,
+			product.Attributes, product.Id, product.Version).Scan(&version)
+	}
+	if err == sql.ErrNoRows {
+		return sc.versionError(ctx, tx, "product", product.Id)
+	} else if err != nil {
+		return constraintError(err)
+	}
+	if err = sc.savePrices(ctx, tx, product.Id, product.Prices); err != nil {
+		return err
+	}
+	if err = sc.savePriceChanges(ctx, tx, model.PriceChanges(product.Id, current.PriceMap(), product.PriceMap())); err != nil {
+		return err
+	}
+	if err = sc.saveTags(ctx, tx, product.Id, product.Tags); err != nil {
 		return err
-	} else if a == 0 {
-		return sql.ErrNoRows
 	}
+	product.Version = version
 	return nil
 }
 
-// Удалить продукт
-func (sc *StoreContext) DeleteProduct(tx *sql.Tx, id int) error {
-	query := "DELETE FROM product WHERE id = $1;"
+// Пометить удаленным продукт вместе с его вариантами
+func (sc *StoreContext) DeleteProduct(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	now := time.Now().UTC()
+	query := "UPDATE product SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3);"
 	var res sql.Result
 	var err error
 	if tx != nil {
-		res, err = tx.Exec(query, id)
+		res, err = tx.ExecContext(ctx, query, now, id, version)
 	} else {
-		res, err = sc.db.Exec(query, id)
+		res, err = sc.db.ExecContext(ctx, query, now, id, version)
 	}
 	if err != nil {
 		return err
@@ -297,7 +841,993 @@ func (sc *StoreContext) DeleteProduct(tx *sql.Tx, id int) error {
 	if a, err := res.RowsAffected(); err != nil {
 		return err
 	} else if a == 0 {
-		return sql.ErrNoRows
+		return sc.versionError(ctx, tx, "product", id)
+	}
+	query = "UPDATE product_variant SET deleted_at = $1, version = version + 1 WHERE product = $2 AND deleted_at IS NULL;"
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, now, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, now, id)
+	}
+	return err
+}
+
+// Восстановить удаленный продукт вместе с вариантами, удаленными вместе с ним или после него
+func (sc *StoreContext) RestoreProduct(ctx context.Context, tx *sql.Tx, id int) error {
+	category, err := sc.categoryOf(ctx, tx, "SELECT category FROM product WHERE id = $1;", id)
+	if err != nil {
+		return err
+	}
+	if err = sc.liveCategory(ctx, tx, category); err != nil {
+		return err
+	}
+	query := "UPDATE product_variant SET deleted_at = NULL, version = version + 1 WHERE product = $1 AND " +
+		"deleted_at >= (SELECT deleted_at FROM product WHERE id = $1);"
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+	return sc.restore(ctx, tx, "product", id)
+}
+
+// Заполнить цены продуктов в валютах, отличных от валюты продукта
+func (sc *StoreContext) loadPrices(ctx context.Context, tx *sql.Tx, products []*model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	byId := map[int]*model.Product{}
+	ids := make([]int, len(products))
+	for i, product := range products {
+		byId[product.Id] = product
+		ids[i] = product.Id
+	}
+	// основная цена тоже попадает в список, если продукт выбран в другой валюте
+	conds, args := inCondition(nil, nil, "id", ids)
+	query := "SELECT id, currency, price FROM product" + where(conds)
+	conds, args = inCondition(nil, args, "product", ids)
+	query += " UNION ALL SELECT product, currency, amount FROM product_price" + where(conds) + " ORDER BY 2;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var price model.ProductPrice
+		if err := rows.Scan(&id, &price.Currency, &price.Amount); err != nil {
+			return err
+		}
+		if product := byId[id]; price.Currency != product.Currency {
+			product.Prices = append(product.Prices, price)
+		}
+	}
+	return rows.Err()
+}
+
+// Заменить цены продукта в других валютах
+func (sc *StoreContext) savePrices(ctx context.Context, tx *sql.Tx, id int, prices []model.ProductPrice) error {
+	query := "DELETE FROM product_price WHERE product = $1;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+	query = "INSERT INTO product_price(product, currency, amount) VALUES($1, $2, $3);"
+	for _, price := range prices {
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, id, price.Currency, price.Amount)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, id, price.Currency, price.Amount)
+		}
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// Заполнить теги продуктов из product_tag
+func (sc *StoreContext) loadTags(ctx context.Context, tx *sql.Tx, products []*model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	byId := map[int]*model.Product{}
+	ids := make([]int, len(products))
+	for i, product := range products {
+		byId[product.Id] = product
+		ids[i] = product.Id
+	}
+	conds, args := inCondition(nil, nil, "product_tag.product", ids)
+	query := "SELECT product_tag.product, tag.name FROM product_tag JOIN tag ON tag.id = product_tag.tag" + where(conds) + " ORDER BY tag.name;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		byId[id].Tags = append(byId[id].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// Заменить теги продукта, создав недостающие
+func (sc *StoreContext) saveTags(ctx context.Context, tx *sql.Tx, id int, tags []string) error {
+	query := "DELETE FROM product_tag WHERE product = $1;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		query = "INSERT INTO tag(name) VALUES($1) ON CONFLICT (name) DO NOTHING;"
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, tag)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, tag)
+		}
+		if err != nil {
+			return err
+		}
+		query = "INSERT INTO product_tag(product, tag) SELECT $1, id FROM tag WHERE name = $2;"
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, id, tag)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, id, tag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Получить теги неудаленных продуктов с количеством продуктов
+func (sc *StoreContext) GetTags(ctx context.Context, tx *sql.Tx) ([]*model.Tag, error) {
+	query := "SELECT tag.name, count(*) FROM tag JOIN product_tag ON product_tag.tag = tag.id " +
+		"JOIN product ON product.id = product_tag.product WHERE product.deleted_at IS NULL GROUP BY tag.name ORDER BY tag.name;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tags := []*model.Tag{}
+	for rows.Next() {
+		tag := &model.Tag{}
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// Прочитать изображения из результата запроса
+func scanImages(rows *sql.Rows) ([]*model.ProductImage, error) {
+	defer rows.Close()
+	var images []*model.ProductImage
+	for rows.Next() {
+		image := &model.ProductImage{}
+		if err := rows.Scan(&image.Id, &image.Product, &image.ContentType, &image.Position, &image.CreatedAt); err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	return images, rows.Err()
+}
+
+// Заполнить изображения продуктов из product_image
+func (sc *StoreContext) loadImages(ctx context.Context, tx *sql.Tx, products []*model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+	byId := map[int]*model.Product{}
+	ids := make([]int, len(products))
+	for i, product := range products {
+		byId[product.Id] = product
+		ids[i] = product.Id
+	}
+	conds, args := inCondition(nil, nil, "product", ids)
+	query := "SELECT id, product, content_type, position, created_at FROM product_image" + where(conds) + " ORDER BY position, id;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	images, err := scanImages(rows)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		byId[image.Product].Images = append(byId[image.Product].Images, image)
+	}
+	return nil
+}
+
+// Получить изображения продукта в порядке показа
+func (sc *StoreContext) GetImages(ctx context.Context, tx *sql.Tx, product int) ([]*model.ProductImage, error) {
+	query := "SELECT id, product, content_type, position, created_at FROM product_image WHERE product = $1 ORDER BY position, id;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, product)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, product)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return scanImages(rows)
+}
+
+// Получить изображение по id
+func (sc *StoreContext) GetImage(ctx context.Context, tx *sql.Tx, id int) (*model.ProductImage, error) {
+	query := "SELECT id, product, content_type, position, created_at FROM product_image WHERE id = $1;"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, id)
+	} else {
+		row = sc.db.QueryRowContext(ctx, query, id)
+	}
+	image := &model.ProductImage{}
+	if err := row.Scan(&image.Id, &image.Product, &image.ContentType, &image.Position, &image.CreatedAt); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		} else {
+			return nil, nil
+		}
+	}
+	return image, nil
+}
+
+// Добавить изображение продукта последним
+func (sc *StoreContext) CreateImage(ctx context.Context, tx *sql.Tx, image *model.ProductImage) (*int, error) {
+	query := "INSERT INTO product_image(product, content_type, position, created_at) " +
+		"SELECT $1, $2, COALESCE(MAX(position) + 1, 0), $3 FROM product_image WHERE product = $1 RETURNING id, position;"
+	image.CreatedAt = time.Now().UTC()
+	var id int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, image.Product, image.ContentType, image.CreatedAt).Scan(&id, &image.Position)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, image.Product, image.ContentType, image.CreatedAt).Scan(&id, &image.Position)
+	}
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	return &id, nil
+}
+
+// Удалить изображение
+func (sc *StoreContext) DeleteImage(ctx context.Context, tx *sql.Tx, id int) error {
+	query := "DELETE FROM product_image WHERE id = $1;"
+	var res sql.Result
+	var err error
+	if tx != nil {
+		res, err = tx.ExecContext(ctx, query, id)
+	} else {
+		res, err = sc.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Упорядочить изображения продукта в порядке ids
+func (sc *StoreContext) ReorderImages(ctx context.Context, tx *sql.Tx, product int, ids []int) error {
+	images, err := sc.GetImages(ctx, tx, product)
+	if err != nil {
+		return err
+	}
+	if !model.SameImages(images, ids) {
+		return ErrImageOrder
+	}
+	query := "UPDATE product_image SET position = $1 WHERE id = $2;"
+	for position, id := range ids {
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, position, id)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, position, id)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Записать изменения цен в историю от имени пользователя из контекста
+func (sc *StoreContext) savePriceChanges(ctx context.Context, tx *sql.Tx, changes []*model.PriceChange) error {
+	now := time.Now().UTC()
+	user := model.UserFromContext(ctx)
+	query := "INSERT INTO product_price_history(product, currency, old_price, new_price, changed_at, changed_by) " +
+		"VALUES($1, $2, $3, $4, $5, $6) RETURNING id;"
+	for _, change := range changes {
+		var err error
+		if tx != nil {
+			err = tx.QueryRowContext(ctx, query, change.Product, change.Currency, change.OldPrice, change.NewPrice, now, user).Scan(&change.Id)
+		} else {
+			err = sc.db.QueryRowContext(ctx, query, change.Product, change.Currency, change.OldPrice, change.NewPrice, now, user).Scan(&change.Id)
+		}
+		if err != nil {
+			return err
+		}
+		change.ChangedAt = now
+		change.ChangedBy = user
+	}
+	return nil
+}
+
+// Получить страницу истории цен продукта и общее количество изменений
+func (sc *StoreContext) GetPriceHistory(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.PriceChange, int, error) {
+	if err := checkSort(params, model.PriceChangeSortFields); err != nil {
+		return nil, 0, err
+	}
+	conds := []string{"product = $1"}
+	args := []interface{}{product}
+	total, err := sc.count(ctx, tx, "SELECT count(*) FROM product_price_history"+where(conds)+";", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	conds, args, err = afterCursor(conds, args, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := limitQuery("SELECT id, product, currency, old_price, new_price, changed_at, changed_by FROM product_price_history"+
+		where(conds)+orderBy(params), args, params)
+	var rows *sql.Rows
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var changes []*model.PriceChange
+	for rows.Next() {
+		c := &model.PriceChange{}
+		if err := rows.Scan(&c.Id, &c.Product, &c.Currency, &c.OldPrice, &c.NewPrice, &c.ChangedAt, &c.ChangedBy); err != nil {
+			return nil, 0, err
+		}
+		changes = append(changes, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return changes, total, nil
+}
+
+// Заполнить опции вариантов из variant_option
+func (sc *StoreContext) loadOptions(ctx context.Context, tx *sql.Tx, variants []*model.Variant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	byId := map[int]*model.Variant{}
+	ids := make([]int, len(variants))
+	for i, variant := range variants {
+		variant.Options = map[string]string{}
+		byId[variant.Id] = variant
+		ids[i] = variant.Id
+	}
+	conds, args := inCondition(nil, nil, "variant", ids)
+	query := "SELECT variant, name, value FROM variant_option" + where(conds) + ";"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var name, value string
+		if err := rows.Scan(&id, &name, &value); err != nil {
+			return err
+		}
+		byId[id].Options[name] = value
+	}
+	return rows.Err()
+}
+
+// Заменить опции варианта
+func (sc *StoreContext) saveOptions(ctx context.Context, tx *sql.Tx, id int, options map[string]string) error {
+	query := "DELETE FROM variant_option WHERE variant = $1;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, id)
+	}
+	if err != nil {
+		return err
+	}
+	query = "INSERT INTO variant_option(variant, name, value) VALUES($1, $2, $3);"
+	for name, value := range options {
+		if tx != nil {
+			_, err = tx.ExecContext(ctx, query, id, name, value)
+		} else {
+			_, err = sc.db.ExecContext(ctx, query, id, name, value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Проверить, что артикул варианта не занят другим неудаленным вариантом
+func (sc *StoreContext) checkSku(ctx context.Context, tx *sql.Tx, variant *model.Variant) error {
+	n, err := sc.count(ctx, tx, "SELECT count(*) FROM product_variant WHERE sku = $1 AND id <> $2 AND deleted_at IS NULL;", variant.Sku, variant.Id)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// Получить вариант продукта по id
+func (sc *StoreContext) GetVariant(ctx context.Context, tx *sql.Tx, id int) (*model.Variant, error) {
+	var query = "SELECT id, product, sku, price, version, deleted_at FROM product_variant WHERE id = $1;"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, id)
+	} else {
+		row = sc.db.QueryRowContext(ctx, query, id)
+	}
+	variant := &model.Variant{}
+	if err := row.Scan(&variant.Id, &variant.Product, &variant.Sku, &variant.Price, &variant.Version, &variant.DeletedAt); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		} else {
+			return nil, nil
+		}
+	}
+	if err := sc.loadOptions(ctx, tx, []*model.Variant{variant}); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// Получить неудаленные варианты продукта
+func (sc *StoreContext) GetVariants(ctx context.Context, tx *sql.Tx, product int) ([]*model.Variant, error) {
+	query := "SELECT id, product, sku, price, version, deleted_at FROM product_variant WHERE product = $1 AND deleted_at IS NULL ORDER BY id;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, product)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, product)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	variants := []*model.Variant{}
+	for rows.Next() {
+		variant := &model.Variant{}
+		if err := rows.Scan(&variant.Id, &variant.Product, &variant.Sku, &variant.Price, &variant.Version, &variant.DeletedAt); err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	// в транзакции следующий запрос можно выполнить только после закрытия строк предыдущего
+	rows.Close()
+	if err = sc.loadOptions(ctx, tx, variants); err != nil {
+		return nil, err
+	}
+	return variants, nil
+}
+
+// Создать вариант продукта
+func (sc *StoreContext) CreateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) (*int, error) {
+	if err := sc.checkSku(ctx, tx, variant); err != nil {
+		return nil, err
+	}
+	var query = "INSERT INTO product_variant(product, sku, price) VALUES($1, $2, $3) RETURNING id, version;"
+	var id int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, variant.Product, variant.Sku, variant.Price).Scan(&id, &variant.Version)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, variant.Product, variant.Sku, variant.Price).Scan(&id, &variant.Version)
+	}
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	if err = sc.saveOptions(ctx, tx, id, variant.Options); err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// Обновить вариант продукта
+func (sc *StoreContext) UpdateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) error {
+	if err := sc.checkSku(ctx, tx, variant); err != nil {
+		return err
+	}
+	query := "UPDATE product_variant SET sku = $1, price = $2, version = version + 1 " +
+		"WHERE id = $3 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) RETURNING version;"
+	var version int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, variant.Sku, variant.Price, variant.Id, variant.Version).Scan(&version)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, variant.Sku, variant.Price, variant.Id, variant.Version).Scan(&version)
+	}
+	if err == sql.ErrNoRows {
+		return sc.versionError(ctx, tx, "product_variant", variant.Id)
+	} else if err != nil {
+		return constraintError(err)
+	}
+	if err = sc.saveOptions(ctx, tx, variant.Id, variant.Options); err != nil {
+		return err
+	}
+	variant.Version = version
+	return nil
+}
+
+// Пометить удаленным вариант продукта
+func (sc *StoreContext) DeleteVariant(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	query := "UPDATE product_variant SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3);"
+	var res sql.Result
+	var err error
+	if tx != nil {
+		res, err = tx.ExecContext(ctx, query, time.Now().UTC(), id, version)
+	} else {
+		res, err = sc.db.ExecContext(ctx, query, time.Now().UTC(), id, version)
+	}
+	if err != nil {
+		return err
+	}
+	if a, err := res.RowsAffected(); err != nil {
+		return err
+	} else if a == 0 {
+		return sc.versionError(ctx, tx, "product_variant", id)
+	}
+	return nil
+}
+
+// Заблокировать остаток продукта до конца транзакции и получить количество на складе.
+// UPDATE без изменений блокирует строку и в postgresql, и в sqlite, в котором нет SELECT ... FOR UPDATE
+func (sc *StoreContext) lockStock(ctx context.Context, tx *sql.Tx, product int) (int, error) {
+	query := "INSERT INTO product_stock(product) VALUES($1) ON CONFLICT (product) DO NOTHING;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, product)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, product)
+	}
+	if err != nil {
+		return 0, constraintError(err)
+	}
+	return sc.count(ctx, tx, "UPDATE product_stock SET on_hand = on_hand WHERE product = $1 RETURNING on_hand;", product)
+}
+
+// Количество продукта в действующих на момент now резервах
+func (sc *StoreContext) reserved(ctx context.Context, tx *sql.Tx, product int, now time.Time) (int, error) {
+	return sc.count(ctx, tx, "SELECT COALESCE(sum(quantity), 0) FROM stock_reservation WHERE product = $1 AND status = $2 AND expires_at > $3;",
+		product, model.ReservationActive, now)
+}
+
+// Получить остаток продукта
+func (sc *StoreContext) GetStock(ctx context.Context, tx *sql.Tx, product int) (*model.Stock, error) {
+	onHand, err := sc.count(ctx, tx, "SELECT COALESCE((SELECT on_hand FROM product_stock WHERE product = $1), 0);", product)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := sc.reserved(ctx, tx, product, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	return &model.Stock{Product: product, OnHand: onHand, Reserved: reserved, Available: onHand - reserved}, nil
+}
+
+// Записать изменение в журнал и изменить количество на складе. Остаток должен быть заблокирован
+func (sc *StoreContext) adjust(ctx context.Context, tx *sql.Tx, adjustment *model.StockAdjustment, now time.Time) (*int, error) {
+	query := "INSERT INTO stock_adjustment(product, delta, reason, note, created_at) VALUES($1, $2, $3, $4, $5) RETURNING id;"
+	var id int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, adjustment.Product, adjustment.Delta, adjustment.Reason, adjustment.Note, now).Scan(&id)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, adjustment.Product, adjustment.Delta, adjustment.Reason, adjustment.Note, now).Scan(&id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	query = "UPDATE product_stock SET on_hand = on_hand + $1 WHERE product = $2;"
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, adjustment.Delta, adjustment.Product)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, adjustment.Delta, adjustment.Product)
+	}
+	if err != nil {
+		return nil, err
+	}
+	adjustment.CreatedAt = now
+	return &id, nil
+}
+
+// Изменить количество продукта на складе
+func (sc *StoreContext) AdjustStock(ctx context.Context, tx *sql.Tx, adjustment *model.StockAdjustment) (*int, error) {
+	now := time.Now().UTC()
+	onHand, err := sc.lockStock(ctx, tx, adjustment.Product)
+	if err != nil {
+		return nil, err
+	}
+	// уменьшить можно только доступное количество, иначе действующие резервы нельзя будет подтвердить
+	if adjustment.Delta < 0 {
+		reserved, err := sc.reserved(ctx, tx, adjustment.Product, now)
+		if err != nil {
+			return nil, err
+		}
+		if onHand-reserved+adjustment.Delta < 0 {
+			return nil, ErrInsufficientStock
+		}
+	}
+	return sc.adjust(ctx, tx, adjustment, now)
+}
+
+// Получить страницу журнала изменений остатка продукта и общее количество изменений
+func (sc *StoreContext) GetStockAdjustments(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error) {
+	if err := checkSort(params, model.StockAdjustmentSortFields); err != nil {
+		return nil, 0, err
+	}
+	conds := []string{"product = $1"}
+	args := []interface{}{product}
+	total, err := sc.count(ctx, tx, "SELECT count(*) FROM stock_adjustment"+where(conds)+";", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	conds, args, err = afterCursor(conds, args, params)
+	if err != nil {
+		return nil, 0, err
+	}
+	query, args := limitQuery("SELECT id, product, delta, reason, note, created_at FROM stock_adjustment"+where(conds)+orderBy(params), args, params)
+	var rows *sql.Rows
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query, args...)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var adjustments []*model.StockAdjustment
+	for rows.Next() {
+		a := &model.StockAdjustment{}
+		if err := rows.Scan(&a.Id, &a.Product, &a.Delta, &a.Reason, &a.Note, &a.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+		adjustments = append(adjustments, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	return adjustments, total, nil
+}
+
+// Получить резерв по id
+func (sc *StoreContext) GetReservation(ctx context.Context, tx *sql.Tx, id int) (*model.StockReservation, error) {
+	var query = "SELECT id, product, quantity, status, expires_at, created_at FROM stock_reservation WHERE id = $1;"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, id)
+	} else {
+		row = sc.db.QueryRowContext(ctx, query, id)
+	}
+	r := &model.StockReservation{}
+	if err := row.Scan(&r.Id, &r.Product, &r.Quantity, &r.Status, &r.ExpiresAt, &r.CreatedAt); err != nil {
+		if err != sql.ErrNoRows {
+			return nil, err
+		} else {
+			return nil, nil
+		}
+	}
+	r.Expire(time.Now().UTC())
+	return r, nil
+}
+
+// Зарезервировать продукт
+func (sc *StoreContext) CreateReservation(ctx context.Context, tx *sql.Tx, reservation *model.StockReservation) (*int, error) {
+	now := time.Now().UTC()
+	onHand, err := sc.lockStock(ctx, tx, reservation.Product)
+	if err != nil {
+		return nil, err
+	}
+	reserved, err := sc.reserved(ctx, tx, reservation.Product, now)
+	if err != nil {
+		return nil, err
+	}
+	if onHand-reserved < reservation.Quantity {
+		return nil, ErrInsufficientStock
+	}
+	query := "INSERT INTO stock_reservation(product, quantity, status, expires_at, created_at) VALUES($1, $2, $3, $4, $5) RETURNING id;"
+	var id int
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, reservation.Product, reservation.Quantity, model.ReservationActive, reservation.ExpiresAt.UTC(), now).Scan(&id)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, reservation.Product, reservation.Quantity, model.ReservationActive, reservation.ExpiresAt.UTC(), now).Scan(&id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	reservation.Status = model.ReservationActive
+	reservation.CreatedAt = now
+	return &id, nil
+}
+
+// Получить резерв, заблокировав остаток его продукта, и количество продукта на складе
+func (sc *StoreContext) lockReservation(ctx context.Context, tx *sql.Tx, id int) (*model.StockReservation, int, error) {
+	r, err := sc.GetReservation(ctx, tx, id)
+	if err != nil {
+		return nil, 0, err
+	}
+	if r == nil {
+		return nil, 0, sql.ErrNoRows
+	}
+	onHand, err := sc.lockStock(ctx, tx, r.Product)
+	if err != nil {
+		return nil, 0, err
+	}
+	// статус мог измениться, пока остаток был заблокирован другой транзакцией
+	if r, err = sc.GetReservation(ctx, tx, id); err != nil {
+		return nil, 0, err
+	}
+	return r, onHand, nil
+}
+
+// Изменить статус резерва
+func (sc *StoreContext) setReservationStatus(ctx context.Context, tx *sql.Tx, id int, status string) error {
+	query := "UPDATE stock_reservation SET status = $1 WHERE id = $2;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, status, id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, status, id)
+	}
+	return err
+}
+
+// Подтвердить резерв
+func (sc *StoreContext) CommitReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	r, onHand, err := sc.lockReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	if !r.Active(now) {
+		return ErrReservationClosed
+	}
+	if onHand < r.Quantity {
+		return ErrInsufficientStock
+	}
+	adjustment := &model.StockAdjustment{Product: r.Product, Delta: -r.Quantity, Reason: model.StockReserved, Note: fmt.Sprintf("reservation %d", id)}
+	if _, err = sc.adjust(ctx, tx, adjustment, now); err != nil {
+		return err
+	}
+	return sc.setReservationStatus(ctx, tx, id, model.ReservationCommitted)
+}
+
+// Отменить резерв
+func (sc *StoreContext) ReleaseReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	r, _, err := sc.lockReservation(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	if r.Status != model.ReservationActive && r.Status != model.ReservationExpired {
+		return ErrReservationClosed
+	}
+	return sc.setReservationStatus(ctx, tx, id, model.ReservationReleased)
+}
+
+// Окончательно удалить варианты, продукты и категории, удаленные раньше before.
+// Вместе с категорией удаляются все ее продукты, вместе с продуктом - его варианты
+func (sc *StoreContext) Purge(ctx context.Context, tx *sql.Tx, before time.Time) (int, error) {
+	var total int64
+	for _, query := range []string{
+		"DELETE FROM product_variant WHERE deleted_at < $1;",
+		"DELETE FROM product WHERE deleted_at < $1;",
+		"DELETE FROM category WHERE deleted_at < $1;",
+	} {
+		var res sql.Result
+		var err error
+		if tx != nil {
+			res, err = tx.ExecContext(ctx, query, before.UTC())
+		} else {
+			res, err = sc.db.ExecContext(ctx, query, before.UTC())
+		}
+		if err != nil {
+			return 0, err
+		}
+		a, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		total += a
+	}
+	// теги без продуктов не считаются удаленными записями
+	query := "DELETE FROM tag WHERE id NOT IN (SELECT tag FROM product_tag);"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return int(total), nil
+}
+
+// Колонки api_key в порядке сканирования scanApiKey
+const apiKeyColumns = "id, name, prefix, key_hash, scopes, expires_at, last_used_at, created_at, revoked_at"
+
+// Прочитать ключ API из строки результата
+func scanApiKey(scan func(dest ...interface{}) error) (*model.ApiKey, error) {
+	key := &model.ApiKey{}
+	var scopes string
+	if err := scan(&key.Id, &key.Name, &key.Prefix, &key.Hash, &scopes, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+	key.Scopes = model.ParseScopes(scopes)
+	return key, nil
+}
+
+// Получить все ключи API в порядке создания
+func (sc *StoreContext) GetApiKeys(ctx context.Context, tx *sql.Tx) ([]*model.ApiKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_key ORDER BY id;"
+	var rows *sql.Rows
+	var err error
+	if tx != nil {
+		rows, err = tx.QueryContext(ctx, query)
+	} else {
+		rows, err = sc.db.QueryContext(ctx, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []*model.ApiKey
+	for rows.Next() {
+		key, err := scanApiKey(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Получить ключ API по хэшу
+func (sc *StoreContext) GetApiKeyByHash(ctx context.Context, tx *sql.Tx, hash string) (*model.ApiKey, error) {
+	query := "SELECT " + apiKeyColumns + " FROM api_key WHERE key_hash = $1;"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRowContext(ctx, query, hash)
+	} else {
+		row = sc.db.QueryRowContext(ctx, query, hash)
+	}
+	key, err := scanApiKey(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return key, err
+}
+
+// Создать ключ API
+func (sc *StoreContext) CreateApiKey(ctx context.Context, tx *sql.Tx, key *model.ApiKey) (*int, error) {
+	query := "INSERT INTO api_key(name, prefix, key_hash, scopes, expires_at, created_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING id;"
+	key.CreatedAt = time.Now().UTC()
+	var expiresAt *time.Time
+	if key.ExpiresAt != nil {
+		utc := key.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+	var id int
+	var err error
+	if tx != nil {
+		err = tx.QueryRowContext(ctx, query, key.Name, key.Prefix, key.Hash, model.ScopeString(key.Scopes), expiresAt, key.CreatedAt).Scan(&id)
+	} else {
+		err = sc.db.QueryRowContext(ctx, query, key.Name, key.Prefix, key.Hash, model.ScopeString(key.Scopes), expiresAt, key.CreatedAt).Scan(&id)
+	}
+	if err != nil {
+		return nil, constraintError(err)
+	}
+	key.Id = id
+	return &id, nil
+}
+
+// Отозвать ключ API
+func (sc *StoreContext) RevokeApiKey(ctx context.Context, tx *sql.Tx, id int) error {
+	query := "UPDATE api_key SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL;"
+	var res sql.Result
+	var err error
+	if tx != nil {
+		res, err = tx.ExecContext(ctx, query, time.Now().UTC(), id)
+	} else {
+		res, err = sc.db.ExecContext(ctx, query, time.Now().UTC(), id)
+	}
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Записать время последнего использования ключа API
+func (sc *StoreContext) TouchApiKey(ctx context.Context, tx *sql.Tx, id int, at time.Time) error {
+	query := "UPDATE api_key SET last_used_at = $1 WHERE id = $2;"
+	var err error
+	if tx != nil {
+		_, err = tx.ExecContext(ctx, query, at.UTC(), id)
+	} else {
+		_, err = sc.db.ExecContext(ctx, query, at.UTC(), id)
+	}
+	return err
+}
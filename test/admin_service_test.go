@@ -0,0 +1,91 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/service"
+	"echo-rest-api/test/mock"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminService_GetDbStats(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	mockStore.EXPECT().Stats().Return(sql.DBStats{
+		MaxOpenConnections: 25,
+		OpenConnections:    7,
+		InUse:              5,
+		Idle:               2,
+		WaitCount:          3,
+		WaitDuration:       1500 * time.Millisecond,
+	}).Times(1)
+	as := service.NewAdminService(mockStore)
+	assert.Equal(t, &model.DbStats{
+		MaxOpenConnections: 25,
+		OpenConnections:    7,
+		InUse:              5,
+		Idle:               2,
+		WaitCount:          3,
+		WaitDuration:       1500,
+	}, as.GetDbStats())
+}
+
+func TestAdminService_CreateApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	var stored *model.ApiKey
+	mockStore.EXPECT().CreateApiKey(ctx, nil, gomock.Any()).DoAndReturn(func(_ context.Context, _ *sql.Tx, key *model.ApiKey) (*int, error) {
+		stored = key
+		id := 1
+		return &id, nil
+	}).Times(1)
+	as := service.NewAdminService(mockStore)
+	key := &model.ApiKey{Name: "erp", Scopes: []string{model.ScopeCatalogRead}}
+	secret, err := as.CreateApiKey(ctx, key)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, model.ApiKeyPrefix))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	// хранится только хэш ключа
+	assert.Equal(t, model.HashApiKey(secret), stored.Hash)
+	mockStore.EXPECT().CreateApiKey(ctx, nil, gomock.Any()).Return(nil, errors.New("test")).Times(1)
+	secret, err = as.CreateApiKey(ctx, &model.ApiKey{Name: "erp"})
+	assert.Error(t, err)
+	assert.Equal(t, "", secret)
+}
+
+func TestAdminService_AuthenticateApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	as := service.NewAdminService(mockStore)
+	now := time.Now().UTC()
+	past := now.Add(-time.Hour)
+	recent := now.Add(-time.Second)
+	mockStore.EXPECT().GetApiKeyByHash(ctx, nil, model.HashApiKey("unknown")).Return(nil, nil).Times(1)
+	mockStore.EXPECT().GetApiKeyByHash(ctx, nil, model.HashApiKey("revoked")).Return(&model.ApiKey{Id: 1, RevokedAt: &past}, nil).Times(1)
+	mockStore.EXPECT().GetApiKeyByHash(ctx, nil, model.HashApiKey("expired")).Return(&model.ApiKey{Id: 2, ExpiresAt: &past}, nil).Times(1)
+	mockStore.EXPECT().GetApiKeyByHash(ctx, nil, model.HashApiKey("used")).Return(&model.ApiKey{Id: 3, LastUsedAt: &past}, nil).Times(1)
+	mockStore.EXPECT().GetApiKeyByHash(ctx, nil, model.HashApiKey("recent")).Return(&model.ApiKey{Id: 4, LastUsedAt: &recent}, nil).Times(1)
+	// время использования обновляется не чаще раза в минуту
+	mockStore.EXPECT().TouchApiKey(ctx, nil, 3, gomock.Any()).Return(nil).Times(1)
+	for _, secret := range []string{"unknown", "revoked", "expired"} {
+		key, err := as.AuthenticateApiKey(ctx, secret)
+		assert.NoError(t, err)
+		assert.Nil(t, key, secret)
+	}
+	key, err := as.AuthenticateApiKey(ctx, "used")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, key.Id)
+	assert.True(t, key.LastUsedAt.After(past))
+	key, err = as.AuthenticateApiKey(ctx, "recent")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, key.Id)
+}
@@ -1,19 +1,27 @@
 package test
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"echo-rest-api/api"
 	"echo-rest-api/config"
 	"echo-rest-api/model"
+	"echo-rest-api/store"
 	"echo-rest-api/test/mock"
 	"encoding/json"
+	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo"
 	"github.com/stretchr/testify/assert"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestApi_GetCategories(t *testing.T) {
@@ -21,25 +29,36 @@ func TestApi_GetCategories(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 0}
 	cs := mock.NewMockCategoryService(mockCtrl)
-	api := api.NewApi(conf, cs, nil)
+	api := api.NewApi(conf, cs, nil, nil)
 	req := httptest.NewRequest(echo.GET, "/api/categories", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	// 200 [] - ничего не найдено
 	rec := httptest.NewRecorder()
 	var cats []*model.Category
-	cs.EXPECT().GetCategories().Return(cats, nil).Times(1)
+	cs.EXPECT().GetCategories(gomock.Any(), gomock.Any()).Return(cats, len(cats), nil).Times(1)
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, rec.Body.String(), "[]")
 	// 200 - ок
 	cats = append(cats, &model.Category{Id: 1, Name: "Name1"})
 	cats = append(cats, &model.Category{Id: 2, Name: "Name2"})
-	cs.EXPECT().GetCategories().Return(cats, nil).Times(1)
+	cs.EXPECT().GetCategories(gomock.Any(), gomock.Any()).Return(cats, len(cats), nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	res, _ := json.Marshal(cats)
 	assert.Equal(t, rec.Body.String(), string(res))
+	// 200 - сортировка
+	req = httptest.NewRequest(echo.GET, "/api/categories?sort=-name", nil)
+	cs.EXPECT().GetCategories(gomock.Any(), &model.ListParams{Sort: []model.SortField{{Field: "name", Desc: true}}}).Return(cats, len(cats), nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 400 - сортировка по неизвестному полю
+	req = httptest.NewRequest(echo.GET, "/api/categories?sort=price", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 }
 
 func TestApi_GetCategory(t *testing.T) {
@@ -47,20 +66,21 @@ func TestApi_GetCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	cs := mock.NewMockCategoryService(mockCtrl)
-	api := api.NewApi(conf, cs, nil)
+	api := api.NewApi(conf, cs, nil, nil)
 	req := httptest.NewRequest(echo.GET, "/api/categories/2", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	// 404
 	rec := httptest.NewRecorder()
-	cs.EXPECT().GetCategory(2).Return(nil, nil).Times(1)
+	cs.EXPECT().GetCategory(gomock.Any(), 2).Return(nil, nil).Times(1)
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 	// 200
-	cat := &model.Category{Id: 2, Name: "Name2"}
-	cs.EXPECT().GetCategory(2).Return(cat, nil).Times(1)
+	cat := &model.Category{Id: 2, Name: "Name2", Version: 4}
+	cs.EXPECT().GetCategory(gomock.Any(), 2).Return(cat, nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"4"`, rec.Header().Get("ETag"))
 	res, _ := json.Marshal(cat)
 	assert.Equal(t, rec.Body.String(), string(res))
 }
@@ -70,7 +90,7 @@ func TestApi_CreateCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	cs := mock.NewMockCategoryService(mockCtrl)
-	api := api.NewApi(conf, cs, nil)
+	api := api.NewApi(conf, cs, nil, nil)
 	// 400
 	catJSON := `{"name": "te"}`
 	req := httptest.NewRequest(echo.POST, "/api/categories/", strings.NewReader(catJSON))
@@ -83,7 +103,7 @@ func TestApi_CreateCategory(t *testing.T) {
 	id := 2
 	req = httptest.NewRequest(echo.POST, "/api/categories/", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	cs.EXPECT().CreateCategory(gomock.Any()).Return(&id, nil).Times(1)
+	cs.EXPECT().CreateCategory(gomock.Any(), gomock.Any()).Return(&id, nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusCreated, rec.Code)
@@ -97,7 +117,7 @@ func TestApi_UpdateCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	cs := mock.NewMockCategoryService(mockCtrl)
-	api := api.NewApi(conf, cs, nil)
+	api := api.NewApi(conf, cs, nil, nil)
 	// 400
 	catJSON := `{"name": "te"}`
 	req := httptest.NewRequest(echo.PUT, "/api/categories/2", strings.NewReader(catJSON))
@@ -105,22 +125,48 @@ func TestApi_UpdateCategory(t *testing.T) {
 	rec := httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
-	// 404
+	// 428
 	catJSON = `{"name": "test"}`
 	req = httptest.NewRequest(echo.PUT, "/api/categories/1", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	cs.EXPECT().UpdateCategory(gomock.Any()).Return(sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.PUT, "/api/categories/1", strings.NewReader(catJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	cs.EXPECT().UpdateCategory(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 412
+	req = httptest.NewRequest(echo.PUT, "/api/categories/2", strings.NewReader(catJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", `"1"`)
+	cs.EXPECT().UpdateCategory(gomock.Any(), &model.Category{Id: 2, Name: "test", Version: 1}).Return(store.ErrConflict).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	// 400 - родитель в поддереве категории
+	req = httptest.NewRequest(echo.PUT, "/api/categories/2", strings.NewReader(`{"name": "test", "parent_id": 3}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	cs.EXPECT().UpdateCategory(gomock.Any(), gomock.Any()).Return(store.ErrCycle).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
 	// 204
-	catJSON = `{"name": "test"}`
 	req = httptest.NewRequest(echo.PUT, "/api/categories/2", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	cs.EXPECT().UpdateCategory(gomock.Any()).Return(nil).Times(1)
+	req.Header.Set("If-Match", `"2"`)
+	cs.EXPECT().UpdateCategory(gomock.Any(), &model.Category{Id: 2, Name: "test", Version: 2}).Do(func(_ context.Context, c *model.Category) {
+		c.Version = 3
+	}).Return(nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
 }
 
 func TestApi_DeleteCategory(t *testing.T) {
@@ -128,41 +174,99 @@ func TestApi_DeleteCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	cs := mock.NewMockCategoryService(mockCtrl)
-	api := api.NewApi(conf, cs, nil)
-	// 404
+	api := api.NewApi(conf, cs, nil, nil)
+	// 428
 	req := httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
-	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	cs.EXPECT().DeleteCategory(gomock.Any()).Return(sql.ErrNoRows).Times(1)
 	rec := httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	// 400
+	req = httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set("If-Match", "1")
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	cs.EXPECT().DeleteCategory(gomock.Any(), 1, 0).Return(sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 412
+	req = httptest.NewRequest(echo.DELETE, "/api/categories/2", nil)
+	req.Header.Set("If-Match", `"1"`)
+	cs.EXPECT().DeleteCategory(gomock.Any(), 2, 1).Return(store.ErrConflict).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
 	// 201
 	req = httptest.NewRequest(echo.DELETE, "/api/categories/2", nil)
-	cs.EXPECT().DeleteCategory(gomock.Any()).Return(nil).Times(1)
+	req.Header.Set("If-Match", `"2"`)
+	cs.EXPECT().DeleteCategory(gomock.Any(), 2, 2).Return(nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNoContent, rec.Code)
 }
 
+func TestApi_IfMatchOptional(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	conf.Api.IfMatchOptional = true
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	req := httptest.NewRequest(echo.DELETE, "/api/categories/2", nil)
+	cs.EXPECT().DeleteCategory(gomock.Any(), 2, 0).Return(nil).Times(1)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestApi_RestoreCategory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	// 404
+	req := httptest.NewRequest(echo.POST, "/api/categories/1/restore", nil)
+	cs.EXPECT().RestoreCategory(gomock.Any(), 1).Return(nil, sql.ErrNoRows).Times(1)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 200
+	req = httptest.NewRequest(echo.POST, "/api/categories/2/restore", nil)
+	cat := &model.Category{Id: 2, Name: "test", Version: 3}
+	cs.EXPECT().RestoreCategory(gomock.Any(), 2).Return(cat, nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	res, _ := json.Marshal(cat)
+	assert.Equal(t, string(res), rec.Body.String())
+}
+
 func TestApi_GetProducts(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	ps := mock.NewMockProductService(mockCtrl)
-	api := api.NewApi(conf, nil, ps)
+	api := api.NewApi(conf, nil, ps, nil)
 	req := httptest.NewRequest(echo.GET, "/api/products", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	// 200 [] - ничего не найдено
 	rec := httptest.NewRecorder()
 	var cats []*model.Product
-	ps.EXPECT().GetProducts(gomock.Any()).Return(cats, nil).Times(1)
+	ps.EXPECT().GetProducts(gomock.Any(), gomock.Any(), gomock.Any()).Return(cats, len(cats), nil).Times(1)
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	assert.Equal(t, rec.Body.String(), "[]")
 	// 200 - ок
 	cats = append(cats, &model.Product{Id: 1, Name: "Name1"})
 	cats = append(cats, &model.Product{Id: 2, Name: "Name2"})
-	ps.EXPECT().GetProducts(gomock.Any()).Return(cats, nil).Times(1)
+	ps.EXPECT().GetProducts(gomock.Any(), gomock.Any(), gomock.Any()).Return(cats, len(cats), nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
@@ -172,12 +276,197 @@ func TestApi_GetProducts(t *testing.T) {
 	rec = httptest.NewRecorder()
 	req = httptest.NewRequest(echo.GET, "/api/products?category=2", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	id := 2
-	ps.EXPECT().GetProducts(&id).Return(cats, nil).Times(1)
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{Categories: []int{2}}, gomock.Any()).Return(cats, len(cats), nil).Times(1)
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	res, _ = json.Marshal(cats)
 	assert.Equal(t, rec.Body.String(), string(res))
+	// 200 - продукты всех подкатегорий
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(echo.GET, "/api/products?category=2&recursive=true", nil)
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{Categories: []int{2}, Recursive: true}, gomock.Any()).Return(cats, len(cats), nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 400
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest(echo.GET, "/api/products?category=2&recursive=maybe", nil)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestApi_GetProductsFilter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400
+	for _, q := range []string{"category=a", "category=1,", "ids=1,b", "min_price=x", "max_price=-1", "min_price=10&max_price=5"} {
+		req := httptest.NewRequest(echo.GET, "/api/products?"+q, nil)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+	// 200
+	req := httptest.NewRequest(echo.GET, "/api/products?category=1,2&category=3&ids=4&min_price=1.5&max_price=10&name=foo&desc=bar", nil)
+	rec := httptest.NewRecorder()
+	minPrice, maxPrice := model.Money(150), model.Money(1000)
+	filter := &model.ProductFilter{
+		Ids:         []int{4},
+		Categories:  []int{1, 2, 3},
+		MinPrice:    &minPrice,
+		MaxPrice:    &maxPrice,
+		Name:        "foo",
+		Description: "bar",
+	}
+	ps.EXPECT().GetProducts(gomock.Any(), filter, gomock.Any()).Return(nil, 0, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestApi_GetProductsSort(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	conf.Api.Limit = 2
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400
+	for _, q := range []string{"sort=desc", "sort=name,-name", "sort=price,"} {
+		req := httptest.NewRequest(echo.GET, "/api/products?"+q, nil)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+	// 200 - курсор содержит значения полей сортировки
+	req := httptest.NewRequest(echo.GET, "/api/products?sort=-price,name", nil)
+	rec := httptest.NewRecorder()
+	sort := []model.SortField{{Field: "price", Desc: true}, {Field: "name"}}
+	prods := []*model.Product{{Id: 1, Name: "Name1", Price: 2000}, {Id: 2, Name: "Name2", Price: 1000}}
+	ps.EXPECT().GetProducts(gomock.Any(), gomock.Any(), &model.ListParams{Limit: 2, Sort: sort}).Return(prods, 3, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	cursor := rec.Header().Get("X-Next-Cursor")
+	req = httptest.NewRequest(echo.GET, "/api/products?sort=-price,name&cursor="+cursor, nil)
+	rec = httptest.NewRecorder()
+	after := &model.Cursor{Sort: "-price,name", Values: []interface{}{10.0, "Name2"}, Id: 2}
+	ps.EXPECT().GetProducts(gomock.Any(), gomock.Any(), &model.ListParams{Limit: 2, Sort: sort, After: after}).Return(nil, 3, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 400 - курсор получен для другой сортировки
+	req = httptest.NewRequest(echo.GET, "/api/products?sort=name&cursor="+cursor, nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestApi_GetProductsPage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	conf.Api.Limit = 10
+	conf.Api.MaxLimit = 100
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400
+	for _, q := range []string{"limit=0", "limit=101", "limit=a", "offset=-1"} {
+		req := httptest.NewRequest(echo.GET, "/api/products?"+q, nil)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+	// 200 - размер страницы по умолчанию
+	req := httptest.NewRequest(echo.GET, "/api/products", nil)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{}, &model.ListParams{Limit: 10}).Return([]*model.Product{}, 0, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get("X-Total-Count"))
+	// 200 - страница из середины
+	req = httptest.NewRequest(echo.GET, "/api/products?limit=2&offset=2", nil)
+	rec = httptest.NewRecorder()
+	prods := []*model.Product{{Id: 3, Name: "Name3"}, {Id: 4, Name: "Name4"}}
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{}, &model.ListParams{Limit: 2, Offset: 2}).Return(prods, 7, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "7", rec.Header().Get("X-Total-Count"))
+	link := rec.Header().Get("Link")
+	assert.Contains(t, link, `<http://example.com/api/products?limit=2&offset=0>; rel="prev"`)
+	assert.Contains(t, link, `<http://example.com/api/products?limit=2&offset=4>; rel="next"`)
+	assert.Contains(t, link, `<http://example.com/api/products?limit=2&offset=6>; rel="last"`)
+}
+
+func TestApi_GetProductsCursor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	conf.Api.Limit = 2
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 200 - первая страница отдает курсор следующей
+	req := httptest.NewRequest(echo.GET, "/api/products", nil)
+	rec := httptest.NewRecorder()
+	prods := []*model.Product{{Id: 1, Name: "Name1"}, {Id: 2, Name: "Name2"}}
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{}, &model.ListParams{Limit: 2}).Return(prods, 3, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	cursor := rec.Header().Get("X-Next-Cursor")
+	assert.NotEmpty(t, cursor)
+	// 200 - по курсору
+	req = httptest.NewRequest(echo.GET, "/api/products?cursor="+cursor, nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{}, &model.ListParams{Limit: 2, After: &model.Cursor{Id: 2}}).Return(prods[:1], 3, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("X-Next-Cursor"))
+	// 400 - подделанный курсор
+	req = httptest.NewRequest(echo.GET, "/api/products?cursor=eyJpZCI6MTB9."+cursor[strings.Index(cursor, ".")+1:], nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 400 - курсор вместе с offset
+	req = httptest.NewRequest(echo.GET, "/api/products?offset=2&cursor="+cursor, nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestApi_SearchProducts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400
+	for _, q := range []string{"", "q=+", "q=apple&category=a", "q=apple&sort=name", "q=apple&limit=0"} {
+		req := httptest.NewRequest(echo.GET, "/api/search?"+q, nil)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, q)
+	}
+	// 200
+	req := httptest.NewRequest(echo.GET, "/api/search?q=red+apple&category=1,2&limit=1", nil)
+	rec := httptest.NewRecorder()
+	search := &model.ProductSearch{Query: "red apple", Categories: []int{1, 2}}
+	results := []*model.ProductSearchResult{{
+		Product:    model.Product{Id: 1, Name: "Red Apple"},
+		Rank:       0.5,
+		Highlights: model.ProductHighlights{Name: "<b>Red</b> <b>Apple</b>"},
+	}}
+	ps.EXPECT().SearchProducts(gomock.Any(), search, &model.ListParams{Limit: 1}).Return(results, 2, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get("X-Total-Count"))
+	var res []*model.ProductSearchResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &res))
+	assert.Equal(t, results, res)
+	// ничего не найдено
+	req = httptest.NewRequest(echo.GET, "/api/search?q=pear", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().SearchProducts(gomock.Any(), &model.ProductSearch{Query: "pear"}, gomock.Any()).Return(nil, 0, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
 }
 
 func TestApi_GetProduct(t *testing.T) {
@@ -185,22 +474,61 @@ func TestApi_GetProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	ps := mock.NewMockProductService(mockCtrl)
-	api := api.NewApi(conf, nil, ps)
+	api := api.NewApi(conf, nil, ps, nil)
 	req := httptest.NewRequest(echo.GET, "/api/products/2", nil)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	// 404
 	rec := httptest.NewRecorder()
-	ps.EXPECT().GetProduct(2).Return(nil, nil).Times(1)
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(nil, nil).Times(1)
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
 	// 200
 	cat := &model.Product{Id: 2, Name: "Name2"}
-	ps.EXPECT().GetProduct(2).Return(cat, nil).Times(1)
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(cat, nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusOK, rec.Code)
 	res, _ := json.Marshal(cat)
 	assert.Equal(t, rec.Body.String(), string(res))
+	// 400
+	req = httptest.NewRequest(echo.GET, "/api/products/abc", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Bad request param `id`")
+}
+
+func TestApi_GetDeletedProduct(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	deletedAt := time.Now()
+	prod := &model.Product{Id: 2, Name: "Name2", DeletedAt: &deletedAt}
+	// 404
+	req := httptest.NewRequest(echo.GET, "/api/products/2", nil)
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(prod, nil).Times(1)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 400
+	req = httptest.NewRequest(echo.GET, "/api/products/2?include_deleted=yes", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 200
+	req = httptest.NewRequest(echo.GET, "/api/products/2?include_deleted=true", nil)
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(prod, nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// список с удаленными
+	req = httptest.NewRequest(echo.GET, "/api/products?include_deleted=true", nil)
+	ps.EXPECT().GetProducts(gomock.Any(), gomock.Any(), &model.ListParams{IncludeDeleted: true}).Return(nil, 0, nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
 }
 
 func TestApi_CreateProduct(t *testing.T) {
@@ -208,7 +536,9 @@ func TestApi_CreateProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	ps := mock.NewMockProductService(mockCtrl)
-	api := api.NewApi(conf, nil, ps)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
 	// 400
 	catJSON := `{"name": "test","description":"test","category":1}`
 	req := httptest.NewRequest(echo.POST, "/api/products/", strings.NewReader(catJSON))
@@ -221,7 +551,7 @@ func TestApi_CreateProduct(t *testing.T) {
 	id := 2
 	req = httptest.NewRequest(echo.POST, "/api/products/", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	ps.EXPECT().CreateProduct(gomock.Any()).Return(&id, nil).Times(1)
+	ps.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(&id, nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusCreated, rec.Code)
@@ -235,7 +565,9 @@ func TestApi_UpdateProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	ps := mock.NewMockProductService(mockCtrl)
-	api := api.NewApi(conf, nil, ps)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
 	// 400
 	catJSON := `{"name": "test","description":"test","category":1}`
 	req := httptest.NewRequest(echo.PUT, "/api/products/2", strings.NewReader(catJSON))
@@ -243,22 +575,42 @@ func TestApi_UpdateProduct(t *testing.T) {
 	rec := httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusBadRequest, rec.Code)
-	// 404
+	// 428
 	catJSON = `{"name": "test","description":"test","category":1,"price":10.1}`
 	req = httptest.NewRequest(echo.PUT, "/api/products/1", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	ps.EXPECT().UpdateProduct(gomock.Any()).Return(sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.PUT, "/api/products/1", strings.NewReader(catJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	ps.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).Return(sql.ErrNoRows).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Product `id` = 1 not found")
+	// 412
+	req = httptest.NewRequest(echo.PUT, "/api/products/2", strings.NewReader(catJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", `"1"`)
+	ps.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).Return(store.ErrConflict).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
 	// 204
-	catJSON = `{"name": "test","description":"test","category":1,"price":10.1}`
 	req = httptest.NewRequest(echo.PUT, "/api/products/2", strings.NewReader(catJSON))
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	ps.EXPECT().UpdateProduct(gomock.Any()).Return(nil).Times(1)
+	req.Header.Set("If-Match", `"2"`)
+	product := &model.Product{Id: 2, Name: "test", Category: 1, Price: 1010, Version: 2}
+	ps.EXPECT().UpdateProduct(gomock.Any(), product).Do(func(_ context.Context, p *model.Product) {
+		p.Version = 3
+	}).Return(nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
 }
 
 func TestApi_DeleteProduct(t *testing.T) {
@@ -266,18 +618,880 @@ func TestApi_DeleteProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 	conf := &config.Config{LogLevel: 5}
 	ps := mock.NewMockProductService(mockCtrl)
-	api := api.NewApi(conf, nil, ps)
-	// 404
+	api := api.NewApi(conf, nil, ps, nil)
+	// 428
 	req := httptest.NewRequest(echo.DELETE, "/api/products/1", nil)
-	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	ps.EXPECT().DeleteProduct(gomock.Any()).Return(sql.ErrNoRows).Times(1)
 	rec := httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.DELETE, "/api/products/1", nil)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	ps.EXPECT().DeleteProduct(gomock.Any(), 1, 0).Return(sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 412
+	req = httptest.NewRequest(echo.DELETE, "/api/products/2", nil)
+	req.Header.Set("If-Match", `"1"`)
+	ps.EXPECT().DeleteProduct(gomock.Any(), 2, 1).Return(store.ErrConflict).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
 	// 201
 	req = httptest.NewRequest(echo.DELETE, "/api/products/2", nil)
-	ps.EXPECT().DeleteProduct(gomock.Any()).Return(nil).Times(1)
+	req.Header.Set("If-Match", `"2"`)
+	ps.EXPECT().DeleteProduct(gomock.Any(), 2, 2).Return(nil).Times(1)
 	rec = httptest.NewRecorder()
 	api.Http.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusNoContent, rec.Code)
 }
+
+func TestApi_RequestContext(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	conf.Api.Timeout = 30
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	// 200 - в сервис передается контекст запроса с ограничением времени
+	req := httptest.NewRequest(echo.GET, "/api/categories/2", nil)
+	rec := httptest.NewRecorder()
+	cs.EXPECT().GetCategory(gomock.Any(), 2).DoAndReturn(func(ctx context.Context, id int) (*model.Category, error) {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return &model.Category{Id: id, Name: "Name2"}, nil
+	}).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 499 - клиент отменил запрос
+	reqCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req = httptest.NewRequest(echo.GET, "/api/categories/2", nil).WithContext(reqCtx)
+	rec = httptest.NewRecorder()
+	cs.EXPECT().GetCategory(gomock.Any(), 2).Return(nil, context.Canceled).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, 499, rec.Code)
+	// 503 - истекло время обработки запроса
+	reqCtx, cancel = context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	req = httptest.NewRequest(echo.GET, "/api/categories/2", nil).WithContext(reqCtx)
+	rec = httptest.NewRecorder()
+	cs.EXPECT().GetCategory(gomock.Any(), 2).Return(nil, context.DeadlineExceeded).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	// 500 - прочие ошибки не меняются
+	req = httptest.NewRequest(echo.GET, "/api/categories/2", nil)
+	rec = httptest.NewRecorder()
+	cs.EXPECT().GetCategory(gomock.Any(), 2).Return(nil, errors.New("test")).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestApi_GetDbStats(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	as := mock.NewMockAdminService(mockCtrl)
+	api := api.NewApi(conf, nil, nil, as)
+	req := httptest.NewRequest(echo.GET, "/api/admin/db/stats", nil)
+	rec := httptest.NewRecorder()
+	stats := &model.DbStats{MaxOpenConnections: 25, OpenConnections: 3, InUse: 2, Idle: 1, WaitCount: 4, WaitDuration: 120}
+	as.EXPECT().GetDbStats().Return(stats).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	res, _ := json.Marshal(stats)
+	assert.JSONEq(t, string(res), rec.Body.String())
+	assert.Contains(t, rec.Body.String(), `"wait_duration_ms":120`)
+}
+
+func TestApi_GetCategoryTree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	root := 1
+	tree := model.NewCategoryTree([]*model.Category{{Id: 1, Name: "root"}, {Id: 2, Name: "child", ParentId: &root}})
+	cs.EXPECT().GetCategoryTree(gomock.Any()).Return(tree, nil).Times(1)
+	req := httptest.NewRequest(echo.GET, "/api/categories/tree", nil)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[{"id":1,"name":"root","parent_id":null,"version":0,"children":[`+
+		`{"id":2,"name":"child","parent_id":1,"version":0,"children":[]}]}]`, rec.Body.String())
+}
+
+func TestApi_GetCategoryAncestors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	// 400
+	req := httptest.NewRequest(echo.GET, "/api/categories/x/ancestors", nil)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.GET, "/api/categories/3/ancestors", nil)
+	rec = httptest.NewRecorder()
+	cs.EXPECT().GetCategoryAncestors(gomock.Any(), 3).Return(nil, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 200
+	ancestors := []*model.Category{{Id: 1, Name: "root"}, {Id: 2, Name: "child"}}
+	req = httptest.NewRequest(echo.GET, "/api/categories/3/ancestors", nil)
+	rec = httptest.NewRecorder()
+	cs.EXPECT().GetCategoryAncestors(gomock.Any(), 3).Return(ancestors, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	res, _ := json.Marshal(ancestors)
+	assert.Equal(t, string(res), rec.Body.String())
+}
+
+func TestApi_GetProductEmbedVariants(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400
+	req := httptest.NewRequest(echo.GET, "/api/products/2?embed=images", nil)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 200
+	variants := []*model.Variant{{Id: 1, Product: 2, Sku: "SKU-M", Options: map[string]string{"size": "M"}}}
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(&model.Product{Id: 2, Name: "Name2"}, nil).Times(1)
+	ps.EXPECT().GetVariants(gomock.Any(), 2).Return(variants, nil).Times(1)
+	req = httptest.NewRequest(echo.GET, "/api/products/2?embed=variants", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	res, _ := json.Marshal(&model.Product{Id: 2, Name: "Name2", Variants: variants})
+	assert.Equal(t, string(res), rec.Body.String())
+}
+
+func TestApi_Variants(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 404 - продукта нет
+	req := httptest.NewRequest(echo.GET, "/api/products/2/variants", nil)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().GetVariants(gomock.Any(), 2).Return(nil, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 200
+	req = httptest.NewRequest(echo.GET, "/api/products/2/variants", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetVariants(gomock.Any(), 2).Return([]*model.Variant{}, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "[]", rec.Body.String())
+	// 200 - вариант
+	req = httptest.NewRequest(echo.GET, "/api/products/2/variants/5", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetVariant(gomock.Any(), 2, 5).Return(&model.Variant{Id: 5, Product: 2, Sku: "SKU", Version: 3}, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	// 400 - нет артикула
+	req = httptest.NewRequest(echo.POST, "/api/products/2/variants", strings.NewReader(`{"price": 10}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 409 - артикул занят
+	variantJSON := `{"sku": "SKU", "price": 10, "options": {"size": "M"}}`
+	price := model.Money(1000)
+	variant := &model.Variant{Product: 2, Sku: "SKU", Price: &price, Options: map[string]string{"size": "M"}}
+	req = httptest.NewRequest(echo.POST, "/api/products/2/variants", strings.NewReader(variantJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CreateVariant(gomock.Any(), variant).Return(nil, store.ErrDuplicate).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	// 201
+	id := 5
+	req = httptest.NewRequest(echo.POST, "/api/products/2/variants", strings.NewReader(variantJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CreateVariant(gomock.Any(), variant).DoAndReturn(func(_ context.Context, v *model.Variant) (*int, error) {
+		v.Version = 1
+		return &id, nil
+	}).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	// 412
+	req = httptest.NewRequest(echo.PUT, "/api/products/2/variants/5", strings.NewReader(variantJSON))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", `"1"`)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().UpdateVariant(gomock.Any(), &model.Variant{Id: 5, Product: 2, Sku: "SKU", Price: &price, Options: map[string]string{"size": "M"}, Version: 1}).Return(store.ErrConflict).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	// 404
+	req = httptest.NewRequest(echo.DELETE, "/api/products/2/variants/5", nil)
+	req.Header.Set("If-Match", "*")
+	rec = httptest.NewRecorder()
+	ps.EXPECT().DeleteVariant(gomock.Any(), 2, 5, 0).Return(sql.ErrNoRows).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 204
+	req = httptest.NewRequest(echo.DELETE, "/api/products/2/variants/5", nil)
+	req.Header.Set("If-Match", `"2"`)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().DeleteVariant(gomock.Any(), 2, 5, 2).Return(nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestApi_Stock(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	conf.Api.ReservationTtl = 60
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 404 - продукта нет
+	req := httptest.NewRequest(echo.GET, "/api/products/2/stock", nil)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().GetStock(gomock.Any(), 2).Return(nil, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 400 - причину reservation нельзя указать вручную
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/adjustments", strings.NewReader(`{"delta": -1, "reason": "reservation"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 409 - остатка не хватает
+	adjustment := &model.StockAdjustment{Product: 2, Delta: -1, Reason: model.StockLoss}
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/adjustments", strings.NewReader(`{"delta": -1, "reason": "loss"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().AdjustStock(gomock.Any(), adjustment).Return(nil, store.ErrInsufficientStock).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	// 201 - в ответе новый остаток
+	id := 1
+	stock := &model.Stock{Product: 2, OnHand: 4, Available: 4}
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/adjustments", strings.NewReader(`{"delta": -1, "reason": "loss"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().AdjustStock(gomock.Any(), adjustment).Return(&id, nil).Times(1)
+	ps.EXPECT().GetStock(gomock.Any(), 2).Return(stock, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	res, _ := json.Marshal(stock)
+	assert.Equal(t, string(res), rec.Body.String())
+	// 200 - журнал
+	req = httptest.NewRequest(echo.GET, "/api/products/2/stock/adjustments?sort=-id", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetStockAdjustments(gomock.Any(), 2, gomock.Any()).Return([]*model.StockAdjustment{{Id: 1, Product: 2, Delta: -1, Reason: model.StockLoss}}, 1, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("X-Total-Count"))
+}
+
+func TestApi_Reservations(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	conf.Api.ReservationTtl = 60
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 400 - количество должно быть положительным
+	req := httptest.NewRequest(echo.POST, "/api/products/2/stock/reservations", strings.NewReader(`{"quantity": -1}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 201 - срок резерва по умолчанию из конфига
+	id := 7
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/reservations", strings.NewReader(`{"quantity": 2}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	start := time.Now()
+	ps.EXPECT().CreateReservation(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, r *model.StockReservation) (*int, error) {
+		assert.Equal(t, 2, r.Product)
+		assert.Equal(t, 2, r.Quantity)
+		assert.WithinDuration(t, start.Add(time.Minute), r.ExpiresAt, 5*time.Second)
+		r.Status = model.ReservationActive
+		return &id, nil
+	}).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	reservation := &model.StockReservation{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), reservation))
+	assert.Equal(t, id, reservation.Id)
+	assert.Equal(t, model.ReservationActive, reservation.Status)
+	// 409 - резервировать нечего
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/reservations", strings.NewReader(`{"quantity": 2, "ttl": 10}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CreateReservation(gomock.Any(), gomock.Any()).Return(nil, store.ErrInsufficientStock).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	// 404 - резерва нет
+	req = httptest.NewRequest(echo.GET, "/api/products/2/stock/reservations/7", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetReservation(gomock.Any(), 2, 7).Return(nil, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 409 - резерв уже закрыт
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/reservations/7/commit", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CommitReservation(gomock.Any(), 2, 7).Return(nil, store.ErrReservationClosed).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	// 200
+	req = httptest.NewRequest(echo.POST, "/api/products/2/stock/reservations/7/release", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().ReleaseReservation(gomock.Any(), 2, 7).Return(&model.StockReservation{Id: 7, Product: 2, Quantity: 2, Status: model.ReservationReleased}, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestApi_ProductCurrency(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	conf.Api.Currency = "RUB"
+	ps := mock.NewMockProductService(mockCtrl)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
+	// 400 - больше двух знаков после запятой, повтор валюты
+	for _, body := range []string{
+		`{"name": "test", "category": 1, "price": 10.001}`,
+		`{"name": "test", "category": 1, "price": 10, "prices": [{"currency": "usd", "amount": 1}, {"currency": "USD", "amount": 2}]}`,
+		`{"name": "test", "category": 1, "price": 10, "prices": [{"currency": "RUB", "amount": 1}]}`,
+		`{"name": "test", "category": 1, "price": 10, "currency": "RUBLE"}`,
+	} {
+		req := httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	// 201 - валюта по умолчанию из конфига, коды в верхнем регистре
+	id := 2
+	req := httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "test", "category": 1, "price": "19.99", "prices": [{"currency": "usd", "amount": 0.3}]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().CreateProduct(gomock.Any(), &model.Product{Name: "test", Category: 1, Price: 1999, Currency: "RUB",
+		Prices: []model.ProductPrice{{Currency: "USD", Amount: 30}}}).Return(&id, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	// 200 - цена в запрошенной валюте
+	product := &model.Product{Id: 2, Name: "test", Category: 1, Price: 1999, Currency: "RUB", Prices: []model.ProductPrice{{Currency: "USD", Amount: 30}}}
+	ps.EXPECT().GetProduct(gomock.Any(), 2).DoAndReturn(func(_ context.Context, _ int) (*model.Product, error) {
+		p := *product
+		return &p, nil
+	}).Times(2)
+	req = httptest.NewRequest(echo.GET, "/api/products/2?currency=usd", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"price":0.30,"currency":"USD","prices":[{"currency":"RUB","amount":19.99}]`)
+	// 404 - цены в валюте нет
+	req = httptest.NewRequest(echo.GET, "/api/products/2?currency=EUR", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 400 - некорректный код валюты
+	req = httptest.NewRequest(echo.GET, "/api/products?currency=12", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestApi_PriceHistory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 404
+	req := httptest.NewRequest(echo.GET, "/api/products/2/prices", nil)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().GetPriceHistory(gomock.Any(), 2, gomock.Any()).Return(nil, 0, sql.ErrNoRows).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 200
+	price := model.Money(1000)
+	req = httptest.NewRequest(echo.GET, "/api/products/2/prices", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetPriceHistory(gomock.Any(), 2, gomock.Any()).Return([]*model.PriceChange{{Id: 1, Product: 2, Currency: "RUB", NewPrice: &price}}, 1, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"old_price":null,"new_price":10.00`)
+	// 400 - некорректное время
+	req = httptest.NewRequest(echo.GET, "/api/products/2?at=yesterday", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 200 - цена на момент at
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	req = httptest.NewRequest(echo.GET, "/api/products/2?at=2026-03-01T15:00:00%2B03:00", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProductAt(gomock.Any(), 2, gomock.Any()).DoAndReturn(func(_ context.Context, _ int, t2 time.Time) (*model.Product, error) {
+		assert.True(t, at.Equal(t2))
+		return &model.Product{Id: 2, Name: "test", Price: price, Currency: "RUB"}, nil
+	}).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 404 - цен в тот момент не было
+	req = httptest.NewRequest(echo.GET, "/api/products/2?at=2020-01-01T00:00:00Z", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProductAt(gomock.Any(), 2, gomock.Any()).Return(nil, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestApi_RequestUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	ps := mock.NewMockProductService(mockCtrl)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
+	req := httptest.NewRequest(echo.PUT, "/api/products/2", strings.NewReader(`{"name": "test", "category": 1, "price": 10}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", "*")
+	req.Header.Set("X-User", "manager")
+	rec := httptest.NewRecorder()
+	ps.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ *model.Product) error {
+		assert.Equal(t, "manager", model.UserFromContext(ctx))
+		return nil
+	}).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
+
+func TestApi_Tags(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	ps := mock.NewMockProductService(mockCtrl)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
+	req := httptest.NewRequest(echo.GET, "/api/tags", nil)
+	rec := httptest.NewRecorder()
+	ps.EXPECT().GetTags(gomock.Any()).Return([]*model.Tag{{Name: "red", Count: 2}}, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `[{"name":"red","count":2}]`, strings.TrimSpace(rec.Body.String()))
+	// 400 - неизвестный режим
+	req = httptest.NewRequest(echo.GET, "/api/products?tag=red&tag_mode=some", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// фильтр по тегам
+	req = httptest.NewRequest(echo.GET, "/api/products?tag=Red,fruit&tag=berry&tag=red&tag_mode=all", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{Tags: []string{"red", "fruit", "berry"}, AllTags: true}, gomock.Any()).Return(nil, 0, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// теги продукта приводятся к нижнему регистру без повторов
+	id := 2
+	req = httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "test", "category": 1, "price": 10, "tags": ["Red", " red", "fruit"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CreateProduct(gomock.Any(), &model.Product{Name: "test", Category: 1, Price: 1000, Tags: []string{"fruit", "red"}}).Return(&id, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestApi_ProductAttributes(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 0}
+	cs := mock.NewMockCategoryService(mockCtrl)
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, cs, ps, nil)
+	// 400 - некорректная схема категории
+	req := httptest.NewRequest(echo.POST, "/api/categories", strings.NewReader(`{"name": "electronics", "attribute_schema": {"type": 1}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 400 - атрибуты не подходят под схему, ошибки по атрибутам
+	schema := model.JsonObject{}
+	json.Unmarshal([]byte(voltageSchema), &schema)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "electronics", AttributeSchema: schema}, nil).Times(2)
+	req = httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "kettle", "category": 1, "price": 10, "attributes": {"plug": 1}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	res := &struct {
+		Code   string                 `json:"code"`
+		Errors []model.AttributeError `json:"errors"`
+	}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), res))
+	assert.Equal(t, "invalid_attributes", res.Code)
+	assert.Equal(t, 2, len(res.Errors))
+	assert.Equal(t, "application/problem+json", rec.Header().Get(echo.HeaderContentType))
+	// 201
+	id := 2
+	req = httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "kettle", "category": 1, "price": 10, "attributes": {"voltage": 220}}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().CreateProduct(gomock.Any(), &model.Product{Name: "kettle", Category: 1, Price: 1000,
+		Attributes: model.JsonObject{"voltage": 220.0}}).Return(&id, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	// фильтр по атрибутам
+	req = httptest.NewRequest(echo.GET, "/api/products?attr.voltage=220&attr.plug=C", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProducts(gomock.Any(), &model.ProductFilter{Attributes: map[string]string{"voltage": "220", "plug": "C"}}, gomock.Any()).Return(nil, 0, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// 400 - некорректное имя атрибута
+	req = httptest.NewRequest(echo.GET, "/api/products?attr.a-b=1", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+// Запрос на загрузку файла data в поле image формы
+func imageUpload(path string, data []byte) *http.Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, _ := w.CreateFormFile("image", "image.png")
+	part.Write(data)
+	w.Close()
+	req := httptest.NewRequest(echo.POST, path, body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func TestApi_Images(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf, cleanup := imagesConfig(t)
+	defer cleanup()
+	ps := mock.NewMockProductService(mockCtrl)
+	api := api.NewApi(conf, nil, ps, nil)
+	// 415 - не изображение
+	rec := httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, imageUpload("/api/products/2/images", []byte("just text")))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	// 413 - слишком большое изображение
+	big := append(testPng(10, 10), make([]byte, conf.Images.MaxSize)...)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, imageUpload("/api/products/2/images", big))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	// 413 - тело без Content-Length обрезается по images.maxsize
+	req := imageUpload("/api/products/2/images", big)
+	req.ContentLength = -1
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	// 413 - маленький файл, заявляющий изображение больше images.maxpixels
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, imageUpload("/api/products/2/images", testPngHeader(30000, 30000)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), "pixels")
+	// 404
+	ps.EXPECT().CreateImage(gomock.Any(), gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, imageUpload("/api/products/2/images", testPng(10, 10)))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 201
+	ps.EXPECT().CreateImage(gomock.Any(), &model.ProductImage{Product: 2, ContentType: "image/png"}).DoAndReturn(func(_ context.Context, image *model.ProductImage) (*int, error) {
+		image.Id = 5
+		return &image.Id, nil
+	}).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, imageUpload("/api/products/2/images", testPng(10, 10)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	image := &model.ProductImage{}
+	json.Unmarshal(rec.Body.Bytes(), image)
+	assert.Equal(t, "/images/2/5.png", image.Url)
+	assert.Equal(t, "/images/2/5_100.png", image.Thumbnails["100"])
+	// изображения отдаются с заголовком кэширования
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(&model.Product{Id: 2}, nil).Times(1)
+	req = httptest.NewRequest(echo.GET, image.Thumbnails["10"], nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "public, max-age=60", rec.Header().Get("Cache-Control"))
+	// файлы удаленного продукта остаются для восстановления, но не отдаются
+	deletedAt := time.Now()
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(&model.Product{Id: 2, DeletedAt: &deletedAt}, nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, httptest.NewRequest(echo.GET, image.Url, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Empty(t, rec.Header().Get("Cache-Control"))
+	assert.FileExists(t, filepath.Join(conf.Images.Dir, "2", "5.png"))
+	ps.EXPECT().GetProduct(gomock.Any(), 3).Return(nil, nil).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/images/3/5.png", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// url изображений в продукте
+	req = httptest.NewRequest(echo.GET, "/api/products/2", nil)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().GetProduct(gomock.Any(), 2).Return(&model.Product{Id: 2, Images: []*model.ProductImage{{Id: 5, Product: 2, ContentType: "image/png"}}}, nil).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"url":"/images/2/5.png"`)
+	// 400 - переданы не все изображения
+	req = httptest.NewRequest(echo.PUT, "/api/products/2/images/order", strings.NewReader(`{"ids": [5]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec = httptest.NewRecorder()
+	ps.EXPECT().ReorderImages(gomock.Any(), 2, []int{5}).Return(nil, store.ErrImageOrder).Times(1)
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 204 - файлы изображения удаляются
+	ps.EXPECT().DeleteImage(gomock.Any(), 2, 5).Return(&model.ProductImage{Id: 5, Product: 2, ContentType: "image/png"}, nil).Times(1)
+	req = httptest.NewRequest(echo.DELETE, "/api/products/2/images/5", nil)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err := os.Stat(filepath.Join(conf.Images.Dir, "2", "5.png"))
+	assert.True(t, os.IsNotExist(err))
+	// 404
+	ps.EXPECT().DeleteImage(gomock.Any(), 2, 5).Return(nil, sql.ErrNoRows).Times(1)
+	rec = httptest.NewRecorder()
+	api.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestApi_PatchProduct(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	ps := mock.NewMockProductService(mockCtrl)
+	// схема категории читается только через lookup сервиса продуктов, не через сервис категорий
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, ps, nil)
+	var schema model.JsonObject
+	lookup := func(id int) (*model.Category, error) {
+		return &model.Category{Id: id, Name: "test", AttributeSchema: schema}, nil
+	}
+	current := func() *model.Product {
+		return &model.Product{Id: 2, Name: "test", Category: 1, Price: 1000, Currency: "USD", Tags: []string{"a"}, Version: 2}
+	}
+	// изменение применяется к текущему продукту
+	patched := func(patch model.ProductPatch) (*model.Product, error) {
+		prod, err := patch(current(), lookup)
+		if err != nil {
+			return nil, err
+		}
+		prod.Version = 3
+		return prod, nil
+	}
+	patch := func(contentType, body, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.PATCH, "/api/products/2", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		return rec
+	}
+	// 428
+	rec := patch("application/merge-patch+json", `{"price": 20}`, "")
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+	// 415
+	rec = patch(echo.MIMEApplicationJSON, `{"price": 20}`, "*")
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	// 400 - некорректный json patch
+	rec = patch("application/json-patch+json", `{"op": "replace"}`, "*")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 404
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 0, gomock.Any()).Return(nil, sql.ErrNoRows).Times(1)
+	rec = patch("application/merge-patch+json", `{"price": 20}`, "*")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	// 412
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 1, gomock.Any()).Return(nil, store.ErrConflict).Times(1)
+	rec = patch("application/merge-patch+json", `{"price": 20}`, `"1"`)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	// 400 - результат не проходит валидацию
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 2, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ int, p model.ProductPatch) (*model.Product, error) {
+			return patched(p)
+		}).Times(1)
+	rec = patch("application/merge-patch+json", `{"name": null}`, `"2"`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 400 - операция json patch не применяется
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 2, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ int, p model.ProductPatch) (*model.Product, error) {
+			return patched(p)
+		}).Times(1)
+	rec = patch("application/json-patch+json", `[{"op": "test", "path": "/name", "value": "other"}]`, `"2"`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 200 - merge patch
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 2, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ int, p model.ProductPatch) (*model.Product, error) {
+			return patched(p)
+		}).Times(1)
+	rec = patch("application/merge-patch+json; charset=utf-8", `{"price": 20.5, "tags": ["B", "a"]}`, `"2"`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	prod := &model.Product{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), prod))
+	assert.Equal(t, "test", prod.Name)
+	assert.Equal(t, 2050, int(prod.Price))
+	assert.Equal(t, []string{"a", "b"}, prod.Tags)
+	// 200 - json patch
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 0, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ int, p model.ProductPatch) (*model.Product, error) {
+			return patched(p)
+		}).Times(1)
+	rec = patch("application/json-patch+json", `[{"op": "test", "path": "/name", "value": "test"}, {"op": "replace", "path": "/name", "value": "new"}]`, "*")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	prod = &model.Product{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), prod))
+	assert.Equal(t, "new", prod.Name)
+	assert.Equal(t, 1000, int(prod.Price))
+	// 400 - атрибуты не проходят схему категории из lookup
+	schema = model.JsonObject{"type": "object", "required": []interface{}{"voltage"}}
+	ps.EXPECT().PatchProduct(gomock.Any(), 2, 0, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ int, _ int, p model.ProductPatch) (*model.Product, error) {
+			return patched(p)
+		}).Times(1)
+	rec = patch("application/merge-patch+json", `{"attributes": {"power": 5}}`, "*")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "voltage")
+	// 413 - тело больше лимита
+	rec = patch("application/merge-patch+json", `{"description": "`+strings.Repeat("a", 1<<20)+`"}`, "*")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
+
+func TestApi_PatchCategory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	cs := mock.NewMockCategoryService(mockCtrl)
+	api := api.NewApi(conf, cs, nil, nil)
+	patched := func(_ context.Context, _ int, _ int, p model.CategoryPatch) (*model.Category, error) {
+		return p(&model.Category{Id: 2, Name: "test", Version: 2})
+	}
+	patch := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.PATCH, "/api/categories/2", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		req.Header.Set("If-Match", `"2"`)
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		return rec
+	}
+	// 400 - родитель в поддереве категории
+	cs.EXPECT().PatchCategory(gomock.Any(), 2, 2, gomock.Any()).Return(nil, store.ErrCycle).Times(1)
+	rec := patch("application/merge-patch+json", `{"parent_id": 3}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 400 - некорректная схема атрибутов
+	cs.EXPECT().PatchCategory(gomock.Any(), 2, 2, gomock.Any()).DoAndReturn(patched).Times(1)
+	rec = patch("application/merge-patch+json", `{"attribute_schema": {"type": 1}}`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	// 200
+	cs.EXPECT().PatchCategory(gomock.Any(), 2, 2, gomock.Any()).DoAndReturn(patched).Times(1)
+	rec = patch("application/json-patch+json", `[{"op": "replace", "path": "/name", "value": "patched"}]`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	cat := &model.Category{}
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), cat))
+	assert.Equal(t, 2, cat.Id)
+	assert.Equal(t, "patched", cat.Name)
+}
+
+func TestApi_Problem(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	conf := &config.Config{LogLevel: 5}
+	ps := mock.NewMockProductService(mockCtrl)
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+	api := api.NewApi(conf, cs, ps, nil)
+	type fieldError struct {
+		Field   string `json:"field"`
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	type problem struct {
+		Type      string       `json:"type"`
+		Title     string       `json:"title"`
+		Status    int          `json:"status"`
+		Detail    string       `json:"detail"`
+		Instance  string       `json:"instance"`
+		RequestId string       `json:"request_id"`
+		Code      string       `json:"code"`
+		Errors    []fieldError `json:"errors"`
+	}
+	serve := func(req *http.Request) (*httptest.ResponseRecorder, *problem) {
+		rec := httptest.NewRecorder()
+		api.Http.ServeHTTP(rec, req)
+		res := &problem{}
+		assert.Equal(t, "application/problem+json", rec.Header().Get(echo.HeaderContentType))
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), res))
+		return rec, res
+	}
+	// 400 - ошибки валидации по полям с именами из json
+	req := httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "ab", "prices": [{"currency": "RU", "amount": 1}]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec, res := serve(req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "/problems/validation_failed", res.Type)
+	assert.Equal(t, "Bad Request", res.Title)
+	assert.Equal(t, http.StatusBadRequest, res.Status)
+	assert.Equal(t, "/api/products", res.Instance)
+	assert.Equal(t, "req-1", res.RequestId)
+	assert.Equal(t, "validation_failed", res.Code)
+	assert.Contains(t, res.Errors, fieldError{Field: "name", Code: "min", Message: "must be at least 3"})
+	assert.Contains(t, res.Errors, fieldError{Field: "category", Code: "required", Message: "is required"})
+	assert.Contains(t, res.Errors, fieldError{Field: "prices[0].currency", Code: "len", Message: "must have length 3"})
+	// 404 - описание с id, id запроса создается, если его нет в запросе
+	ps.EXPECT().GetProduct(gomock.Any(), 7).Return(nil, nil).Times(1)
+	rec, res = serve(httptest.NewRequest(echo.GET, "/api/products/7", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "not_found", res.Code)
+	assert.Equal(t, "Product `id` = 7 not found", res.Detail)
+	assert.NotEmpty(t, res.RequestId)
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), res.RequestId)
+	// 422 - нарушение внешнего ключа
+	req = httptest.NewRequest(echo.POST, "/api/products", strings.NewReader(`{"name": "test", "category": 9, "price": 10}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	ps.EXPECT().CreateProduct(gomock.Any(), gomock.Any()).Return(nil, store.ErrForeignKey).Times(1)
+	rec, res = serve(req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Equal(t, "foreign_key_violation", res.Code)
+	// 409 - нарушение уникальности
+	req = httptest.NewRequest(echo.POST, "/api/products/2/variants", strings.NewReader(`{"sku": "SKU"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	ps.EXPECT().CreateVariant(gomock.Any(), gomock.Any()).Return(nil, store.ErrDuplicate).Times(1)
+	rec, res = serve(req)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "duplicate_value", res.Code)
+	assert.Equal(t, "Variant with the same `sku` already exists", res.Detail)
+	// 412 - версия изменилась
+	req = httptest.NewRequest(echo.PUT, "/api/products/2", strings.NewReader(`{"name": "test", "category": 1, "price": 10}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("If-Match", `"1"`)
+	ps.EXPECT().UpdateProduct(gomock.Any(), gomock.Any()).Return(store.ErrConflict).Times(1)
+	rec, res = serve(req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	assert.Equal(t, "version_conflict", res.Code)
+	// 500 - текст внутренней ошибки не отдается клиенту
+	ps.EXPECT().GetProduct(gomock.Any(), 8).Return(nil, errors.New("connection refused")).Times(1)
+	rec, res = serve(httptest.NewRequest(echo.GET, "/api/products/8", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "internal_error", res.Code)
+	assert.Equal(t, "Internal Server Error", res.Detail)
+	// 404 - неизвестный путь
+	rec, res = serve(httptest.NewRequest(echo.GET, "/api/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "not_found", res.Code)
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"echo-rest-api/model"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const voltageSchema = `{"type": "object", "required": ["voltage"], "properties": {"voltage": {"type": "integer", "minimum": 1}, "plug": {"type": "string"}}}`
+
+func TestAttributes_Validate(t *testing.T) {
+	schema := model.JsonObject{}
+	assert.NoError(t, json.Unmarshal([]byte(voltageSchema), &schema))
+	assert.NoError(t, model.CheckAttributeSchema(schema))
+	assert.Error(t, model.CheckAttributeSchema(model.JsonObject{"type": 1}))
+	errs, err := model.ValidateAttributes(schema, model.JsonObject{"voltage": 220.0, "plug": "C"})
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	// без схемы подходят любые атрибуты
+	errs, _ = model.ValidateAttributes(nil, model.JsonObject{"voltage": "high"})
+	assert.Empty(t, errs)
+	errs, _ = model.ValidateAttributes(schema, nil)
+	assert.Equal(t, 1, len(errs))
+	assert.Equal(t, "voltage", errs[0].Field)
+	errs, _ = model.ValidateAttributes(schema, model.JsonObject{"voltage": 0.0, "plug": 1.0})
+	assert.Equal(t, 2, len(errs))
+	fields := []string{errs[0].Field, errs[1].Field}
+	assert.ElementsMatch(t, []string{"voltage", "plug"}, fields)
+}
+
+func TestAttributes_Filter(t *testing.T) {
+	p := &model.Product{Attributes: model.JsonObject{"voltage": 220.0, "fabric": "cotton", "wireless": true}}
+	assert.True(t, p.HasAttributes(nil))
+	assert.True(t, p.HasAttributes(map[string]string{"voltage": "220", "fabric": "cotton"}))
+	assert.True(t, p.HasAttributes(map[string]string{"wireless": "true"}))
+	assert.False(t, p.HasAttributes(map[string]string{"voltage": "110"}))
+	assert.False(t, p.HasAttributes(map[string]string{"color": "red"}))
+	// значение из БД
+	var o model.JsonObject
+	assert.NoError(t, o.Scan([]byte(`{"voltage": 220}`)))
+	assert.Equal(t, model.JsonObject{"voltage": 220.0}, o)
+	v, _ := o.Value()
+	assert.Equal(t, `{"voltage":220}`, v)
+	o = nil
+	v, _ = o.Value()
+	assert.Nil(t, v)
+}
@@ -0,0 +1,376 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"echo-rest-api/api"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"echo-rest-api/test/mock"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const authSecret = "test-secret"
+
+// Конфиг с проверкой токенов HS256
+func authConfig() *config.Config {
+	conf := &config.Config{LogLevel: 5}
+	conf.Auth.Enabled = true
+	conf.Auth.Algorithm = "HS256"
+	conf.Auth.Secret = authSecret
+	conf.Auth.Issuer = "https://auth.example.com"
+	conf.Auth.Audience = "catalog"
+	return conf
+}
+
+// Claims действующего токена пользователя sub
+func authClaims(sub string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   sub,
+		"iss":   "https://auth.example.com",
+		"aud":   "catalog",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "catalog:write",
+	}
+}
+
+// Подписать токен
+func signToken(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	res, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return res
+}
+
+// Выполнить запрос с токеном, пустой token - без заголовка Authorization
+func authRequest(a *api.Api, method string, path string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuth_HS256(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	a := api.NewApi(authConfig(), cs, nil, nil)
+	assert.Contains(t, a.GetApiInfo().MW, "JWTAuth")
+	// без токена
+	rec := authRequest(a, echo.DELETE, "/api/categories/1", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="api"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	// не Bearer
+	req := httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Basic dXNlcjpwYXNz")
+	rec = httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	// чужая подпись
+	rec = authRequest(a, echo.DELETE, "/api/categories/1", signToken(t, jwt.SigningMethodHS256, []byte("other"), "", authClaims("manager")))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get(echo.HeaderWWWAuthenticate), `error="invalid_token"`)
+	// X-User не подменяет пользователя из токена
+	token := signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", authClaims("manager"))
+	req = httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	req.Header.Set("X-User", "admin")
+	req.Header.Set("If-Match", "*")
+	cs.EXPECT().DeleteCategory(gomock.Any(), 1, 0).DoAndReturn(func(ctx context.Context, _ int, _ int) error {
+		assert.Equal(t, "manager", model.UserFromContext(ctx))
+		assert.Equal(t, "catalog:write", model.ClaimsFromContext(ctx)["scope"])
+		return nil
+	}).Times(1)
+	rec = httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	// спецификация доступна без токена
+	rec = authRequest(a, echo.GET, "/", "")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+}
+
+func TestAuth_Claims(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "test"}, nil).AnyTimes()
+	a := api.NewApi(authConfig(), cs, nil, nil)
+	get := func(claims jwt.MapClaims) int {
+		return authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", claims)).Code
+	}
+	assert.Equal(t, http.StatusOK, get(authClaims("manager")))
+	// aud - массив
+	claims := authClaims("manager")
+	claims["aud"] = []string{"other", "catalog"}
+	assert.Equal(t, http.StatusOK, get(claims))
+	claims["aud"] = "other"
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	claims = authClaims("manager")
+	claims["iss"] = "https://other.example.com"
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	// exp обязателен и проверяется с допустимым расхождением часов
+	claims = authClaims("manager")
+	delete(claims, "exp")
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	claims["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	claims = authClaims("manager")
+	claims["nbf"] = time.Now().Add(time.Hour).Unix()
+	assert.Equal(t, http.StatusUnauthorized, get(claims))
+	// токен с другим алгоритмом не принимается
+	token := signToken(t, jwt.SigningMethodHS384, []byte(authSecret), "", authClaims("manager"))
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/categories/1", token).Code)
+}
+
+func TestAuth_Leeway(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "test"}, nil).Times(1)
+	conf := authConfig()
+	conf.Auth.Leeway = 30
+	a := api.NewApi(conf, cs, nil, nil)
+	claims := authClaims("manager")
+	claims["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	rec := authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", claims))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuth_AnonymousRead(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	conf := authConfig()
+	conf.Auth.AnonymousRead = true
+	a := api.NewApi(conf, cs, nil, nil)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (*model.Category, error) {
+		assert.Equal(t, "", model.UserFromContext(ctx))
+		assert.Nil(t, model.ClaimsFromContext(ctx))
+		return &model.Category{Id: 1, Name: "test"}, nil
+	}).Times(1)
+	assert.Equal(t, http.StatusOK, authRequest(a, echo.GET, "/api/categories/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.DELETE, "/api/categories/1", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/admin/db/stats", "").Code)
+	// переданный токен проверяется и при чтении
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/categories/1", "invalid").Code)
+}
+
+func TestAuth_RS256(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, err := ioutil.TempDir("", "echo-rest-api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	assert.NoError(t, err)
+	file := filepath.Join(dir, "public.pem")
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644))
+	conf := authConfig()
+	conf.Auth.Algorithm = "RS256"
+	conf.Auth.PublicKeyFile = file
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "test"}, nil).Times(1)
+	a := api.NewApi(conf, cs, nil, nil)
+	rec := authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodRS256, key, "", authClaims("manager")))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// публичный ключ в качестве секрета HS256
+	pemKey, _ := ioutil.ReadFile(file)
+	rec = authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodHS256, pemKey, "", authClaims("manager")))
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuth_ES256Jwks(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	dir, err := ioutil.TempDir("", "echo-rest-api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	coord := func(v []byte) string {
+		padded := make([]byte, 32)
+		copy(padded[32-len(v):], v)
+		return base64.RawURLEncoding.EncodeToString(padded)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "EC", "kid": "k1", "crv": "P-256", "x": coord(key.X.Bytes()), "y": coord(key.Y.Bytes()), "use": "sig"},
+		{"kty": "EC", "kid": "k2", "crv": "P-256", "x": coord(other.X.Bytes()), "y": coord(other.Y.Bytes())},
+		{"kty": "RSA", "kid": "r1", "n": "AQAB", "e": "AQAB"},
+	}})
+	file := filepath.Join(dir, "jwks.json")
+	assert.NoError(t, ioutil.WriteFile(file, jwks, 0644))
+	conf := authConfig()
+	conf.Auth.Algorithm = "ES256"
+	conf.Auth.JwksFile = file
+	cs := mock.NewMockCategoryService(mockCtrl)
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "test"}, nil).Times(1)
+	a := api.NewApi(conf, cs, nil, nil)
+	assert.Equal(t, http.StatusOK, authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodES256, key, "k1", authClaims("manager"))).Code)
+	// ключ выбирается по kid
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodES256, key, "k2", authClaims("manager"))).Code)
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodES256, key, "k3", authClaims("manager"))).Code)
+	// без kid при нескольких ключах
+	assert.Equal(t, http.StatusUnauthorized, authRequest(a, echo.GET, "/api/categories/1", signToken(t, jwt.SigningMethodES256, key, "", authClaims("manager"))).Code)
+}
+
+func TestAuth_Config(t *testing.T) {
+	conf := authConfig()
+	conf.Auth.Secret = ""
+	a := api.NewApi(conf, nil, nil, nil)
+	assert.Error(t, a.Start())
+	// запросы не выполняются без проверки токена
+	assert.Equal(t, http.StatusInternalServerError, authRequest(a, echo.GET, "/api/categories/1", "").Code)
+	conf = authConfig()
+	conf.Auth.Algorithm = "none"
+	assert.Error(t, api.NewApi(conf, nil, nil, nil).Start())
+	conf = authConfig()
+	conf.Auth.Algorithm = "RS256"
+	conf.Auth.PublicKeyFile = "not-exists.pem"
+	assert.Error(t, api.NewApi(conf, nil, nil, nil).Start())
+}
+
+// Выполнить запрос с ключом API
+func apiKeyRequest(a *api.Api, method string, path string, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set(api.HeaderApiKey, key)
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuth_ApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	as := mock.NewMockAdminService(mockCtrl)
+	a := api.NewApi(authConfig(), cs, nil, as)
+	reader := &model.ApiKey{Id: 1, Name: "shop", Scopes: []string{model.ScopeCatalogRead}}
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_reader").Return(reader, nil).AnyTimes()
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_revoked").Return(nil, nil).AnyTimes()
+	cs.EXPECT().GetCategory(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (*model.Category, error) {
+		assert.Equal(t, "api-key:shop", model.UserFromContext(ctx))
+		return &model.Category{Id: 1, Name: "test"}, nil
+	}).Times(1)
+	assert.Equal(t, http.StatusOK, apiKeyRequest(a, echo.GET, "/api/categories/1", "erk_reader").Code)
+	// области доступа проверяются для каждого маршрута
+	rec := apiKeyRequest(a, echo.POST, "/api/categories", "erk_reader")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), model.ScopeCatalogWrite)
+	assert.Equal(t, http.StatusForbidden, apiKeyRequest(a, echo.GET, "/api/admin/db/stats", "erk_reader").Code)
+	rec = apiKeyRequest(a, echo.GET, "/api/categories/1", "erk_revoked")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, `Bearer realm="api"`, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	// токен не ограничивается областями доступа
+	as.EXPECT().GetDbStats().Return(&model.DbStats{}).Times(1)
+	token := signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", authClaims("manager"))
+	assert.Equal(t, http.StatusOK, authRequest(a, echo.GET, "/api/admin/db/stats", token).Code)
+}
+
+func TestAuth_ApiKeyAdmin(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	as := mock.NewMockAdminService(mockCtrl)
+	a := api.NewApi(authConfig(), nil, nil, as)
+	admin := &model.ApiKey{Id: 1, Name: "ops", Scopes: []string{model.ScopeAdmin}}
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_admin").Return(admin, nil).AnyTimes()
+	as.EXPECT().CreateApiKey(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, key *model.ApiKey) (string, error) {
+		assert.Equal(t, "erp", key.Name)
+		key.Id = 2
+		key.Prefix = "erk_secret"
+		key.Hash = model.HashApiKey("erk_secret")
+		return "erk_secret", nil
+	}).Times(1)
+	create := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(echo.POST, "/api/admin/keys", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(api.HeaderApiKey, "erk_admin")
+		rec := httptest.NewRecorder()
+		a.Http.ServeHTTP(rec, req)
+		return rec
+	}
+	rec := create(`{"name":"erp","scopes":["catalog:read","catalog:write"]}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	created := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &created))
+	assert.Equal(t, "erk_secret", created["key"])
+	assert.Equal(t, float64(2), created["id"])
+	assert.NotContains(t, created, "hash")
+	// название неотозванного ключа уникально
+	as.EXPECT().CreateApiKey(gomock.Any(), gomock.Any()).Return("", store.ErrDuplicate).Times(1)
+	rec = create(`{"name":"erp","scopes":["catalog:read"]}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Contains(t, rec.Body.String(), "duplicate_value")
+	assert.Equal(t, http.StatusBadRequest, create(`{"name":"erp","scopes":["catalog:purge"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create(`{"name":"erp"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, create(`{"name":"erp","scopes":["admin"],"expires_at":"2000-01-01T00:00:00Z"}`).Code)
+	// в списке сам ключ не возвращается
+	as.EXPECT().GetApiKeys(gomock.Any()).Return([]*model.ApiKey{{Id: 2, Name: "erp", Prefix: "erk_secret", Hash: "hash"}}, nil).Times(1)
+	rec = apiKeyRequest(a, echo.GET, "/api/admin/keys", "erk_admin")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "hash")
+	as.EXPECT().RevokeApiKey(gomock.Any(), 2).Return(nil).Times(1)
+	as.EXPECT().RevokeApiKey(gomock.Any(), 3).Return(sql.ErrNoRows).Times(1)
+	assert.Equal(t, http.StatusNoContent, apiKeyRequest(a, echo.DELETE, "/api/admin/keys/2", "erk_admin").Code)
+	assert.Equal(t, http.StatusNotFound, apiKeyRequest(a, echo.DELETE, "/api/admin/keys/3", "erk_admin").Code)
+}
+
+func TestAuth_ApiKeysWithoutJwt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	as := mock.NewMockAdminService(mockCtrl)
+	conf := &config.Config{}
+	conf.Auth.ApiKeys = true
+	a := api.NewApi(conf, cs, nil, as)
+	assert.Contains(t, a.GetApiInfo().MW, "ApiKeyAuth")
+	reader := &model.ApiKey{Id: 1, Name: "shop", Scopes: []string{model.ScopeCatalogRead}}
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_reader").Return(reader, nil).AnyTimes()
+	cs.EXPECT().GetCategory(gomock.Any(), 1).DoAndReturn(func(ctx context.Context, id int) (*model.Category, error) {
+		assert.Equal(t, "api-key:shop", model.UserFromContext(ctx))
+		return &model.Category{Id: 1, Name: "test"}, nil
+	}).Times(1)
+	assert.Equal(t, http.StatusOK, apiKeyRequest(a, echo.GET, "/api/categories/1", "erk_reader").Code)
+	assert.Equal(t, http.StatusForbidden, apiKeyRequest(a, echo.POST, "/api/categories", "erk_reader").Code)
+	// без ключа запрос не выполняется, X-User не заменяет аутентификацию
+	req := httptest.NewRequest(echo.GET, "/api/categories/1", nil)
+	req.Header.Set(api.HeaderUser, "root")
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	// токены не принимаются, их нечем проверить
+	token := signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", authClaims("manager"))
+	rec = authRequest(a, echo.GET, "/api/categories/1", token)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), api.HeaderApiKey)
+}
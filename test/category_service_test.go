@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"echo-rest-api/model"
 	"echo-rest-api/service"
+	"echo-rest-api/store"
 	"echo-rest-api/test/mock"
 	"errors"
 	"github.com/golang/mock/gomock"
@@ -15,13 +16,13 @@ func TestCategoryService_GetCategory(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().GetCategory(nil, 1).Return(nil, errors.New("test")).Times(1)
-	mockStore.EXPECT().GetCategory(nil, 2).Return(&model.Category{2, "test"}, nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, nil, 1).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, nil, 2).Return(&model.Category{Id: 2, Name: "test"}, nil).Times(1)
 	cs := service.NewCategoryService(mockStore)
-	r, e := cs.GetCategory(1)
+	r, e := cs.GetCategory(ctx, 1)
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
-	r, e = cs.GetCategory(2)
+	r, e = cs.GetCategory(ctx, 2)
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -30,13 +31,13 @@ func TestCategoryService_GetCategories(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().GetCategories(nil).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().GetCategories(ctx, nil, nil).Return(nil, 0, errors.New("test")).Times(1)
 	cs := service.NewCategoryService(mockStore)
-	r, e := cs.GetCategories()
+	r, _, e := cs.GetCategories(ctx, nil)
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
-	mockStore.EXPECT().GetCategories(nil).Return([]*model.Category{}, nil).Times(1)
-	r, e = cs.GetCategories()
+	mockStore.EXPECT().GetCategories(ctx, nil, nil).Return([]*model.Category{}, 0, nil).Times(1)
+	r, _, e = cs.GetCategories(ctx, nil)
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -46,30 +47,30 @@ func TestCategoryService_CreateCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	cs := service.NewCategoryService(mockStore)
-	r, e := cs.CreateCategory(&model.Category{Name: "Test"})
+	r, e := cs.CreateCategory(ctx, &model.Category{Name: "Test"})
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().CreateCategory(tx, &model.Category{Name: "Test"}).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().CreateCategory(ctx, tx, &model.Category{Name: "Test"}).Return(nil, errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	r, e = cs.CreateCategory(&model.Category{Name: "Test"})
+	r, e = cs.CreateCategory(ctx, &model.Category{Name: "Test"})
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
 	var id = 1
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().CreateCategory(tx, &model.Category{Name: "Test"}).Return(&id, nil).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().CreateCategory(ctx, tx, &model.Category{Name: "Test"}).Return(&id, nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	r, e = cs.CreateCategory(&model.Category{Name: "Test"})
+	r, e = cs.CreateCategory(ctx, &model.Category{Name: "Test"})
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -79,57 +80,161 @@ func TestCategoryService_UpdateCategory(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	cs := service.NewCategoryService(mockStore)
-	e := cs.UpdateCategory(nil)
+	e := cs.UpdateCategory(ctx, nil)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
-	cat := &model.Category{1, "test"}
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().UpdateCategory(tx, cat).Return(errors.New("test")).Times(1)
+	cat := &model.Category{Id: 1, Name: "test"}
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().UpdateCategory(ctx, tx, cat).Return(errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	e = cs.UpdateCategory(cat)
+	e = cs.UpdateCategory(ctx, cat)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
-	cat = &model.Category{1, "test"}
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().UpdateCategory(tx, cat).Return(nil).Times(1)
+	cat = &model.Category{Id: 1, Name: "test"}
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().UpdateCategory(ctx, tx, cat).Return(nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	e = cs.UpdateCategory(cat)
+	e = cs.UpdateCategory(ctx, cat)
 	assert.Nil(t, e)
 }
 
+func TestCategoryService_PatchCategory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	rename := func(current *model.Category) (*model.Category, error) {
+		cat := *current
+		cat.Name = "patched"
+		return &cat, nil
+	}
+
+	mockStore := mock.NewMockStore(mockCtrl)
+	tx := new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, tx, 1).Return(nil, nil).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	cs := service.NewCategoryService(mockStore)
+	_, e := cs.PatchCategory(ctx, 1, 0, rename)
+	assert.Equal(t, sql.ErrNoRows, e)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, tx, 1).Return(&model.Category{Id: 1, Name: "test", Version: 3}, nil).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	cs = service.NewCategoryService(mockStore)
+	_, e = cs.PatchCategory(ctx, 1, 2, rename)
+	assert.Equal(t, store.ErrConflict, e)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, tx, 1).Return(&model.Category{Id: 1, Name: "test", Version: 2}, nil).Times(1)
+	mockStore.EXPECT().UpdateCategory(ctx, tx, &model.Category{Id: 1, Name: "patched", Version: 2}).Return(nil).Times(1)
+	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
+	cs = service.NewCategoryService(mockStore)
+	cat, e := cs.PatchCategory(ctx, 1, 0, rename)
+	assert.Nil(t, e)
+	assert.Equal(t, "patched", cat.Name)
+}
+
+func TestCategoryService_RestoreCategory(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStore := mock.NewMockStore(mockCtrl)
+	tx := new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().RestoreCategory(ctx, tx, 1).Return(sql.ErrNoRows).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	cs := service.NewCategoryService(mockStore)
+	r, e := cs.RestoreCategory(ctx, 1)
+	assert.Equal(t, sql.ErrNoRows, e)
+	assert.Nil(t, r)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().RestoreCategory(ctx, tx, 2).Return(nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, tx, 2).Return(&model.Category{Id: 2, Version: 3}, nil).Times(1)
+	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
+	cs = service.NewCategoryService(mockStore)
+	r, e = cs.RestoreCategory(ctx, 2)
+	assert.Nil(t, e)
+	assert.Equal(t, 3, r.Version)
+}
+
 func TestCategoryService_DeleteCategory(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	cs := service.NewCategoryService(mockStore)
-	e := cs.DeleteCategory(1)
+	e := cs.DeleteCategory(ctx, 1, 2)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().DeleteCategory(tx, 1).Return(errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().DeleteCategory(ctx, tx, 1, 2).Return(errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	e = cs.DeleteCategory(1)
+	e = cs.DeleteCategory(ctx, 1, 2)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().DeleteCategory(tx, 1).Return(nil).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().DeleteCategory(ctx, tx, 1, 2).Return(nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	cs = service.NewCategoryService(mockStore)
-	e = cs.DeleteCategory(1)
+	e = cs.DeleteCategory(ctx, 1, 2)
+	assert.Nil(t, e)
+}
+
+func TestCategoryService_GetCategoryTree(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	cs := service.NewCategoryService(mockStore)
+	params := &model.ListParams{Sort: []model.SortField{{Field: "name"}}}
+	mockStore.EXPECT().GetCategories(ctx, nil, params).Return(nil, 0, errors.New("test")).Times(1)
+	r, e := cs.GetCategoryTree(ctx)
+	assert.NotNil(t, e)
+	assert.Nil(t, r)
+	root, child := 1, 2
+	mockStore.EXPECT().GetCategories(ctx, nil, params).Return([]*model.Category{
+		{Id: 3, Name: "a", ParentId: &child},
+		{Id: 2, Name: "b", ParentId: &root},
+		{Id: 1, Name: "c"},
+		{Id: 4, Name: "d", ParentId: &root},
+	}, 4, nil).Times(1)
+	r, e = cs.GetCategoryTree(ctx)
+	assert.Nil(t, e)
+	assert.Len(t, r, 1)
+	assert.Equal(t, 1, r[0].Id)
+	assert.Len(t, r[0].Children, 2)
+	assert.Equal(t, 2, r[0].Children[0].Id)
+	assert.Equal(t, 4, r[0].Children[1].Id)
+	assert.Len(t, r[0].Children[0].Children, 1)
+	assert.Equal(t, 3, r[0].Children[0].Children[0].Id)
+}
+
+func TestCategoryService_GetCategoryAncestors(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	mockStore.EXPECT().GetCategoryAncestors(ctx, nil, 2).Return([]*model.Category{{Id: 1, Name: "root"}}, nil).Times(1)
+	cs := service.NewCategoryService(mockStore)
+	r, e := cs.GetCategoryAncestors(ctx, 2)
 	assert.Nil(t, e)
+	assert.Len(t, r, 1)
 }
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"bytes"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Изображение png размером width x height
+func testPng(width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+	return buf.Bytes()
+}
+
+// Маленький файл png, заголовок которого заявляет изображение width x height
+func testPngHeader(width, height uint32) []byte {
+	data := testPng(1, 1)
+	// IHDR: длина 8 байт сигнатуры, затем длина, тип и данные чанка, ширина и высота - первые в данных
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// Конфиг с временным каталогом изображений
+func imagesConfig(t *testing.T) (*config.Config, func()) {
+	dir, err := ioutil.TempDir("", "echo-rest-api-images")
+	assert.NoError(t, err)
+	conf := &config.Config{}
+	conf.Images.Dir = dir
+	conf.Images.MaxSize = 1 << 20
+	conf.Images.MaxPixels = 1 << 20
+	conf.Images.ThumbnailSizes = []int{10, 100}
+	conf.Images.CacheMaxAge = 60
+	return conf, func() { os.RemoveAll(dir) }
+}
+
+func TestImageFiles_Save(t *testing.T) {
+	conf, cleanup := imagesConfig(t)
+	defer cleanup()
+	files := store.NewImageFiles(conf)
+	img := &model.ProductImage{Id: 3, Product: 2, ContentType: "image/png"}
+	assert.NoError(t, files.Save(img, testPng(40, 20)))
+	assert.FileExists(t, filepath.Join(conf.Images.Dir, "2", "3.png"))
+	// миниатюра вписывается в размер, но не увеличивается
+	for size, width := range map[int]int{10: 10, 100: 40} {
+		f, err := os.Open(filepath.Join(conf.Images.Dir, img.ThumbnailFile(size)))
+		assert.NoError(t, err)
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, width, cfg.Width)
+		assert.Equal(t, width/2, cfg.Height)
+	}
+	assert.Error(t, files.Save(&model.ProductImage{Id: 4, Product: 2, ContentType: "image/png"}, []byte("not an image")))
+	// изображение больше images.maxpixels не декодируется
+	assert.Equal(t, store.ErrImageTooLarge, files.Save(&model.ProductImage{Id: 4, Product: 2, ContentType: "image/png"}, testPngHeader(30000, 30000)))
+	_, err := os.Stat(filepath.Join(conf.Images.Dir, "2", "4.png"))
+	assert.True(t, os.IsNotExist(err))
+	img.SetUrls("/images", files.Sizes())
+	assert.Equal(t, "/images/2/3.png", img.Url)
+	assert.Equal(t, map[string]string{"10": "/images/2/3_10.png", "100": "/images/2/3_100.png"}, img.Thumbnails)
+	assert.NoError(t, files.Remove(img))
+	entries, _ := ioutil.ReadDir(filepath.Join(conf.Images.Dir, "2"))
+	assert.Empty(t, entries)
+}
+
+func TestImageFiles_Purge(t *testing.T) {
+	conf, cleanup := imagesConfig(t)
+	defer cleanup()
+	files := store.NewImageFiles(conf)
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	kept, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "kettle", Category: *category, Price: 1000})
+	purged, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "lamp", Category: *category, Price: 1000})
+	for _, product := range []int{*kept, *purged} {
+		assert.NoError(t, files.Save(&model.ProductImage{Id: product, Product: product, ContentType: "image/png"}, testPng(10, 10)))
+	}
+	// удаленный продукт еще можно восстановить, его файлы остаются до purge
+	ms.DeleteProduct(ctx, nil, *purged, 0)
+	n, err := files.Purge(ctx, ms)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	ms.Purge(ctx, nil, time.Now().Add(time.Hour))
+	n, err = files.Purge(ctx, ms)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.DirExists(t, filepath.Join(conf.Images.Dir, strconv.Itoa(*kept)))
+	_, err = os.Stat(filepath.Join(conf.Images.Dir, strconv.Itoa(*purged)))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,360 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_Category(t *testing.T) {
+	ms := store.NewMemoryStore()
+	c, err := ms.GetCategory(ctx, nil, -1)
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+	id, err := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	assert.NoError(t, err)
+	cat, _ := ms.GetCategory(ctx, nil, *id)
+	assert.Equal(t, "text", cat.Name)
+	cat.Name = "text2"
+	assert.Nil(t, ms.UpdateCategory(ctx, nil, cat))
+	cat2, _ := ms.GetCategory(ctx, nil, *id)
+	assert.Equal(t, "text2", cat2.Name)
+	res, total, _ := ms.GetCategories(ctx, nil, nil)
+	assert.Len(t, res, 1)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, sql.ErrNoRows, ms.UpdateCategory(ctx, nil, &model.Category{Id: -1, Name: "text"}))
+	assert.Equal(t, sql.ErrNoRows, ms.DeleteCategory(ctx, nil, -1, 0))
+	assert.Nil(t, ms.DeleteCategory(ctx, nil, *id, 0))
+	cat2, _ = ms.GetCategory(ctx, nil, *id)
+	assert.NotNil(t, cat2.DeletedAt)
+}
+
+func TestMemoryStore_Product(t *testing.T) {
+	ms := store.NewMemoryStore()
+	_, err := ms.CreateProduct(ctx, nil, &model.Product{Name: "test_name", Category: -1, Price: 6550})
+	assert.Equal(t, store.ErrForeignKey, err)
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	category2, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	id, err := ms.CreateProduct(ctx, nil, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
+	assert.NoError(t, err)
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "test_name2", Description: "test_description2", Category: *category2, Price: 6552})
+	p, _ := ms.GetProduct(ctx, nil, *id)
+	assert.Equal(t, *id, p.Id)
+	assert.Equal(t, model.Money(6550), p.Price)
+	ps, _, _ := ms.GetProducts(ctx, nil, nil, nil)
+	assert.Len(t, ps, 2)
+	ps, total, _ := ms.GetProducts(ctx, nil, &model.ProductFilter{Categories: []int{*category}}, nil)
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 1, total)
+	ps, total, _ = ms.GetProducts(ctx, nil, nil, &model.ListParams{Limit: 1, Offset: 1})
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "test_name2", ps[0].Name)
+	ps, _, _ = ms.GetProducts(ctx, nil, nil, &model.ListParams{Limit: 1, Offset: 5})
+	assert.Empty(t, ps)
+	ps, total, _ = ms.GetProducts(ctx, nil, nil, &model.ListParams{Limit: 5, After: &model.Cursor{Id: *id}})
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "test_name2", ps[0].Name)
+	p.Price = 6570
+	assert.Nil(t, ms.UpdateProduct(ctx, nil, p))
+	p2, _ := ms.GetProduct(ctx, nil, *id)
+	assert.Equal(t, model.Money(6570), p2.Price)
+	assert.Equal(t, sql.ErrNoRows, ms.DeleteProduct(ctx, nil, -1, 0))
+	// удаление категории удаляет ее продукты
+	assert.Nil(t, ms.DeleteCategory(ctx, nil, *category, 0))
+	p, _ = ms.GetProduct(ctx, nil, *id)
+	assert.NotNil(t, p.DeletedAt)
+	ps, _, _ = ms.GetProducts(ctx, nil, nil, nil)
+	assert.Len(t, ps, 1)
+}
+
+func TestMemoryStore_Version(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	cat, _ := ms.GetCategory(ctx, nil, *category)
+	assert.Equal(t, 1, cat.Version)
+	cat.Name = "text2"
+	assert.Nil(t, ms.UpdateCategory(ctx, nil, cat))
+	assert.Equal(t, 2, cat.Version)
+	// версия устарела
+	assert.Equal(t, store.ErrConflict, ms.UpdateCategory(ctx, nil, &model.Category{Id: *category, Name: "text3", Version: 1}))
+	assert.Equal(t, store.ErrConflict, ms.DeleteCategory(ctx, nil, *category, 1))
+	assert.Equal(t, sql.ErrNoRows, ms.UpdateCategory(ctx, nil, &model.Category{Id: -1, Name: "text3", Version: 1}))
+	product := &model.Product{Name: "test_name", Category: *category, Price: 1000}
+	id, _ := ms.CreateProduct(ctx, nil, product)
+	assert.Equal(t, 1, product.Version)
+	p, _ := ms.GetProduct(ctx, nil, *id)
+	p.Price = 2000
+	assert.Nil(t, ms.UpdateProduct(ctx, nil, p))
+	assert.Equal(t, 2, p.Version)
+	// без проверки версии
+	p.Version = 0
+	assert.Nil(t, ms.UpdateProduct(ctx, nil, p))
+	assert.Equal(t, 3, p.Version)
+	product.Id = *id
+	assert.Equal(t, store.ErrConflict, ms.UpdateProduct(ctx, nil, product))
+	assert.Equal(t, store.ErrConflict, ms.DeleteProduct(ctx, nil, *id, 2))
+	assert.Nil(t, ms.DeleteProduct(ctx, nil, *id, 3))
+	assert.Equal(t, sql.ErrNoRows, ms.DeleteProduct(ctx, nil, *id, 3))
+	assert.Nil(t, ms.DeleteCategory(ctx, nil, *category, 2))
+}
+
+func TestMemoryStore_SoftDelete(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	deletedBefore, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	id, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "test_name2", Category: *category, Price: 2000})
+	assert.Nil(t, ms.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, ms.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, ms.UpdateProduct(ctx, nil, &model.Product{Id: *deletedBefore, Name: "test_name", Category: *category, Price: 1000}))
+	filter := &model.ProductFilter{Categories: []int{*category}}
+	ps, total, _ := ms.GetProducts(ctx, nil, filter, nil)
+	assert.Equal(t, 1, total)
+	assert.Len(t, ps, 1)
+	ps, total, _ = ms.GetProducts(ctx, nil, filter, &model.ListParams{IncludeDeleted: true})
+	assert.Equal(t, 2, total)
+	assert.Len(t, ps, 2)
+	// удаление категории помечает удаленными ее продукты
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, ms.DeleteCategory(ctx, nil, *category, 0))
+	p, _ := ms.GetProduct(ctx, nil, *id)
+	assert.NotNil(t, p.DeletedAt)
+	_, total, _ = ms.GetProducts(ctx, nil, filter, nil)
+	assert.Equal(t, 0, total)
+	// восстановление категории восстанавливает только продукты, удаленные вместе с ней
+	assert.Nil(t, ms.RestoreCategory(ctx, nil, *category))
+	assert.Equal(t, sql.ErrNoRows, ms.RestoreCategory(ctx, nil, *category))
+	p, _ = ms.GetProduct(ctx, nil, *id)
+	assert.Nil(t, p.DeletedAt)
+	p, _ = ms.GetProduct(ctx, nil, *deletedBefore)
+	assert.NotNil(t, p.DeletedAt)
+	assert.Nil(t, ms.RestoreProduct(ctx, nil, *deletedBefore))
+	assert.Equal(t, sql.ErrNoRows, ms.RestoreProduct(ctx, nil, *deletedBefore))
+	// очистка удаляет только записи, удаленные раньше заданного времени
+	assert.Nil(t, ms.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	n, err := ms.Purge(ctx, nil, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = ms.Purge(ctx, nil, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	p, _ = ms.GetProduct(ctx, nil, *deletedBefore)
+	assert.Nil(t, p)
+	p, _ = ms.GetProduct(ctx, nil, *id)
+	assert.NotNil(t, p)
+}
+
+func TestMemoryStore_DeletedCategory(t *testing.T) {
+	testDeletedCategory(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_ProductFilter(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	category2, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	id, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "Red Apple", Description: "fresh 100%", Category: *category, Price: 1000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "Green apple", Description: "fresh", Category: *category2, Price: 2000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "Pear", Description: "old", Category: *category2, Price: 3000})
+	minPrice, maxPrice := model.Money(1500), model.Money(3000)
+	ps, total, _ := ms.GetProducts(ctx, nil, &model.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}, nil)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, 2, total)
+	ps, _, _ = ms.GetProducts(ctx, nil, &model.ProductFilter{Name: "APPLE"}, nil)
+	assert.Len(t, ps, 2)
+	ps, _, _ = ms.GetProducts(ctx, nil, &model.ProductFilter{Name: "apple", Categories: []int{*category2}}, nil)
+	assert.Len(t, ps, 1)
+	assert.Equal(t, "Green apple", ps[0].Name)
+	ps, _, _ = ms.GetProducts(ctx, nil, &model.ProductFilter{Description: "100%"}, nil)
+	assert.Len(t, ps, 1)
+	ps, _, _ = ms.GetProducts(ctx, nil, &model.ProductFilter{Ids: []int{*id, -1}}, nil)
+	assert.Len(t, ps, 1)
+}
+
+func TestMemoryStore_SearchProducts(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	category2, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "Red Apple", Description: "fresh red fruit", Category: *category, Price: 1000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "Green apple", Description: "fresh", Category: *category2, Price: 2000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "Pear", Description: "not an apple", Category: *category2, Price: 3000})
+	categories := []int{*category, *category2}
+	rs, total, err := ms.SearchProducts(ctx, nil, &model.ProductSearch{Query: "apple", Categories: categories}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, rs, 3)
+	// совпадение в названии релевантнее совпадения в описании
+	assert.Equal(t, "Pear", rs[2].Name)
+	assert.True(t, rs[0].Rank > rs[2].Rank)
+	assert.Contains(t, rs[0].Highlights.Name, "<b>")
+	rs, total, _ = ms.SearchProducts(ctx, nil, &model.ProductSearch{Query: "red", Categories: categories}, nil)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Red Apple", rs[0].Name)
+	assert.Contains(t, rs[0].Highlights.Description, "<b>red</b>")
+	rs, total, _ = ms.SearchProducts(ctx, nil, &model.ProductSearch{Query: "apple", Categories: []int{*category2}}, &model.ListParams{Limit: 1})
+	assert.Equal(t, 2, total)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "Green apple", rs[0].Name)
+	rs, total, _ = ms.SearchProducts(ctx, nil, &model.ProductSearch{Query: "banana", Categories: categories}, nil)
+	assert.Equal(t, 0, total)
+	assert.Len(t, rs, 0)
+}
+
+func TestMemoryStore_ProductSort(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "b", Category: *category, Price: 1000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "a", Category: *category, Price: 2000})
+	ms.CreateProduct(ctx, nil, &model.Product{Name: "c", Category: *category, Price: 2000})
+	sort := []model.SortField{{Field: "price", Desc: true}, {Field: "name"}}
+	ps, _, _ := ms.GetProducts(ctx, nil, nil, &model.ListParams{Sort: sort})
+	assert.Equal(t, "a", ps[0].Name)
+	assert.Equal(t, "c", ps[1].Name)
+	assert.Equal(t, "b", ps[2].Name)
+	// страница после курсора
+	after := &model.Cursor{Values: []interface{}{20.0, "a"}, Id: ps[0].Id}
+	ps, _, err := ms.GetProducts(ctx, nil, nil, &model.ListParams{Limit: 5, Sort: sort, After: after})
+	assert.NoError(t, err)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, "c", ps[0].Name)
+	_, _, err = ms.GetProducts(ctx, nil, nil, &model.ListParams{Sort: []model.SortField{{Field: "desc"}}})
+	assert.Error(t, err)
+}
+
+func TestMemoryStore_Tx(t *testing.T) {
+	ms := store.NewMemoryStore()
+	assert.Error(t, ms.Commit(nil))
+	assert.Error(t, ms.Rollback(nil))
+	// откат отбрасывает изменения
+	tx, _ := ms.Begin(ctx)
+	id, _ := ms.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	c, _ := ms.GetCategory(ctx, tx, *id)
+	assert.NotNil(t, c)
+	c, _ = ms.GetCategory(ctx, nil, *id)
+	assert.Nil(t, c)
+	assert.Nil(t, ms.Rollback(tx))
+	c, _ = ms.GetCategory(ctx, nil, *id)
+	assert.Nil(t, c)
+	assert.Equal(t, sql.ErrTxDone, ms.Commit(tx))
+	// коммит применяет изменения
+	tx, _ = ms.Begin(ctx)
+	id, _ = ms.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	assert.Nil(t, ms.Commit(tx))
+	c, _ = ms.GetCategory(ctx, nil, *id)
+	assert.NotNil(t, c)
+	_, err := ms.GetCategory(ctx, tx, *id)
+	assert.Equal(t, sql.ErrTxDone, err)
+}
+
+func TestMemoryStore_ConcurrentTx(t *testing.T) {
+	ms := store.NewMemoryStore()
+	category, _ := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	product, _ := ms.CreateProduct(ctx, nil, &model.Product{Name: "kettle", Category: *category, Price: 1000})
+	ms.AdjustStock(ctx, nil, &model.StockAdjustment{Product: *product, Delta: 5, Reason: model.StockReceipt})
+	// коммит транзакции не затирает транзакции и записи без транзакции, выполненные после ее начала
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	reserved := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			tx, err := ms.Begin(ctx)
+			assert.NoError(t, err)
+			runtime.Gosched()
+			_, err = ms.CreateReservation(ctx, tx, &model.StockReservation{Product: *product, Quantity: 1, ExpiresAt: time.Now().Add(time.Hour)})
+			if err != nil {
+				assert.Equal(t, store.ErrInsufficientStock, err)
+				assert.NoError(t, ms.Rollback(tx))
+				return
+			}
+			runtime.Gosched()
+			assert.NoError(t, ms.Commit(tx))
+			mu.Lock()
+			reserved++
+			mu.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := ms.CreateCategory(ctx, nil, &model.Category{Name: "child"})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	// продать больше, чем есть на складе, нельзя
+	assert.Equal(t, 5, reserved)
+	stock, _ := ms.GetStock(ctx, nil, *product)
+	assert.Equal(t, 5, stock.Reserved)
+	assert.Equal(t, 0, stock.Available)
+	_, total, _ := ms.GetCategories(ctx, nil, nil)
+	assert.Equal(t, 21, total)
+	// транзакция ждет завершения открытой транзакции, пока не отменен контекст
+	tx, _ := ms.Begin(ctx)
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := ms.Begin(timeout)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.NoError(t, ms.Rollback(tx))
+	tx, err = ms.Begin(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, ms.Commit(tx))
+}
+
+func TestMemoryStore_Context(t *testing.T) {
+	ms := store.NewMemoryStore()
+	id, err := ms.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	assert.NoError(t, err)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	// запросы с отмененным контекстом не выполняются
+	_, err = ms.Begin(cancelled)
+	assert.Equal(t, context.Canceled, err)
+	_, err = ms.GetCategory(cancelled, nil, *id)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, ms.DeleteCategory(cancelled, nil, *id, 0))
+	cat, err := ms.GetCategory(ctx, nil, *id)
+	assert.NoError(t, err)
+	assert.Nil(t, cat.DeletedAt)
+}
+
+func TestMemoryStore_CategoryTree(t *testing.T) {
+	testCategoryTree(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Variants(t *testing.T) {
+	testVariants(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Stock(t *testing.T) {
+	testStock(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Currency(t *testing.T) {
+	testCurrency(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_PriceHistory(t *testing.T) {
+	testPriceHistory(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Tags(t *testing.T) {
+	testTags(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Attributes(t *testing.T) {
+	testAttributes(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_Images(t *testing.T) {
+	testImages(t, store.NewMemoryStore(), nil)
+}
+
+func TestMemoryStore_ApiKeys(t *testing.T) {
+	testApiKeys(t, store.NewMemoryStore(), nil)
+}
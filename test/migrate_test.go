@@ -0,0 +1,27 @@
+package test
+
+import (
+	"echo-rest-api/config"
+	"echo-rest-api/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMigrate_Migrations(t *testing.T) {
+	migrations, err := store.Migrations()
+	assert.NoError(t, err)
+	assert.True(t, len(migrations) >= 4)
+	assert.Equal(t, "1_0_init_store.sql", migrations[0].Id)
+	for _, m := range migrations {
+		assert.NotEmpty(t, m.Up, m.Id)
+		assert.NotEmpty(t, m.Down, m.Id)
+		assert.NotContains(t, m.Up, "+migrate", m.Id)
+	}
+}
+
+func TestMigrate_NewMigrator(t *testing.T) {
+	conf := &config.Config{}
+	conf.Store.Driver = "sqlite"
+	_, err := store.NewMigrator(conf)
+	assert.Error(t, err)
+}
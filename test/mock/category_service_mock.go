@@ -5,6 +5,7 @@
 package mock
 
 import (
+	context "context"
 	model "echo-rest-api/model"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -34,64 +35,117 @@ func (m *MockCategoryService) EXPECT() *MockCategoryServiceMockRecorder {
 }
 
 // GetCategory mocks base method
-func (m *MockCategoryService) GetCategory(id int) (*model.Category, error) {
-	ret := m.ctrl.Call(m, "GetCategory", id)
+func (m *MockCategoryService) GetCategory(ctx context.Context, id int) (*model.Category, error) {
+	ret := m.ctrl.Call(m, "GetCategory", ctx, id)
 	ret0, _ := ret[0].(*model.Category)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCategory indicates an expected call of GetCategory
-func (mr *MockCategoryServiceMockRecorder) GetCategory(id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockCategoryService)(nil).GetCategory), id)
+func (mr *MockCategoryServiceMockRecorder) GetCategory(ctx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockCategoryService)(nil).GetCategory), ctx, id)
 }
 
-// GetCategories mocks base method
-func (m *MockCategoryService) GetCategories() ([]*model.Category, error) {
-	ret := m.ctrl.Call(m, "GetCategories")
+// GetCategoryAncestors mocks base method
+func (m *MockCategoryService) GetCategoryAncestors(ctx context.Context, id int) ([]*model.Category, error) {
+	ret := m.ctrl.Call(m, "GetCategoryAncestors", ctx, id)
 	ret0, _ := ret[0].([]*model.Category)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetCategoryAncestors indicates an expected call of GetCategoryAncestors
+func (mr *MockCategoryServiceMockRecorder) GetCategoryAncestors(ctx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategoryAncestors", reflect.TypeOf((*MockCategoryService)(nil).GetCategoryAncestors), ctx, id)
+}
+
+// GetCategories mocks base method
+func (m *MockCategoryService) GetCategories(ctx context.Context, params *model.ListParams) ([]*model.Category, int, error) {
+	ret := m.ctrl.Call(m, "GetCategories", ctx, params)
+	ret0, _ := ret[0].([]*model.Category)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // GetCategories indicates an expected call of GetCategories
-func (mr *MockCategoryServiceMockRecorder) GetCategories() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockCategoryService)(nil).GetCategories))
+func (mr *MockCategoryServiceMockRecorder) GetCategories(ctx, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockCategoryService)(nil).GetCategories), ctx, params)
+}
+
+// GetCategoryTree mocks base method
+func (m *MockCategoryService) GetCategoryTree(ctx context.Context) ([]*model.CategoryTree, error) {
+	ret := m.ctrl.Call(m, "GetCategoryTree", ctx)
+	ret0, _ := ret[0].([]*model.CategoryTree)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCategoryTree indicates an expected call of GetCategoryTree
+func (mr *MockCategoryServiceMockRecorder) GetCategoryTree(ctx interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategoryTree", reflect.TypeOf((*MockCategoryService)(nil).GetCategoryTree), ctx)
 }
 
 // CreateCategory mocks base method
-func (m *MockCategoryService) CreateCategory(category *model.Category) (*int, error) {
-	ret := m.ctrl.Call(m, "CreateCategory", category)
+func (m *MockCategoryService) CreateCategory(ctx context.Context, category *model.Category) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateCategory", ctx, category)
 	ret0, _ := ret[0].(*int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateCategory indicates an expected call of CreateCategory
-func (mr *MockCategoryServiceMockRecorder) CreateCategory(category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCategoryService)(nil).CreateCategory), category)
+func (mr *MockCategoryServiceMockRecorder) CreateCategory(ctx, category interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockCategoryService)(nil).CreateCategory), ctx, category)
 }
 
 // UpdateCategory mocks base method
-func (m *MockCategoryService) UpdateCategory(category *model.Category) error {
-	ret := m.ctrl.Call(m, "UpdateCategory", category)
+func (m *MockCategoryService) UpdateCategory(ctx context.Context, category *model.Category) error {
+	ret := m.ctrl.Call(m, "UpdateCategory", ctx, category)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateCategory indicates an expected call of UpdateCategory
-func (mr *MockCategoryServiceMockRecorder) UpdateCategory(category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCategory", reflect.TypeOf((*MockCategoryService)(nil).UpdateCategory), category)
+func (mr *MockCategoryServiceMockRecorder) UpdateCategory(ctx, category interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCategory", reflect.TypeOf((*MockCategoryService)(nil).UpdateCategory), ctx, category)
+}
+
+// PatchCategory mocks base method
+func (m *MockCategoryService) PatchCategory(ctx context.Context, id int, version int, patch model.CategoryPatch) (*model.Category, error) {
+	ret := m.ctrl.Call(m, "PatchCategory", ctx, id, version, patch)
+	ret0, _ := ret[0].(*model.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PatchCategory indicates an expected call of PatchCategory
+func (mr *MockCategoryServiceMockRecorder) PatchCategory(ctx, id, version, patch interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchCategory", reflect.TypeOf((*MockCategoryService)(nil).PatchCategory), ctx, id, version, patch)
 }
 
 // DeleteCategory mocks base method
-func (m *MockCategoryService) DeleteCategory(id int) error {
-	ret := m.ctrl.Call(m, "DeleteCategory", id)
+func (m *MockCategoryService) DeleteCategory(ctx context.Context, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteCategory", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteCategory indicates an expected call of DeleteCategory
-func (mr *MockCategoryServiceMockRecorder) DeleteCategory(id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCategoryService)(nil).DeleteCategory), id)
+func (mr *MockCategoryServiceMockRecorder) DeleteCategory(ctx, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockCategoryService)(nil).DeleteCategory), ctx, id, version)
+}
+
+// RestoreCategory mocks base method
+func (m *MockCategoryService) RestoreCategory(ctx context.Context, id int) (*model.Category, error) {
+	ret := m.ctrl.Call(m, "RestoreCategory", ctx, id)
+	ret0, _ := ret[0].(*model.Category)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreCategory indicates an expected call of RestoreCategory
+func (mr *MockCategoryServiceMockRecorder) RestoreCategory(ctx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCategory", reflect.TypeOf((*MockCategoryService)(nil).RestoreCategory), ctx, id)
 }
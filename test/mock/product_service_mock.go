@@ -5,9 +5,11 @@
 package mock
 
 import (
+	context "context"
 	model "echo-rest-api/model"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockProductService is a mock of ProductService interface
@@ -34,64 +36,352 @@ func (m *MockProductService) EXPECT() *MockProductServiceMockRecorder {
 }
 
 // GetProduct mocks base method
-func (m *MockProductService) GetProduct(id int) (*model.Product, error) {
-	ret := m.ctrl.Call(m, "GetProduct", id)
+func (m *MockProductService) GetProduct(ctx context.Context, id int) (*model.Product, error) {
+	ret := m.ctrl.Call(m, "GetProduct", ctx, id)
 	ret0, _ := ret[0].(*model.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetProduct indicates an expected call of GetProduct
-func (mr *MockProductServiceMockRecorder) GetProduct(id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockProductService)(nil).GetProduct), id)
+func (mr *MockProductServiceMockRecorder) GetProduct(ctx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockProductService)(nil).GetProduct), ctx, id)
 }
 
 // GetProducts mocks base method
-func (m *MockProductService) GetProducts(category *int) ([]*model.Product, error) {
-	ret := m.ctrl.Call(m, "GetProducts", category)
+func (m *MockProductService) GetProducts(ctx context.Context, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error) {
+	ret := m.ctrl.Call(m, "GetProducts", ctx, filter, params)
 	ret0, _ := ret[0].([]*model.Product)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetProducts indicates an expected call of GetProducts
-func (mr *MockProductServiceMockRecorder) GetProducts(category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProducts", reflect.TypeOf((*MockProductService)(nil).GetProducts), category)
+func (mr *MockProductServiceMockRecorder) GetProducts(ctx, filter, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProducts", reflect.TypeOf((*MockProductService)(nil).GetProducts), ctx, filter, params)
+}
+
+// SearchProducts mocks base method
+func (m *MockProductService) SearchProducts(ctx context.Context, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	ret := m.ctrl.Call(m, "SearchProducts", ctx, search, params)
+	ret0, _ := ret[0].([]*model.ProductSearchResult)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchProducts indicates an expected call of SearchProducts
+func (mr *MockProductServiceMockRecorder) SearchProducts(ctx, search, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockProductService)(nil).SearchProducts), ctx, search, params)
 }
 
 // CreateProduct mocks base method
-func (m *MockProductService) CreateProduct(product *model.Product) (*int, error) {
-	ret := m.ctrl.Call(m, "CreateProduct", product)
+func (m *MockProductService) CreateProduct(ctx context.Context, product *model.Product) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateProduct", ctx, product)
 	ret0, _ := ret[0].(*int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateProduct indicates an expected call of CreateProduct
-func (mr *MockProductServiceMockRecorder) CreateProduct(product interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProduct", reflect.TypeOf((*MockProductService)(nil).CreateProduct), product)
+func (mr *MockProductServiceMockRecorder) CreateProduct(ctx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProduct", reflect.TypeOf((*MockProductService)(nil).CreateProduct), ctx, product)
 }
 
 // UpdateProduct mocks base method
-func (m *MockProductService) UpdateProduct(product *model.Product) error {
-	ret := m.ctrl.Call(m, "UpdateProduct", product)
+func (m *MockProductService) UpdateProduct(ctx context.Context, product *model.Product) error {
+	ret := m.ctrl.Call(m, "UpdateProduct", ctx, product)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateProduct indicates an expected call of UpdateProduct
-func (mr *MockProductServiceMockRecorder) UpdateProduct(product interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockProductService)(nil).UpdateProduct), product)
+func (mr *MockProductServiceMockRecorder) UpdateProduct(ctx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockProductService)(nil).UpdateProduct), ctx, product)
+}
+
+// PatchProduct mocks base method
+func (m *MockProductService) PatchProduct(ctx context.Context, id int, version int, patch model.ProductPatch) (*model.Product, error) {
+	ret := m.ctrl.Call(m, "PatchProduct", ctx, id, version, patch)
+	ret0, _ := ret[0].(*model.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PatchProduct indicates an expected call of PatchProduct
+func (mr *MockProductServiceMockRecorder) PatchProduct(ctx, id, version, patch interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PatchProduct", reflect.TypeOf((*MockProductService)(nil).PatchProduct), ctx, id, version, patch)
 }
 
 // DeleteProduct mocks base method
-func (m *MockProductService) DeleteProduct(id int) error {
-	ret := m.ctrl.Call(m, "DeleteProduct", id)
+func (m *MockProductService) DeleteProduct(ctx context.Context, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteProduct", ctx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteProduct indicates an expected call of DeleteProduct
-func (mr *MockProductServiceMockRecorder) DeleteProduct(id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockProductService)(nil).DeleteProduct), id)
+func (mr *MockProductServiceMockRecorder) DeleteProduct(ctx, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockProductService)(nil).DeleteProduct), ctx, id, version)
+}
+
+// RestoreProduct mocks base method
+func (m *MockProductService) RestoreProduct(ctx context.Context, id int) (*model.Product, error) {
+	ret := m.ctrl.Call(m, "RestoreProduct", ctx, id)
+	ret0, _ := ret[0].(*model.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RestoreProduct indicates an expected call of RestoreProduct
+func (mr *MockProductServiceMockRecorder) RestoreProduct(ctx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreProduct", reflect.TypeOf((*MockProductService)(nil).RestoreProduct), ctx, id)
+}
+
+// GetVariants mocks base method
+func (m *MockProductService) GetVariants(ctx context.Context, product int) ([]*model.Variant, error) {
+	ret := m.ctrl.Call(m, "GetVariants", ctx, product)
+	ret0, _ := ret[0].([]*model.Variant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVariants indicates an expected call of GetVariants
+func (mr *MockProductServiceMockRecorder) GetVariants(ctx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVariants", reflect.TypeOf((*MockProductService)(nil).GetVariants), ctx, product)
+}
+
+// GetVariant mocks base method
+func (m *MockProductService) GetVariant(ctx context.Context, product int, id int) (*model.Variant, error) {
+	ret := m.ctrl.Call(m, "GetVariant", ctx, product, id)
+	ret0, _ := ret[0].(*model.Variant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVariant indicates an expected call of GetVariant
+func (mr *MockProductServiceMockRecorder) GetVariant(ctx, product, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVariant", reflect.TypeOf((*MockProductService)(nil).GetVariant), ctx, product, id)
+}
+
+// CreateVariant mocks base method
+func (m *MockProductService) CreateVariant(ctx context.Context, variant *model.Variant) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateVariant", ctx, variant)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateVariant indicates an expected call of CreateVariant
+func (mr *MockProductServiceMockRecorder) CreateVariant(ctx, variant interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVariant", reflect.TypeOf((*MockProductService)(nil).CreateVariant), ctx, variant)
+}
+
+// UpdateVariant mocks base method
+func (m *MockProductService) UpdateVariant(ctx context.Context, variant *model.Variant) error {
+	ret := m.ctrl.Call(m, "UpdateVariant", ctx, variant)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateVariant indicates an expected call of UpdateVariant
+func (mr *MockProductServiceMockRecorder) UpdateVariant(ctx, variant interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateVariant", reflect.TypeOf((*MockProductService)(nil).UpdateVariant), ctx, variant)
+}
+
+// DeleteVariant mocks base method
+func (m *MockProductService) DeleteVariant(ctx context.Context, product int, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteVariant", ctx, product, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteVariant indicates an expected call of DeleteVariant
+func (mr *MockProductServiceMockRecorder) DeleteVariant(ctx, product, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteVariant", reflect.TypeOf((*MockProductService)(nil).DeleteVariant), ctx, product, id, version)
+}
+
+// GetStock mocks base method
+func (m *MockProductService) GetStock(ctx context.Context, product int) (*model.Stock, error) {
+	ret := m.ctrl.Call(m, "GetStock", ctx, product)
+	ret0, _ := ret[0].(*model.Stock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStock indicates an expected call of GetStock
+func (mr *MockProductServiceMockRecorder) GetStock(ctx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStock", reflect.TypeOf((*MockProductService)(nil).GetStock), ctx, product)
+}
+
+// AdjustStock mocks base method
+func (m *MockProductService) AdjustStock(ctx context.Context, adjustment *model.StockAdjustment) (*int, error) {
+	ret := m.ctrl.Call(m, "AdjustStock", ctx, adjustment)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustStock indicates an expected call of AdjustStock
+func (mr *MockProductServiceMockRecorder) AdjustStock(ctx, adjustment interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustStock", reflect.TypeOf((*MockProductService)(nil).AdjustStock), ctx, adjustment)
+}
+
+// GetStockAdjustments mocks base method
+func (m *MockProductService) GetStockAdjustments(ctx context.Context, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error) {
+	ret := m.ctrl.Call(m, "GetStockAdjustments", ctx, product, params)
+	ret0, _ := ret[0].([]*model.StockAdjustment)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetStockAdjustments indicates an expected call of GetStockAdjustments
+func (mr *MockProductServiceMockRecorder) GetStockAdjustments(ctx, product, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockAdjustments", reflect.TypeOf((*MockProductService)(nil).GetStockAdjustments), ctx, product, params)
+}
+
+// GetReservation mocks base method
+func (m *MockProductService) GetReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	ret := m.ctrl.Call(m, "GetReservation", ctx, product, id)
+	ret0, _ := ret[0].(*model.StockReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReservation indicates an expected call of GetReservation
+func (mr *MockProductServiceMockRecorder) GetReservation(ctx, product, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReservation", reflect.TypeOf((*MockProductService)(nil).GetReservation), ctx, product, id)
+}
+
+// CreateReservation mocks base method
+func (m *MockProductService) CreateReservation(ctx context.Context, reservation *model.StockReservation) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateReservation", ctx, reservation)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReservation indicates an expected call of CreateReservation
+func (mr *MockProductServiceMockRecorder) CreateReservation(ctx, reservation interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*MockProductService)(nil).CreateReservation), ctx, reservation)
+}
+
+// CommitReservation mocks base method
+func (m *MockProductService) CommitReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	ret := m.ctrl.Call(m, "CommitReservation", ctx, product, id)
+	ret0, _ := ret[0].(*model.StockReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CommitReservation indicates an expected call of CommitReservation
+func (mr *MockProductServiceMockRecorder) CommitReservation(ctx, product, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitReservation", reflect.TypeOf((*MockProductService)(nil).CommitReservation), ctx, product, id)
+}
+
+// ReleaseReservation mocks base method
+func (m *MockProductService) ReleaseReservation(ctx context.Context, product int, id int) (*model.StockReservation, error) {
+	ret := m.ctrl.Call(m, "ReleaseReservation", ctx, product, id)
+	ret0, _ := ret[0].(*model.StockReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReleaseReservation indicates an expected call of ReleaseReservation
+func (mr *MockProductServiceMockRecorder) ReleaseReservation(ctx, product, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseReservation", reflect.TypeOf((*MockProductService)(nil).ReleaseReservation), ctx, product, id)
+}
+
+// GetPriceHistory mocks base method
+func (m *MockProductService) GetPriceHistory(ctx context.Context, product int, params *model.ListParams) ([]*model.PriceChange, int, error) {
+	ret := m.ctrl.Call(m, "GetPriceHistory", ctx, product, params)
+	ret0, _ := ret[0].([]*model.PriceChange)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPriceHistory indicates an expected call of GetPriceHistory
+func (mr *MockProductServiceMockRecorder) GetPriceHistory(ctx, product, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPriceHistory", reflect.TypeOf((*MockProductService)(nil).GetPriceHistory), ctx, product, params)
+}
+
+// GetProductAt mocks base method
+func (m *MockProductService) GetProductAt(ctx context.Context, id int, at time.Time) (*model.Product, error) {
+	ret := m.ctrl.Call(m, "GetProductAt", ctx, id, at)
+	ret0, _ := ret[0].(*model.Product)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProductAt indicates an expected call of GetProductAt
+func (mr *MockProductServiceMockRecorder) GetProductAt(ctx, id, at interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProductAt", reflect.TypeOf((*MockProductService)(nil).GetProductAt), ctx, id, at)
+}
+
+// GetTags mocks base method
+func (m *MockProductService) GetTags(ctx context.Context) ([]*model.Tag, error) {
+	ret := m.ctrl.Call(m, "GetTags", ctx)
+	ret0, _ := ret[0].([]*model.Tag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTags indicates an expected call of GetTags
+func (mr *MockProductServiceMockRecorder) GetTags(ctx interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTags", reflect.TypeOf((*MockProductService)(nil).GetTags), ctx)
+}
+
+// GetImages mocks base method
+func (m *MockProductService) GetImages(ctx context.Context, product int) ([]*model.ProductImage, error) {
+	ret := m.ctrl.Call(m, "GetImages", ctx, product)
+	ret0, _ := ret[0].([]*model.ProductImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImages indicates an expected call of GetImages
+func (mr *MockProductServiceMockRecorder) GetImages(ctx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImages", reflect.TypeOf((*MockProductService)(nil).GetImages), ctx, product)
+}
+
+// CreateImage mocks base method
+func (m *MockProductService) CreateImage(ctx context.Context, image *model.ProductImage) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateImage", ctx, image)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateImage indicates an expected call of CreateImage
+func (mr *MockProductServiceMockRecorder) CreateImage(ctx, image interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateImage", reflect.TypeOf((*MockProductService)(nil).CreateImage), ctx, image)
+}
+
+// DeleteImage mocks base method
+func (m *MockProductService) DeleteImage(ctx context.Context, product int, id int) (*model.ProductImage, error) {
+	ret := m.ctrl.Call(m, "DeleteImage", ctx, product, id)
+	ret0, _ := ret[0].(*model.ProductImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteImage indicates an expected call of DeleteImage
+func (mr *MockProductServiceMockRecorder) DeleteImage(ctx, product, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteImage", reflect.TypeOf((*MockProductService)(nil).DeleteImage), ctx, product, id)
+}
+
+// ReorderImages mocks base method
+func (m *MockProductService) ReorderImages(ctx context.Context, product int, ids []int) ([]*model.ProductImage, error) {
+	ret := m.ctrl.Call(m, "ReorderImages", ctx, product, ids)
+	ret0, _ := ret[0].([]*model.ProductImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReorderImages indicates an expected call of ReorderImages
+func (mr *MockProductServiceMockRecorder) ReorderImages(ctx, product, ids interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderImages", reflect.TypeOf((*MockProductService)(nil).ReorderImages), ctx, product, ids)
 }
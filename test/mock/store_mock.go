@@ -5,10 +5,12 @@
 package mock
 
 import (
+	context "context"
 	sql "database/sql"
 	model "echo-rest-api/model"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
+	time "time"
 )
 
 // MockStore is a mock of Store interface
@@ -46,17 +48,29 @@ func (mr *MockStoreMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStore)(nil).Close))
 }
 
+// Stats mocks base method
+func (m *MockStore) Stats() sql.DBStats {
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(sql.DBStats)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats
+func (mr *MockStoreMockRecorder) Stats() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockStore)(nil).Stats))
+}
+
 // Begin mocks base method
-func (m *MockStore) Begin() (*sql.Tx, error) {
-	ret := m.ctrl.Call(m, "Begin")
+func (m *MockStore) Begin(ctx context.Context) (*sql.Tx, error) {
+	ret := m.ctrl.Call(m, "Begin", ctx)
 	ret0, _ := ret[0].(*sql.Tx)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Begin indicates an expected call of Begin
-func (mr *MockStoreMockRecorder) Begin() *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockStore)(nil).Begin))
+func (mr *MockStoreMockRecorder) Begin(ctx interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Begin", reflect.TypeOf((*MockStore)(nil).Begin), ctx)
 }
 
 // Commit mocks base method
@@ -84,127 +98,499 @@ func (mr *MockStoreMockRecorder) Rollback(tx interface{}) *gomock.Call {
 }
 
 // GetCategory mocks base method
-func (m *MockStore) GetCategory(tx *sql.Tx, id int) (*model.Category, error) {
-	ret := m.ctrl.Call(m, "GetCategory", tx, id)
+func (m *MockStore) GetCategory(ctx context.Context, tx *sql.Tx, id int) (*model.Category, error) {
+	ret := m.ctrl.Call(m, "GetCategory", ctx, tx, id)
 	ret0, _ := ret[0].(*model.Category)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetCategory indicates an expected call of GetCategory
-func (mr *MockStoreMockRecorder) GetCategory(tx, id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockStore)(nil).GetCategory), tx, id)
+func (mr *MockStoreMockRecorder) GetCategory(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategory", reflect.TypeOf((*MockStore)(nil).GetCategory), ctx, tx, id)
 }
 
-// GetCategories mocks base method
-func (m *MockStore) GetCategories(tx *sql.Tx) ([]*model.Category, error) {
-	ret := m.ctrl.Call(m, "GetCategories", tx)
+// GetCategoryAncestors mocks base method
+func (m *MockStore) GetCategoryAncestors(ctx context.Context, tx *sql.Tx, id int) ([]*model.Category, error) {
+	ret := m.ctrl.Call(m, "GetCategoryAncestors", ctx, tx, id)
 	ret0, _ := ret[0].([]*model.Category)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
+// GetCategoryAncestors indicates an expected call of GetCategoryAncestors
+func (mr *MockStoreMockRecorder) GetCategoryAncestors(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategoryAncestors", reflect.TypeOf((*MockStore)(nil).GetCategoryAncestors), ctx, tx, id)
+}
+
+// GetCategories mocks base method
+func (m *MockStore) GetCategories(ctx context.Context, tx *sql.Tx, params *model.ListParams) ([]*model.Category, int, error) {
+	ret := m.ctrl.Call(m, "GetCategories", ctx, tx, params)
+	ret0, _ := ret[0].([]*model.Category)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
 // GetCategories indicates an expected call of GetCategories
-func (mr *MockStoreMockRecorder) GetCategories(tx interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockStore)(nil).GetCategories), tx)
+func (mr *MockStoreMockRecorder) GetCategories(ctx, tx, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCategories", reflect.TypeOf((*MockStore)(nil).GetCategories), ctx, tx, params)
 }
 
 // CreateCategory mocks base method
-func (m *MockStore) CreateCategory(tx *sql.Tx, category *model.Category) (*int, error) {
-	ret := m.ctrl.Call(m, "CreateCategory", tx, category)
+func (m *MockStore) CreateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateCategory", ctx, tx, category)
 	ret0, _ := ret[0].(*int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateCategory indicates an expected call of CreateCategory
-func (mr *MockStoreMockRecorder) CreateCategory(tx, category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockStore)(nil).CreateCategory), tx, category)
+func (mr *MockStoreMockRecorder) CreateCategory(ctx, tx, category interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateCategory", reflect.TypeOf((*MockStore)(nil).CreateCategory), ctx, tx, category)
 }
 
 // UpdateCategory mocks base method
-func (m *MockStore) UpdateCategory(tx *sql.Tx, category *model.Category) error {
-	ret := m.ctrl.Call(m, "UpdateCategory", tx, category)
+func (m *MockStore) UpdateCategory(ctx context.Context, tx *sql.Tx, category *model.Category) error {
+	ret := m.ctrl.Call(m, "UpdateCategory", ctx, tx, category)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateCategory indicates an expected call of UpdateCategory
-func (mr *MockStoreMockRecorder) UpdateCategory(tx, category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCategory", reflect.TypeOf((*MockStore)(nil).UpdateCategory), tx, category)
+func (mr *MockStoreMockRecorder) UpdateCategory(ctx, tx, category interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCategory", reflect.TypeOf((*MockStore)(nil).UpdateCategory), ctx, tx, category)
 }
 
 // DeleteCategory mocks base method
-func (m *MockStore) DeleteCategory(tx *sql.Tx, id int) error {
-	ret := m.ctrl.Call(m, "DeleteCategory", tx, id)
+func (m *MockStore) DeleteCategory(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteCategory", ctx, tx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteCategory indicates an expected call of DeleteCategory
-func (mr *MockStoreMockRecorder) DeleteCategory(tx, id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockStore)(nil).DeleteCategory), tx, id)
+func (mr *MockStoreMockRecorder) DeleteCategory(ctx, tx, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCategory", reflect.TypeOf((*MockStore)(nil).DeleteCategory), ctx, tx, id, version)
+}
+
+// RestoreCategory mocks base method
+func (m *MockStore) RestoreCategory(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "RestoreCategory", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreCategory indicates an expected call of RestoreCategory
+func (mr *MockStoreMockRecorder) RestoreCategory(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreCategory", reflect.TypeOf((*MockStore)(nil).RestoreCategory), ctx, tx, id)
 }
 
 // GetProduct mocks base method
-func (m *MockStore) GetProduct(tx *sql.Tx, id int) (*model.Product, error) {
-	ret := m.ctrl.Call(m, "GetProduct", tx, id)
+func (m *MockStore) GetProduct(ctx context.Context, tx *sql.Tx, id int) (*model.Product, error) {
+	ret := m.ctrl.Call(m, "GetProduct", ctx, tx, id)
 	ret0, _ := ret[0].(*model.Product)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetProduct indicates an expected call of GetProduct
-func (mr *MockStoreMockRecorder) GetProduct(tx, id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockStore)(nil).GetProduct), tx, id)
+func (mr *MockStoreMockRecorder) GetProduct(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProduct", reflect.TypeOf((*MockStore)(nil).GetProduct), ctx, tx, id)
 }
 
 // GetProducts mocks base method
-func (m *MockStore) GetProducts(tx *sql.Tx, category *int) ([]*model.Product, error) {
-	ret := m.ctrl.Call(m, "GetProducts", tx, category)
+func (m *MockStore) GetProducts(ctx context.Context, tx *sql.Tx, filter *model.ProductFilter, params *model.ListParams) ([]*model.Product, int, error) {
+	ret := m.ctrl.Call(m, "GetProducts", ctx, tx, filter, params)
 	ret0, _ := ret[0].([]*model.Product)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
 }
 
 // GetProducts indicates an expected call of GetProducts
-func (mr *MockStoreMockRecorder) GetProducts(tx, category interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProducts", reflect.TypeOf((*MockStore)(nil).GetProducts), tx, category)
+func (mr *MockStoreMockRecorder) GetProducts(ctx, tx, filter, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProducts", reflect.TypeOf((*MockStore)(nil).GetProducts), ctx, tx, filter, params)
+}
+
+// SearchProducts mocks base method
+func (m *MockStore) SearchProducts(ctx context.Context, tx *sql.Tx, search *model.ProductSearch, params *model.ListParams) ([]*model.ProductSearchResult, int, error) {
+	ret := m.ctrl.Call(m, "SearchProducts", ctx, tx, search, params)
+	ret0, _ := ret[0].([]*model.ProductSearchResult)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchProducts indicates an expected call of SearchProducts
+func (mr *MockStoreMockRecorder) SearchProducts(ctx, tx, search, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchProducts", reflect.TypeOf((*MockStore)(nil).SearchProducts), ctx, tx, search, params)
 }
 
 // CreateProduct mocks base method
-func (m *MockStore) CreateProduct(tx *sql.Tx, product *model.Product) (*int, error) {
-	ret := m.ctrl.Call(m, "CreateProduct", tx, product)
+func (m *MockStore) CreateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateProduct", ctx, tx, product)
 	ret0, _ := ret[0].(*int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // CreateProduct indicates an expected call of CreateProduct
-func (mr *MockStoreMockRecorder) CreateProduct(tx, product interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProduct", reflect.TypeOf((*MockStore)(nil).CreateProduct), tx, product)
+func (mr *MockStoreMockRecorder) CreateProduct(ctx, tx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateProduct", reflect.TypeOf((*MockStore)(nil).CreateProduct), ctx, tx, product)
 }
 
 // UpdateProduct mocks base method
-func (m *MockStore) UpdateProduct(tx *sql.Tx, product *model.Product) error {
-	ret := m.ctrl.Call(m, "UpdateProduct", tx, product)
+func (m *MockStore) UpdateProduct(ctx context.Context, tx *sql.Tx, product *model.Product) error {
+	ret := m.ctrl.Call(m, "UpdateProduct", ctx, tx, product)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // UpdateProduct indicates an expected call of UpdateProduct
-func (mr *MockStoreMockRecorder) UpdateProduct(tx, product interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockStore)(nil).UpdateProduct), tx, product)
+func (mr *MockStoreMockRecorder) UpdateProduct(ctx, tx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateProduct", reflect.TypeOf((*MockStore)(nil).UpdateProduct), ctx, tx, product)
 }
 
 // DeleteProduct mocks base method
-func (m *MockStore) DeleteProduct(tx *sql.Tx, id int) error {
-	ret := m.ctrl.Call(m, "DeleteProduct", tx, id)
+func (m *MockStore) DeleteProduct(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteProduct", ctx, tx, id, version)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // DeleteProduct indicates an expected call of DeleteProduct
-func (mr *MockStoreMockRecorder) DeleteProduct(tx, id interface{}) *gomock.Call {
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockStore)(nil).DeleteProduct), tx, id)
+func (mr *MockStoreMockRecorder) DeleteProduct(ctx, tx, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteProduct", reflect.TypeOf((*MockStore)(nil).DeleteProduct), ctx, tx, id, version)
+}
+
+// RestoreProduct mocks base method
+func (m *MockStore) RestoreProduct(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "RestoreProduct", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RestoreProduct indicates an expected call of RestoreProduct
+func (mr *MockStoreMockRecorder) RestoreProduct(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RestoreProduct", reflect.TypeOf((*MockStore)(nil).RestoreProduct), ctx, tx, id)
+}
+
+// GetVariant mocks base method
+func (m *MockStore) GetVariant(ctx context.Context, tx *sql.Tx, id int) (*model.Variant, error) {
+	ret := m.ctrl.Call(m, "GetVariant", ctx, tx, id)
+	ret0, _ := ret[0].(*model.Variant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVariant indicates an expected call of GetVariant
+func (mr *MockStoreMockRecorder) GetVariant(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVariant", reflect.TypeOf((*MockStore)(nil).GetVariant), ctx, tx, id)
+}
+
+// GetVariants mocks base method
+func (m *MockStore) GetVariants(ctx context.Context, tx *sql.Tx, product int) ([]*model.Variant, error) {
+	ret := m.ctrl.Call(m, "GetVariants", ctx, tx, product)
+	ret0, _ := ret[0].([]*model.Variant)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetVariants indicates an expected call of GetVariants
+func (mr *MockStoreMockRecorder) GetVariants(ctx, tx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVariants", reflect.TypeOf((*MockStore)(nil).GetVariants), ctx, tx, product)
+}
+
+// CreateVariant mocks base method
+func (m *MockStore) CreateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateVariant", ctx, tx, variant)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateVariant indicates an expected call of CreateVariant
+func (mr *MockStoreMockRecorder) CreateVariant(ctx, tx, variant interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateVariant", reflect.TypeOf((*MockStore)(nil).CreateVariant), ctx, tx, variant)
+}
+
+// UpdateVariant mocks base method
+func (m *MockStore) UpdateVariant(ctx context.Context, tx *sql.Tx, variant *model.Variant) error {
+	ret := m.ctrl.Call(m, "UpdateVariant", ctx, tx, variant)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateVariant indicates an expected call of UpdateVariant
+func (mr *MockStoreMockRecorder) UpdateVariant(ctx, tx, variant interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateVariant", reflect.TypeOf((*MockStore)(nil).UpdateVariant), ctx, tx, variant)
+}
+
+// DeleteVariant mocks base method
+func (m *MockStore) DeleteVariant(ctx context.Context, tx *sql.Tx, id int, version int) error {
+	ret := m.ctrl.Call(m, "DeleteVariant", ctx, tx, id, version)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteVariant indicates an expected call of DeleteVariant
+func (mr *MockStoreMockRecorder) DeleteVariant(ctx, tx, id, version interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteVariant", reflect.TypeOf((*MockStore)(nil).DeleteVariant), ctx, tx, id, version)
+}
+
+// GetStock mocks base method
+func (m *MockStore) GetStock(ctx context.Context, tx *sql.Tx, product int) (*model.Stock, error) {
+	ret := m.ctrl.Call(m, "GetStock", ctx, tx, product)
+	ret0, _ := ret[0].(*model.Stock)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetStock indicates an expected call of GetStock
+func (mr *MockStoreMockRecorder) GetStock(ctx, tx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStock", reflect.TypeOf((*MockStore)(nil).GetStock), ctx, tx, product)
+}
+
+// AdjustStock mocks base method
+func (m *MockStore) AdjustStock(ctx context.Context, tx *sql.Tx, adjustment *model.StockAdjustment) (*int, error) {
+	ret := m.ctrl.Call(m, "AdjustStock", ctx, tx, adjustment)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdjustStock indicates an expected call of AdjustStock
+func (mr *MockStoreMockRecorder) AdjustStock(ctx, tx, adjustment interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdjustStock", reflect.TypeOf((*MockStore)(nil).AdjustStock), ctx, tx, adjustment)
+}
+
+// GetStockAdjustments mocks base method
+func (m *MockStore) GetStockAdjustments(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.StockAdjustment, int, error) {
+	ret := m.ctrl.Call(m, "GetStockAdjustments", ctx, tx, product, params)
+	ret0, _ := ret[0].([]*model.StockAdjustment)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetStockAdjustments indicates an expected call of GetStockAdjustments
+func (mr *MockStoreMockRecorder) GetStockAdjustments(ctx, tx, product, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetStockAdjustments", reflect.TypeOf((*MockStore)(nil).GetStockAdjustments), ctx, tx, product, params)
+}
+
+// GetReservation mocks base method
+func (m *MockStore) GetReservation(ctx context.Context, tx *sql.Tx, id int) (*model.StockReservation, error) {
+	ret := m.ctrl.Call(m, "GetReservation", ctx, tx, id)
+	ret0, _ := ret[0].(*model.StockReservation)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReservation indicates an expected call of GetReservation
+func (mr *MockStoreMockRecorder) GetReservation(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReservation", reflect.TypeOf((*MockStore)(nil).GetReservation), ctx, tx, id)
+}
+
+// CreateReservation mocks base method
+func (m *MockStore) CreateReservation(ctx context.Context, tx *sql.Tx, reservation *model.StockReservation) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateReservation", ctx, tx, reservation)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateReservation indicates an expected call of CreateReservation
+func (mr *MockStoreMockRecorder) CreateReservation(ctx, tx, reservation interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReservation", reflect.TypeOf((*MockStore)(nil).CreateReservation), ctx, tx, reservation)
+}
+
+// CommitReservation mocks base method
+func (m *MockStore) CommitReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "CommitReservation", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CommitReservation indicates an expected call of CommitReservation
+func (mr *MockStoreMockRecorder) CommitReservation(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CommitReservation", reflect.TypeOf((*MockStore)(nil).CommitReservation), ctx, tx, id)
+}
+
+// ReleaseReservation mocks base method
+func (m *MockStore) ReleaseReservation(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "ReleaseReservation", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseReservation indicates an expected call of ReleaseReservation
+func (mr *MockStoreMockRecorder) ReleaseReservation(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseReservation", reflect.TypeOf((*MockStore)(nil).ReleaseReservation), ctx, tx, id)
+}
+
+// GetPriceHistory mocks base method
+func (m *MockStore) GetPriceHistory(ctx context.Context, tx *sql.Tx, product int, params *model.ListParams) ([]*model.PriceChange, int, error) {
+	ret := m.ctrl.Call(m, "GetPriceHistory", ctx, tx, product, params)
+	ret0, _ := ret[0].([]*model.PriceChange)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPriceHistory indicates an expected call of GetPriceHistory
+func (mr *MockStoreMockRecorder) GetPriceHistory(ctx, tx, product, params interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPriceHistory", reflect.TypeOf((*MockStore)(nil).GetPriceHistory), ctx, tx, product, params)
+}
+
+// GetTags mocks base method
+func (m *MockStore) GetTags(ctx context.Context, tx *sql.Tx) ([]*model.Tag, error) {
+	ret := m.ctrl.Call(m, "GetTags", ctx, tx)
+	ret0, _ := ret[0].([]*model.Tag)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTags indicates an expected call of GetTags
+func (mr *MockStoreMockRecorder) GetTags(ctx, tx interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTags", reflect.TypeOf((*MockStore)(nil).GetTags), ctx, tx)
+}
+
+// GetImages mocks base method
+func (m *MockStore) GetImages(ctx context.Context, tx *sql.Tx, product int) ([]*model.ProductImage, error) {
+	ret := m.ctrl.Call(m, "GetImages", ctx, tx, product)
+	ret0, _ := ret[0].([]*model.ProductImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImages indicates an expected call of GetImages
+func (mr *MockStoreMockRecorder) GetImages(ctx, tx, product interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImages", reflect.TypeOf((*MockStore)(nil).GetImages), ctx, tx, product)
+}
+
+// GetImage mocks base method
+func (m *MockStore) GetImage(ctx context.Context, tx *sql.Tx, id int) (*model.ProductImage, error) {
+	ret := m.ctrl.Call(m, "GetImage", ctx, tx, id)
+	ret0, _ := ret[0].(*model.ProductImage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetImage indicates an expected call of GetImage
+func (mr *MockStoreMockRecorder) GetImage(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImage", reflect.TypeOf((*MockStore)(nil).GetImage), ctx, tx, id)
+}
+
+// CreateImage mocks base method
+func (m *MockStore) CreateImage(ctx context.Context, tx *sql.Tx, image *model.ProductImage) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateImage", ctx, tx, image)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateImage indicates an expected call of CreateImage
+func (mr *MockStoreMockRecorder) CreateImage(ctx, tx, image interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateImage", reflect.TypeOf((*MockStore)(nil).CreateImage), ctx, tx, image)
+}
+
+// DeleteImage mocks base method
+func (m *MockStore) DeleteImage(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "DeleteImage", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteImage indicates an expected call of DeleteImage
+func (mr *MockStoreMockRecorder) DeleteImage(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteImage", reflect.TypeOf((*MockStore)(nil).DeleteImage), ctx, tx, id)
+}
+
+// ReorderImages mocks base method
+func (m *MockStore) ReorderImages(ctx context.Context, tx *sql.Tx, product int, ids []int) error {
+	ret := m.ctrl.Call(m, "ReorderImages", ctx, tx, product, ids)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReorderImages indicates an expected call of ReorderImages
+func (mr *MockStoreMockRecorder) ReorderImages(ctx, tx, product, ids interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReorderImages", reflect.TypeOf((*MockStore)(nil).ReorderImages), ctx, tx, product, ids)
+}
+
+// GetApiKeys mocks base method
+func (m *MockStore) GetApiKeys(ctx context.Context, tx *sql.Tx) ([]*model.ApiKey, error) {
+	ret := m.ctrl.Call(m, "GetApiKeys", ctx, tx)
+	ret0, _ := ret[0].([]*model.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApiKeys indicates an expected call of GetApiKeys
+func (mr *MockStoreMockRecorder) GetApiKeys(ctx, tx interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApiKeys", reflect.TypeOf((*MockStore)(nil).GetApiKeys), ctx, tx)
+}
+
+// GetApiKeyByHash mocks base method
+func (m *MockStore) GetApiKeyByHash(ctx context.Context, tx *sql.Tx, hash string) (*model.ApiKey, error) {
+	ret := m.ctrl.Call(m, "GetApiKeyByHash", ctx, tx, hash)
+	ret0, _ := ret[0].(*model.ApiKey)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApiKeyByHash indicates an expected call of GetApiKeyByHash
+func (mr *MockStoreMockRecorder) GetApiKeyByHash(ctx, tx, hash interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApiKeyByHash", reflect.TypeOf((*MockStore)(nil).GetApiKeyByHash), ctx, tx, hash)
+}
+
+// CreateApiKey mocks base method
+func (m *MockStore) CreateApiKey(ctx context.Context, tx *sql.Tx, key *model.ApiKey) (*int, error) {
+	ret := m.ctrl.Call(m, "CreateApiKey", ctx, tx, key)
+	ret0, _ := ret[0].(*int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateApiKey indicates an expected call of CreateApiKey
+func (mr *MockStoreMockRecorder) CreateApiKey(ctx, tx, key interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateApiKey", reflect.TypeOf((*MockStore)(nil).CreateApiKey), ctx, tx, key)
+}
+
+// RevokeApiKey mocks base method
+func (m *MockStore) RevokeApiKey(ctx context.Context, tx *sql.Tx, id int) error {
+	ret := m.ctrl.Call(m, "RevokeApiKey", ctx, tx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeApiKey indicates an expected call of RevokeApiKey
+func (mr *MockStoreMockRecorder) RevokeApiKey(ctx, tx, id interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeApiKey", reflect.TypeOf((*MockStore)(nil).RevokeApiKey), ctx, tx, id)
+}
+
+// TouchApiKey mocks base method
+func (m *MockStore) TouchApiKey(ctx context.Context, tx *sql.Tx, id int, at time.Time) error {
+	ret := m.ctrl.Call(m, "TouchApiKey", ctx, tx, id, at)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchApiKey indicates an expected call of TouchApiKey
+func (mr *MockStoreMockRecorder) TouchApiKey(ctx, tx, id, at interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchApiKey", reflect.TypeOf((*MockStore)(nil).TouchApiKey), ctx, tx, id, at)
+}
+
+// Purge mocks base method
+func (m *MockStore) Purge(ctx context.Context, tx *sql.Tx, before time.Time) (int, error) {
+	ret := m.ctrl.Call(m, "Purge", ctx, tx, before)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Purge indicates an expected call of Purge
+func (mr *MockStoreMockRecorder) Purge(ctx, tx, before interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockStore)(nil).Purge), ctx, tx, before)
 }
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"echo-rest-api/model"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMoney_Parse(t *testing.T) {
+	for s, expected := range map[string]model.Money{"19.99": 1999, "19.9": 1990, "19": 1900, "0.01": 1, "-1.5": -150} {
+		m, err := model.ParseMoney(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, expected, m, s)
+	}
+	for _, s := range []string{"", "1.999", "1e3", "a", ".5", "1.-5", "--1"} {
+		_, err := model.ParseMoney(s)
+		assert.Error(t, err, s)
+	}
+	assert.Equal(t, "19.99", model.Money(1999).String())
+	assert.Equal(t, "-0.05", model.Money(-5).String())
+	// float64 дал бы 19.989999...
+	assert.Equal(t, model.Money(1999), model.MoneyFromFloat(19.99))
+}
+
+func TestMoney_JSON(t *testing.T) {
+	p := &model.Product{}
+	assert.NoError(t, json.Unmarshal([]byte(`{"price": 19.99, "prices": [{"currency": "USD", "amount": "0.30"}]}`), p))
+	assert.Equal(t, model.Money(1999), p.Price)
+	assert.Equal(t, model.Money(30), p.Prices[0].Amount)
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 19.999}`), p))
+	res, _ := json.Marshal(model.ProductPrice{Currency: "USD", Amount: 1990})
+	assert.Equal(t, `{"currency":"USD","amount":19.90}`, string(res))
+}
+
+func TestProduct_InCurrency(t *testing.T) {
+	p := &model.Product{Price: 1000, Currency: "RUB", Prices: []model.ProductPrice{{Currency: "EUR", Amount: 10}, {Currency: "USD", Amount: 12}}}
+	assert.True(t, p.InCurrency("rub"))
+	assert.Equal(t, model.Money(1000), p.Price)
+	assert.False(t, p.InCurrency("GBP"))
+	assert.True(t, p.InCurrency("USD"))
+	assert.Equal(t, model.Money(12), p.Price)
+	assert.Equal(t, "USD", p.Currency)
+	assert.Equal(t, []model.ProductPrice{{Currency: "EUR", Amount: 10}, {Currency: "RUB", Amount: 1000}}, p.Prices)
+	assert.Nil(t, p.CheckPrices())
+	p.Prices = append(p.Prices, model.ProductPrice{Currency: "USD", Amount: 1})
+	assert.Error(t, p.CheckPrices())
+}
+
+func TestPriceChange_PricesAt(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	price := func(m model.Money) *model.Money { return &m }
+	history := []*model.PriceChange{
+		{Currency: "RUB", NewPrice: price(1000), ChangedAt: start},
+		{Currency: "RUB", OldPrice: price(1000), NewPrice: price(1200), ChangedAt: start.Add(2 * time.Hour)},
+		{Currency: "USD", NewPrice: price(15), ChangedAt: start.Add(2 * time.Hour)},
+		{Currency: "USD", OldPrice: price(15), ChangedAt: start.Add(4 * time.Hour)},
+	}
+	current := map[string]model.Money{"RUB": 1200, "EUR": 11}
+	assert.Equal(t, map[string]model.Money{"EUR": 11}, model.PricesAt(history, current, start.Add(-time.Hour)))
+	assert.Equal(t, map[string]model.Money{"RUB": 1000, "EUR": 11}, model.PricesAt(history, current, start.Add(time.Hour)))
+	assert.Equal(t, map[string]model.Money{"RUB": 1200, "USD": 15, "EUR": 11}, model.PricesAt(history, current, start.Add(2*time.Hour)))
+	assert.Equal(t, map[string]model.Money{"RUB": 1200, "EUR": 11}, model.PricesAt(history, current, start.Add(5*time.Hour)))
+	p := &model.Product{Price: 1200, Currency: "RUB"}
+	assert.True(t, p.WithPrices(map[string]model.Money{"USD": 15, "EUR": 11}))
+	assert.Equal(t, "EUR", p.Currency)
+	assert.Equal(t, []model.ProductPrice{{Currency: "USD", Amount: 15}}, p.Prices)
+	assert.False(t, p.WithPrices(nil))
+}
@@ -1,27 +1,30 @@
 package test
 
 import (
+	"context"
 	"database/sql"
 	"echo-rest-api/model"
 	"echo-rest-api/service"
+	"echo-rest-api/store"
 	"echo-rest-api/test/mock"
 	"errors"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestProductService_GetProduct(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().GetProduct(nil, 1).Return(nil, errors.New("test")).Times(1)
-	mockStore.EXPECT().GetProduct(nil, 2).Return(&model.Product{Id: 2, Name: "test"}, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, nil, 1).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(&model.Product{Id: 2, Name: "test"}, nil).Times(1)
 	ps := service.NewProductService(mockStore)
-	r, e := ps.GetProduct(1)
+	r, e := ps.GetProduct(ctx, 1)
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
-	r, e = ps.GetProduct(2)
+	r, e = ps.GetProduct(ctx, 2)
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -30,13 +33,55 @@ func TestProductService_GetProducts(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().GetProducts(nil, nil).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().GetProducts(ctx, nil, nil, nil).Return(nil, 0, errors.New("test")).Times(1)
 	ps := service.NewProductService(mockStore)
-	r, e := ps.GetProducts(nil)
+	r, _, e := ps.GetProducts(ctx, nil, nil)
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
-	mockStore.EXPECT().GetProducts(nil, nil).Return([]*model.Product{}, nil).Times(1)
-	r, e = ps.GetProducts(nil)
+	mockStore.EXPECT().GetProducts(ctx, nil, nil, nil).Return([]*model.Product{}, 0, nil).Times(1)
+	r, _, e = ps.GetProducts(ctx, nil, nil)
+	assert.Nil(t, e)
+	assert.NotNil(t, r)
+}
+
+func TestProductService_RestoreProduct(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockStore := mock.NewMockStore(mockCtrl)
+	tx := new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().RestoreProduct(ctx, tx, 1).Return(sql.ErrNoRows).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	ps := service.NewProductService(mockStore)
+	r, e := ps.RestoreProduct(ctx, 1)
+	assert.Equal(t, sql.ErrNoRows, e)
+	assert.Nil(t, r)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().RestoreProduct(ctx, tx, 2).Return(nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 2).Return(&model.Product{Id: 2, Version: 3}, nil).Times(1)
+	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
+	ps = service.NewProductService(mockStore)
+	r, e = ps.RestoreProduct(ctx, 2)
+	assert.Nil(t, e)
+	assert.Equal(t, 3, r.Version)
+}
+
+func TestProductService_SearchProducts(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	search := &model.ProductSearch{Query: "test"}
+	mockStore.EXPECT().SearchProducts(ctx, nil, search, nil).Return(nil, 0, errors.New("test")).Times(1)
+	ps := service.NewProductService(mockStore)
+	r, _, e := ps.SearchProducts(ctx, search, nil)
+	assert.NotNil(t, e)
+	assert.Nil(t, r)
+	mockStore.EXPECT().SearchProducts(ctx, nil, search, nil).Return([]*model.ProductSearchResult{}, 0, nil).Times(1)
+	r, _, e = ps.SearchProducts(ctx, search, nil)
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -46,30 +91,30 @@ func TestProductService_CreateProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	ps := service.NewProductService(mockStore)
-	r, e := ps.CreateProduct(&model.Product{Name: "test"})
+	r, e := ps.CreateProduct(ctx, &model.Product{Name: "test"})
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().CreateProduct(tx, &model.Product{Name: "test"}).Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().CreateProduct(ctx, tx, &model.Product{Name: "test"}).Return(nil, errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	r, e = ps.CreateProduct(&model.Product{Name: "test"})
+	r, e = ps.CreateProduct(ctx, &model.Product{Name: "test"})
 	assert.NotNil(t, e)
 	assert.Nil(t, r)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
 	var id = 1
-	mockStore.EXPECT().CreateProduct(tx, &model.Product{Name: "test"}).Return(&id, nil).Times(1)
+	mockStore.EXPECT().CreateProduct(ctx, tx, &model.Product{Name: "test"}).Return(&id, nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	r, e = ps.CreateProduct(&model.Product{Name: "test"})
+	r, e = ps.CreateProduct(ctx, &model.Product{Name: "test"})
 	assert.Nil(t, e)
 	assert.NotNil(t, r)
 }
@@ -79,29 +124,97 @@ func TestProductService_UpdateProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	ps := service.NewProductService(mockStore)
-	e := ps.UpdateProduct(nil)
+	e := ps.UpdateProduct(ctx, nil)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
 	prod := &model.Product{Id: 1, Name: "test"}
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().UpdateProduct(tx, prod).Return(errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().UpdateProduct(ctx, tx, prod).Return(errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	e = ps.UpdateProduct(prod)
+	e = ps.UpdateProduct(ctx, prod)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
 	prod = &model.Product{Id: 1, Name: "test"}
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().UpdateProduct(tx, prod).Return(nil).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().UpdateProduct(ctx, tx, prod).Return(nil).Times(1)
+	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
+	ps = service.NewProductService(mockStore)
+	e = ps.UpdateProduct(ctx, prod)
+	assert.Nil(t, e)
+}
+
+func TestProductService_PatchProduct(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	setPrice := func(current *model.Product, _ model.CategoryLookup) (*model.Product, error) {
+		prod := *current
+		prod.Price = 2000
+		return &prod, nil
+	}
+
+	mockStore := mock.NewMockStore(mockCtrl)
+	tx := new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 1).Return(nil, nil).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	ps := service.NewProductService(mockStore)
+	_, e := ps.PatchProduct(ctx, 1, 0, setPrice)
+	assert.Equal(t, sql.ErrNoRows, e)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 1).Return(&model.Product{Id: 1, Name: "test", Version: 3}, nil).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	ps = service.NewProductService(mockStore)
+	_, e = ps.PatchProduct(ctx, 1, 2, setPrice)
+	assert.Equal(t, store.ErrConflict, e)
+
+	// ошибка изменения прерывает транзакцию
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 1).Return(&model.Product{Id: 1, Name: "test", Version: 2}, nil).Times(1)
+	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
+	ps = service.NewProductService(mockStore)
+	_, e = ps.PatchProduct(ctx, 1, 2, func(*model.Product, model.CategoryLookup) (*model.Product, error) {
+		return nil, errors.New("test")
+	})
+	assert.NotNil(t, e)
+
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 1).Return(&model.Product{Id: 1, Name: "test", Price: 1000, Version: 2}, nil).Times(1)
+	mockStore.EXPECT().UpdateProduct(ctx, tx, &model.Product{Id: 1, Name: "test", Price: 2000, Version: 2}).Return(nil).Times(1)
+	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
+	ps = service.NewProductService(mockStore)
+	prod, e := ps.PatchProduct(ctx, 1, 2, setPrice)
+	assert.Nil(t, e)
+	assert.Equal(t, 2000, int(prod.Price))
+
+	// категория для проверки атрибутов читается в транзакции изменения
+	mockStore = mock.NewMockStore(mockCtrl)
+	tx = new(sql.Tx)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().GetProduct(ctx, tx, 1).Return(&model.Product{Id: 1, Name: "test", Category: 3, Version: 2}, nil).Times(1)
+	mockStore.EXPECT().GetCategory(ctx, tx, 3).Return(&model.Category{Id: 3, Name: "test"}, nil).Times(1)
+	mockStore.EXPECT().UpdateProduct(ctx, tx, &model.Product{Id: 1, Name: "test", Category: 3, Version: 2}).Return(nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	e = ps.UpdateProduct(prod)
+	_, e = ps.PatchProduct(ctx, 1, 2, func(current *model.Product, category model.CategoryLookup) (*model.Product, error) {
+		c, err := category(current.Category)
+		assert.Nil(t, err)
+		assert.Equal(t, "test", c.Name)
+		return current, nil
+	})
 	assert.Nil(t, e)
 }
 
@@ -110,26 +223,164 @@ func TestProductService_DeleteProduct(t *testing.T) {
 	defer mockCtrl.Finish()
 
 	mockStore := mock.NewMockStore(mockCtrl)
-	mockStore.EXPECT().Begin().Return(nil, errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(nil, errors.New("test")).Times(1)
 	ps := service.NewProductService(mockStore)
-	e := ps.DeleteProduct(1)
+	e := ps.DeleteProduct(ctx, 1, 2)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx := new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().DeleteProduct(tx, 1).Return(errors.New("test")).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().DeleteProduct(ctx, tx, 1, 2).Return(errors.New("test")).Times(1)
 	mockStore.EXPECT().Rollback(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	e = ps.DeleteProduct(1)
+	e = ps.DeleteProduct(ctx, 1, 2)
 	assert.NotNil(t, e)
 
 	mockStore = mock.NewMockStore(mockCtrl)
 	tx = new(sql.Tx)
-	mockStore.EXPECT().Begin().Return(tx, nil).Times(1)
-	mockStore.EXPECT().DeleteProduct(tx, 1).Return(nil).Times(1)
+	mockStore.EXPECT().Begin(ctx).Return(tx, nil).Times(1)
+	mockStore.EXPECT().DeleteProduct(ctx, tx, 1, 2).Return(nil).Times(1)
 	mockStore.EXPECT().Commit(tx).Return(nil).Times(1)
 	ps = service.NewProductService(mockStore)
-	e = ps.DeleteProduct(1)
+	e = ps.DeleteProduct(ctx, 1, 2)
+	assert.Nil(t, e)
+}
+
+func TestProductService_GetVariants(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	// продукта нет
+	mockStore.EXPECT().GetProduct(ctx, nil, 1).Return(nil, nil).Times(1)
+	r, e := ps.GetVariants(ctx, 1)
+	assert.Nil(t, e)
+	assert.Nil(t, r)
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(&model.Product{Id: 2}, nil).Times(1)
+	mockStore.EXPECT().GetVariants(ctx, nil, 2).Return([]*model.Variant{{Id: 1, Product: 2, Sku: "SKU"}}, nil).Times(1)
+	r, e = ps.GetVariants(ctx, 2)
+	assert.Nil(t, e)
+	assert.Len(t, r, 1)
+	// вариант другого продукта не отдается
+	mockStore.EXPECT().GetVariant(ctx, nil, 1).Return(&model.Variant{Id: 1, Product: 2, Sku: "SKU"}, nil).Times(2)
+	v, e := ps.GetVariant(ctx, 3, 1)
+	assert.Nil(t, e)
+	assert.Nil(t, v)
+	v, e = ps.GetVariant(ctx, 2, 1)
+	assert.Nil(t, e)
+	assert.NotNil(t, v)
+}
+
+func TestProductService_CreateVariant(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	variant := &model.Variant{Product: 2, Sku: "SKU"}
+	// продукт удален
+	deletedAt := time.Now()
+	mockStore.EXPECT().Begin(ctx).Return(nil, nil).Times(2)
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(&model.Product{Id: 2, DeletedAt: &deletedAt}, nil).Times(1)
+	mockStore.EXPECT().Rollback(nil).Return(nil).Times(1)
+	_, e := ps.CreateVariant(ctx, variant)
+	assert.Equal(t, sql.ErrNoRows, e)
+	id := 1
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(&model.Product{Id: 2}, nil).Times(1)
+	mockStore.EXPECT().CreateVariant(ctx, nil, variant).Return(&id, nil).Times(1)
+	mockStore.EXPECT().Commit(nil).Return(nil).Times(1)
+	r, e := ps.CreateVariant(ctx, variant)
+	assert.Nil(t, e)
+	assert.Equal(t, id, *r)
+}
+
+func TestProductService_UpdateVariant(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	mockStore.EXPECT().Begin(ctx).Return(nil, nil).Times(3)
+	mockStore.EXPECT().GetVariant(ctx, nil, 1).Return(&model.Variant{Id: 1, Product: 2, Sku: "SKU"}, nil).Times(3)
+	// вариант другого продукта
+	mockStore.EXPECT().Rollback(nil).Return(nil).Times(2)
+	assert.Equal(t, sql.ErrNoRows, ps.UpdateVariant(ctx, &model.Variant{Id: 1, Product: 3, Sku: "SKU"}))
+	assert.Equal(t, sql.ErrNoRows, ps.DeleteVariant(ctx, 3, 1, 0))
+	variant := &model.Variant{Id: 1, Product: 2, Sku: "SKU2"}
+	mockStore.EXPECT().UpdateVariant(ctx, nil, variant).Return(nil).Times(1)
+	mockStore.EXPECT().Commit(nil).Return(nil).Times(1)
+	assert.Nil(t, ps.UpdateVariant(ctx, variant))
+}
+
+func TestProductService_AdjustStock(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	adjustment := &model.StockAdjustment{Product: 2, Delta: 5, Reason: model.StockReceipt}
+	// продукта нет
+	mockStore.EXPECT().Begin(ctx).Return(nil, nil).Times(3)
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(nil, nil).Times(1)
+	mockStore.EXPECT().Rollback(nil).Return(nil).Times(2)
+	_, e := ps.AdjustStock(ctx, adjustment)
+	assert.Equal(t, sql.ErrNoRows, e)
+	// остатка не хватает
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).Return(&model.Product{Id: 2}, nil).Times(2)
+	mockStore.EXPECT().AdjustStock(ctx, nil, adjustment).Return(nil, store.ErrInsufficientStock).Times(1)
+	_, e = ps.AdjustStock(ctx, adjustment)
+	assert.Equal(t, store.ErrInsufficientStock, e)
+	id := 1
+	mockStore.EXPECT().AdjustStock(ctx, nil, adjustment).Return(&id, nil).Times(1)
+	mockStore.EXPECT().Commit(nil).Return(nil).Times(1)
+	r, e := ps.AdjustStock(ctx, adjustment)
+	assert.Nil(t, e)
+	assert.Equal(t, id, *r)
+}
+
+func TestProductService_Reservation(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	// резерв другого продукта не отдается и не меняется
+	mockStore.EXPECT().GetReservation(ctx, nil, 1).Return(&model.StockReservation{Id: 1, Product: 2, Quantity: 1, Status: model.ReservationActive}, nil).Times(3)
+	r, e := ps.GetReservation(ctx, 3, 1)
+	assert.Nil(t, e)
+	assert.Nil(t, r)
+	mockStore.EXPECT().Begin(ctx).Return(nil, nil).Times(2)
+	mockStore.EXPECT().Rollback(nil).Return(nil).Times(1)
+	_, e = ps.CommitReservation(ctx, 3, 1)
+	assert.Equal(t, sql.ErrNoRows, e)
+	// подтверждение возвращает измененный резерв
+	mockStore.EXPECT().CommitReservation(ctx, nil, 1).Return(nil).Times(1)
+	mockStore.EXPECT().GetReservation(ctx, nil, 1).Return(&model.StockReservation{Id: 1, Product: 2, Quantity: 1, Status: model.ReservationCommitted}, nil).Times(1)
+	mockStore.EXPECT().Commit(nil).Return(nil).Times(1)
+	r, e = ps.CommitReservation(ctx, 2, 1)
+	assert.Nil(t, e)
+	assert.Equal(t, model.ReservationCommitted, r.Status)
+}
+
+func TestProductService_GetProductAt(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockStore := mock.NewMockStore(mockCtrl)
+	ps := service.NewProductService(mockStore)
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldPrice, newPrice := model.Money(1000), model.Money(1200)
+	history := []*model.PriceChange{
+		{Id: 1, Product: 2, Currency: "RUB", NewPrice: &oldPrice, ChangedAt: created},
+		{Id: 2, Product: 2, Currency: "RUB", OldPrice: &oldPrice, NewPrice: &newPrice, ChangedAt: created.Add(time.Hour)},
+	}
+	mockStore.EXPECT().Begin(ctx).Return(nil, nil).Times(2)
+	mockStore.EXPECT().Rollback(nil).Return(nil).Times(2)
+	mockStore.EXPECT().GetProduct(ctx, nil, 2).DoAndReturn(func(_ context.Context, _ *sql.Tx, _ int) (*model.Product, error) {
+		return &model.Product{Id: 2, Price: newPrice, Currency: "RUB"}, nil
+	}).Times(2)
+	mockStore.EXPECT().GetPriceHistory(ctx, nil, 2, nil).Return(history, 2, nil).Times(2)
+	p, e := ps.GetProductAt(ctx, 2, created.Add(time.Minute))
+	assert.Nil(t, e)
+	assert.Equal(t, oldPrice, p.Price)
+	// до создания продукта цен не было
+	p, e = ps.GetProductAt(ctx, 2, created.Add(-time.Minute))
 	assert.Nil(t, e)
+	assert.Nil(t, p)
 }
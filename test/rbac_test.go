@@ -0,0 +1,184 @@
+package test
+
+import (
+	"context"
+	"echo-rest-api/api"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"echo-rest-api/test/mock"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Конфиг с проверкой токенов и ролей по умолчанию
+func rbacConfig() *config.Config {
+	conf := authConfig()
+	conf.Rbac.Enabled = true
+	conf.Rbac.RoleClaim = "roles"
+	conf.Rbac.DefaultRole = model.RoleViewer
+	conf.Rbac.Users = map[string][]string{"editor": {model.RoleEditor}, "root": {model.RoleAdmin}}
+	return conf
+}
+
+// Выполнить запрос с токеном пользователя sub и ролями из claim roles
+func rbacRequest(t *testing.T, a *api.Api, method string, path string, sub string, roles ...interface{}) *httptest.ResponseRecorder {
+	claims := authClaims(sub)
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"name":"test"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", claims))
+	req.Header.Set("If-Match", "*")
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRbac_Roles(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	a := api.NewApi(rbacConfig(), cs, nil, nil)
+	assert.Contains(t, a.GetApiInfo().MW, "RBAC")
+	cs.EXPECT().GetCategory(gomock.Any(), 1).Return(&model.Category{Id: 1, Name: "test"}, nil).AnyTimes()
+	cs.EXPECT().CreateCategory(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, category *model.Category) (*int, error) {
+		id := 2
+		return &id, nil
+	}).Times(2)
+	cs.EXPECT().DeleteCategory(gomock.Any(), 1, 0).Return(nil).Times(2)
+	// пользователь без ролей - viewer
+	assert.Equal(t, http.StatusOK, rbacRequest(t, a, echo.GET, "/api/categories/1", "guest").Code)
+	rec := rbacRequest(t, a, echo.POST, "/api/categories", "guest")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), model.ScopeCatalogWrite)
+	// editor изменяет каталог, но не удаляет категории
+	assert.Equal(t, http.StatusCreated, rbacRequest(t, a, echo.POST, "/api/categories", "editor").Code)
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.DELETE, "/api/categories/1", "editor").Code)
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.GET, "/api/admin/db/stats", "editor").Code)
+	assert.Equal(t, http.StatusNoContent, rbacRequest(t, a, echo.DELETE, "/api/categories/1", "root").Code)
+	// роли из токена дополняют роли из конфига, неизвестные роли прав не дают
+	assert.Equal(t, http.StatusCreated, rbacRequest(t, a, echo.POST, "/api/categories", "guest", "editor").Code)
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.DELETE, "/api/categories/1", "guest", "owner").Code)
+	assert.Equal(t, http.StatusNoContent, rbacRequest(t, a, echo.DELETE, "/api/categories/1", "editor", "admin").Code)
+}
+
+func TestRbac_ApiKey(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	as := mock.NewMockAdminService(mockCtrl)
+	conf := rbacConfig()
+	conf.Rbac.Users["api-key:erp"] = []string{model.RoleEditor}
+	a := api.NewApi(conf, cs, nil, as)
+	// область доступа ключа не расширяет права его роли
+	key := &model.ApiKey{Id: 1, Name: "erp", Scopes: []string{model.ScopeCatalogRead, model.ScopeCatalogWrite, model.ScopeCatalogDelete}}
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_erp").Return(key, nil).AnyTimes()
+	req := httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(api.HeaderApiKey, "erk_erp")
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "editor")
+}
+
+func TestRbac_SpoofedUser(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	// X-User задает сам клиент, поэтому rbac без аутентификации не запускается и запросы не выполняет
+	conf := rbacConfig()
+	conf.Auth.Enabled = false
+	a := api.NewApi(conf, cs, nil, nil)
+	assert.Error(t, a.Start())
+	req := httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(api.HeaderUser, "root")
+	rec := httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	// с аутентификацией X-User не дает ролей пользователя из rbac.users
+	a = api.NewApi(rbacConfig(), cs, nil, nil)
+	claims := authClaims("guest")
+	req = httptest.NewRequest(echo.DELETE, "/api/categories/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+signToken(t, jwt.SigningMethodHS256, []byte(authSecret), "", claims))
+	req.Header.Set(api.HeaderUser, "root")
+	rec = httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), model.RoleViewer)
+}
+
+func TestRbac_IncludeDeleted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	cs := mock.NewMockCategoryService(mockCtrl)
+	ps := mock.NewMockProductService(mockCtrl)
+	as := mock.NewMockAdminService(mockCtrl)
+	a := api.NewApi(rbacConfig(), cs, ps, as)
+	cs.EXPECT().GetCategories(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, params *model.ListParams) ([]*model.Category, int, error) {
+		assert.True(t, params.IncludeDeleted)
+		return nil, 0, nil
+	}).Times(1)
+	// удаленные записи выбираются только с правом admin
+	rec := rbacRequest(t, a, echo.GET, "/api/categories?include_deleted=true", "editor")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "include_deleted")
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.GET, "/api/categories/1?include_deleted=true", "guest").Code)
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.GET, "/api/products?include_deleted=true", "editor").Code)
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.GET, "/api/products/1?include_deleted=true", "editor").Code)
+	assert.Equal(t, http.StatusOK, rbacRequest(t, a, echo.GET, "/api/categories?include_deleted=true", "root").Code)
+	// без rbac - по области доступа ключа API, анонимному чтению удаленные записи недоступны
+	conf := authConfig()
+	conf.Auth.AnonymousRead = true
+	a = api.NewApi(conf, cs, ps, as)
+	key := &model.ApiKey{Id: 1, Name: "erp", Scopes: []string{model.ScopeCatalogRead, model.ScopeCatalogWrite}}
+	as.EXPECT().AuthenticateApiKey(gomock.Any(), "erk_erp").Return(key, nil).AnyTimes()
+	req := httptest.NewRequest(echo.GET, "/api/products/1?include_deleted=true", nil)
+	req.Header.Set(api.HeaderApiKey, "erk_erp")
+	rec = httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = httptest.NewRecorder()
+	a.Http.ServeHTTP(rec, httptest.NewRequest(echo.GET, "/api/categories?include_deleted=true", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestRbac_Routs(t *testing.T) {
+	a := api.NewApi(rbacConfig(), nil, nil, nil)
+	routs := a.GetApiInfo().Routs
+	assert.Contains(t, routs, "/api/categories/:id DELETE catalog:delete [admin]")
+	assert.Contains(t, routs, "/api/products POST catalog:write [admin editor]")
+	assert.Contains(t, routs, "/api/products GET catalog:read [admin editor viewer]")
+	assert.Contains(t, routs, "/ GET")
+	// без rbac маршруты показываются с требуемой областью доступа
+	routs = api.NewApi(&config.Config{}, nil, nil, nil).GetApiInfo().Routs
+	assert.Contains(t, routs, "/api/admin/keys POST admin")
+}
+
+func TestRbac_Config(t *testing.T) {
+	conf := rbacConfig()
+	conf.Rbac.Roles = map[string][]string{"reader": {model.ScopeCatalogRead}}
+	conf.Rbac.DefaultRole = "reader"
+	conf.Rbac.Users = nil
+	a := api.NewApi(conf, nil, nil, nil)
+	assert.Contains(t, a.GetApiInfo().Routs, "/api/products GET catalog:read [reader]")
+	assert.Equal(t, http.StatusForbidden, rbacRequest(t, a, echo.POST, "/api/categories", "guest").Code)
+	// роль пользователя должна быть задана
+	conf = rbacConfig()
+	conf.Rbac.Users["manager"] = []string{"owner"}
+	a = api.NewApi(conf, nil, nil, nil)
+	assert.Error(t, a.Start())
+	assert.Equal(t, http.StatusInternalServerError, rbacRequest(t, a, echo.GET, "/api/categories/1", "guest").Code)
+	conf = rbacConfig()
+	conf.Rbac.Roles = map[string][]string{"viewer": {"catalog:purge"}}
+	assert.Error(t, api.NewApi(conf, nil, nil, nil).Start())
+	conf = rbacConfig()
+	conf.Rbac.DefaultRole = "guest"
+	assert.Error(t, api.NewApi(conf, nil, nil, nil).Start())
+}
@@ -0,0 +1,331 @@
+package test
+
+import (
+	"context"
+	"database/sql"
+	"echo-rest-api/config"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSqliteStore(t *testing.T) (store.Store, func()) {
+	dir, err := ioutil.TempDir("", "echo-rest-api")
+	assert.NoError(t, err)
+	conf := &config.Config{}
+	conf.Store.Driver = "sqlite"
+	conf.Store.Dsn = filepath.Join(dir, "store.db")
+	s, err := store.NewStore(conf)
+	assert.NoError(t, err)
+	return s, func() {
+		s.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestSqliteStore_Category(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	c, err := s.GetCategory(ctx, nil, -1)
+	assert.Nil(t, err)
+	assert.Nil(t, c)
+	tx, _ := s.Begin(ctx)
+	defer s.Rollback(tx)
+	id, err := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	assert.NoError(t, err)
+	cat, _ := s.GetCategory(ctx, tx, *id)
+	cat.Name = "text2"
+	assert.Nil(t, s.UpdateCategory(ctx, tx, cat))
+	cat2, _ := s.GetCategory(ctx, tx, *id)
+	assert.Equal(t, "text2", cat2.Name)
+	s.CreateCategory(ctx, tx, &model.Category{Name: "text3"})
+	res, total, _ := s.GetCategories(ctx, tx, &model.ListParams{Limit: 1, Offset: 1})
+	assert.Len(t, res, 1)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "text3", res[0].Name)
+	assert.Equal(t, sql.ErrNoRows, s.DeleteCategory(ctx, tx, -1, 0))
+}
+
+func TestSqliteStore_Product(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	tx, _ := s.Begin(ctx)
+	defer s.Rollback(tx)
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	id, err := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
+	assert.NoError(t, err)
+	p, _ := s.GetProduct(ctx, tx, *id)
+	assert.Equal(t, "test_name", p.Name)
+	assert.Equal(t, model.Money(6550), p.Price)
+	p.Price = 6570
+	assert.Nil(t, s.UpdateProduct(ctx, tx, p))
+	ps, total, _ := s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*category}}, nil)
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, model.Money(6570), ps[0].Price)
+	ps, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*category}}, &model.ListParams{Limit: 1, After: &model.Cursor{Id: *id}})
+	assert.Empty(t, ps)
+	assert.Equal(t, 1, total)
+	_, err = s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: -1, Price: 6550})
+	assert.Equal(t, store.ErrForeignKey, err)
+	// удаление категории удаляет ее продукты
+	assert.Nil(t, s.DeleteCategory(ctx, tx, *category, 0))
+	p, _ = s.GetProduct(ctx, tx, *id)
+	assert.NotNil(t, p.DeletedAt)
+}
+
+func TestSqliteStore_Version(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	category, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	cat, _ := s.GetCategory(ctx, nil, *category)
+	assert.Equal(t, 1, cat.Version)
+	cat.Name = "text2"
+	assert.Nil(t, s.UpdateCategory(ctx, nil, cat))
+	assert.Equal(t, 2, cat.Version)
+	// версия устарела
+	assert.Equal(t, store.ErrConflict, s.UpdateCategory(ctx, nil, &model.Category{Id: *category, Name: "text3", Version: 1}))
+	assert.Equal(t, store.ErrConflict, s.DeleteCategory(ctx, nil, *category, 1))
+	assert.Equal(t, sql.ErrNoRows, s.UpdateCategory(ctx, nil, &model.Category{Id: -1, Name: "text3", Version: 1}))
+	product := &model.Product{Name: "test_name", Category: *category, Price: 1000}
+	id, _ := s.CreateProduct(ctx, nil, product)
+	assert.Equal(t, 1, product.Version)
+	p, _ := s.GetProduct(ctx, nil, *id)
+	p.Price = 2000
+	assert.Nil(t, s.UpdateProduct(ctx, nil, p))
+	assert.Equal(t, 2, p.Version)
+	// без проверки версии
+	p.Version = 0
+	assert.Nil(t, s.UpdateProduct(ctx, nil, p))
+	assert.Equal(t, 3, p.Version)
+	product.Id = *id
+	assert.Equal(t, store.ErrConflict, s.UpdateProduct(ctx, nil, product))
+	assert.Equal(t, store.ErrConflict, s.DeleteProduct(ctx, nil, *id, 2))
+	assert.Nil(t, s.DeleteProduct(ctx, nil, *id, 3))
+	assert.Equal(t, sql.ErrNoRows, s.DeleteProduct(ctx, nil, *id, 3))
+	assert.Nil(t, s.DeleteCategory(ctx, nil, *category, 2))
+}
+
+func TestSqliteStore_SoftDelete(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	category, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	deletedBefore, _ := s.CreateProduct(ctx, nil, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	id, _ := s.CreateProduct(ctx, nil, &model.Product{Name: "test_name2", Category: *category, Price: 2000})
+	assert.Nil(t, s.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, s.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, s.UpdateProduct(ctx, nil, &model.Product{Id: *deletedBefore, Name: "test_name", Category: *category, Price: 1000}))
+	filter := &model.ProductFilter{Categories: []int{*category}}
+	ps, total, _ := s.GetProducts(ctx, nil, filter, nil)
+	assert.Equal(t, 1, total)
+	assert.Len(t, ps, 1)
+	ps, total, _ = s.GetProducts(ctx, nil, filter, &model.ListParams{IncludeDeleted: true})
+	assert.Equal(t, 2, total)
+	assert.Len(t, ps, 2)
+	// удаление категории помечает удаленными ее продукты
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, s.DeleteCategory(ctx, nil, *category, 0))
+	p, _ := s.GetProduct(ctx, nil, *id)
+	assert.NotNil(t, p.DeletedAt)
+	_, total, _ = s.GetProducts(ctx, nil, filter, nil)
+	assert.Equal(t, 0, total)
+	// восстановление категории восстанавливает только продукты, удаленные вместе с ней
+	assert.Nil(t, s.RestoreCategory(ctx, nil, *category))
+	assert.Equal(t, sql.ErrNoRows, s.RestoreCategory(ctx, nil, *category))
+	p, _ = s.GetProduct(ctx, nil, *id)
+	assert.Nil(t, p.DeletedAt)
+	p, _ = s.GetProduct(ctx, nil, *deletedBefore)
+	assert.NotNil(t, p.DeletedAt)
+	assert.Nil(t, s.RestoreProduct(ctx, nil, *deletedBefore))
+	assert.Equal(t, sql.ErrNoRows, s.RestoreProduct(ctx, nil, *deletedBefore))
+	// очистка удаляет только записи, удаленные раньше заданного времени
+	assert.Nil(t, s.DeleteProduct(ctx, nil, *deletedBefore, 0))
+	n, err := s.Purge(ctx, nil, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = s.Purge(ctx, nil, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	p, _ = s.GetProduct(ctx, nil, *deletedBefore)
+	assert.Nil(t, p)
+	p, _ = s.GetProduct(ctx, nil, *id)
+	assert.NotNil(t, p)
+}
+
+func TestSqliteStore_DeletedCategory(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testDeletedCategory(t, s, nil)
+}
+
+func TestSqliteStore_ProductFilter(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	category, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	category2, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	id, _ := s.CreateProduct(ctx, nil, &model.Product{Name: "Red Apple", Description: "fresh 100%", Category: *category, Price: 1000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "Green apple", Description: "fresh 100", Category: *category2, Price: 2000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "Pear", Description: "old", Category: *category2, Price: 3000})
+	minPrice, maxPrice := model.Money(1500), model.Money(3000)
+	ps, total, err := s.GetProducts(ctx, nil, &model.ProductFilter{MinPrice: &minPrice, MaxPrice: &maxPrice}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, 2, total)
+	ps, _, _ = s.GetProducts(ctx, nil, &model.ProductFilter{Name: "APPLE"}, nil)
+	assert.Len(t, ps, 2)
+	ps, _, _ = s.GetProducts(ctx, nil, &model.ProductFilter{Name: "apple", Categories: []int{*category2, -1}}, nil)
+	assert.Len(t, ps, 1)
+	assert.Equal(t, "Green apple", ps[0].Name)
+	ps, _, _ = s.GetProducts(ctx, nil, &model.ProductFilter{Description: "100%"}, nil)
+	assert.Len(t, ps, 1)
+	ps, _, _ = s.GetProducts(ctx, nil, &model.ProductFilter{Ids: []int{*id, -1}}, nil)
+	assert.Len(t, ps, 1)
+}
+
+func TestSqliteStore_SearchProducts(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	category, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	category2, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "Red Apple", Description: "fresh red fruit", Category: *category, Price: 1000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "Green apple", Description: "fresh", Category: *category2, Price: 2000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "Pear", Description: "not an apple", Category: *category2, Price: 3000})
+	categories := []int{*category, *category2}
+	rs, total, err := s.SearchProducts(ctx, nil, &model.ProductSearch{Query: "apple", Categories: categories}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, rs, 3)
+	// совпадение в названии релевантнее совпадения в описании
+	assert.Equal(t, "Pear", rs[2].Name)
+	assert.True(t, rs[0].Rank > rs[2].Rank)
+	assert.Contains(t, rs[0].Highlights.Name, "<b>")
+	rs, total, _ = s.SearchProducts(ctx, nil, &model.ProductSearch{Query: "red", Categories: categories}, nil)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Red Apple", rs[0].Name)
+	assert.Contains(t, rs[0].Highlights.Description, "<b>red</b>")
+	rs, total, _ = s.SearchProducts(ctx, nil, &model.ProductSearch{Query: "apple", Categories: []int{*category2}}, &model.ListParams{Limit: 1})
+	assert.Equal(t, 2, total)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "Green apple", rs[0].Name)
+	rs, total, _ = s.SearchProducts(ctx, nil, &model.ProductSearch{Query: "banana", Categories: categories}, nil)
+	assert.Equal(t, 0, total)
+	assert.Len(t, rs, 0)
+}
+
+func TestSqliteStore_ProductSort(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	category, _ := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "b", Description: "", Category: *category, Price: 1000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "a", Description: "", Category: *category, Price: 2000})
+	s.CreateProduct(ctx, nil, &model.Product{Name: "c", Description: "", Category: *category, Price: 2000})
+	sort := []model.SortField{{Field: "price", Desc: true}, {Field: "name"}}
+	ps, _, err := s.GetProducts(ctx, nil, nil, &model.ListParams{Sort: sort})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", ps[0].Name)
+	assert.Equal(t, "c", ps[1].Name)
+	assert.Equal(t, "b", ps[2].Name)
+	after := &model.Cursor{Values: []interface{}{20.0, "a"}, Id: ps[0].Id}
+	ps, _, err = s.GetProducts(ctx, nil, nil, &model.ListParams{Limit: 5, Sort: sort, After: after})
+	assert.NoError(t, err)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, "c", ps[0].Name)
+	_, _, err = s.GetProducts(ctx, nil, nil, &model.ListParams{Sort: []model.SortField{{Field: "price; DROP TABLE product"}}})
+	assert.Error(t, err)
+}
+
+func TestSqliteStore_Context(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	id, err := s.CreateCategory(ctx, nil, &model.Category{Name: "text"})
+	assert.NoError(t, err)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	// запросы с отмененным контекстом не выполняются
+	_, err = s.Begin(cancelled)
+	assert.Equal(t, context.Canceled, err)
+	_, err = s.GetCategory(cancelled, nil, *id)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, context.Canceled, s.DeleteCategory(cancelled, nil, *id, 0))
+	cat, err := s.GetCategory(ctx, nil, *id)
+	assert.NoError(t, err)
+	assert.Nil(t, cat.DeletedAt)
+}
+
+func TestSqliteStore_Pool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "echo-rest-api")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	conf := &config.Config{}
+	conf.Store.Driver = "sqlite"
+	conf.Store.Dsn = filepath.Join(dir, "store.db")
+	conf.Store.MaxOpenConns = 3
+	conf.Store.MaxIdleConns = 2
+	s, err := store.NewStore(conf)
+	assert.NoError(t, err)
+	defer s.Close()
+	stats := s.Stats()
+	assert.Equal(t, 3, stats.MaxOpenConnections)
+	assert.True(t, stats.OpenConnections >= 1)
+	assert.True(t, stats.OpenConnections <= 3)
+}
+
+func TestSqliteStore_CategoryTree(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testCategoryTree(t, s, nil)
+}
+
+func TestSqliteStore_Variants(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testVariants(t, s, nil)
+}
+
+func TestSqliteStore_Stock(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testStock(t, s, nil)
+}
+
+func TestSqliteStore_Currency(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testCurrency(t, s, nil)
+}
+
+func TestSqliteStore_PriceHistory(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testPriceHistory(t, s, nil)
+}
+
+func TestSqliteStore_Tags(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testTags(t, s, nil)
+}
+
+func TestSqliteStore_Attributes(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testAttributes(t, s, nil)
+}
+
+func TestSqliteStore_Images(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testImages(t, s, nil)
+}
+
+func TestSqliteStore_ApiKeys(t *testing.T) {
+	s, cleanup := newSqliteStore(t)
+	defer cleanup()
+	testApiKeys(t, s, nil)
+}
@@ -0,0 +1,424 @@
+package test
+
+import (
+	"database/sql"
+	"echo-rest-api/model"
+	"echo-rest-api/store"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// Общие проверки стореджа, не зависящие от драйвера. Каждый драйвер вызывает их из своих тестов,
+// в tx передается транзакция, если тест выполняется в ней
+
+// Под удаленной категорией нельзя создавать, переносить и восстанавливать продукты и подкатегории
+func testDeletedCategory(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "deleted"})
+	child, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "child", ParentId: category})
+	product, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	other, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "other"})
+	otherProduct, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name2", Category: *other, Price: 2000})
+	assert.Nil(t, s.DeleteCategory(ctx, tx, *category, 0))
+	_, err := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name3", Category: *category, Price: 1000})
+	assert.Equal(t, store.ErrCategoryDeleted, err)
+	_, err = s.CreateCategory(ctx, tx, &model.Category{Name: "child2", ParentId: category})
+	assert.Equal(t, store.ErrCategoryDeleted, err)
+	assert.Equal(t, store.ErrCategoryDeleted, s.UpdateProduct(ctx, tx, &model.Product{Id: *otherProduct, Name: "test_name2", Category: *category, Price: 2000}))
+	assert.Equal(t, store.ErrCategoryDeleted, s.UpdateCategory(ctx, tx, &model.Category{Id: *other, Name: "other", ParentId: category}))
+	assert.Equal(t, store.ErrCategoryDeleted, s.RestoreProduct(ctx, tx, *product))
+	assert.Equal(t, store.ErrCategoryDeleted, s.RestoreCategory(ctx, tx, *child))
+	// отклоненные изменения ничего не меняют
+	p, _ := s.GetProduct(ctx, tx, *otherProduct)
+	assert.Equal(t, *other, p.Category)
+	c, _ := s.GetCategory(ctx, tx, *other)
+	assert.Nil(t, c.ParentId)
+	// после восстановления категории под ней снова можно создавать
+	assert.Nil(t, s.RestoreCategory(ctx, tx, *category))
+	_, err = s.CreateProduct(ctx, tx, &model.Product{Name: "test_name3", Category: *category, Price: 1000})
+	assert.NoError(t, err)
+	_, err = s.CreateCategory(ctx, tx, &model.Category{Name: "child2", ParentId: category})
+	assert.NoError(t, err)
+}
+
+// Дерево категорий: предки, запрет циклов, продукты поддерева, удаление и восстановление поддерева
+func testCategoryTree(t *testing.T, s store.Store, tx *sql.Tx) {
+	root, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "root"})
+	child, err := s.CreateCategory(ctx, tx, &model.Category{Name: "child", ParentId: root})
+	assert.NoError(t, err)
+	leaf, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "leaf", ParentId: child})
+	c, _ := s.GetCategory(ctx, tx, *leaf)
+	assert.Equal(t, *child, *c.ParentId)
+	// предки от корневой до родительской
+	ancestors, err := s.GetCategoryAncestors(ctx, tx, *leaf)
+	assert.NoError(t, err)
+	assert.Len(t, ancestors, 2)
+	assert.Equal(t, *root, ancestors[0].Id)
+	assert.Equal(t, *child, ancestors[1].Id)
+	ancestors, _ = s.GetCategoryAncestors(ctx, tx, *root)
+	assert.NotNil(t, ancestors)
+	assert.Len(t, ancestors, 0)
+	ancestors, _ = s.GetCategoryAncestors(ctx, tx, -1)
+	assert.Nil(t, ancestors)
+	// категория не может стать своей подкатегорией
+	assert.Equal(t, store.ErrCycle, s.UpdateCategory(ctx, tx, &model.Category{Id: *root, Name: "root", ParentId: leaf}))
+	assert.Equal(t, store.ErrCycle, s.UpdateCategory(ctx, tx, &model.Category{Id: *root, Name: "root", ParentId: root}))
+	// продукты всего поддерева
+	s.CreateProduct(ctx, tx, &model.Product{Name: "root_product", Category: *root, Price: 1000})
+	s.CreateProduct(ctx, tx, &model.Product{Name: "leaf_product", Category: *leaf, Price: 1000})
+	_, total, _ := s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*child}}, nil)
+	assert.Equal(t, 0, total)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*child}, Recursive: true}, nil)
+	assert.Equal(t, 1, total)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*root}, Recursive: true}, nil)
+	assert.Equal(t, 2, total)
+	// удаление категории удаляет поддерево, восстановление - восстанавливает
+	assert.Nil(t, s.DeleteCategory(ctx, tx, *child, 0))
+	c, _ = s.GetCategory(ctx, tx, *leaf)
+	assert.NotNil(t, c.DeletedAt)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*root}, Recursive: true}, nil)
+	assert.Equal(t, 1, total)
+	assert.Nil(t, s.RestoreCategory(ctx, tx, *child))
+	c, _ = s.GetCategory(ctx, tx, *leaf)
+	assert.Nil(t, c.DeletedAt)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*root}, Recursive: true}, nil)
+	assert.Equal(t, 2, total)
+	// перенос в корень
+	assert.Nil(t, s.UpdateCategory(ctx, tx, &model.Category{Id: *leaf, Name: "leaf"}))
+	c, _ = s.GetCategory(ctx, tx, *leaf)
+	assert.Nil(t, c.ParentId)
+}
+
+// Варианты продукта: уникальность артикула, замена опций, удаление и восстановление вместе с продуктом и категорией
+func testVariants(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	product, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	price := model.Money(1250)
+	id, err := s.CreateVariant(ctx, tx, &model.Variant{Product: *product, Sku: "SKU-M", Price: &price, Options: map[string]string{"size": "M", "color": "red"}})
+	assert.NoError(t, err)
+	id2, err := s.CreateVariant(ctx, tx, &model.Variant{Product: *product, Sku: "SKU-L"})
+	assert.NoError(t, err)
+	v, err := s.GetVariant(ctx, tx, *id)
+	assert.NoError(t, err)
+	assert.Equal(t, "SKU-M", v.Sku)
+	assert.Equal(t, price, *v.Price)
+	assert.Equal(t, map[string]string{"size": "M", "color": "red"}, v.Options)
+	v, _ = s.GetVariant(ctx, tx, -1)
+	assert.Nil(t, v)
+	// артикул уникален
+	_, err = s.CreateVariant(ctx, tx, &model.Variant{Product: *product, Sku: "SKU-M"})
+	assert.Equal(t, store.ErrDuplicate, err)
+	assert.Equal(t, store.ErrDuplicate, s.UpdateVariant(ctx, tx, &model.Variant{Id: *id2, Product: *product, Sku: "SKU-M"}))
+	// обновление заменяет опции
+	v = &model.Variant{Id: *id, Product: *product, Sku: "SKU-M2", Options: map[string]string{"size": "XL"}, Version: 1}
+	assert.Nil(t, s.UpdateVariant(ctx, tx, v))
+	assert.Equal(t, 2, v.Version)
+	assert.Equal(t, store.ErrConflict, s.UpdateVariant(ctx, tx, &model.Variant{Id: *id, Product: *product, Sku: "SKU-M2", Version: 1}))
+	variants, err := s.GetVariants(ctx, tx, *product)
+	assert.NoError(t, err)
+	assert.Len(t, variants, 2)
+	assert.Equal(t, *id, variants[0].Id)
+	assert.Nil(t, variants[0].Price)
+	assert.Equal(t, map[string]string{"size": "XL"}, variants[0].Options)
+	// удаленный вариант не выбирается, его артикул освобождается
+	assert.Nil(t, s.DeleteVariant(ctx, tx, *id2, 0))
+	assert.Equal(t, sql.ErrNoRows, s.DeleteVariant(ctx, tx, *id2, 0))
+	variants, _ = s.GetVariants(ctx, tx, *product)
+	assert.Len(t, variants, 1)
+	id3, err := s.CreateVariant(ctx, tx, &model.Variant{Product: *product, Sku: "SKU-L"})
+	assert.NoError(t, err)
+	// удаление продукта удаляет его варианты, восстановление - восстанавливает
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, s.DeleteProduct(ctx, tx, *product, 0))
+	variants, _ = s.GetVariants(ctx, tx, *product)
+	assert.Len(t, variants, 0)
+	assert.Nil(t, s.RestoreProduct(ctx, tx, *product))
+	variants, _ = s.GetVariants(ctx, tx, *product)
+	assert.Len(t, variants, 2)
+	v, _ = s.GetVariant(ctx, tx, *id2)
+	assert.NotNil(t, v.DeletedAt)
+	// то же при удалении категории
+	assert.Nil(t, s.DeleteCategory(ctx, tx, *category, 0))
+	v, _ = s.GetVariant(ctx, tx, *id3)
+	assert.NotNil(t, v.DeletedAt)
+	assert.Nil(t, s.RestoreCategory(ctx, tx, *category))
+	v, _ = s.GetVariant(ctx, tx, *id3)
+	assert.Nil(t, v.DeletedAt)
+}
+
+// Остатки: корректировки, резервы, их подтверждение и отмена, остаток не меньше зарезервированного
+func testStock(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	product, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	stock, err := s.GetStock(ctx, tx, *product)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Stock{Product: *product}, stock)
+	// остаток не может стать отрицательным
+	_, err = s.AdjustStock(ctx, tx, &model.StockAdjustment{Product: *product, Delta: -1, Reason: model.StockLoss})
+	assert.Equal(t, store.ErrInsufficientStock, err)
+	id, err := s.AdjustStock(ctx, tx, &model.StockAdjustment{Product: *product, Delta: 10, Reason: model.StockReceipt, Note: "invoice 1"})
+	assert.NoError(t, err)
+	_, err = s.AdjustStock(ctx, tx, &model.StockAdjustment{Product: *product, Delta: -2, Reason: model.StockDamage})
+	assert.NoError(t, err)
+	stock, _ = s.GetStock(ctx, tx, *product)
+	assert.Equal(t, 8, stock.OnHand)
+	assert.Equal(t, 8, stock.Available)
+	adjustments, total, err := s.GetStockAdjustments(ctx, tx, *product, &model.ListParams{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, adjustments, 1)
+	assert.Equal(t, *id, adjustments[0].Id)
+	assert.Equal(t, "invoice 1", adjustments[0].Note)
+	// резерв уменьшает доступное количество, но не количество на складе
+	r1, err := s.CreateReservation(ctx, tx, &model.StockReservation{Product: *product, Quantity: 5, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	_, err = s.CreateReservation(ctx, tx, &model.StockReservation{Product: *product, Quantity: 4, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Equal(t, store.ErrInsufficientStock, err)
+	_, err = s.AdjustStock(ctx, tx, &model.StockAdjustment{Product: *product, Delta: -9, Reason: model.StockCorrection})
+	assert.Equal(t, store.ErrInsufficientStock, err)
+	// списать зарезервированное количество нельзя, иначе резерв не подтвердится
+	_, err = s.AdjustStock(ctx, tx, &model.StockAdjustment{Product: *product, Delta: -4, Reason: model.StockLoss})
+	assert.Equal(t, store.ErrInsufficientStock, err)
+	stock, _ = s.GetStock(ctx, tx, *product)
+	assert.Equal(t, &model.Stock{Product: *product, OnHand: 8, Reserved: 5, Available: 3}, stock)
+	// истекший резерв не учитывается
+	r2, err := s.CreateReservation(ctx, tx, &model.StockReservation{Product: *product, Quantity: 3, ExpiresAt: time.Now().Add(-time.Second)})
+	assert.NoError(t, err)
+	r, _ := s.GetReservation(ctx, tx, *r2)
+	assert.Equal(t, model.ReservationExpired, r.Status)
+	assert.Equal(t, store.ErrReservationClosed, s.CommitReservation(ctx, tx, *r2))
+	stock, _ = s.GetStock(ctx, tx, *product)
+	assert.Equal(t, 3, stock.Available)
+	// подтверждение списывает количество со склада
+	assert.Nil(t, s.CommitReservation(ctx, tx, *r1))
+	assert.Equal(t, store.ErrReservationClosed, s.CommitReservation(ctx, tx, *r1))
+	assert.Equal(t, store.ErrReservationClosed, s.ReleaseReservation(ctx, tx, *r1))
+	r, _ = s.GetReservation(ctx, tx, *r1)
+	assert.Equal(t, model.ReservationCommitted, r.Status)
+	stock, _ = s.GetStock(ctx, tx, *product)
+	assert.Equal(t, &model.Stock{Product: *product, OnHand: 3, Reserved: 0, Available: 3}, stock)
+	_, total, _ = s.GetStockAdjustments(ctx, tx, *product, nil)
+	assert.Equal(t, 3, total)
+	// отмена возвращает количество в доступное
+	r3, err := s.CreateReservation(ctx, tx, &model.StockReservation{Product: *product, Quantity: 3, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Nil(t, s.ReleaseReservation(ctx, tx, *r3))
+	r, _ = s.GetReservation(ctx, tx, *r3)
+	assert.Equal(t, model.ReservationReleased, r.Status)
+	stock, _ = s.GetStock(ctx, tx, *product)
+	assert.Equal(t, 3, stock.Available)
+	assert.Equal(t, sql.ErrNoRows, s.CommitReservation(ctx, tx, -1))
+	r, _ = s.GetReservation(ctx, tx, -1)
+	assert.Nil(t, r)
+}
+
+// Цены в валютах: цены продукта по валютам и выбор по валюте
+func testCurrency(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	id, err := s.CreateProduct(ctx, tx, &model.Product{Name: "rub_only", Category: *category, Price: 100000, Currency: "RUB"})
+	assert.NoError(t, err)
+	id2, err := s.CreateProduct(ctx, tx, &model.Product{Name: "rub_usd", Category: *category, Price: 199999, Currency: "RUB",
+		Prices: []model.ProductPrice{{Currency: "USD", Amount: 1999}, {Currency: "EUR", Amount: 1850}}})
+	assert.NoError(t, err)
+	id3, err := s.CreateProduct(ctx, tx, &model.Product{Name: "usd", Category: *category, Price: 1001, Currency: "USD"})
+	assert.NoError(t, err)
+	p, err := s.GetProduct(ctx, tx, *id2)
+	assert.NoError(t, err)
+	assert.Equal(t, model.Money(199999), p.Price)
+	assert.Equal(t, "RUB", p.Currency)
+	assert.Equal(t, []model.ProductPrice{{Currency: "EUR", Amount: 1850}, {Currency: "USD", Amount: 1999}}, p.Prices)
+	p, _ = s.GetProduct(ctx, tx, *id)
+	assert.Empty(t, p.Prices)
+	// в валюте выбираются только продукты с ценой в ней, фильтр и сортировка - по цене в этой валюте
+	minPrice := model.Money(1000)
+	ps, total, err := s.GetProducts(ctx, tx, &model.ProductFilter{Currency: "USD", MinPrice: &minPrice}, &model.ListParams{Sort: []model.SortField{{Field: "price", Desc: true}}})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, *id2, ps[0].Id)
+	assert.Equal(t, model.Money(1999), ps[0].Price)
+	assert.Equal(t, "USD", ps[0].Currency)
+	assert.Equal(t, []model.ProductPrice{{Currency: "EUR", Amount: 1850}, {Currency: "RUB", Amount: 199999}}, ps[0].Prices)
+	assert.Equal(t, *id3, ps[1].Id)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Currency: "EUR"}, nil)
+	assert.Equal(t, 1, total)
+	// обновление заменяет цены
+	assert.Nil(t, s.UpdateProduct(ctx, tx, &model.Product{Id: *id2, Name: "rub_usd", Category: *category, Price: 199999, Currency: "RUB",
+		Prices: []model.ProductPrice{{Currency: "USD", Amount: 2099}}}))
+	p, _ = s.GetProduct(ctx, tx, *id2)
+	assert.Equal(t, []model.ProductPrice{{Currency: "USD", Amount: 2099}}, p.Prices)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Currency: "EUR"}, nil)
+	assert.Equal(t, 0, total)
+}
+
+// История цен: изменения основной цены и цен в валютах с пользователем, который их изменил, без записей для неизменных цен
+func testPriceHistory(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	id, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000, Currency: "RUB"})
+	userCtx := model.ContextWithUser(ctx, "manager")
+	// изменение без смены цен не пишется в историю
+	assert.Nil(t, s.UpdateProduct(userCtx, tx, &model.Product{Id: *id, Name: "test_name2", Category: *category, Price: 1000, Currency: "RUB"}))
+	assert.Nil(t, s.UpdateProduct(userCtx, tx, &model.Product{Id: *id, Name: "test_name2", Category: *category, Price: 1200, Currency: "RUB",
+		Prices: []model.ProductPrice{{Currency: "USD", Amount: 15}}}))
+	changes, total, err := s.GetPriceHistory(ctx, tx, *id, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, "RUB", changes[0].Currency)
+	assert.Nil(t, changes[0].OldPrice)
+	assert.Equal(t, model.Money(1000), *changes[0].NewPrice)
+	assert.Equal(t, "", changes[0].ChangedBy)
+	assert.Equal(t, model.Money(1000), *changes[1].OldPrice)
+	assert.Equal(t, model.Money(1200), *changes[1].NewPrice)
+	assert.Equal(t, "manager", changes[1].ChangedBy)
+	assert.Equal(t, "USD", changes[2].Currency)
+	assert.Nil(t, changes[2].OldPrice)
+	// удаление цены в валюте
+	assert.Nil(t, s.UpdateProduct(ctx, tx, &model.Product{Id: *id, Name: "test_name2", Category: *category, Price: 1200, Currency: "RUB"}))
+	changes, total, _ = s.GetPriceHistory(ctx, tx, *id, &model.ListParams{Limit: 1, Sort: []model.SortField{{Field: "id", Desc: true}}})
+	assert.Equal(t, 4, total)
+	assert.Equal(t, "USD", changes[0].Currency)
+	assert.Equal(t, model.Money(15), *changes[0].OldPrice)
+	assert.Nil(t, changes[0].NewPrice)
+}
+
+// Теги: сохранение, замена, фильтр по любому и по всем тегам, список тегов
+func testTags(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	apple, err := s.CreateProduct(ctx, tx, &model.Product{Name: "apple", Category: *category, Price: 1000, Tags: []string{"fruit", "red"}})
+	assert.NoError(t, err)
+	cherry, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "cherry", Category: *category, Price: 1000, Tags: []string{"berry", "red"}})
+	pear, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "pear", Category: *category, Price: 1000, Tags: []string{"fruit"}})
+	s.CreateProduct(ctx, tx, &model.Product{Name: "bread", Category: *category, Price: 1000})
+	p, _ := s.GetProduct(ctx, tx, *apple)
+	assert.Equal(t, []string{"fruit", "red"}, p.Tags)
+	// хотя бы один тег
+	ps, total, err := s.GetProducts(ctx, tx, &model.ProductFilter{Tags: []string{"red", "fruit"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"berry", "red"}, ps[1].Tags)
+	// все теги
+	ps, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Tags: []string{"red", "fruit"}, AllTags: true}, nil)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, *apple, ps[0].Id)
+	// повторы тегов в фильтре не мешают выбору
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Tags: []string{"red", "fruit", "red"}, AllTags: true}, nil)
+	assert.Equal(t, 1, total)
+	tags, err := s.GetTags(ctx, tx)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.Tag{{Name: "berry", Count: 1}, {Name: "fruit", Count: 2}, {Name: "red", Count: 2}}, tags)
+	// обновление заменяет теги, удаленные продукты не учитываются
+	assert.Nil(t, s.UpdateProduct(ctx, tx, &model.Product{Id: *pear, Name: "pear", Category: *category, Price: 1000, Tags: []string{"green"}}))
+	assert.Nil(t, s.DeleteProduct(ctx, tx, *cherry, 0))
+	tags, _ = s.GetTags(ctx, tx)
+	assert.Equal(t, []*model.Tag{{Name: "fruit", Count: 1}, {Name: "green", Count: 1}, {Name: "red", Count: 1}}, tags)
+}
+
+// Атрибуты: схема атрибутов категории и фильтр продуктов по атрибутам
+func testAttributes(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, err := s.CreateCategory(ctx, tx, &model.Category{Name: "electronics", AttributeSchema: model.JsonObject{"type": "object"}})
+	assert.NoError(t, err)
+	c, _ := s.GetCategory(ctx, tx, *category)
+	assert.Equal(t, model.JsonObject{"type": "object"}, c.AttributeSchema)
+	kettle, err := s.CreateProduct(ctx, tx, &model.Product{Name: "kettle", Category: *category, Price: 1000,
+		Attributes: model.JsonObject{"voltage": 220.0, "plug": "C", "wireless": true}})
+	assert.NoError(t, err)
+	lamp, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "lamp", Category: *category, Price: 1000, Attributes: model.JsonObject{"voltage": 110.0, "plug": "A"}})
+	s.CreateProduct(ctx, tx, &model.Product{Name: "cable", Category: *category, Price: 1000})
+	p, _ := s.GetProduct(ctx, tx, *kettle)
+	assert.Equal(t, model.JsonObject{"voltage": 220.0, "plug": "C", "wireless": true}, p.Attributes)
+	// число, строка и true/false
+	ps, total, err := s.GetProducts(ctx, tx, &model.ProductFilter{Attributes: map[string]string{"voltage": "220"}}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, *kettle, ps[0].Id)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Attributes: map[string]string{"plug": "A"}}, nil)
+	assert.Equal(t, 1, total)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Attributes: map[string]string{"plug": "C", "voltage": "110"}}, nil)
+	assert.Equal(t, 0, total)
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Attributes: map[string]string{"color": "red"}}, nil)
+	assert.Equal(t, 0, total)
+	// обновление заменяет атрибуты
+	assert.Nil(t, s.UpdateProduct(ctx, tx, &model.Product{Id: *lamp, Name: "lamp", Category: *category, Price: 1000, Attributes: model.JsonObject{"voltage": 220.0}}))
+	_, total, _ = s.GetProducts(ctx, tx, &model.ProductFilter{Attributes: map[string]string{"voltage": "220"}}, nil)
+	assert.Equal(t, 2, total)
+}
+
+// Изображения продукта: добавление, порядок показа, удаление
+func testImages(t *testing.T, s store.Store, tx *sql.Tx) {
+	category, _ := s.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	product, _ := s.CreateProduct(ctx, tx, &model.Product{Name: "kettle", Category: *category, Price: 1000})
+	var ids []int
+	for i := 0; i < 3; i++ {
+		image := &model.ProductImage{Product: *product, ContentType: "image/png"}
+		id, err := s.CreateImage(ctx, tx, image)
+		assert.NoError(t, err)
+		assert.Equal(t, i, image.Position)
+		ids = append(ids, *id)
+	}
+	p, _ := s.GetProduct(ctx, tx, *product)
+	assert.Equal(t, 3, len(p.Images))
+	assert.Equal(t, ids[0], p.Images[0].Id)
+	assert.Equal(t, "image/png", p.Images[0].ContentType)
+	// порядок меняется только для всех изображений продукта сразу
+	assert.Equal(t, store.ErrImageOrder, s.ReorderImages(ctx, tx, *product, []int{ids[2], ids[0]}))
+	assert.Equal(t, store.ErrImageOrder, s.ReorderImages(ctx, tx, *product, []int{ids[2], ids[0], ids[0]}))
+	assert.NoError(t, s.ReorderImages(ctx, tx, *product, []int{ids[2], ids[0], ids[1]}))
+	images, err := s.GetImages(ctx, tx, *product)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{ids[2], ids[0], ids[1]}, []int{images[0].Id, images[1].Id, images[2].Id})
+	ps, _, _ := s.GetProducts(ctx, tx, nil, nil)
+	assert.Equal(t, ids[2], ps[0].Images[0].Id)
+	assert.NoError(t, s.DeleteImage(ctx, tx, ids[0]))
+	assert.Equal(t, sql.ErrNoRows, s.DeleteImage(ctx, tx, ids[0]))
+	image, _ := s.GetImage(ctx, tx, ids[0])
+	assert.Nil(t, image)
+	image, _ = s.GetImage(ctx, tx, ids[1])
+	assert.Equal(t, *product, image.Product)
+	// новое изображение - последнее
+	last := &model.ProductImage{Product: *product, ContentType: "image/jpeg"}
+	s.CreateImage(ctx, tx, last)
+	images, _ = s.GetImages(ctx, tx, *product)
+	assert.Equal(t, 3, len(images))
+	assert.Equal(t, "image/jpeg", images[2].ContentType)
+}
+
+// Ключи API: поиск по хэшу, отметка использования, отзыв, уникальность хэша и названия неотозванного ключа
+func testApiKeys(t *testing.T, s store.Store, tx *sql.Tx) {
+	expiresAt := time.Now().Add(time.Hour)
+	key := &model.ApiKey{Name: "erp", Prefix: "erk_abcdef", Hash: model.HashApiKey("erk_abcdef1"), Scopes: []string{model.ScopeCatalogRead, model.ScopeCatalogWrite}, ExpiresAt: &expiresAt}
+	id, err := s.CreateApiKey(ctx, tx, key)
+	assert.NoError(t, err)
+	assert.Equal(t, *id, key.Id)
+	assert.False(t, key.CreatedAt.IsZero())
+	k, err := s.GetApiKeyByHash(ctx, tx, model.HashApiKey("erk_abcdef1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "erp", k.Name)
+	assert.Equal(t, []string{model.ScopeCatalogRead, model.ScopeCatalogWrite}, k.Scopes)
+	assert.WithinDuration(t, expiresAt, *k.ExpiresAt, time.Second)
+	assert.Nil(t, k.LastUsedAt)
+	k, err = s.GetApiKeyByHash(ctx, tx, model.HashApiKey("other"))
+	assert.NoError(t, err)
+	assert.Nil(t, k)
+	now := time.Now()
+	assert.NoError(t, s.TouchApiKey(ctx, tx, *id, now))
+	assert.NoError(t, s.RevokeApiKey(ctx, tx, *id))
+	assert.Equal(t, sql.ErrNoRows, s.RevokeApiKey(ctx, tx, *id))
+	assert.Equal(t, sql.ErrNoRows, s.RevokeApiKey(ctx, tx, -1))
+	keys, err := s.GetApiKeys(ctx, tx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(keys))
+	assert.WithinDuration(t, now, *keys[0].LastUsedAt, time.Second)
+	assert.NotNil(t, keys[0].RevokedAt)
+	assert.False(t, keys[0].Active(time.Now()))
+	// название отозванного ключа можно выпустить заново
+	_, err = s.CreateApiKey(ctx, tx, &model.ApiKey{Name: "erp", Prefix: "erk_ghijkl", Hash: model.HashApiKey("erk_ghijkl1"), Scopes: []string{model.ScopeCatalogRead}})
+	assert.NoError(t, err)
+	// ошибки уникальности проверяются последними: в Postgres ошибка прерывает транзакцию, поэтому в ней проверяется только одна.
+	// Хэш уникален и у отозванных ключей
+	if tx == nil {
+		_, err = s.CreateApiKey(ctx, tx, &model.ApiKey{Name: "copy", Prefix: "erk_abcdef", Hash: key.Hash, Scopes: []string{model.ScopeAdmin}})
+		assert.Equal(t, store.ErrDuplicate, err)
+	}
+	// название уникально среди неотозванных ключей
+	_, err = s.CreateApiKey(ctx, tx, &model.ApiKey{Name: "erp", Prefix: "erk_mnopqr", Hash: model.HashApiKey("erk_mnopqr1"), Scopes: []string{model.ScopeAdmin}})
+	assert.Equal(t, store.ErrDuplicate, err)
+}
@@ -1,140 +1,421 @@
 package test
 
 import (
+	"context"
+	"database/sql"
 	"echo-rest-api/config"
 	"echo-rest-api/model"
 	"echo-rest-api/store"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 var st store.Store
 
+// Контекст запросов к стореджу и сервисам в тестах
+var ctx = context.Background()
+
 func init() {
 	conf, _ := config.NewConfig("../config/config.yaml")
 	st, _ = store.NewStore(conf)
 }
 
 func TestStore_CreateCategory(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	id, err := st.CreateCategory(tx, &model.Category{Name: "text"})
+	id, err := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
 	assert.NoError(t, err)
 	assert.NotNil(t, id)
 }
 
 func TestStore_GetCategory(t *testing.T) {
-	c, err := st.GetCategory(nil, -1)
+	c, err := st.GetCategory(ctx, nil, -1)
 	assert.Nil(t, err)
 	assert.Nil(t, c)
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	id, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	cat, _ := st.GetCategory(tx, *id)
+	id, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	cat, _ := st.GetCategory(ctx, tx, *id)
 	assert.Equal(t, *id, cat.Id)
 }
 
 func TestStore_GetCategories(t *testing.T) {
-	_, err := st.GetCategories(nil)
+	_, _, err := st.GetCategories(ctx, nil, nil)
 	assert.NoError(t, err)
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	st.CreateCategory(tx, &model.Category{Name: "text"})
-	res, _ := st.GetCategories(tx)
+	st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	res, total, _ := st.GetCategories(ctx, tx, nil)
 	assert.NotEmpty(t, res)
+	assert.Equal(t, len(res), total)
+	res, total2, _ := st.GetCategories(ctx, tx, &model.ListParams{Limit: 1, Offset: 1})
+	assert.Len(t, res, 1)
+	assert.Equal(t, total, total2)
 }
 
 func TestStore_UpdateCategory(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	id, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	cat, _ := st.GetCategory(tx, *id)
+	id, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	cat, _ := st.GetCategory(ctx, tx, *id)
 	cat.Name = "text2"
-	st.UpdateCategory(tx, cat)
-	cat2, _ := st.GetCategory(tx, cat.Id)
+	st.UpdateCategory(ctx, tx, cat)
+	cat2, _ := st.GetCategory(ctx, tx, cat.Id)
 	assert.Equal(t, cat2.Name, "text2")
 }
 
 func TestStore_DeleteCategory(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	id, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	st.DeleteCategory(tx, *id)
-	cat2, _ := st.GetCategory(tx, *id)
-	assert.Nil(t, cat2)
+	id, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	st.DeleteCategory(ctx, tx, *id, 0)
+	cat2, _ := st.GetCategory(ctx, tx, *id)
+	assert.NotNil(t, cat2.DeletedAt)
 }
 
 func TestStore_CreateProduct(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	category, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	p, err := st.CreateProduct(tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 65.5})
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	p, err := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
 	assert.NoError(t, err)
-	product, err := st.GetProduct(tx, *p)
+	product, err := st.GetProduct(ctx, tx, *p)
 	assert.NotNil(t, product)
 	assert.Equal(t, product.Name, "test_name")
 	assert.Equal(t, product.Description, "test_description")
 	assert.Equal(t, product.Category, *category)
-	assert.Equal(t, product.Price, 65.5)
+	assert.Equal(t, product.Price, model.Money(6550))
+}
+
+func TestStore_ForeignKey(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	_, err := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: -1, Price: 6550})
+	assert.Equal(t, store.ErrForeignKey, err)
 }
 
 func TestStore_GetProduct(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	category, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	p, _ := st.CreateProduct(tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 65.5})
-	ps, err := st.GetProduct(tx, *p)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	p, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
+	ps, err := st.GetProduct(ctx, tx, *p)
 	assert.Nil(t, err)
 	assert.NotNil(t, ps)
-	ps, err = st.GetProduct(tx, -1)
+	ps, err = st.GetProduct(ctx, tx, -1)
 	assert.Nil(t, err)
 	assert.Nil(t, ps)
 }
 
 func TestStore_GetProducts(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	category, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	st.CreateProduct(tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 65.5})
-	st.CreateProduct(tx, &model.Product{Name: "test_name2", Description: "test_description2", Category: *category, Price: 65.52})
-	ps, err := st.GetProducts(tx, nil)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "test_name2", Description: "test_description2", Category: *category, Price: 6552})
+	ps, _, err := st.GetProducts(ctx, tx, nil, nil)
 	assert.Nil(t, err)
 	assert.NotEmpty(t, ps)
-	ps, _ = st.GetProducts(tx, category)
+	ps, total, _ := st.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*category}}, nil)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "test_name", ps[0].Name)
+	assert.Equal(t, "test_name2", ps[1].Name)
+	ps, total, _ = st.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*category}}, &model.ListParams{Limit: 1, Offset: 1})
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "test_name2", ps[0].Name)
+	first := ps[0].Id - 1
+	ps, total, _ = st.GetProducts(ctx, tx, &model.ProductFilter{Categories: []int{*category}}, &model.ListParams{Limit: 5, After: &model.Cursor{Id: first}})
+	assert.Len(t, ps, 1)
+	assert.Equal(t, 2, total)
+}
+
+func TestStore_Version(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	cat, _ := st.GetCategory(ctx, tx, *category)
+	assert.Equal(t, 1, cat.Version)
+	cat.Name = "text2"
+	assert.Nil(t, st.UpdateCategory(ctx, tx, cat))
+	assert.Equal(t, 2, cat.Version)
+	// версия устарела
+	assert.Equal(t, store.ErrConflict, st.UpdateCategory(ctx, tx, &model.Category{Id: *category, Name: "text3", Version: 1}))
+	assert.Equal(t, store.ErrConflict, st.DeleteCategory(ctx, tx, *category, 1))
+	assert.Equal(t, sql.ErrNoRows, st.UpdateCategory(ctx, tx, &model.Category{Id: -1, Name: "text3", Version: 1}))
+	product := &model.Product{Name: "test_name", Category: *category, Price: 1000}
+	id, _ := st.CreateProduct(ctx, tx, product)
+	assert.Equal(t, 1, product.Version)
+	p, _ := st.GetProduct(ctx, tx, *id)
+	p.Price = 2000
+	assert.Nil(t, st.UpdateProduct(ctx, tx, p))
+	assert.Equal(t, 2, p.Version)
+	// без проверки версии
+	p.Version = 0
+	assert.Nil(t, st.UpdateProduct(ctx, tx, p))
+	assert.Equal(t, 3, p.Version)
+	product.Id = *id
+	assert.Equal(t, store.ErrConflict, st.UpdateProduct(ctx, tx, product))
+	assert.Equal(t, store.ErrConflict, st.DeleteProduct(ctx, tx, *id, 2))
+	assert.Nil(t, st.DeleteProduct(ctx, tx, *id, 3))
+	assert.Equal(t, sql.ErrNoRows, st.DeleteProduct(ctx, tx, *id, 3))
+	assert.Nil(t, st.DeleteCategory(ctx, tx, *category, 2))
+}
+
+func TestStore_SoftDelete(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	deletedBefore, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	id, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name2", Category: *category, Price: 2000})
+	assert.Nil(t, st.DeleteProduct(ctx, tx, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, st.DeleteProduct(ctx, tx, *deletedBefore, 0))
+	assert.Equal(t, sql.ErrNoRows, st.UpdateProduct(ctx, tx, &model.Product{Id: *deletedBefore, Name: "test_name", Category: *category, Price: 1000}))
+	filter := &model.ProductFilter{Categories: []int{*category}}
+	ps, total, _ := st.GetProducts(ctx, tx, filter, nil)
+	assert.Equal(t, 1, total)
+	assert.Len(t, ps, 1)
+	ps, total, _ = st.GetProducts(ctx, tx, filter, &model.ListParams{IncludeDeleted: true})
+	assert.Equal(t, 2, total)
+	assert.Len(t, ps, 2)
+	// удаление категории помечает удаленными ее продукты
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, st.DeleteCategory(ctx, tx, *category, 0))
+	p, _ := st.GetProduct(ctx, tx, *id)
+	assert.NotNil(t, p.DeletedAt)
+	_, total, _ = st.GetProducts(ctx, tx, filter, nil)
+	assert.Equal(t, 0, total)
+	// восстановление категории восстанавливает только продукты, удаленные вместе с ней
+	assert.Nil(t, st.RestoreCategory(ctx, tx, *category))
+	assert.Equal(t, sql.ErrNoRows, st.RestoreCategory(ctx, tx, *category))
+	p, _ = st.GetProduct(ctx, tx, *id)
+	assert.Nil(t, p.DeletedAt)
+	p, _ = st.GetProduct(ctx, tx, *deletedBefore)
+	assert.NotNil(t, p.DeletedAt)
+	assert.Nil(t, st.RestoreProduct(ctx, tx, *deletedBefore))
+	assert.Equal(t, sql.ErrNoRows, st.RestoreProduct(ctx, tx, *deletedBefore))
+	// очистка удаляет только записи, удаленные раньше заданного времени
+	assert.Nil(t, st.DeleteProduct(ctx, tx, *deletedBefore, 0))
+	n, err := st.Purge(ctx, tx, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	n, err = st.Purge(ctx, tx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	p, _ = st.GetProduct(ctx, tx, *deletedBefore)
+	assert.Nil(t, p)
+	p, _ = st.GetProduct(ctx, tx, *id)
+	assert.NotNil(t, p)
+}
+
+func TestStore_DeletedCategory(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testDeletedCategory(t, st, tx)
+}
+
+// Проверка удаленной категории блокирует ее строку: удаление в другой транзакции дожидается создания продукта
+// и помечает удаленным и его, а создание дожидается удаления и получает ErrCategoryDeleted.
+// Записи теста фиксируются, поэтому остаются в БД удаленными
+func TestStore_DeletedCategoryConcurrent(t *testing.T) {
+	category, err := st.CreateCategory(ctx, nil, &model.Category{Name: "concurrent"})
+	assert.NoError(t, err)
+	// продукт создается раньше удаления
+	tx, _ := st.Begin(ctx)
+	product, err := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Category: *category, Price: 1000})
+	assert.NoError(t, err)
+	deleted := make(chan error)
+	go func() {
+		tx2, _ := st.Begin(ctx)
+		if err := st.DeleteCategory(ctx, tx2, *category, 0); err != nil {
+			st.Rollback(tx2)
+			deleted <- err
+			return
+		}
+		deleted <- st.Commit(tx2)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, st.Commit(tx))
+	assert.NoError(t, <-deleted)
+	p, _ := st.GetProduct(ctx, nil, *product)
+	assert.NotNil(t, p.DeletedAt)
+	assert.Nil(t, st.RestoreCategory(ctx, nil, *category))
+	// удаление раньше создания
+	tx, _ = st.Begin(ctx)
+	assert.NoError(t, st.DeleteCategory(ctx, tx, *category, 0))
+	created := make(chan error)
+	go func() {
+		tx2, _ := st.Begin(ctx)
+		defer st.Rollback(tx2)
+		_, err := st.CreateProduct(ctx, tx2, &model.Product{Name: "test_name2", Category: *category, Price: 1000})
+		created <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, st.Commit(tx))
+	assert.Equal(t, store.ErrCategoryDeleted, <-created)
+}
+
+func TestStore_GetProductsFilter(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	category2, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	id, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "Red Apple", Description: "fresh 100%", Category: *category, Price: 1000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "Green apple", Description: "fresh 100", Category: *category2, Price: 2000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "Pear", Description: "old", Category: *category2, Price: 3000})
+	categories := []int{*category, *category2}
+	minPrice, maxPrice := model.Money(1500), model.Money(3000)
+	ps, total, err := st.GetProducts(ctx, tx, &model.ProductFilter{Categories: categories, MinPrice: &minPrice, MaxPrice: &maxPrice}, nil)
+	assert.NoError(t, err)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, 2, total)
+	ps, _, _ = st.GetProducts(ctx, tx, &model.ProductFilter{Categories: categories, Name: "APPLE"}, nil)
+	assert.Len(t, ps, 2)
+	ps, _, _ = st.GetProducts(ctx, tx, &model.ProductFilter{Categories: categories, Description: "100%"}, nil)
+	assert.Len(t, ps, 1)
+	ps, _, _ = st.GetProducts(ctx, tx, &model.ProductFilter{Ids: []int{*id, -1}}, nil)
+	assert.Len(t, ps, 1)
+}
+
+func TestStore_SearchProducts(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	category2, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "Red Apple", Description: "fresh red fruit", Category: *category, Price: 1000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "Green apple", Description: "fresh", Category: *category2, Price: 2000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "Pear", Description: "not an apple", Category: *category2, Price: 3000})
+	categories := []int{*category, *category2}
+	rs, total, err := st.SearchProducts(ctx, tx, &model.ProductSearch{Query: "apple", Categories: categories}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, total)
+	assert.Len(t, rs, 3)
+	// совпадение в названии релевантнее совпадения в описании
+	assert.Equal(t, "Pear", rs[2].Name)
+	assert.True(t, rs[0].Rank > rs[2].Rank)
+	assert.Contains(t, rs[0].Highlights.Name, "<b>")
+	rs, total, _ = st.SearchProducts(ctx, tx, &model.ProductSearch{Query: "red", Categories: categories}, nil)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, "Red Apple", rs[0].Name)
+	assert.Contains(t, rs[0].Highlights.Description, "<b>red</b>")
+	rs, total, _ = st.SearchProducts(ctx, tx, &model.ProductSearch{Query: "apple", Categories: []int{*category2}}, &model.ListParams{Limit: 1})
+	assert.Equal(t, 2, total)
+	assert.Len(t, rs, 1)
+	assert.Equal(t, "Green apple", rs[0].Name)
+	rs, total, _ = st.SearchProducts(ctx, tx, &model.ProductSearch{Query: "banana", Categories: categories}, nil)
+	assert.Equal(t, 0, total)
+	assert.Len(t, rs, 0)
+}
+
+func TestStore_GetProductsSort(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "b", Description: "", Category: *category, Price: 1000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "a", Description: "", Category: *category, Price: 2000})
+	st.CreateProduct(ctx, tx, &model.Product{Name: "c", Description: "", Category: *category, Price: 2000})
+	filter := &model.ProductFilter{Categories: []int{*category}}
+	sort := []model.SortField{{Field: "price", Desc: true}, {Field: "name"}}
+	ps, _, err := st.GetProducts(ctx, tx, filter, &model.ListParams{Sort: sort})
+	assert.NoError(t, err)
+	assert.Equal(t, "a", ps[0].Name)
+	assert.Equal(t, "c", ps[1].Name)
+	assert.Equal(t, "b", ps[2].Name)
+	after := &model.Cursor{Values: []interface{}{20.0, "a"}, Id: ps[0].Id}
+	ps, _, err = st.GetProducts(ctx, tx, filter, &model.ListParams{Limit: 5, Sort: sort, After: after})
+	assert.NoError(t, err)
 	assert.Len(t, ps, 2)
+	assert.Equal(t, "c", ps[0].Name)
 }
 
 func TestStore_UpdateProduct(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	category, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	category2, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	id, _ := st.CreateProduct(tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 65.5})
-	p, _ := st.GetProduct(tx, *id)
+	category, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	category2, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	id, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *category, Price: 6550})
+	p, _ := st.GetProduct(ctx, tx, *id)
 	p.Name = "test_name2"
 	p.Description = "test_description2"
 	p.Category = *category2
-	p.Price = 65.7
-	err := st.UpdateProduct(tx, p)
+	p.Price = 6570
+	err := st.UpdateProduct(ctx, tx, p)
 	assert.Nil(t, err)
-	p2, _ := st.GetProduct(tx, p.Id)
+	p2, _ := st.GetProduct(ctx, tx, p.Id)
 	assert.Equal(t, p2.Name, "test_name2")
 	assert.Equal(t, p2.Description, "test_description2")
 	assert.Equal(t, p2.Category, *category2)
-	assert.Equal(t, p2.Price, 65.7)
+	assert.Equal(t, p2.Price, model.Money(6570))
 }
 
 func TestStore_DeleteProduct(t *testing.T) {
-	tx, _ := st.Begin()
+	tx, _ := st.Begin(ctx)
 	defer st.Rollback(tx)
-	id, _ := st.CreateCategory(tx, &model.Category{Name: "text"})
-	product, _ := st.CreateProduct(tx, &model.Product{Name: "test_name", Description: "test_description", Category: *id, Price: 65.5})
-	err := st.DeleteProduct(tx, *product)
+	id, _ := st.CreateCategory(ctx, tx, &model.Category{Name: "text"})
+	product, _ := st.CreateProduct(ctx, tx, &model.Product{Name: "test_name", Description: "test_description", Category: *id, Price: 6550})
+	err := st.DeleteProduct(ctx, tx, *product, 0)
 	assert.Nil(t, err)
-	p, _ := st.GetProduct(tx, *product)
-	assert.Nil(t, p)
+	p, _ := st.GetProduct(ctx, tx, *product)
+	assert.NotNil(t, p.DeletedAt)
 }
 
 //  &model.Category{Name:"text"}
 //
+
+func TestStore_CategoryTree(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testCategoryTree(t, st, tx)
+}
+
+func TestStore_Variants(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testVariants(t, st, tx)
+}
+
+func TestStore_Stock(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testStock(t, st, tx)
+}
+
+func TestStore_Currency(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testCurrency(t, st, tx)
+}
+
+func TestStore_PriceHistory(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testPriceHistory(t, st, tx)
+}
+
+func TestStore_Tags(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testTags(t, st, tx)
+}
+
+func TestStore_Attributes(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testAttributes(t, st, tx)
+}
+
+func TestStore_Images(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testImages(t, st, tx)
+}
+
+func TestStore_ApiKeys(t *testing.T) {
+	tx, _ := st.Begin(ctx)
+	defer st.Rollback(tx)
+	testApiKeys(t, st, tx)
+}